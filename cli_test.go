@@ -643,3 +643,302 @@ func TestCLICombinedFlags(t *testing.T) {
 		})
 	}
 }
+
+// TestCLIRun tests the 'run' subcommand, which interprets a program
+func TestCLIRun(t *testing.T) {
+	ensureBlangOrSkip(t)
+	tmpDir := t.TempDir()
+	bFile := filepath.Join(tmpDir, "args.b")
+	code := `main(argv) {
+    printf("%d %s*n", argv[0], argv[argv[0]]);
+    return (argv[0]);
+}`
+	if err := os.WriteFile(bFile, []byte(code), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	cmd := exec.Command("./blang", "run", bFile, "--", "-x")
+	output, err := cmd.Output()
+	exitCode := 0
+	if exitError, ok := err.(*exec.ExitError); ok {
+		exitCode = exitError.ExitCode()
+	} else if err != nil {
+		t.Fatalf("Command failed with non-exit error: %v", err)
+	}
+	if string(output) != "2 -x\n" {
+		t.Errorf("Output = %q, want %q", output, "2 -x\n")
+	}
+	if exitCode != 2 {
+		t.Errorf("Exit code = %d, want 2", exitCode)
+	}
+
+	// No clang is needed, so no executable gets created
+	if _, err := os.Stat(filepath.Join(tmpDir, "args")); err == nil {
+		t.Errorf("Executable should not be created by 'blang run'")
+	}
+}
+
+// TestCLINativeBackend tests selecting the code generator with -fbackend
+func TestCLINativeBackend(t *testing.T) {
+	ensureBlangOrSkip(t)
+	tmpDir := t.TempDir()
+	bFile := filepath.Join(tmpDir, "hello.b")
+	if err := os.WriteFile(bFile, []byte(`main() { write('Hi!*n'); }`), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	// Assembly is generated without clang
+	sFile := filepath.Join(tmpDir, "hello.s")
+	cmd := exec.Command("./blang", "-fbackend=native", "-S", "-o", sFile, bFile)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("Command failed: %v\nOutput: %s", err, output)
+	}
+	asm, err := os.ReadFile(sFile)
+	if err != nil {
+		t.Fatalf("Assembly file not created: %v", err)
+	}
+	if !strings.Contains(string(asm), "call b.write") {
+		t.Errorf("Assembly doesn't call b.write:\n%s", asm)
+	}
+
+	cmd = exec.Command("./blang", "-fbackend=gcc", bFile)
+	output, err := cmd.CombinedOutput()
+	if err == nil {
+		t.Errorf("Unknown backend should fail")
+	}
+	if !strings.Contains(string(output), "unknown backend 'gcc'") {
+		t.Errorf("Output = %q, want unknown backend error", output)
+	}
+}
+
+// TestCLITargetPDP11 tests the --target option
+func TestCLITargetPDP11(t *testing.T) {
+	ensureBlangOrSkip(t)
+	tmpDir := t.TempDir()
+	bFile := filepath.Join(tmpDir, "hello.b")
+	if err := os.WriteFile(bFile, []byte(`main() { write('Hi'); }`), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	sFile := filepath.Join(tmpDir, "hello.s")
+	cmd := exec.Command("./blang", "--target=pdp11", "-S", "-o", sFile, bFile)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("Command failed: %v\nOutput: %s", err, output)
+	}
+	asm, err := os.ReadFile(sFile)
+	if err != nil {
+		t.Fatalf("Assembly file not created: %v", err)
+	}
+	if !strings.Contains(string(asm), "\tb.lc; 18537.\n") {
+		t.Errorf("Assembly doesn't push 'Hi' as a 16-bit word:\n%s", asm)
+	}
+
+	cmd = exec.Command("./blang", "--target=pdp11", bFile)
+	output, err := cmd.CombinedOutput()
+	if err == nil {
+		t.Errorf("Executable for pdp11 should fail")
+	}
+	if !strings.Contains(string(output), "supports only assembly output") {
+		t.Errorf("Output = %q, want assembly only error", output)
+	}
+
+	cmd = exec.Command("./blang", "--target=vax", "-S", bFile)
+	output, err = cmd.CombinedOutput()
+	if err == nil {
+		t.Errorf("Unknown target should fail")
+	}
+	if !strings.Contains(string(output), "unknown target 'vax'") {
+		t.Errorf("Output = %q, want unknown target error", output)
+	}
+}
+
+// TestCLIFmt tests the 'fmt' subcommand and its -d and -w options
+func TestCLIFmt(t *testing.T) {
+	ensureBlangOrSkip(t)
+	tmpDir := t.TempDir()
+	bFile := filepath.Join(tmpDir, "sq.b")
+	if err := os.WriteFile(bFile, []byte("sq(n)  return(n*n);\n"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	want := "sq(n)\n    return (n * n);\n"
+
+	output, err := exec.Command("./blang", "fmt", bFile).Output()
+	if err != nil {
+		t.Fatalf("Command failed: %v", err)
+	}
+	if string(output) != want {
+		t.Errorf("Output = %q, want %q", output, want)
+	}
+
+	output, err = exec.Command("./blang", "fmt", "-d", bFile).Output()
+	if err != nil {
+		t.Fatalf("Command failed: %v", err)
+	}
+	if !strings.Contains(string(output), "-sq(n)  return(n*n);\n+sq(n)\n+    return (n * n);\n") {
+		t.Errorf("Diff = %q", output)
+	}
+
+	if output, err := exec.Command("./blang", "fmt", "-w", bFile).CombinedOutput(); err != nil || len(output) != 0 {
+		t.Fatalf("Command failed: %v\nOutput: %s", err, output)
+	}
+	if src, _ := os.ReadFile(bFile); string(src) != want {
+		t.Errorf("Rewritten file = %q, want %q", src, want)
+	}
+
+	if err := os.WriteFile(bFile, []byte("main() {\n    x = 1\n}\n"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	output, err = exec.Command("./blang", "fmt", "-w", bFile).CombinedOutput()
+	if err == nil {
+		t.Errorf("Malformed source should fail")
+	}
+	if !strings.Contains(string(output), "sq.b:3: expect ';' after expression statement") {
+		t.Errorf("Output = %q, want syntax error", output)
+	}
+}
+
+func TestCLIRunBoundsCheck(t *testing.T) {
+	ensureBlangOrSkip(t)
+	tmpDir := t.TempDir()
+	bFile := filepath.Join(tmpDir, "fill.b")
+	code := "main() {\n    auto buf[10], i;\n    i = 0;\n    while (i <= 10)\n        buf[i++] = 0;\n}\n"
+	if err := os.WriteFile(bFile, []byte(code), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	if output, err := exec.Command("./blang", "run", bFile).CombinedOutput(); err != nil {
+		t.Errorf("Unchecked run failed: %v\nOutput: %s", err, output)
+	}
+
+	output, err := exec.Command("./blang", "run", "-fbounds-check", bFile).CombinedOutput()
+	if err == nil {
+		t.Errorf("Checked run should fail")
+	}
+	want := bFile + ":5: in main(): index 10 out of range of vector buf[10]"
+	if !strings.Contains(string(output), want) {
+		t.Errorf("Output = %q, want %q", output, want)
+	}
+}
+
+func TestCLIXref(t *testing.T) {
+	ensureBlangOrSkip(t)
+	tmpDir := t.TempDir()
+	bFile := filepath.Join(tmpDir, "calls.b")
+	src := "f;\n\nsq(n) return (n * n);\n\nmain() {\n    extrn f;\n    f = sq;\n    printf(\"%d*n\", sq(3), f(4));\n}\n"
+	if err := os.WriteFile(bFile, []byte(src), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	output, err := exec.Command("./blang", "xref", bFile).Output()
+	if err != nil {
+		t.Fatalf("Command failed: %v", err)
+	}
+	if !strings.Contains(string(output), "sq (function, "+bFile+":3)\n    main: address "+bFile+":7; call "+bFile+":8\n") {
+		t.Errorf("Listing = %q", output)
+	}
+
+	dotFile := filepath.Join(tmpDir, "calls.dot")
+	if output, err := exec.Command("./blang", "xref", "--format=dot", "-o", dotFile, bFile).CombinedOutput(); err != nil || len(output) != 0 {
+		t.Fatalf("Command failed: %v\nOutput: %s", err, output)
+	}
+	dot, _ := os.ReadFile(dotFile)
+	if !strings.Contains(string(dot), `"main" -> "sq";`) || !strings.Contains(string(dot), `"main" -> "*f" [style=dashed];`) {
+		t.Errorf("Call graph = %q", dot)
+	}
+
+	output, err = exec.Command("./blang", "xref", "--format=json", bFile).Output()
+	if err != nil {
+		t.Fatalf("Command failed: %v", err)
+	}
+	if !strings.Contains(string(output), `"via": "f"`) {
+		t.Errorf("JSON = %s", output)
+	}
+
+	output, err = exec.Command("./blang", "xref", "--format=svg", bFile).CombinedOutput()
+	if err == nil || !strings.Contains(string(output), "unknown report format 'svg'") {
+		t.Errorf("Unknown format: %v, %q", err, output)
+	}
+}
+
+func TestCLICov(t *testing.T) {
+	ensureBlangOrSkip(t)
+	tmpDir := t.TempDir()
+	bFile := filepath.Join(tmpDir, "count.b")
+	src := "main() {\n    auto i;\n    i = 0;\n    while (i < 3)\n        i++;\n    if (i > 5)\n        printf(\"big*n\");\n}\n"
+	if err := os.WriteFile(bFile, []byte(src), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	if output, err := exec.Command("./blang", "run", "--coverage", bFile).CombinedOutput(); err != nil {
+		t.Fatalf("Command failed: %v\nOutput: %s", err, output)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "count.cov")); err != nil {
+		t.Fatalf("No counts: %v", err)
+	}
+
+	output, err := exec.Command("./blang", "cov", bFile).Output()
+	if err != nil {
+		t.Fatalf("Command failed: %v", err)
+	}
+	for _, line := range []string{"        4:    4:    while (i < 3)\n", "        3:    5:        i++;\n", "    #####:    7:        printf(\"big*n\");\n"} {
+		if !strings.Contains(string(output), line) {
+			t.Errorf("Listing has no %q:\n%s", line, output)
+		}
+	}
+
+	infoFile := filepath.Join(tmpDir, "count.info")
+	if output, err := exec.Command("./blang", "cov", "--format=lcov", "-o", infoFile, bFile).CombinedOutput(); err != nil || len(output) != 0 {
+		t.Fatalf("Command failed: %v\nOutput: %s", err, output)
+	}
+	info, _ := os.ReadFile(infoFile)
+	if !strings.Contains(string(info), "SF:"+bFile+"\n") || !strings.Contains(string(info), "DA:7,0\n") {
+		t.Errorf("Tracefile = %q", info)
+	}
+
+	output, err = exec.Command("./blang", "cov", "--format=html", bFile).CombinedOutput()
+	if err == nil || !strings.Contains(string(output), "unknown report format 'html'") {
+		t.Errorf("Unknown format: %v, %q", err, output)
+	}
+}
+
+func TestCLIProf(t *testing.T) {
+	ensureBlangOrSkip(t)
+	blang, err := filepath.Abs("blang")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpDir := t.TempDir()
+	bFile := filepath.Join(tmpDir, "calls.b")
+	src := "sq(x) return (x * x);\n\nmain() {\n    auto i, s;\n    i = s = 0;\n    while (i < 3)\n        s =+ sq(i++);\n    printf(\"%d*n\", s);\n}\n"
+	if err := os.WriteFile(bFile, []byte(src), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	cmd := exec.Command(blang, "run", "-p", bFile)
+	cmd.Dir = tmpDir
+	if output, err := cmd.CombinedOutput(); err != nil || string(output) != "5\n" {
+		t.Fatalf("Command failed: %v\nOutput: %s", err, output)
+	}
+
+	cmd = exec.Command(blang, "prof")
+	cmd.Dir = tmpDir
+	output, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("Command failed: %v", err)
+	}
+	for _, want := range []string{"Flat profile", "          3  sq\n", "Call graph:", "    called by main [1]: 3 call(s)\n"} {
+		if !strings.Contains(string(output), want) {
+			t.Errorf("Report has no %q:\n%s", want, output)
+		}
+	}
+
+	output, err = exec.Command(blang, "prof", "--flat", filepath.Join(tmpDir, "bmon.out")).Output()
+	if err != nil || strings.Contains(string(output), "Call graph:") {
+		t.Errorf("Flat profile only: %v\n%s", err, output)
+	}
+
+	output, err = exec.Command(blang, "prof", filepath.Join(tmpDir, "missing.out")).CombinedOutput()
+	if err == nil || !strings.Contains(string(output), "missing.out") {
+		t.Errorf("Missing profile: %v, %q", err, output)
+	}
+}
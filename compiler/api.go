@@ -0,0 +1,214 @@
+// Package compiler compiles programs in the B language: it holds the
+// lexer, the parser, the LLVM IR generator, the native and PDP-11 code
+// generators, the driver which runs clang or the GNU tools, and the
+// interpreter. The blang command is a thin layer over this package.
+//
+// Programs which embed the compiler build options with NewOptions
+// and the With functions, then call Compile for files on disk, or
+// ParseReader and Build for sources held in memory. Warnings and
+// errors in the source are reported as Diagnostic values.
+package compiler
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/llir/llvm/ir"
+)
+
+// Option sets a field of the compile options
+type Option func(*CompileOptions)
+
+// WithOutput sets the output file
+func WithOutput(file string) Option {
+	return func(args *CompileOptions) { args.OutputFile = file }
+}
+
+// WithOutputType selects what is generated: IR, assembly, object or executable
+func WithOutputType(t OutputType) Option {
+	return func(args *CompileOptions) { args.OutputType = t }
+}
+
+// WithOptimize sets the optimization level, 0 to 3
+func WithOptimize(level int) Option {
+	return func(args *CompileOptions) { args.Optimize = level }
+}
+
+// WithDebugInfo enables debug information
+func WithDebugInfo() Option {
+	return func(args *CompileOptions) { args.DebugInfo = true }
+}
+
+// WithVerbose makes the driver print the steps of compilation
+func WithVerbose() Option {
+	return func(args *CompileOptions) { args.Verbose = true }
+}
+
+// WithSaveTemps keeps the intermediate files
+func WithSaveTemps() Option {
+	return func(args *CompileOptions) { args.SaveTemps = true }
+}
+
+// WithBackend selects the code generator
+func WithBackend(b Backend) Option {
+	return func(args *CompileOptions) { args.Backend = b }
+}
+
+// WithBoundsCheck makes indexing of vectors with a known size check the
+// index and trap when it is out of range
+func WithBoundsCheck() Option {
+	return func(args *CompileOptions) { args.BoundsCheck = true }
+}
+
+// WithStackCheck makes every function check the stack on entry, so that
+// a program stops with a message on stack overflow
+func WithStackCheck() Option {
+	return func(args *CompileOptions) { args.StackCheck = true }
+}
+
+// WithCache takes the outputs of sources compiled before with the same
+// options from the build cache, and stores those of the others there
+func WithCache() Option {
+	return func(args *CompileOptions) { args.Cache = true }
+}
+
+// WithCoverage counts how many times each source line runs; the program
+// appends the counts at exit to a file next to the source, named with
+// the extension .cov
+func WithCoverage() Option {
+	return func(args *CompileOptions) { args.Coverage = true }
+}
+
+// WithProfile counts the calls of every function and the time spent in
+// it; the program writes the profile at exit to bmon.out
+func WithProfile() Option {
+	return func(args *CompileOptions) { args.Profile = true }
+}
+
+// WithSanitize builds with the sanitizers given, "address" or
+// "undefined", linking the program with the C library
+func WithSanitize(names ...string) Option {
+	return func(args *CompileOptions) { args.Sanitize = append(args.Sanitize, names...) }
+}
+
+// WithArith selects what division by zero, overflowing division and
+// shifts out of range do: ArithWrap gives them results, ArithTrap stops
+// the program on a division without result
+func WithArith(mode Arith) Option {
+	return func(args *CompileOptions) { args.Arith = mode }
+}
+
+// WithTarget selects the machine, one of Targets(); empty for the host
+func WithTarget(name string) Option {
+	return func(args *CompileOptions) {
+		args.Target = name
+		if name == "pdp11" {
+			// Character constants pack two bytes into a 16-bit word
+			args.WordSize = 2
+		}
+	}
+}
+
+// WithSysroot sets the root directory of the target system
+func WithSysroot(dir string) Option {
+	return func(args *CompileOptions) { args.Sysroot = dir }
+}
+
+// WithLibraryDirs adds directories to the library search path
+func WithLibraryDirs(dirs ...string) Option {
+	return func(args *CompileOptions) { args.LibraryDirs = append(args.LibraryDirs, dirs...) }
+}
+
+// WithLibraries adds libraries to link with
+func WithLibraries(libs ...string) Option {
+	return func(args *CompileOptions) { args.Libraries = append(args.Libraries, libs...) }
+}
+
+// WithSource gives the text of an input file, which is then not read from disk
+func WithSource(name string, code []byte) Option {
+	return func(args *CompileOptions) {
+		if args.Sources == nil {
+			args.Sources = make(map[string][]byte)
+		}
+		args.Sources[name] = code
+	}
+}
+
+// WithDiagnostics passes warnings to the handler instead of printing them
+func WithDiagnostics(handler func(Diagnostic)) Option {
+	return func(args *CompileOptions) { args.OnDiagnostic = handler }
+}
+
+// NewOptions creates compile options for the input files
+func NewOptions(inputFiles []string, opts ...Option) *CompileOptions {
+	args := NewCompileOptions("blang", inputFiles)
+	for _, opt := range opts {
+		opt(args)
+	}
+	return args
+}
+
+// Targets returns the names of the machines accepted by WithTarget
+func Targets() []string {
+	names := []string{"pdp11"}
+	for name := range llvmTargets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ParseReader compiles B source read from r into an LLVM module.
+// The name is used in diagnostics. The warnings are returned, and
+// also the error when the source is not correct.
+func ParseReader(name string, r io.Reader, opts ...Option) (*ir.Module, []Diagnostic, error) {
+	var diags []Diagnostic
+	args := NewOptions(nil, opts...)
+	args.OnDiagnostic = func(d Diagnostic) { diags = append(diags, d) }
+	module, err := parse(args, name, r)
+	return module, withError(diags, err), err
+}
+
+// Source is the text of a B program with the name of its file
+type Source struct {
+	Name string
+	Code []byte
+}
+
+// Build compiles the sources into the output selected by the options,
+// an executable by default, and returns its contents. The output is
+// built in a temporary directory; IR, assembly and object output need
+// exactly one source.
+func Build(sources []Source, opts ...Option) ([]byte, []Diagnostic, error) {
+	dir, err := os.MkdirTemp("", "blang")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	var diags []Diagnostic
+	args := NewOptions(nil, opts...)
+	args.OutputFile = filepath.Join(dir, "out")
+	args.OnDiagnostic = func(d Diagnostic) { diags = append(diags, d) }
+	for _, src := range sources {
+		WithSource(src.Name, src.Code)(args)
+		args.InputFiles = append(args.InputFiles, src.Name)
+	}
+	if err := Compile(args); err != nil {
+		return nil, withError(diags, err), err
+	}
+	out, err := os.ReadFile(args.OutputFile)
+	return out, diags, err
+}
+
+// withError appends an error in the source to the diagnostics
+func withError(diags []Diagnostic, err error) []Diagnostic {
+	var d Diagnostic
+	if errors.As(err, &d) {
+		diags = append(diags, d)
+	}
+	return diags
+}
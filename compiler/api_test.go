@@ -0,0 +1,70 @@
+package compiler
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestParseReader tests compiling from a reader with diagnostics
+func TestParseReader(t *testing.T) {
+	module, diags, err := ParseReader("ok.b", strings.NewReader(`main() {
+    printf("%d*n");
+}`))
+	if err != nil {
+		t.Fatalf("ParseReader() failed: %v", err)
+	}
+	if !strings.Contains(module.String(), "define i64 @main()") {
+		t.Errorf("module does not define main:\n%s", module)
+	}
+	want := Diagnostic{SeverityWarning, Pos{"ok.b", 2}, "printf format expects 1 argument(s), but 0 given"}
+	if len(diags) != 1 || diags[0] != want {
+		t.Errorf("diagnostics = %v, want %v", diags, want)
+	}
+
+	_, diags, err = ParseReader("bad.b", strings.NewReader("main() {\n    x = 1;\n}\n"))
+	if err == nil {
+		t.Fatalf("ParseReader() should fail")
+	}
+	if len(diags) != 1 || diags[0].Severity != SeverityError || diags[0].Pos != (Pos{"bad.b", 2}) {
+		t.Errorf("diagnostics = %v, want an error at bad.b:2", diags)
+	}
+	if !strings.HasPrefix(err.Error(), "bad.b:2: ") || !strings.Contains(err.Error(), "undefined identifier") {
+		t.Errorf("error = %q, want position and message", err)
+	}
+}
+
+// TestBuild tests compiling in-memory sources with options
+func TestBuild(t *testing.T) {
+	src := []Source{{Name: "hello.b", Code: []byte("main() { write('Hi'); }\n")}}
+	out, diags, err := Build(src, WithOutputType(OutputIR), WithTarget("aarch64-linux-gnu"))
+	if err != nil {
+		t.Fatalf("Build() failed: %v", err)
+	}
+	if len(diags) != 0 {
+		t.Errorf("unexpected diagnostics %v", diags)
+	}
+	if !strings.Contains(string(out), `target triple = "aarch64-unknown-linux-gnu"`) {
+		t.Errorf("IR is not for aarch64:\n%s", out)
+	}
+
+	out, _, err = Build(src, WithOutputType(OutputAssembly), WithTarget("pdp11"))
+	if err != nil {
+		t.Fatalf("Build() for pdp11 failed: %v", err)
+	}
+	if !strings.Contains(string(out), "\tb.lc; 18537.\n") {
+		t.Errorf("assembly does not push 'Hi' as a 16-bit word:\n%s", out)
+	}
+
+	_, _, err = Build([]Source{{Name: "a.b", Code: []byte("main(")}}, WithOutputType(OutputIR))
+	if err == nil {
+		t.Errorf("Build() of incorrect source should fail")
+	}
+}
+
+// TestTargets tests the list of machines
+func TestTargets(t *testing.T) {
+	got := strings.Join(Targets(), " ")
+	if want := "aarch64-linux-gnu pdp11 riscv64-linux-gnu wasm32-wasi x86_64-linux-gnu"; got != want {
+		t.Errorf("Targets() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,115 @@
+package compiler
+
+import (
+	"fmt"
+
+	"github.com/llir/llvm/ir/constant"
+	"github.com/llir/llvm/ir/enum"
+	"github.com/llir/llvm/ir/value"
+)
+
+//
+// Division and shifts. LLVM leaves a division by zero, the quotient of
+// the most negative word by -1, and a shift by the word size or more
+// undefined, so the optimizer may assume they never happen. With
+// -fwrapv each gets a result:
+//
+//	x / 0 == 0          x % 0 == x
+//	MIN / -1 == MIN     MIN % -1 == 0
+//	x << n == 0         x >> n == (x < 0 ? -1 : 0)    for n < 0 or n >= 64
+//
+// so that x == x / y * y + x % y holds for every x and y. With -ftrapv
+// a division or remainder which has no result calls b..trap in the
+// runtime library, which reports the position and traps; shifts are
+// defined as with -fwrapv. Addition, subtraction and multiplication
+// wrap around in every mode.
+//
+
+// Arith selects the semantics of division and shifts
+type Arith int
+
+const (
+	ArithUndefined Arith = iota // default: as LLVM, undefined on bad operands
+	ArithWrap                   // -fwrapv: every operation has a result
+	ArithTrap                   // -ftrapv: division without result traps
+)
+
+// trapHandler is the routine of the runtime called on a failed check
+const trapHandler = ".trap"
+
+// isConst reports whether a value is the constant n
+func isConst(v value.Value, n int64) bool {
+	k, ok := v.(*constant.Int)
+	return ok && k.X.IsInt64() && k.X.Int64() == n
+}
+
+// divide emits x / y for op '/', or x % y for op '%'
+func (c *Compiler) divide(op rune, x, y value.Value, pos Pos) value.Value {
+	k, constY := y.(*constant.Int)
+	if c.args.Arith == ArithUndefined || (constY && k.X.Sign() != 0 && !isConst(y, -1)) {
+		if op == '/' {
+			return c.builder.NewSDiv(x, y)
+		}
+		return c.builder.NewSRem(x, y)
+	}
+
+	word := c.WordType()
+	zero := c.builder.NewICmp(enum.IPredEQ, y, constant.NewInt(word, 0))
+	minusOne := c.builder.NewICmp(enum.IPredEQ, y, constant.NewInt(word, -1))
+	minWord := c.builder.NewICmp(enum.IPredEQ, x, constant.NewInt(word, -1<<(word.BitSize-1)))
+	overflow := c.builder.NewAnd(minusOne, minWord)
+
+	if c.args.Arith == ArithTrap {
+		c.trapIf(zero, pos, "division by zero")
+		c.trapIf(overflow, pos, "division overflow")
+		if op == '/' {
+			return c.builder.NewSDiv(x, y)
+		}
+		return c.builder.NewSRem(x, y)
+	}
+
+	// Divide by 1 instead, then replace the result of a zero divisor
+	safe := c.builder.NewSelect(c.builder.NewOr(zero, overflow), constant.NewInt(word, 1), y)
+	if op == '/' {
+		return c.builder.NewSelect(zero, constant.NewInt(word, 0), c.builder.NewSDiv(x, safe))
+	}
+	return c.builder.NewSelect(zero, x, c.builder.NewSRem(x, safe))
+}
+
+// shift emits x << n for op '<', or the arithmetic x >> n for op '>'
+func (c *Compiler) shift(op rune, x, n value.Value) value.Value {
+	word := c.WordType()
+	bits := int64(word.BitSize)
+	k, constN := n.(*constant.Int)
+	if c.args.Arith == ArithUndefined || (constN && k.X.IsInt64() && k.X.Int64() >= 0 && k.X.Int64() < bits) {
+		if op == '<' {
+			return c.builder.NewShl(x, n)
+		}
+		return c.builder.NewAShr(x, n)
+	}
+
+	inRange := c.builder.NewICmp(enum.IPredULT, n, constant.NewInt(word, bits))
+	if op == '<' {
+		return c.builder.NewSelect(inRange, c.builder.NewShl(x, n), constant.NewInt(word, 0))
+	}
+	return c.builder.NewAShr(x, c.builder.NewSelect(inRange, n, constant.NewInt(word, bits-1)))
+}
+
+// trapIf emits a call to the trap handler of the runtime when the
+// condition holds, with the position, the function and the message
+func (c *Compiler) trapIf(cond value.Value, pos Pos, msg string) {
+	id := c.labelID
+	c.labelID++
+	from := c.builder
+	trapBlock := c.NewBlock(fmt.Sprintf("trap.%d", id))
+	okBlock := c.NewBlock(fmt.Sprintf("trap.%d.ok", id))
+	c.builder.NewCondBr(cond, trapBlock, okBlock)
+
+	c.SetInsertPoint(trapBlock)
+	fnName := c.currentName()
+	c.builder.NewCall(c.runtimeTrap(trapHandler),
+		c.stringWord(pos.String()), c.stringWord(fnName), c.stringWord(msg))
+	c.builder.NewUnreachable()
+
+	c.continueAt(from, okBlock)
+}
@@ -0,0 +1,115 @@
+package compiler
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestTrapv tests that divisions without result stop the program
+func TestTrapv(t *testing.T) {
+	tests := []struct {
+		name    string
+		code    string
+		wantErr string
+	}{
+		{"division", "main() {\n    auto x, y;\n    x = 7;\n    y = 0;\n    return (x / y);\n}\n",
+			"v.b:5: in main(): division by zero"},
+		{"remainder", "f(x, y) {\n    return (x % y);\n}\nmain() {\n    f(7, 0);\n}\n",
+			"v.b:2: in f(): division by zero"},
+		{"compound", "main() {\n    auto x;\n    x = 7;\n    x =/ 0;\n}\n",
+			"v.b:4: in main(): division by zero"},
+		{"overflow", "main() {\n    auto x, y;\n    x = 1 << 63;\n    y = -1;\n    return (x / y);\n}\n",
+			"v.b:5: in main(): division overflow"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := interpretFromCode(t, "v", tt.code, "", []Option{WithArith(ArithTrap)})
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestWrapv tests the results of divisions without result
+func TestWrapv(t *testing.T) {
+	out, _, err := interpretFromCode(t, "v", `main() {
+    auto min, zero, m1;
+    min = 1 << 63;
+    zero = 0;
+    m1 = -1;
+    printf("%d %d*n", 7 / zero, 7 % zero);
+    printf("%d %d*n", min / m1 == min, min % m1);
+    printf("%d %d*n", -7 / 2, -7 % 2);
+}
+`, "", []Option{WithArith(ArithWrap)})
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if want := "0 7\n1 0\n-3 -1\n"; out != want {
+		t.Errorf("output = %q, want %q", out, want)
+	}
+}
+
+// TestShiftOutOfRange tests the results of shifts by a negative count
+// or by the word size, the same with -fwrapv and -ftrapv
+func TestShiftOutOfRange(t *testing.T) {
+	code := `main() {
+    auto n;
+    n = 64;
+    printf("%d %d %d*n", 1 << n, 5 >> n, -5 >> n);
+    n = -1;
+    printf("%d %d %d*n", 1 << n, 5 >> n, -5 >> n);
+    n = 3;
+    printf("%d %d %d*n", 1 << n, 40 >> n, -40 >> n);
+    n = 63;
+    n =<< 1;
+    printf("%d*n", 1 << n);
+}
+`
+	want := "0 0 -1\n0 0 -1\n8 5 -5\n0\n"
+	for _, mode := range []Arith{ArithWrap, ArithTrap} {
+		out, _, err := interpretFromCode(t, "v", code, "", []Option{WithArith(mode)})
+		if err != nil {
+			t.Fatalf("mode %d: Run failed: %v", mode, err)
+		}
+		if out != want {
+			t.Errorf("mode %d: output = %q, want %q", mode, out, want)
+		}
+	}
+}
+
+// TestArithIR tests that checks are generated only when needed
+func TestArithIR(t *testing.T) {
+	build := func(code string, opts ...Option) string {
+		t.Helper()
+		opts = append(opts, WithOutputType(OutputIR))
+		out, _, err := Build([]Source{{Name: "v.b", Code: []byte(code)}}, opts...)
+		if err != nil {
+			t.Fatalf("Build() failed: %v", err)
+		}
+		return bodyIR(string(out), "f")
+	}
+	variable := "f(x, y) return (x / y + (x << y));\n"
+	constant := "f(x) return (x / 10 + x % 3 + (x << 2));\n"
+
+	if ir := build(variable); strings.Contains(ir, "select") || strings.Contains(ir, "@b..trap") {
+		t.Errorf("checks by default, IR:\n%s", ir)
+	}
+	if ir := build(variable, WithArith(ArithWrap)); !strings.Contains(ir, "select") || strings.Contains(ir, "@b..trap") {
+		t.Errorf("no selects with -fwrapv, IR:\n%s", ir)
+	}
+	if ir := build(variable, WithArith(ArithTrap)); !strings.Contains(ir, "call i64 (i64, ...) @b..trap") {
+		t.Errorf("no trap with -ftrapv, IR:\n%s", ir)
+	}
+	for _, mode := range []Arith{ArithWrap, ArithTrap} {
+		if ir := build(constant, WithArith(mode)); strings.Contains(ir, "select") || strings.Contains(ir, "@b..trap") {
+			t.Errorf("mode %d checks constant operands, IR:\n%s", mode, ir)
+		}
+	}
+
+	_, _, err := Build([]Source{{Name: "v.b", Code: []byte(variable)}}, WithOutputType(OutputAssembly), WithTarget("pdp11"), WithArith(ArithTrap))
+	if err == nil || !strings.Contains(err.Error(), "pdp11") {
+		t.Errorf("pdp11 with -ftrapv: error = %v", err)
+	}
+}
@@ -0,0 +1,99 @@
+package compiler
+
+import (
+	"fmt"
+
+	"github.com/llir/llvm/ir"
+	"github.com/llir/llvm/ir/constant"
+	"github.com/llir/llvm/ir/enum"
+	"github.com/llir/llvm/ir/value"
+)
+
+//
+// Bounds checking, enabled by -fbounds-check. The compiler remembers
+// the size of every vector it declares, and where its data starts.
+// Indexing a name which refers to such a vector, as in v[i], compares
+// the index with the size, unsigned so that negative indices fail too.
+// The check applies only while the name still holds the address of its
+// data: after 'v = getvec(n)' the size is no longer known.
+//
+// A failed check calls b..bounds in the runtime library, which reports
+// the position, the function, the vector and the index, then traps.
+// The name cannot clash with a B function, which has no dot.
+//
+
+// boundsHandler is the routine of the runtime called on a failed check
+const boundsHandler = ".bounds"
+
+// vector is the extent of a vector known to the compiler
+type vector struct {
+	data value.Value // address of the first word, as a word
+	size int64       // number of words
+}
+
+// vectorNamed returns the vector a name refers to in the current
+// context, or nil when it is not a vector with a known size
+func (c *Compiler) vectorNamed(name string) *vector {
+	if v, ok := c.localVectors[name]; ok {
+		return v
+	}
+	if _, ok := c.locals[name]; ok {
+		return nil
+	}
+	if g, ok := c.globals[name].(*ir.Global); ok {
+		return c.globalVectors[g]
+	}
+	return nil
+}
+
+// checkBounds emits a check of the index into a vector, whose name
+// holds the address base. On failure the handler of the runtime is
+// called with the position, the function, the name, the index and
+// the size.
+func (c *Compiler) checkBounds(name string, vec *vector, base, index value.Value, pos Pos) {
+	id := c.labelID
+	c.labelID++
+	from := c.builder
+	trapBlock := c.NewBlock(fmt.Sprintf("bounds.%d.trap", id))
+	okBlock := c.NewBlock(fmt.Sprintf("bounds.%d.ok", id))
+
+	size := constant.NewInt(c.WordType(), vec.size)
+	moved := c.builder.NewICmp(enum.IPredNE, base, vec.data)
+	inside := c.builder.NewICmp(enum.IPredULT, index, size)
+	c.builder.NewCondBr(c.builder.NewOr(moved, inside), okBlock, trapBlock)
+
+	c.SetInsertPoint(trapBlock)
+	fnName := c.currentName()
+	c.builder.NewCall(c.runtimeTrap(boundsHandler),
+		c.stringWord(pos.String()), c.stringWord(fnName), c.stringWord(name), index, size)
+	c.builder.NewUnreachable()
+
+	c.continueAt(from, okBlock)
+}
+
+// stringWord returns the address of a string constant as a word
+func (c *Compiler) stringWord(s string) constant.Constant {
+	str := c.CreateStringConstant(s)
+	return constant.NewPtrToInt(str, c.WordType())
+}
+
+// runtimeRoutine returns a routine of the runtime called by generated
+// code, declaring it when needed with the first word fixed, as the
+// runtime defines it, and the attributes given
+func (c *Compiler) runtimeRoutine(routine string, attrs ...ir.FuncAttribute) *ir.Func {
+	name := c.globalName(routine)
+	for _, fn := range c.module.Funcs {
+		if fn.Name() == name {
+			return fn
+		}
+	}
+	fn := c.module.NewFunc(name, c.WordType(), ir.NewParam("", c.WordType()))
+	fn.Sig.Variadic = true
+	fn.FuncAttrs = append(fn.FuncAttrs, attrs...)
+	return fn
+}
+
+// runtimeTrap returns a handler of failed checks, which does not return
+func (c *Compiler) runtimeTrap(handler string) *ir.Func {
+	return c.runtimeRoutine(handler, enum.FuncAttrNoReturn, enum.FuncAttrCold)
+}
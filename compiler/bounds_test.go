@@ -0,0 +1,88 @@
+package compiler
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestBoundsCheck tests the detection of indices out of range
+func TestBoundsCheck(t *testing.T) {
+	tests := []struct {
+		name    string
+		code    string
+		wantErr string
+	}{
+		{"local", "main() {\n    auto v[4], i;\n    i = 4;\n    v[i] = 1;\n}\n",
+			"v.b:4: in main(): index 4 out of range of vector v[4]"},
+		{"negative", "main() {\n    auto v[4];\n    return (v[-1]);\n}\n",
+			"v.b:3: in main(): index -1 out of range of vector v[4]"},
+		{"global", "g[2] 1, 2;\nf(i) {\n    extrn g;\n    return (g[i]);\n}\nmain() {\n    f(2);\n}\n",
+			"v.b:4: in f(): index 2 out of range of vector g[2]"},
+		{"compact global", "g[100];\nmain() {\n    extrn g;\n    g[100] = 1;\n}\n",
+			"v.b:4: in main(): index 100 out of range of vector g[100]"},
+		{"index of index", "main() {\n    auto v[2], w[3];\n    v[w[3]] = 1;\n}\n",
+			"v.b:3: in main(): index 3 out of range of vector w[3]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := interpretFromCode(t, "v", tt.code, "", []Option{WithBoundsCheck()})
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestBoundsCheckInRange tests that valid programs are not stopped,
+// including a vector name which now holds another vector
+func TestBoundsCheckInRange(t *testing.T) {
+	out, _, err := interpretFromCode(t, "v", `g[3] 1, 2, 3;
+main() {
+    extrn g;
+    auto v[4], i, s;
+    s = 0;
+    i = 0;
+    while (i < 4) {
+        v[i] = i;
+        s =+ v[i] + g[i % 3];
+        i++;
+    }
+    v = getvec(10);
+    v[10] = 5;
+    printf("%d %d*n", s, v[10]);
+}
+`, "", []Option{WithBoundsCheck()})
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if out != "13 5\n" {
+		t.Errorf("output = %q, want %q", out, "13 5\n")
+	}
+}
+
+// TestBoundsCheckIR tests that checks are generated only when enabled
+func TestBoundsCheckIR(t *testing.T) {
+	code := []byte("main() {\n    auto v[4];\n    return (v[1]);\n}\n")
+	for _, enabled := range []bool{false, true} {
+		opts := []Option{WithOutputType(OutputIR), WithOptimize(0)}
+		if enabled {
+			opts = append(opts, WithBoundsCheck())
+		}
+		out, _, err := Build([]Source{{Name: "v.b", Code: code}}, opts...)
+		if err != nil {
+			t.Fatalf("Build() failed: %v", err)
+		}
+		ir := string(out)
+		if strings.Contains(ir, "@b..bounds") != enabled {
+			t.Errorf("bounds check %v, IR:\n%s", enabled, ir)
+		}
+		if enabled && !strings.Contains(ir, "icmp ult i64 1, 4") {
+			t.Errorf("IR does not compare the index with the size:\n%s", ir)
+		}
+	}
+
+	_, _, err := Build([]Source{{Name: "v.b", Code: code}}, WithOutputType(OutputAssembly), WithTarget("pdp11"), WithBoundsCheck())
+	if err == nil || !strings.Contains(err.Error(), "pdp11") {
+		t.Errorf("pdp11 with bounds checks: error = %v", err)
+	}
+}
@@ -0,0 +1,266 @@
+package compiler
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+//
+// Build cache, enabled by default in the blang command and disabled by
+// --no-cache. The output of a .b file, IR, assembly or an object, is
+// stored under a key hashed from the compiler itself, the kind of
+// output, the name and text of the source, the options which change
+// the output, and the version of the tool which produces it, clang or
+// as; B has no include files, so the text is the whole input. A later
+// build with the same key copies the output instead of compiling
+// again, and reports the warnings of the first build.
+//
+// An entry is a single file, the warnings in JSON on the first line
+// followed by the output; it is written to a temporary file which is
+// then renamed, so that parallel builds never see a partial entry.
+//
+
+// buildCache is the cache of the outputs of one invocation of Compile
+type buildCache struct {
+	dir      string            // directory of the entries
+	compiler []byte            // hash of the executable of the compiler
+	tools    map[string][]byte // output of --version of the tools run
+	hits     int               // outputs copied from the cache
+	misses   int               // outputs compiled and stored
+	busy     bool              // building an output, whose steps are not cached
+}
+
+// cacheDir returns the directory of the cache: blang under
+// $XDG_CACHE_HOME, or under the cache directory of the user
+func cacheDir() (string, error) {
+	dir := os.Getenv("XDG_CACHE_HOME")
+	if dir == "" {
+		var err error
+		if dir, err = os.UserCacheDir(); err != nil {
+			return "", err
+		}
+	}
+	return filepath.Join(dir, "blang"), nil
+}
+
+// openCache returns the cache for the options, or nil when it is off:
+// besides --no-cache, intermediate files kept by --save-temps and
+// references reported while parsing need a real compilation
+func openCache(args *CompileOptions) *buildCache {
+	if !args.Cache || args.SaveTemps || args.OnReference != nil {
+		return nil
+	}
+	dir, err := cacheDir()
+	if err == nil {
+		err = os.MkdirAll(dir, 0755)
+	}
+	var self []byte
+	if err == nil {
+		self, err = hashExecutable()
+	}
+	if err != nil {
+		if args.Verbose {
+			fmt.Printf("blang: cache disabled: %v\n", err)
+		}
+		return nil
+	}
+	return &buildCache{dir: dir, compiler: self, tools: map[string][]byte{}}
+}
+
+// hashExecutable returns the hash of the running compiler, so that a
+// new version never reuses the outputs of an older one
+func hashExecutable() ([]byte, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(exe)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// tool returns the version of the tool which builds outputs of the
+// kind given from the IR or assembly of a source, or nil
+func (c *buildCache) tool(args *CompileOptions, kind OutputType) ([]byte, error) {
+	var name string
+	switch {
+	case kind == OutputIR || args.Target == "pdp11":
+		return nil, nil
+	case args.Backend == BackendNative && kind == OutputObject:
+		name = "as"
+	case args.Backend == BackendNative:
+		return nil, nil
+	default:
+		name = "clang"
+	}
+	if v, ok := c.tools[name]; ok {
+		return v, nil
+	}
+	v, err := exec.Command(name, "--version").Output()
+	if err != nil {
+		return nil, err
+	}
+	c.tools[name] = v
+	return v, nil
+}
+
+// key returns the key of the output of the kind given for a source
+func (c *buildCache) key(args *CompileOptions, kind OutputType, in string) (string, error) {
+	src, ok := args.Sources[in]
+	if !ok {
+		var err error
+		if src, err = os.ReadFile(in); err != nil {
+			return "", err
+		}
+	}
+	tool, err := c.tool(args, kind)
+	if err != nil {
+		return "", err
+	}
+
+	// The options, without those which only name files, print or
+	// link, which the output does not depend on
+	opts := *args
+	opts.Arg0, opts.OutputFile, opts.InputFiles, opts.OutputType = "", "", nil, 0
+	opts.SaveTemps, opts.Verbose = false, false
+	opts.LibraryDirs, opts.Libraries = nil, nil
+	opts.Sources, opts.OnDiagnostic, opts.OnReference, opts.cache = nil, nil, nil, nil
+
+	h := sha256.New()
+	fmt.Fprintf(h, "%x\n%d\n%q\n%#v\n%q\n", c.compiler, kind, in, opts, tool)
+	if args.Coverage {
+		// The file of counts is named after the absolute path
+		abs, _ := filepath.Abs(in)
+		fmt.Fprintf(h, "%q\n", abs)
+	}
+	h.Write(src)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// cached returns the function processing a source into an output of
+// the kind given, which takes that of .b files from the cache
+func (c *buildCache) cached(args *CompileOptions, kind OutputType, process func(in, out string) error) func(in, out string) error {
+	if c == nil {
+		return process
+	}
+	return func(in, out string) error {
+		if filepath.Ext(in) != ".b" {
+			return process(in, out)
+		}
+		return c.build(args, kind, in, out, func() error { return process(in, out) })
+	}
+}
+
+// build writes the output of the kind given for a source to out, with
+// the function compiling it on a miss
+func (c *buildCache) build(args *CompileOptions, kind OutputType, in, out string, compile func() error) error {
+	if c == nil || c.busy {
+		return compile()
+	}
+	key, err := c.key(args, kind, in)
+	if err != nil {
+		return compile()
+	}
+	entry := filepath.Join(c.dir, key[:2], key)
+	if c.load(args, entry, in, out) {
+		return nil
+	}
+
+	// Compile, keeping the warnings for the entry
+	var diags []Diagnostic
+	outer := *args
+	args.OnDiagnostic = func(d Diagnostic) {
+		diags = append(diags, d)
+		outer.report(d)
+	}
+	c.busy = true
+	err = compile()
+	c.busy = false
+	args.OnDiagnostic = outer.OnDiagnostic
+	if err != nil {
+		return err
+	}
+	c.misses++
+	if args.Verbose {
+		fmt.Printf("blang: cache miss for %s\n", in)
+	}
+	c.store(entry, diags, out)
+	return nil
+}
+
+// load copies the output of an entry to out and reports its warnings,
+// and returns false when there is no such entry
+func (c *buildCache) load(args *CompileOptions, entry, in, out string) bool {
+	data, err := os.ReadFile(entry)
+	if err != nil {
+		return false
+	}
+	line, output, ok := bytes.Cut(data, []byte("\n"))
+	var diags []Diagnostic
+	if !ok || json.Unmarshal(line, &diags) != nil {
+		return false
+	}
+	if err := os.WriteFile(out, output, 0644); err != nil {
+		return false
+	}
+	c.hits++
+	if args.Verbose {
+		fmt.Printf("blang: cache hit for %s\n", in)
+	}
+	for _, d := range diags {
+		args.report(d)
+	}
+	return true
+}
+
+// store adds an entry with the warnings and the contents of out; the
+// build goes on without it when it cannot be written
+func (c *buildCache) store(entry string, diags []Diagnostic, out string) {
+	output, err := os.ReadFile(out)
+	if err != nil {
+		return
+	}
+	line, err := json.Marshal(diags)
+	if err != nil {
+		return
+	}
+	dir := filepath.Dir(entry)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return
+	}
+	tmp, err := os.CreateTemp(dir, "tmp-*")
+	if err != nil {
+		return
+	}
+	_, err = tmp.Write(append(append(line, '\n'), output...))
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), entry)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+}
+
+// report prints the statistics of the cache with -v
+func (c *buildCache) report(args *CompileOptions) {
+	if c != nil && args.Verbose {
+		fmt.Printf("blang: cache: %d hit(s), %d miss(es) in %s\n", c.hits, c.misses, c.dir)
+	}
+}
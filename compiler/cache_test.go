@@ -0,0 +1,173 @@
+package compiler
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// TestBuildCache tests that an output is taken from the cache with its
+// warnings, unless the source or the options change
+func TestBuildCache(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	dir := t.TempDir()
+	src := filepath.Join(dir, "w.b")
+	writeSource := func(code string) {
+		if err := os.WriteFile(src, []byte(code), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	out := filepath.Join(dir, "w.out")
+	compile := func(opts ...Option) (string, int, *buildCache) {
+		t.Helper()
+		os.Remove(out)
+		warnings := 0
+		opts = append([]Option{WithOutput(out), WithOutputType(OutputIR), WithOptimize(0),
+			WithDiagnostics(func(Diagnostic) { warnings++ })}, opts...)
+		args := NewOptions([]string{src}, opts...)
+		if err := Compile(args); err != nil {
+			t.Fatalf("Compile() failed: %v", err)
+		}
+		data, err := os.ReadFile(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data), warnings, args.cache
+	}
+
+	writeSource("main() {\n    printf(\"%d*n\");\n}\n")
+	first, warnings, cache := compile(WithCache())
+	if cache.misses != 1 || cache.hits != 0 || warnings != 1 {
+		t.Errorf("first build: %d miss(es), %d hit(s), %d warning(s)", cache.misses, cache.hits, warnings)
+	}
+	second, warnings, cache := compile(WithCache())
+	if cache.misses != 0 || cache.hits != 1 || warnings != 1 {
+		t.Errorf("second build: %d miss(es), %d hit(s), %d warning(s)", cache.misses, cache.hits, warnings)
+	}
+	if second != first {
+		t.Errorf("cached output differs:\n%s", buildLineDiff(first, second))
+	}
+
+	for name, opts := range map[string][]Option{
+		"-O1":    {WithOptimize(1)},
+		"PDP-11": {WithOutputType(OutputAssembly), WithTarget("pdp11")},
+	} {
+		if _, _, cache := compile(append(opts, WithCache())...); cache.misses != 1 {
+			t.Errorf("%s: %d miss(es), want 1", name, cache.misses)
+		}
+	}
+
+	writeSource("main() {\n    printf(\"%d*n\", 1);\n}\n")
+	if _, warnings, cache := compile(WithCache()); cache.misses != 1 || warnings != 0 {
+		t.Errorf("changed source: %d miss(es), %d warning(s)", cache.misses, warnings)
+	}
+	if _, _, cache := compile(); cache != nil {
+		t.Error("cache used without WithCache()")
+	}
+}
+
+// TestBuildCacheParallel tests builds of the same source at once, which
+// share the entries of the cache
+func TestBuildCacheParallel(t *testing.T) {
+	cacheHome := t.TempDir()
+	t.Setenv("XDG_CACHE_HOME", cacheHome)
+	dir := t.TempDir()
+	src := filepath.Join(dir, "hello.b")
+	if err := os.WriteFile(src, []byte("main() {\n    write('Hi*n');\n}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	const n = 8
+	outputs := make([]string, n)
+	var wg sync.WaitGroup
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			out := filepath.Join(dir, fmt.Sprintf("hello%d.ll", i))
+			args := NewOptions([]string{src}, WithCache(), WithOutput(out), WithOutputType(OutputIR))
+			if err := Compile(args); err != nil {
+				t.Errorf("Compile() failed: %v", err)
+				return
+			}
+			data, err := os.ReadFile(out)
+			if err != nil {
+				t.Error(err)
+			}
+			outputs[i] = string(data)
+		}()
+	}
+	wg.Wait()
+	for i := 1; i < n; i++ {
+		if outputs[i] != outputs[0] {
+			t.Errorf("output %d differs:\n%s", i, buildLineDiff(outputs[0], outputs[i]))
+		}
+	}
+
+	temps, _ := filepath.Glob(filepath.Join(cacheHome, "blang", "*", "tmp-*"))
+	entries, _ := filepath.Glob(filepath.Join(cacheHome, "blang", "*", "*"))
+	if len(temps) != 0 || len(entries) != 1 {
+		t.Errorf("cache holds %d temporary file(s) and %d file(s), want one entry", len(temps), len(entries))
+	}
+}
+
+// TestBuildCacheExecutable tests that a second build of an executable
+// takes the objects of unchanged sources from the cache, and runs clang
+// only to link them
+func TestBuildCacheExecutable(t *testing.T) {
+	ensureLibbOrSkip(t)
+	clang, err := exec.LookPath("clang")
+	if err != nil {
+		t.Skip("clang not found")
+	}
+	libDir, err := filepath.Abs("../runtime")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	// A clang which logs its arguments before running the real one
+	bin := t.TempDir()
+	calls := filepath.Join(bin, "calls")
+	wrapper := fmt.Sprintf("#!/bin/sh\necho \"$@\" >> %s\nexec %s \"$@\"\n", calls, clang)
+	if err := os.WriteFile(filepath.Join(bin, "clang"), []byte(wrapper), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	dir := t.TempDir()
+	main := writeTempFile(t, dir, "main.b", "main() {\n    extrn n;\n    printf(\"%d*n\", twice(n));\n}\n")
+	lib := writeTempFile(t, dir, "lib.b", "n 21;\ntwice(x) return (2 * x);\n")
+	exeFile := filepath.Join(dir, "prog")
+	build := func() (*buildCache, []string) {
+		t.Helper()
+		os.Remove(calls)
+		args := NewOptions([]string{main, lib}, WithCache(), WithOutput(exeFile),
+			WithOutputType(OutputExecutable), WithLibraryDirs(libDir))
+		if err := Compile(args); err != nil {
+			t.Fatalf("Compile() failed: %v", err)
+		}
+		if out, _ := runExecutable(t, exeFile); string(out) != "42\n" {
+			t.Errorf("output %q, want %q", out, "42\n")
+		}
+		data, _ := os.ReadFile(calls)
+		var compiles []string
+		for _, line := range strings.Split(string(data), "\n") {
+			if strings.Contains(" "+line+" ", " -c ") {
+				compiles = append(compiles, line)
+			}
+		}
+		return args.cache, compiles
+	}
+
+	if cache, compiles := build(); cache.misses != 2 || len(compiles) != 2 {
+		t.Errorf("first build: %d miss(es), clang -c run %d time(s)", cache.misses, len(compiles))
+	}
+	if cache, compiles := build(); cache.hits != 2 || cache.misses != 0 || len(compiles) != 0 {
+		t.Errorf("second build: %d hit(s), %d miss(es), clang run for %q", cache.hits, cache.misses, compiles)
+	}
+}
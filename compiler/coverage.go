@@ -0,0 +1,273 @@
+package compiler
+
+import (
+	"bytes"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/llir/llvm/ir"
+	"github.com/llir/llvm/ir/constant"
+	"github.com/llir/llvm/ir/enum"
+	"github.com/llir/llvm/ir/types"
+)
+
+//
+// Coverage, enabled by --coverage. A statement increments a counter of
+// its line, unless the last counter of the same basic block counts that
+// line already; the entry of a function has a counter of its own. Each
+// function also calls b..cov in the runtime library with the descriptor
+// of the file:
+//
+//	word 0  next descriptor registered, 0 until registered
+//	word 1  name of the file of counts
+//	word 2  stamp of the layout of the counters
+//	word 3  number of counters
+//	word 4  address of the counters
+//
+// The first call registers it, and at exit the runtime appends a line
+// with the stamp, the number and the counters to the file of counts,
+// named after the source with the extension .cov.
+//
+// The line of each counter is not recorded: 'blang cov' compiles the
+// source again to find it. The stamp is a hash of that layout, so that
+// the counts of another version of the source are recognized.
+//
+
+// coverHandler is the routine of the runtime which registers counters
+const coverHandler = ".cov"
+
+// counter is a coverage counter: the line it counts, and the name of
+// the function for the counter of its entry
+type counter struct {
+	line int
+	fn   string
+}
+
+// coverFunction emits the registration of the counters of the file
+// and the counter of the entry of a function
+func (c *Compiler) coverFunction(name string, pos Pos) {
+	if !c.args.Coverage {
+		return
+	}
+	word := c.WordType()
+	if c.coverDesc == nil {
+		// The size of the counters is known at the end of the file
+		c.coverCounts = c.module.NewGlobalDef(".cov.counts", constant.NewZeroInitializer(types.NewArray(0, word)))
+		c.coverCounts.Linkage = enum.LinkagePrivate
+		c.coverDesc = c.module.NewGlobalDef(".cov", constant.NewZeroInitializer(types.NewArray(5, word)))
+		c.coverDesc.Linkage = enum.LinkagePrivate
+	}
+	c.builder.NewCall(c.runtimeRoutine(coverHandler), constant.NewPtrToInt(c.coverDesc, word))
+	c.count(counter{line: pos.Line, fn: name})
+}
+
+// coverLine emits the counter of a statement
+func (c *Compiler) coverLine(pos Pos) {
+	if c.coverDesc == nil || c.builder == nil || c.builder.Term != nil {
+		return
+	}
+	if c.builder == c.coveredBlock && pos.Line == c.coveredLine {
+		return
+	}
+	c.count(counter{line: pos.Line})
+}
+
+// count emits the increment of a new counter
+func (c *Compiler) count(k counter) {
+	word := c.WordType()
+	offset := constant.NewInt(word, int64(len(c.counters))*int64(word.BitSize/8))
+	addr := c.builder.NewAdd(constant.NewPtrToInt(c.coverCounts, word), offset)
+	ptr := c.builder.NewIntToPtr(addr, c.WordPtrType())
+	sum := c.builder.NewAdd(c.builder.NewLoad(word, ptr), constant.NewInt(word, 1))
+	c.builder.NewStore(sum, ptr)
+	c.counters = append(c.counters, k)
+	c.coveredBlock, c.coveredLine = c.builder, k.line
+}
+
+// continueAt moves on to the block following a check made in block
+// from, which counts as the same block for coverage, so that the
+// counters do not depend on the checks enabled
+func (c *Compiler) continueAt(from, block *ir.Block) {
+	if c.coveredBlock == from {
+		c.coveredBlock = block
+	}
+	c.SetInsertPoint(block)
+}
+
+// finishCoverage sizes the counters of the file and fills its descriptor
+func (c *Compiler) finishCoverage(source string) {
+	if c.coverDesc == nil {
+		return
+	}
+	word := c.WordType()
+	counts := types.NewArray(uint64(len(c.counters)), word)
+	c.coverCounts.ContentType = counts
+	c.coverCounts.Init = constant.NewZeroInitializer(counts)
+	c.coverCounts.Typ = nil
+	c.coverCounts.Type()
+	c.coverDesc.Init = constant.NewArray(types.NewArray(5, word),
+		constant.NewInt(word, 0),
+		c.stringWord(coverageFile(source)),
+		constant.NewInt(word, coverageStamp(c.counters)),
+		constant.NewInt(word, int64(len(c.counters))),
+		constant.NewPtrToInt(c.coverCounts, word))
+}
+
+// coverageFile returns the name of the file of counts of a source
+func coverageFile(source string) string {
+	if abs, err := filepath.Abs(source); err == nil {
+		source = abs
+	}
+	return strings.TrimSuffix(source, filepath.Ext(source)) + ".cov"
+}
+
+// coverageStamp returns the hash of the layout of the counters
+func coverageStamp(counters []counter) int64 {
+	h := fnv.New32a()
+	for _, k := range counters {
+		fmt.Fprintf(h, "%d %s\n", k.line, k.fn)
+	}
+	return int64(h.Sum32())
+}
+
+// FuncCoverage is the number of calls of a function
+type FuncCoverage struct {
+	Name  string
+	Line  int
+	Count int64
+}
+
+// FileCoverage holds the execution counts of the lines of a source,
+// summed over the runs of the program
+type FileCoverage struct {
+	Source string
+	Runs   int            // runs counted
+	Stale  int            // runs of another version of the source, ignored
+	Lines  map[int]int64  // count of each line with code
+	Funcs  []FuncCoverage // in source order
+}
+
+// LoadCoverage compiles a source with --coverage to find the line of
+// each counter, and reads the counts which its runs have recorded.
+// When the program has not run, every count is zero.
+func LoadCoverage(source string, opts ...Option) (*FileCoverage, error) {
+	args := NewOptions([]string{source}, append(opts, WithCoverage())...)
+	args.OnDiagnostic = func(Diagnostic) {}
+	src, ok := args.Sources[source]
+	if !ok {
+		var err error
+		if src, err = os.ReadFile(source); err != nil {
+			return nil, err
+		}
+	}
+	c, err := parseUnit(args, source, bytes.NewReader(src))
+	if err != nil {
+		return nil, err
+	}
+
+	file := coverageFile(source)
+	data, err := os.ReadFile(file)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	fc := &FileCoverage{Source: source, Lines: map[int]int64{}}
+	stamp := strconv.FormatInt(coverageStamp(c.counters), 10)
+	sums := make([]int64, len(c.counters))
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if fields[0] != stamp || len(fields) != len(sums)+2 {
+			fc.Stale++
+			continue
+		}
+		for i := range sums {
+			n, err := strconv.ParseInt(fields[i+2], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("%s: malformed counts", file)
+			}
+			sums[i] += n
+		}
+		fc.Runs++
+	}
+
+	// A line runs as often as the most frequent of its counters
+	for i, k := range c.counters {
+		fc.Lines[k.line] = max(fc.Lines[k.line], sums[i])
+		if k.fn != "" {
+			fc.Funcs = append(fc.Funcs, FuncCoverage{Name: k.fn, Line: k.line, Count: sums[i]})
+		}
+	}
+	return fc, nil
+}
+
+// WriteListing writes the source annotated with the count of each line,
+// as gcov does: '-' for a line without code, '#####' for one never run
+func (fc *FileCoverage) WriteListing(w io.Writer, src []byte) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%9s:%5d:Source:%s\n", "-", 0, fc.Source)
+	fmt.Fprintf(&b, "%9s:%5d:Runs:%d\n", "-", 0, fc.Runs)
+	text := strings.TrimSuffix(string(src), "\n")
+	for i, line := range strings.Split(text, "\n") {
+		count, ok := fc.Lines[i+1]
+		switch {
+		case !ok:
+			fmt.Fprintf(&b, "%9s:%5d:%s\n", "-", i+1, line)
+		case count == 0:
+			fmt.Fprintf(&b, "%9s:%5d:%s\n", "#####", i+1, line)
+		default:
+			fmt.Fprintf(&b, "%9d:%5d:%s\n", count, i+1, line)
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// WriteLcov writes the counts of the files as an lcov tracefile, as read
+// by genhtml and code coverage services
+func WriteLcov(w io.Writer, files []*FileCoverage) error {
+	var b strings.Builder
+	for _, fc := range files {
+		source := fc.Source
+		if abs, err := filepath.Abs(source); err == nil {
+			source = abs
+		}
+		b.WriteString("TN:\n")
+		fmt.Fprintf(&b, "SF:%s\n", source)
+		hit := 0
+		for _, fn := range fc.Funcs {
+			fmt.Fprintf(&b, "FN:%d,%s\n", fn.Line, fn.Name)
+		}
+		for _, fn := range fc.Funcs {
+			fmt.Fprintf(&b, "FNDA:%d,%s\n", fn.Count, fn.Name)
+			if fn.Count > 0 {
+				hit++
+			}
+		}
+		fmt.Fprintf(&b, "FNF:%d\nFNH:%d\n", len(fc.Funcs), hit)
+
+		lines := make([]int, 0, len(fc.Lines))
+		for line := range fc.Lines {
+			lines = append(lines, line)
+		}
+		slices.Sort(lines)
+		hit = 0
+		for _, line := range lines {
+			fmt.Fprintf(&b, "DA:%d,%d\n", line, fc.Lines[line])
+			if fc.Lines[line] > 0 {
+				hit++
+			}
+		}
+		fmt.Fprintf(&b, "LF:%d\nLH:%d\n", len(lines), hit)
+		b.WriteString("end_of_record\n")
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
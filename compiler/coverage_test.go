@@ -0,0 +1,145 @@
+package compiler
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const coverageProgram = `/* coverage */
+fib(n) {
+    if (n < 2)
+        return (n);
+    return (fib(n - 1) + fib(n - 2));
+}
+
+unused() {
+    printf("never*n");
+}
+
+main() {
+    auto i;
+    i = 0;
+    while (i < 5) {
+        printf("%d ", fib(i));
+        i++;
+    }
+    printf("*n");
+}
+`
+
+// runCovered interprets the program compiled with --coverage, as
+// dir/fib.b, which appends its counts to the file of counts
+func runCovered(t *testing.T, dir string) {
+	t.Helper()
+	_, _, err := interpretFromCode(t, filepath.Join(dir, "fib"), coverageProgram, "", []Option{WithCoverage()})
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+}
+
+// TestCoverage tests the counts of lines and functions over two runs
+func TestCoverage(t *testing.T) {
+	dir := t.TempDir()
+	runCovered(t, dir)
+	runCovered(t, dir)
+
+	file := filepath.Join(dir, "fib.b")
+	fc, err := LoadCoverage(file, WithSource(file, []byte(coverageProgram)))
+	if err != nil {
+		t.Fatalf("LoadCoverage() failed: %v", err)
+	}
+	if fc.Runs != 2 || fc.Stale != 0 {
+		t.Errorf("runs %d, stale %d", fc.Runs, fc.Stale)
+	}
+	want := map[int]int64{2: 38, 3: 38, 4: 24, 5: 14, 8: 0, 9: 0, 12: 2, 13: 2, 14: 2, 15: 12, 16: 10, 17: 10, 19: 2}
+	for line, count := range want {
+		if got, ok := fc.Lines[line]; !ok || got != count {
+			t.Errorf("line %d: count %d (%v), want %d", line, got, ok, count)
+		}
+	}
+	if len(fc.Lines) != len(want) {
+		t.Errorf("lines with code: %v", fc.Lines)
+	}
+	wantFuncs := []FuncCoverage{{"fib", 2, 38}, {"unused", 8, 0}, {"main", 12, 2}}
+	if len(fc.Funcs) != len(wantFuncs) {
+		t.Fatalf("functions: %v", fc.Funcs)
+	}
+	for i, fn := range fc.Funcs {
+		if fn != wantFuncs[i] {
+			t.Errorf("function %d: %v, want %v", i, fn, wantFuncs[i])
+		}
+	}
+
+	var listing strings.Builder
+	fc.WriteListing(&listing, []byte(coverageProgram))
+	for _, line := range []string{
+		"        -:    0:Runs:2\n",
+		"        -:    1:/* coverage */\n",
+		"       38:    2:fib(n) {\n",
+		"    #####:    9:    printf(\"never*n\");\n",
+		"       12:   15:    while (i < 5) {\n",
+	} {
+		if !strings.Contains(listing.String(), line) {
+			t.Errorf("listing has no %q:\n%s", line, listing.String())
+		}
+	}
+
+	var lcov strings.Builder
+	WriteLcov(&lcov, []*FileCoverage{fc})
+	for _, line := range []string{
+		"SF:" + file + "\n",
+		"FN:8,unused\nFN:12,main\nFNDA:38,fib\n",
+		"FNF:3\nFNH:2\n",
+		"DA:4,24\n",
+		"LF:13\nLH:11\nend_of_record\n",
+	} {
+		if !strings.Contains(lcov.String(), line) {
+			t.Errorf("tracefile has no %q:\n%s", line, lcov.String())
+		}
+	}
+}
+
+// TestCoverageStale tests that counts of another version of the source
+// are ignored
+func TestCoverageStale(t *testing.T) {
+	dir := t.TempDir()
+	runCovered(t, dir)
+	file := filepath.Join(dir, "fib.b")
+	fc, err := LoadCoverage(file, WithSource(file, []byte("\n"+coverageProgram)))
+	if err != nil {
+		t.Fatalf("LoadCoverage() failed: %v", err)
+	}
+	if fc.Runs != 0 || fc.Stale != 1 || fc.Lines[3] != 0 {
+		t.Errorf("runs %d, stale %d, line 3 count %d", fc.Runs, fc.Stale, fc.Lines[3])
+	}
+}
+
+// TestCoverageLayout tests that the counters do not depend on the
+// checks enabled, so that 'blang cov' finds the same layout
+func TestCoverageLayout(t *testing.T) {
+	src := "main() {\n    auto v[4], i, x;\n    i = 3; x = v[i] / i; x = i << x;\n    return (x);\n}\n"
+	layout := func(opts ...Option) []counter {
+		t.Helper()
+		args := NewOptions([]string{"v.b"}, append(opts, WithCoverage())...)
+		c, err := parseUnit(args, "v.b", strings.NewReader(src))
+		if err != nil {
+			t.Fatalf("parseUnit() failed: %v", err)
+		}
+		return c.counters
+	}
+	plain := layout()
+	if len(plain) != 4 {
+		t.Errorf("counters: %v", plain)
+	}
+	for _, opts := range [][]Option{{WithBoundsCheck()}, {WithArith(ArithTrap)}, {WithBoundsCheck(), WithArith(ArithWrap)}} {
+		if checked := layout(opts...); coverageStamp(checked) != coverageStamp(plain) {
+			t.Errorf("counters with checks: %v, without: %v", checked, plain)
+		}
+	}
+
+	_, _, err := Build([]Source{{Name: "v.b", Code: []byte(src)}}, WithOutputType(OutputAssembly), WithTarget("pdp11"), WithCoverage())
+	if err == nil || !strings.Contains(err.Error(), "pdp11") {
+		t.Errorf("pdp11 with --coverage: error = %v", err)
+	}
+}
@@ -0,0 +1,47 @@
+package compiler
+
+import "fmt"
+
+// Pos is a position in B source
+type Pos struct {
+	File string `json:"file"` // name of the source, empty when read from elsewhere
+	Line int    `json:"line"` // line number, starting from 1
+}
+
+// String returns the position as "file:line"
+func (p Pos) String() string {
+	if p.File == "" {
+		return fmt.Sprintf("line %d", p.Line)
+	}
+	return fmt.Sprintf("%s:%d", p.File, p.Line)
+}
+
+// Severity tells errors from warnings
+type Severity int
+
+const (
+	SeverityError   Severity = iota // compilation failed
+	SeverityWarning                 // compilation goes on
+)
+
+// String returns the name of the severity as printed by the compiler
+func (s Severity) String() string {
+	if s == SeverityWarning {
+		return "warning"
+	}
+	return "error"
+}
+
+// Diagnostic is an error or a warning about B source. Compilation
+// errors returned by this package are of this type when the position
+// in the source is known.
+type Diagnostic struct {
+	Severity Severity
+	Pos      Pos
+	Message  string
+}
+
+// Error returns the diagnostic as "file:line: message"
+func (d Diagnostic) Error() string {
+	return d.Pos.String() + ": " + d.Message
+}
@@ -0,0 +1,780 @@
+package compiler
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/llir/llvm/ir"
+)
+
+// Compile processes the input files and generates the requested output format
+func Compile(args *CompileOptions) error {
+	if args.Verbose {
+		fmt.Printf("blang: compiling %d file(s)\n", len(args.InputFiles))
+	}
+
+	// Historical machines get assembly only
+	if args.Target == "pdp11" && args.OutputType != OutputAssembly {
+		return fmt.Errorf("target pdp11 supports only assembly output (-S)")
+	}
+	if _, ok := llvmTargets[args.Target]; ok && args.Backend == BackendNative {
+		return fmt.Errorf("target %s needs the LLVM backend", args.Target)
+	}
+	if args.Target == "pdp11" && args.BoundsCheck {
+		return fmt.Errorf("target pdp11 does not support -fbounds-check")
+	}
+	if args.Target == "pdp11" && args.Arith == ArithTrap {
+		return fmt.Errorf("target pdp11 does not support -ftrapv")
+	}
+	if args.Coverage && (args.Target == "pdp11" || args.IsWasm()) {
+		return fmt.Errorf("target %s does not support --coverage", args.Target)
+	}
+	if args.Profile && (args.Target == "pdp11" || args.IsWasm()) {
+		return fmt.Errorf("target %s does not support profiling", args.Target)
+	}
+	if args.StackCheck && (args.Target == "pdp11" || args.IsWasm()) {
+		return fmt.Errorf("target %s does not support -fstack-check", args.Target)
+	}
+	if err := checkSanitize(args); err != nil {
+		return err
+	}
+
+	args.cache = openCache(args)
+	defer args.cache.report(args)
+
+	// Handle different output types
+	switch args.OutputType {
+	case OutputIR:
+		return compileToIR(args)
+	case OutputAssembly:
+		return compileToAssembly(args)
+	case OutputObject:
+		return compileToObject(args)
+	case OutputExecutable:
+		return compileToExecutable(args)
+	default:
+		return fmt.Errorf("unsupported output type")
+	}
+}
+
+// ParseFile compiles a single .b file into an LLVM module, reporting
+// warnings. The source is taken from args.Sources when it has the file.
+func ParseFile(args *CompileOptions, inputFile string) (*ir.Module, error) {
+	var reader io.Reader
+	if src, ok := args.Sources[inputFile]; ok {
+		reader = bytes.NewReader(src)
+	} else {
+		file, err := os.Open(inputFile)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		reader = file
+	}
+	return parse(args, inputFile, reader)
+}
+
+// parse compiles B source into an LLVM module, reporting warnings;
+// an error of the parser is returned as a Diagnostic
+func parse(args *CompileOptions, name string, reader io.Reader) (*ir.Module, error) {
+	compiler, err := parseUnit(args, name, reader)
+	if err != nil {
+		return nil, err
+	}
+	return compiler.GetModule(), nil
+}
+
+// parseUnit compiles B source as parse does, and returns the compiler
+// with the state left after the whole unit
+func parseUnit(args *CompileOptions, name string, reader io.Reader) (*Compiler, error) {
+	// Create a fresh compiler per output unit
+	compiler := NewCompiler(args)
+	lexer := NewLexer(args, reader)
+	lexer.SetFilename(name)
+	err := ParseDeclarations(lexer, compiler)
+	for _, w := range compiler.Warnings() {
+		args.report(w)
+	}
+	if err != nil {
+		return nil, Diagnostic{Severity: SeverityError, Pos: lexer.Pos(), Message: err.Error()}
+	}
+	compiler.finishCoverage(name)
+	return compiler, nil
+}
+
+// compileToIR generates LLVM IR output
+func compileToIR(args *CompileOptions) error {
+	// Helper to compile a single .b file to the provided output path
+	compileSingleTo := func(inputFile string, outputPath string) error {
+		if args.Verbose {
+			fmt.Printf("blang: processing %s\n", inputFile)
+		}
+		module, err := ParseFile(args, inputFile)
+		if err != nil {
+			return err
+		}
+		if args.Optimize > 0 {
+			optimize(module)
+		}
+		// clang records the source file in objects; without it that
+		// would be the temporary IR file, in a directory of its own
+		module.SourceFilename = inputFile
+
+		outFile, err := os.Create(outputPath)
+		if err != nil {
+			return fmt.Errorf("cannot open file '%s': %v", outputPath, err)
+		}
+		if _, err := outFile.WriteString(module.String()); err != nil {
+			outFile.Close()
+			return err
+		}
+		if err := outFile.Close(); err != nil {
+			return err
+		}
+		if args.Verbose {
+			fmt.Printf("blang: generated %s\n", outputPath)
+		}
+		return nil
+	}
+
+	compileSingleTo = args.cache.cached(args, OutputIR, compileSingleTo)
+
+	// In non-pipeline IR mode, enforce that all inputs are .b files
+	for _, inputFile := range args.InputFiles {
+		if !strings.HasSuffix(inputFile, ".b") {
+			return fmt.Errorf("input file '%s' does not have .b extension", inputFile)
+		}
+	}
+
+	if args.OutputFile != "" {
+		// -o present: exactly one input file
+		if len(args.InputFiles) != 1 {
+			return fmt.Errorf("multiple input files with -o for IR output are not allowed")
+		}
+		return compileSingleTo(args.InputFiles[0], args.OutputFile)
+	}
+
+	// No -o: emit one .ll per input into current working directory
+	for _, inputFile := range args.InputFiles {
+		base := filepath.Base(inputFile)
+		out := strings.TrimSuffix(base, filepath.Ext(base)) + ".ll"
+		if err := compileSingleTo(inputFile, out); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// compileToAssembly generates assembly output
+func compileToAssembly(args *CompileOptions) error {
+	// Validate extensions: only .b and .ll are accepted
+	for _, in := range args.InputFiles {
+		ext := filepath.Ext(in)
+		if ext != ".b" && ext != ".ll" {
+			return fmt.Errorf("input file '%s' must have .b or .ll extension", in)
+		}
+	}
+
+	// Helper to build clang args including optimization/debug flags
+	buildClangArgs := func(inputIRorLL, out string) []string {
+		cmdArgs := []string{}
+		if args.Optimize > 0 {
+			cmdArgs = append(cmdArgs, fmt.Sprintf("-O%d", args.Optimize))
+		}
+		if args.DebugInfo {
+			cmdArgs = append(cmdArgs, "-g")
+		}
+		if args.Target != "" {
+			cmdArgs = append(cmdArgs, "--target="+args.Target)
+		}
+		if args.Sysroot != "" {
+			cmdArgs = append(cmdArgs, "--sysroot="+args.Sysroot)
+		}
+		if args.IsHosted() {
+			cmdArgs = append(cmdArgs, args.sanitizeFlag())
+		}
+		cmdArgs = append(cmdArgs, "-S", "-o", out, inputIRorLL)
+		return cmdArgs
+	}
+
+	// Process a single input into the specified output path
+	processOne := func(in, out string) error {
+		if args.Target == "pdp11" {
+			return generatePDP11(args, in, out)
+		}
+		if args.Backend == BackendNative {
+			return generateNative(args, in, out)
+		}
+		if strings.HasSuffix(in, ".b") {
+			// Compile .b to temporary IR first
+			tempIR := out + ".tmp.ll"
+
+			irArgs := *args
+			irArgs.InputFiles = []string{in}
+			irArgs.OutputType = OutputIR
+			irArgs.OutputFile = tempIR
+
+			if err := compileToIR(&irArgs); err != nil {
+				return err
+			}
+
+			// Convert IR to assembly using clang
+			cmd := command("clang", buildClangArgs(tempIR, out)...)
+			if args.Verbose {
+				fmt.Printf("blang: running %s\n", cmd.String())
+			}
+			if err := cmd.Run(); err != nil {
+				if !args.SaveTemps {
+					os.Remove(tempIR)
+				}
+				return fmt.Errorf("failed to generate assembly: %v", err)
+			}
+
+			// Clean up temporary IR unless save-temps is specified
+			if !args.SaveTemps {
+				os.Remove(tempIR)
+			}
+
+			if args.Verbose {
+				fmt.Printf("blang: generated %s\n", out)
+			}
+			return nil
+		}
+
+		// .ll: directly assemble with clang
+		cmd := command("clang", buildClangArgs(in, out)...)
+		if args.Verbose {
+			fmt.Printf("blang: running %s\n", cmd.String())
+		}
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("failed to generate assembly: %v", err)
+		}
+		if args.Verbose {
+			fmt.Printf("blang: generated %s\n", out)
+		}
+		return nil
+	}
+
+	processOne = args.cache.cached(args, OutputAssembly, processOne)
+
+	// If -o specified, require exactly one input file
+	if args.OutputFile != "" {
+		if len(args.InputFiles) != 1 {
+			return fmt.Errorf("-o requires exactly one input file")
+		}
+		return processOne(args.InputFiles[0], args.OutputFile)
+	}
+
+	// No -o: emit one .s per input in the current working directory
+	for _, in := range args.InputFiles {
+		base := filepath.Base(in)
+		out := strings.TrimSuffix(base, filepath.Ext(base)) + ".s"
+		if err := processOne(in, out); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// compileToObject generates object file
+func compileToObject(args *CompileOptions) error {
+	// Validate extensions: only .b, .ll, .s are accepted
+	for _, in := range args.InputFiles {
+		ext := filepath.Ext(in)
+		if ext != ".b" && ext != ".ll" && ext != ".s" {
+			return fmt.Errorf("input file '%s' must have .b, .ll or .s extension", in)
+		}
+	}
+
+	// Process a single input into the specified output object path
+	processOne := func(in, out string) error {
+		if args.Backend == BackendNative {
+			return assembleNative(args, in, out)
+		}
+		return clangObject(args, in, out+".tmp.ll", out)
+	}
+
+	processOne = args.cache.cached(args, OutputObject, processOne)
+
+	// If -o specified, require exactly one input file
+	if args.OutputFile != "" {
+		if len(args.InputFiles) != 1 {
+			return fmt.Errorf("-o requires exactly one input file")
+		}
+		return processOne(args.InputFiles[0], args.OutputFile)
+	}
+
+	// No -o: emit one .o per input in the current working directory
+	for _, in := range args.InputFiles {
+		base := filepath.Base(in)
+		out := strings.TrimSuffix(base, filepath.Ext(base)) + ".o"
+		if err := processOne(in, out); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// clangObject compiles a .b, .ll or .s file into an object with clang;
+// a .b file is first compiled to IR in the temporary file ir
+func clangObject(args *CompileOptions, in, ir, out string) error {
+	if strings.HasSuffix(in, ".b") {
+		irArgs := *args
+		irArgs.InputFiles = []string{in}
+		irArgs.OutputType = OutputIR
+		irArgs.OutputFile = ir
+		if err := compileToIR(&irArgs); err != nil {
+			return err
+		}
+		// Clean up temporary IR unless save-temps is specified
+		if !args.SaveTemps {
+			defer os.Remove(ir)
+		}
+		in = ir
+	}
+
+	// Optimization, debug and target flags
+	cmdArgs := []string{}
+	if args.Optimize > 0 {
+		cmdArgs = append(cmdArgs, fmt.Sprintf("-O%d", args.Optimize))
+	}
+	if args.DebugInfo {
+		cmdArgs = append(cmdArgs, "-g")
+	}
+	if args.Target != "" {
+		cmdArgs = append(cmdArgs, "--target="+args.Target)
+	}
+	if args.Sysroot != "" {
+		cmdArgs = append(cmdArgs, "--sysroot="+args.Sysroot)
+	}
+	if args.IsHosted() {
+		cmdArgs = append(cmdArgs, args.sanitizeFlag())
+	}
+	cmdArgs = append(cmdArgs, "-c", "-o", out, in)
+
+	cmd := command("clang", cmdArgs...)
+	if args.Verbose {
+		fmt.Printf("blang: running %s\n", cmd.String())
+	}
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to generate object file: %v", err)
+	}
+	if args.Verbose {
+		fmt.Printf("blang: generated %s\n", out)
+	}
+	return nil
+}
+
+// linkArgs builds the arguments of clang which link the given inputs
+// with the B runtime into the output file
+func linkArgs(args *CompileOptions, inputs []string) ([]string, error) {
+	cmdArgs := []string{}
+	if args.Optimize > 0 {
+		cmdArgs = append(cmdArgs, fmt.Sprintf("-O%d", args.Optimize))
+	}
+	if args.DebugInfo {
+		cmdArgs = append(cmdArgs, "-g")
+	}
+	cmdArgs = append(cmdArgs, inputs...)
+
+	// Link statically on Linux; on macOS enter through the runtime,
+	// which passes command line arguments to main() in B form.
+	// A WebAssembly module enters through _start of the runtime.
+	// Other Linux machines are linked with lld, which handles every
+	// architecture, so that no cross binutils are needed. Sanitizers
+	// need the C library: the program is linked as a C one, with the
+	// hosted variant of the runtime, whose main() calls that of B.
+	switch {
+	case args.IsHosted():
+		cmdArgs = append(cmdArgs, args.sanitizeFlag())
+	case args.IsWasm():
+		cmdArgs = append(cmdArgs, "--target="+args.Target, "-nostdlib")
+	case args.Target != "":
+		cmdArgs = append(cmdArgs, "--target="+args.Target, "-fuse-ld=lld", "-static", "-nostdlib")
+	case runtime.GOOS == "linux":
+		cmdArgs = append(cmdArgs, "-static", "-nostdlib")
+	case runtime.GOOS == "darwin":
+		cmdArgs = append(cmdArgs, "-Wl,-e,_b_start")
+	}
+	if args.Sysroot != "" {
+		cmdArgs = append(cmdArgs, "--sysroot="+args.Sysroot)
+	}
+
+	// Add library search directories before libraries for correct resolution order
+	for _, libDir := range args.LibraryDirs {
+		cmdArgs = append(cmdArgs, "-L"+libDir)
+	}
+
+	// Always link the B runtime library; the runtime of another target
+	// is in a subdirectory named after it, and is linked by its path
+	// so that the library of the host is never picked by mistake
+	switch {
+	case args.IsHosted():
+		cmdArgs = append(cmdArgs, "-lb-san")
+	case args.Target == "":
+		cmdArgs = append(cmdArgs, "-lb")
+	default:
+		lib, err := findRuntime(args)
+		if err != nil {
+			return nil, err
+		}
+		cmdArgs = append(cmdArgs, lib)
+	}
+	for _, lib := range args.Libraries {
+		cmdArgs = append(cmdArgs, "-l"+lib)
+	}
+	cmdArgs = append(cmdArgs, "-o", args.OutputFile)
+	return cmdArgs, nil
+}
+
+// findRuntime returns the path of the runtime library of the target,
+// <dir>/<target>/libb.a in the first library directory which has it
+func findRuntime(args *CompileOptions) (string, error) {
+	for _, libDir := range args.LibraryDirs {
+		lib := filepath.Join(libDir, args.Target, "libb.a")
+		if _, err := os.Stat(lib); err == nil {
+			return lib, nil
+		}
+	}
+	return "", fmt.Errorf("no runtime library for target %s; build it with 'make %s' in the runtime directory", args.Target, args.Target)
+}
+
+// compileToExecutable generates executable
+func compileToExecutable(args *CompileOptions) error {
+	// Determine output name if not set: basename of the first source file
+	if args.OutputFile == "" {
+		base := filepath.Base(args.InputFiles[0])
+		args.OutputFile = strings.TrimSuffix(base, filepath.Ext(base))
+		if args.IsWasm() {
+			args.OutputFile += ".wasm"
+		}
+	}
+	if args.Backend == BackendNative {
+		return linkNative(args)
+	}
+
+	// Compile .b inputs to temporary objects, taken from the cache
+	// when their sources did not change, and collect inputs for clang
+	temps := []string{}
+	clangInputs := []string{}
+
+	for i, in := range args.InputFiles {
+		ext := filepath.Ext(in)
+		switch ext {
+		case ".b":
+			// For compatibility with CLI tests: when linking a single .b with -o,
+			// use <output>.tmp.ll as the temporary IR name, and
+			// <output>.tmp.o as that of the object.
+			var base string
+			if len(args.InputFiles) == 1 && args.OutputFile != "" {
+				base = args.OutputFile + ".tmp"
+			} else {
+				base = fmt.Sprintf("%s.tmp.%d", strings.TrimSuffix(filepath.Base(in), ext), i)
+			}
+			compile := args.cache.cached(args, OutputObject, func(in, out string) error {
+				return clangObject(args, in, base+".ll", out)
+			})
+			if err := compile(in, base+".o"); err != nil {
+				if !args.SaveTemps {
+					for _, t := range temps {
+						os.Remove(t)
+					}
+				}
+				return err
+			}
+			temps = append(temps, base+".o")
+			clangInputs = append(clangInputs, base+".o")
+
+		case ".ll", ".s", ".o", ".a":
+			clangInputs = append(clangInputs, in)
+
+		default:
+			// main() validated extensions, but keep a guard here
+			return fmt.Errorf("unsupported input file extension: %s", in)
+		}
+	}
+
+	// Build clang command for linking
+	cmdArgs, err := linkArgs(args, clangInputs)
+	if err != nil {
+		if !args.SaveTemps {
+			for _, t := range temps {
+				os.Remove(t)
+			}
+		}
+		return err
+	}
+
+	cmd := command("clang", cmdArgs...)
+	if args.Verbose {
+		fmt.Printf("blang: running %s\n", cmd.String())
+	}
+
+	if err := cmd.Run(); err != nil {
+		if !args.SaveTemps {
+			for _, t := range temps {
+				os.Remove(t)
+			}
+		}
+		return fmt.Errorf("failed to generate executable: %v", err)
+	}
+
+	// Clean up temporary files unless save-temps is specified
+	if !args.SaveTemps {
+		for _, t := range temps {
+			os.Remove(t)
+		}
+	}
+
+	if args.Verbose {
+		fmt.Printf("blang: generated %s\n", args.OutputFile)
+	}
+	return nil
+}
+
+// checkSanitize reports an error unless the sanitizers requested are
+// known and can be used: they need clang and the C library of the host
+func checkSanitize(args *CompileOptions) error {
+	for _, name := range args.Sanitize {
+		if name != "address" && name != "undefined" {
+			return fmt.Errorf("unknown sanitizer '%s'; expected 'address' or 'undefined'", name)
+		}
+	}
+	if !args.IsHosted() {
+		return nil
+	}
+	if args.Target != "" {
+		return fmt.Errorf("-fsanitize is not supported for target %s", args.Target)
+	}
+	if args.Backend == BackendNative {
+		return fmt.Errorf("-fsanitize needs the LLVM backend")
+	}
+	return nil
+}
+
+// checkNativeHost reports an error unless the native backend can
+// build programs on this machine.
+func checkNativeHost() error {
+	if runtime.GOOS != "linux" || runtime.GOARCH != "amd64" {
+		return fmt.Errorf("native backend supports only x86_64 Linux, not %s/%s", runtime.GOOS, runtime.GOARCH)
+	}
+	return nil
+}
+
+// generateNative compiles a .b file to x86_64 assembly without clang
+func generateNative(args *CompileOptions, in, out string) error {
+	if !strings.HasSuffix(in, ".b") {
+		return fmt.Errorf("input file '%s' must have .b extension with the native backend", in)
+	}
+	if args.Verbose {
+		fmt.Printf("blang: processing %s\n", in)
+	}
+	module, err := ParseFile(args, in)
+	if err != nil {
+		return err
+	}
+	if args.Optimize > 0 {
+		optimize(module)
+	}
+	asm, err := GenerateNative(module)
+	if err != nil {
+		return fmt.Errorf("%s: %v", in, err)
+	}
+	if err := os.WriteFile(out, []byte(asm), 0644); err != nil {
+		return fmt.Errorf("cannot open file '%s': %v", out, err)
+	}
+	if args.Verbose {
+		fmt.Printf("blang: generated %s\n", out)
+	}
+	return nil
+}
+
+// command returns the command running a tool of the build. With
+// SOURCE_DATE_EPOCH set, as for a reproducible build, the linker of
+// macOS is told not to record the modification times of the objects.
+func command(name string, arg ...string) *exec.Cmd {
+	cmd := exec.Command(name, arg...)
+	if os.Getenv("SOURCE_DATE_EPOCH") != "" && runtime.GOOS == "darwin" {
+		cmd.Env = append(os.Environ(), "ZERO_AR_DATE=1")
+	}
+	return cmd
+}
+
+// generatePDP11 compiles a .b file to threaded code for the PDP-11
+func generatePDP11(args *CompileOptions, in, out string) error {
+	if !strings.HasSuffix(in, ".b") {
+		return fmt.Errorf("input file '%s' must have .b extension for target pdp11", in)
+	}
+	if args.Verbose {
+		fmt.Printf("blang: processing %s\n", in)
+	}
+	module, err := ParseFile(args, in)
+	if err != nil {
+		return err
+	}
+	asm, err := GeneratePDP11(args, module)
+	if err != nil {
+		return fmt.Errorf("%s: %v", in, err)
+	}
+	if err := os.WriteFile(out, []byte(asm), 0644); err != nil {
+		return fmt.Errorf("cannot open file '%s': %v", out, err)
+	}
+	if args.Verbose {
+		fmt.Printf("blang: generated %s\n", out)
+	}
+	return nil
+}
+
+// assembleNative produces an object file from a .b or .s file with
+// the GNU assembler
+func assembleNative(args *CompileOptions, in, out string) error {
+	if err := checkNativeHost(); err != nil {
+		return err
+	}
+	asmFile := in
+	switch filepath.Ext(in) {
+	case ".b":
+		// hello.o and hello.tmp.o both assemble hello.tmp.s
+		base := strings.TrimSuffix(out, ".o")
+		if !strings.HasSuffix(base, ".tmp") {
+			base += ".tmp"
+		}
+		asmFile = base + ".s"
+		if err := generateNative(args, in, asmFile); err != nil {
+			return err
+		}
+		if !args.SaveTemps {
+			defer os.Remove(asmFile)
+		}
+	case ".s":
+	default:
+		return fmt.Errorf("input file '%s' must have .b or .s extension with the native backend", in)
+	}
+
+	cmdArgs := []string{"--64"}
+	if args.DebugInfo {
+		// Debug info names the assembly file and the current directory;
+		// keep them relative, the more so for a temporary file
+		cmdArgs = append(cmdArgs, "-g")
+		if dir, err := filepath.Abs(filepath.Dir(asmFile)); err == nil {
+			cmdArgs = append(cmdArgs, "--debug-prefix-map="+dir+"=.")
+		}
+		if dir, err := os.Getwd(); err == nil {
+			cmdArgs = append(cmdArgs, "--debug-prefix-map="+dir+"=.")
+		}
+	}
+	cmdArgs = append(cmdArgs, "-o", out, asmFile)
+	cmd := command("as", cmdArgs...)
+	cmd.Stderr = os.Stderr
+	if args.Verbose {
+		fmt.Printf("blang: running %s\n", cmd.String())
+	}
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to generate object file: %v", err)
+	}
+	if args.Verbose {
+		fmt.Printf("blang: generated %s\n", out)
+	}
+	return nil
+}
+
+// linkNative builds an executable with the GNU assembler and linker
+func linkNative(args *CompileOptions) error {
+	if err := checkNativeHost(); err != nil {
+		return err
+	}
+	temps := []string{}
+	removeTemps := func() {
+		if !args.SaveTemps {
+			for _, t := range temps {
+				os.Remove(t)
+			}
+		}
+	}
+	defer removeTemps()
+
+	assemble := args.cache.cached(args, OutputObject, func(in, out string) error {
+		return assembleNative(args, in, out)
+	})
+	objects := []string{}
+	for i, in := range args.InputFiles {
+		ext := filepath.Ext(in)
+		switch ext {
+		case ".b", ".s":
+			var tmp string
+			if len(args.InputFiles) == 1 {
+				tmp = args.OutputFile + ".tmp.o"
+			} else {
+				base := strings.TrimSuffix(filepath.Base(in), ext)
+				tmp = fmt.Sprintf("%s.tmp.%d.o", base, i)
+			}
+			if err := assemble(in, tmp); err != nil {
+				return err
+			}
+			temps = append(temps, tmp)
+			objects = append(objects, tmp)
+
+		case ".o", ".a":
+			objects = append(objects, in)
+
+		default:
+			return fmt.Errorf("input file '%s' cannot be linked with the native backend", in)
+		}
+	}
+
+	// The entry point _start comes from the runtime library
+	cmdArgs := []string{"-static", "-u", "_start", "-o", args.OutputFile}
+	cmdArgs = append(cmdArgs, objects...)
+	for _, libDir := range args.LibraryDirs {
+		cmdArgs = append(cmdArgs, "-L"+libDir)
+	}
+	cmdArgs = append(cmdArgs, "-lb")
+	for _, lib := range args.Libraries {
+		cmdArgs = append(cmdArgs, "-l"+lib)
+	}
+
+	cmd := command("ld", cmdArgs...)
+	cmd.Stderr = os.Stderr
+	if args.Verbose {
+		fmt.Printf("blang: running %s\n", cmd.String())
+	}
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to generate executable: %v", err)
+	}
+	if args.Verbose {
+		fmt.Printf("blang: generated %s\n", args.OutputFile)
+	}
+	return nil
+}
+
+// Interpret runs the input files with the built-in interpreter instead of
+// compiling them, and returns the exit status of the program. The first
+// element of argv is the program name.
+func Interpret(args *CompileOptions, argv []string) (int, error) {
+	interp := NewInterp(args)
+	for _, inputFile := range args.InputFiles {
+		if !strings.HasSuffix(inputFile, ".b") {
+			return 0, fmt.Errorf("input file '%s' does not have .b extension", inputFile)
+		}
+		if args.Verbose {
+			fmt.Fprintf(os.Stderr, "blang: processing %s\n", inputFile)
+		}
+		module, err := ParseFile(args, inputFile)
+		if err != nil {
+			return 0, err
+		}
+		if err := interp.Load(module); err != nil {
+			return 0, err
+		}
+	}
+	if args.Verbose {
+		fmt.Fprintf(os.Stderr, "blang: running %s\n", argv[0])
+	}
+	return interp.Run(argv)
+}
@@ -1,7 +1,8 @@
-package main
+package compiler
 
 import (
 	"os"
+	"os/exec"
 	"path/filepath"
 	"strings"
 	"testing"
@@ -16,7 +17,7 @@ func BenchmarkCompile(b *testing.B) {
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		args := NewCompileOptions("blang", []string{"examples/e-2.b"})
+		args := NewCompileOptions("blang", []string{"../examples/e-2.b"})
 		args.OutputFile = outputFile
 		Compile(args)
 	}
@@ -393,7 +394,7 @@ func TestCompileErrors(t *testing.T) {
 			// Try to compile
 			args := NewCompileOptions("blang", []string{inputFile})
 			args.OutputFile = outputFile
-			args.LibraryDirs = []string{"runtime"} // Add runtime directory for libb.a
+			args.LibraryDirs = []string{"../runtime"} // Add runtime directory for libb.a
 
 			err = Compile(args)
 			if (err != nil) != tt.wantErr {
@@ -599,3 +600,241 @@ func TestCompileLinkRunFromBFile_Smoke(t *testing.T) {
 		t.Fatalf("stdout does not contain expected output, got %q", out)
 	}
 }
+
+// TestExitStatusAndHandlers tests exit statuses from main() and exit(),
+// and that atexit() handlers run in reverse order of registration.
+func TestExitStatusAndHandlers(t *testing.T) {
+	ensureLibbOrSkip(t)
+
+	tests := []struct {
+		name       string
+		code       string
+		wantExit   int
+		wantStdout string
+	}{
+		{
+			name:     "return_from_main",
+			code:     "main() { return(42); }",
+			wantExit: 42,
+		},
+		{
+			name:     "fall_off_main",
+			code:     "main() { }",
+			wantExit: 0,
+		},
+		{
+			name:       "exit_with_status",
+			code:       `main() { printf("a*n"); exit(3); printf("b*n"); }`,
+			wantExit:   3,
+			wantStdout: "a\n",
+		},
+		{
+			name:     "exit_without_argument",
+			code:     "main() { exit(); return(9); }",
+			wantExit: 0,
+		},
+		{
+			name: "handlers_on_return",
+			code: `first() { printf("first*n"); }
+second() { printf("second*n"); }
+third() { printf("third*n"); }
+main() {
+    atexit(first);
+    atexit(second);
+    atexit(third);
+    printf("main*n");
+    return(5);
+}`,
+			wantExit:   5,
+			wantStdout: "main\nthird\nsecond\nfirst\n",
+		},
+		{
+			name: "handlers_on_exit",
+			code: `bye() { printf("bye*n"); }
+work(n) {
+    if (n == 0)
+        exit(7);
+    work(n - 1);
+}
+main() {
+    atexit(bye);
+    work(3);
+    printf("not reached*n");
+}`,
+			wantExit:   7,
+			wantStdout: "bye\n",
+		},
+		{
+			name: "exit_from_handler",
+			code: `late() { printf("late*n"); }
+change() { printf("change*n"); exit(2); }
+main() {
+    atexit(late);
+    atexit(change);
+    return(1);
+}`,
+			wantExit:   2,
+			wantStdout: "change\nlate\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			inputFile := writeTempFile(t, tmpDir, "test.b", tt.code)
+			exeFile := filepath.Join(tmpDir, "test")
+
+			args := NewCompileOptions("blang", []string{inputFile})
+			args.OutputFile = exeFile
+			args.LibraryDirs = []string{"../runtime"}
+			if err := Compile(args); err != nil {
+				t.Fatalf("Compile() failed: %v", err)
+			}
+
+			stdout, exitCode := runExecutable(t, exeFile)
+			if exitCode != tt.wantExit {
+				t.Errorf("Exit code = %d, want %d", exitCode, tt.wantExit)
+			}
+			if string(stdout) != tt.wantStdout {
+				t.Errorf("Stdout = %q, want %q", stdout, tt.wantStdout)
+			}
+		})
+	}
+}
+
+// TestLinkArgsTarget tests how the runtime of another machine is chosen
+func TestLinkArgsTarget(t *testing.T) {
+	dir := t.TempDir()
+	for _, sub := range []string{"aarch64-linux-gnu", "wasm32-wasi"} {
+		if err := os.MkdirAll(filepath.Join(dir, "lib", sub), 0755); err != nil {
+			t.Fatal(err)
+		}
+		writeTempFile(t, filepath.Join(dir, "lib", sub), "libb.a", "!<arch>\n")
+	}
+	libDir := filepath.Join(dir, "lib")
+
+	args := NewCompileOptions("blang", []string{"hello.b"})
+	args.Target = "aarch64-linux-gnu"
+	args.Sysroot = "/srv/arm64"
+	args.LibraryDirs = []string{filepath.Join(dir, "none"), libDir}
+	args.OutputFile = "hello"
+	cmdArgs, err := linkArgs(args, []string{"hello.ll"})
+	if err != nil {
+		t.Fatalf("linkArgs() failed: %v", err)
+	}
+	got := strings.Join(cmdArgs, " ")
+	for _, want := range []string{
+		"--target=aarch64-linux-gnu -fuse-ld=lld -static -nostdlib",
+		"--sysroot=/srv/arm64",
+		" " + filepath.Join(libDir, "aarch64-linux-gnu", "libb.a") + " ",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("link arguments %q do not contain %q", got, want)
+		}
+	}
+	if strings.Contains(got, "-lb ") {
+		t.Errorf("link arguments %q should not search for the host runtime", got)
+	}
+
+	args.Target = "wasm32-wasi"
+	args.Sysroot = ""
+	cmdArgs, err = linkArgs(args, []string{"hello.ll"})
+	if err != nil {
+		t.Fatalf("linkArgs() failed: %v", err)
+	}
+	if got := strings.Join(cmdArgs, " "); strings.Contains(got, "lld") || strings.Contains(got, "-static") {
+		t.Errorf("WebAssembly link arguments %q should use wasm-ld", got)
+	}
+
+	args.Target = "riscv64-linux-gnu"
+	_, err = linkArgs(args, []string{"hello.ll"})
+	if err == nil || !strings.Contains(err.Error(), "make riscv64-linux-gnu") {
+		t.Errorf("linkArgs() error = %v, want missing runtime error", err)
+	}
+}
+
+// TestSanitize tests the IR and the link of a program built with
+// sanitizers, and the combinations which are refused
+func TestSanitize(t *testing.T) {
+	src := []Source{{Name: "s.b", Code: []byte("f(x) return (x);\nmain() {\n    return (f(1));\n}\n")}}
+	out, _, err := Build(src, WithOutputType(OutputIR), WithSanitize("address", "undefined"))
+	if err != nil {
+		t.Fatalf("Build() failed: %v", err)
+	}
+	ir := string(out)
+	for _, want := range []string{
+		"define internal i64 @.body.f(i64 %x) sanitize_address {",
+		"define i64 @b.main() sanitize_address {",
+	} {
+		if !strings.Contains(ir, want) {
+			t.Errorf("IR does not contain %q:\n%s", want, ir)
+		}
+	}
+
+	out, _, err = Build(src, WithOutputType(OutputIR), WithSanitize("undefined"))
+	if err != nil {
+		t.Fatalf("Build() failed: %v", err)
+	}
+	if strings.Contains(string(out), "sanitize_address") || !strings.Contains(string(out), "@b.main()") {
+		t.Errorf("IR with only UBSan:\n%s", out)
+	}
+
+	args := NewCompileOptions("blang", []string{"s.b"})
+	args.Sanitize = []string{"address", "undefined"}
+	args.OutputFile = "s"
+	cmdArgs, err := linkArgs(args, []string{"s.ll"})
+	if err != nil {
+		t.Fatalf("linkArgs() failed: %v", err)
+	}
+	got := strings.Join(cmdArgs, " ")
+	if !strings.Contains(got, "-fsanitize=address,undefined") || !strings.Contains(got, "-lb-san") {
+		t.Errorf("link arguments %q do not use the sanitizers", got)
+	}
+	if strings.Contains(got, "-static") || strings.Contains(got, "-nostdlib") || strings.Contains(got, "-lb ") {
+		t.Errorf("link arguments %q are not hosted", got)
+	}
+
+	for _, tt := range []struct {
+		opts []Option
+		want string
+	}{
+		{[]Option{WithSanitize("memory")}, "unknown sanitizer 'memory'"},
+		{[]Option{WithSanitize("address"), WithTarget("wasm32-wasi")}, "not supported for target wasm32-wasi"},
+		{[]Option{WithSanitize("address"), WithBackend(BackendNative)}, "needs the LLVM backend"},
+	} {
+		if _, _, err := Build(src, append(tt.opts, WithOutputType(OutputAssembly))...); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("error = %v, want %q", err, tt.want)
+		}
+	}
+}
+
+// TestSanitizeVector tests that the address sanitizer reports a store
+// past the end of a vector from getvec(), which the hosted runtime takes
+// from malloc()
+func TestSanitizeVector(t *testing.T) {
+	if _, err := os.Stat("../runtime/libb-san.a"); err != nil {
+		t.Skip("../runtime/libb-san.a not found, run 'make san' first")
+	}
+	if _, err := exec.LookPath("clang"); err != nil {
+		t.Skip("clang not found")
+	}
+	dir := t.TempDir()
+	bFile := writeTempFile(t, dir, "vec.b", `main() {
+    auto v;
+    v = getvec(3);
+    v[3] = 1;
+    v[4] = 1;
+    rlsevec(v, 3);
+}
+`)
+	exeFile := filepath.Join(dir, "vec")
+	args := NewOptions([]string{bFile}, WithOutput(exeFile), WithOutputType(OutputExecutable),
+		WithSanitize("address"), WithLibraryDirs("../runtime"))
+	if err := Compile(args); err != nil {
+		t.Fatalf("Compile() failed: %v", err)
+	}
+	out, err := exec.Command(exeFile).CombinedOutput()
+	if err == nil || !strings.Contains(string(out), "heap-buffer-overflow") {
+		t.Errorf("error = %v, output:\n%s", err, out)
+	}
+}
@@ -1,4 +1,4 @@
-package main
+package compiler
 
 import (
 	"bytes"
@@ -23,25 +23,25 @@ func TestCompileAndRun(t *testing.T) {
 		// Example programs
 		{
 			name:       "hello_write",
-			inputFile:  "examples/hello.b",
+			inputFile:  "../examples/hello.b",
 			wantExit:   0,
 			wantStdout: "Hello, World!",
 		},
 		{
 			name:       "hello_printf",
-			inputFile:  "examples/helloworld.b",
+			inputFile:  "../examples/helloworld.b",
 			wantExit:   0,
 			wantStdout: "Hello, World!",
 		},
 		{
 			name:       "example_fibonacci",
-			inputFile:  "examples/fibonacci.b",
+			inputFile:  "../examples/fibonacci.b",
 			wantExit:   0,
 			wantStdout: "55\n",
 		},
 		{
 			name:       "example_fizzbuzz",
-			inputFile:  "examples/fizzbuzz.b",
+			inputFile:  "../examples/fizzbuzz.b",
 			wantExit:   0,
 			wantStdout: "FizzBuzz", // Check that FizzBuzz appears in output
 		},
@@ -77,7 +77,7 @@ func TestE2Constant(t *testing.T) {
 	ensureLibbOrSkip(t)
 
 	tmpDir := t.TempDir()
-	inputFile := "examples/e-2.b"
+	inputFile := "../examples/e-2.b"
 	llFile := filepath.Join(tmpDir, "e-2.ll")
 	exeFile := filepath.Join(tmpDir, "e2")
 
@@ -95,6 +95,49 @@ func TestE2Constant(t *testing.T) {
 	}
 }
 
+// TestReproducibleExamples tests that the examples compiled twice, in
+// different temporary directories, give the same IR, assembly and objects
+func TestReproducibleExamples(t *testing.T) {
+	outputs := map[string][]Option{
+		"IR -O0":   {WithOutputType(OutputIR), WithOptimize(0)},
+		"IR -O1":   {WithOutputType(OutputIR), WithOptimize(1)},
+		"PDP-11":   {WithOutputType(OutputAssembly), WithTarget("pdp11")},
+		"native":   {WithOutputType(OutputAssembly), WithBackend(BackendNative)},
+		"native.o": {WithOutputType(OutputObject), WithBackend(BackendNative), WithDebugInfo()},
+		"clang.o":  {WithOutputType(OutputObject)},
+	}
+	if _, err := exec.LookPath("as"); err != nil || checkNativeHost() != nil {
+		delete(outputs, "native.o")
+	}
+	if _, err := exec.LookPath("clang"); err != nil {
+		delete(outputs, "clang.o")
+	}
+	files, _ := filepath.Glob("../examples/*.b")
+	for _, file := range files {
+		code, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		src := []Source{{Name: filepath.Base(file), Code: code}}
+		for kind, opts := range outputs {
+			first, _, err := Build(src, opts...)
+			if err != nil && kind == "PDP-11" {
+				continue // some character constants do not fit its words
+			}
+			if err != nil {
+				t.Errorf("%s, %s: %v", src[0].Name, kind, err)
+				continue
+			}
+			second, _, err := Build(src, opts...)
+			if err != nil {
+				t.Errorf("%s, %s: %v", src[0].Name, kind, err)
+			} else if !bytes.Equal(first, second) {
+				t.Errorf("%s, %s: output differs between two builds", src[0].Name, kind)
+			}
+		}
+	}
+}
+
 // The test compiles the historical PDP-7 B compiler (examples/b.b),
 // runs it with examples/b.b as input, and verifies the generated
 // output matches the expected PDP-7 code in examples/b.pdp7.
@@ -106,10 +149,10 @@ func TestPDP7CompilerB(t *testing.T) {
 	exeFile := filepath.Join(tmpDir, "b")
 
 	// Compile the PDP-7 B compiler source to IR and link into an executable.
-	compileToLL(t, "examples/b.b", llFile)
+	compileToLL(t, "../examples/b.b", llFile)
 	linkWithClang(t, llFile, exeFile)
 
-	in, err := os.Open("examples/b.b")
+	in, err := os.Open("../examples/b.b")
 	if err != nil {
 		t.Fatalf("open input: %v", err)
 	}
@@ -126,7 +169,7 @@ func TestPDP7CompilerB(t *testing.T) {
 	}
 
 	// Read expected output
-	wantPDP7, err := os.ReadFile("examples/b.pdp7")
+	wantPDP7, err := os.ReadFile("../examples/b.pdp7")
 	if err != nil {
 		t.Fatalf("Failed to read file: %v", err)
 	}
@@ -139,8 +182,6 @@ func TestPDP7CompilerB(t *testing.T) {
 
 // Test function name() from examples/b.b
 func TestPDP7CompilerName(t *testing.T) {
-	ensureLibbOrSkip(t)
-
 	code := `
 name(s) {
 	while (*s) {
@@ -173,8 +214,6 @@ main() {
 // Embed lookup(), name(), and storage from examples/b.b
 // and verifies that lookup(); name(&csym[2]) prints the identifier.
 func TestPDP7CompilerLookup(t *testing.T) {
-	ensureLibbOrSkip(t)
-
 	code := `
 lookup() {
   extrn symtab, symbuf, eof, ns;
@@ -1,4 +1,4 @@
-package main
+package compiler
 
 import (
 	"fmt"
@@ -239,6 +239,7 @@ func parseExpressionWithLevel(l *Lexer, c *Compiler, level int) (value.Value, er
 			}
 
 			// Parse right side
+			opPos := l.Pos()
 			right, err := parseExpressionWithLevel(l, c, 14)
 			if err != nil {
 				return nil, err
@@ -258,18 +259,16 @@ func parseExpressionWithLevel(l *Lexer, c *Compiler, level int) (value.Value, er
 					newVal = c.builder.NewSub(currentVal, right)
 				case '*':
 					newVal = c.builder.NewMul(currentVal, right)
-				case '/':
-					newVal = c.builder.NewSDiv(currentVal, right)
-				case '%':
-					newVal = c.builder.NewSRem(currentVal, right)
+				case '/', '%':
+					newVal = c.divide(compoundOp, currentVal, right, opPos)
 				case '&':
 					newVal = c.builder.NewAnd(currentVal, right)
 				case '|':
 					newVal = c.builder.NewOr(currentVal, right)
 				case '«': // =<<
-					newVal = c.builder.NewShl(currentVal, right)
+					newVal = c.shift('<', currentVal, right)
 				case '»': // =>>
-					newVal = c.builder.NewAShr(currentVal, right)
+					newVal = c.shift('>', currentVal, right)
 				case '<': // =<
 					cmp := c.builder.NewICmp(enum.IPredSLT, currentVal, right)
 					newVal = c.builder.NewZExt(cmp, c.WordType())
@@ -370,7 +369,7 @@ func parseExpressionWithLevel(l *Lexer, c *Compiler, level int) (value.Value, er
 						if err != nil {
 							return nil, err
 						}
-						left = c.builder.NewShl(left, right)
+						left = c.shift('<', left, right)
 						handled = true
 						continue
 					}
@@ -406,7 +405,7 @@ func parseExpressionWithLevel(l *Lexer, c *Compiler, level int) (value.Value, er
 						if err != nil {
 							return nil, err
 						}
-						left = c.builder.NewAShr(left, right)
+						left = c.shift('>', left, right)
 						handled = true
 						continue
 					}
@@ -478,6 +477,7 @@ func parseExpressionWithLevel(l *Lexer, c *Compiler, level int) (value.Value, er
 				left = c.builder.NewLoad(c.WordType(), left)
 				isLvalue = false
 			}
+			opPos := l.Pos()
 			right, err := parseExpressionWithLevel(l, c, 2)
 			if err != nil {
 				return nil, err
@@ -485,10 +485,8 @@ func parseExpressionWithLevel(l *Lexer, c *Compiler, level int) (value.Value, er
 			switch ch {
 			case '*':
 				left = c.builder.NewMul(left, right)
-			case '/':
-				left = c.builder.NewSDiv(left, right)
-			case '%':
-				left = c.builder.NewSRem(left, right)
+			case '/', '%':
+				left = c.divide(ch, left, right, opPos)
 			}
 			handled = true
 			continue
@@ -631,6 +629,10 @@ func parsePostfix(l *Lexer, c *Compiler) (value.Value, bool, error) {
 		return nil, false, err
 	}
 
+	// A vector with a known size, indexed under -fbounds-check
+	vecName := c.indexed
+	c.indexed = ""
+
 	for {
 		if err := l.Whitespace(); err != nil {
 			return nil, false, err
@@ -658,6 +660,7 @@ func parsePostfix(l *Lexer, c *Compiler) (value.Value, bool, error) {
 			ptr := c.builder.NewIntToPtr(val, c.WordPtrType())
 
 			// Parse index
+			indexPos := l.Pos()
 			index, err := parseExpressionWithLevel(l, c, 15)
 			if err != nil {
 				return nil, false, err
@@ -665,6 +668,10 @@ func parsePostfix(l *Lexer, c *Compiler) (value.Value, bool, error) {
 			if err := l.ExpectChar(']', "expect ']' after array index"); err != nil {
 				return nil, false, err
 			}
+			if vec := c.vectorNamed(vecName); vec != nil && c.args.BoundsCheck {
+				c.checkBounds(vecName, vec, val, index, indexPos)
+			}
+			vecName = ""
 
 			// Calculate element address using getelementptr
 			// This automatically scales by element size (i64 = 8 bytes)
@@ -674,7 +681,9 @@ func parsePostfix(l *Lexer, c *Compiler) (value.Value, bool, error) {
 
 		case '(':
 			// Function call - handle both direct and indirect calls
+			vecName = ""
 			var fn value.Value
+			callPos := l.Pos()
 
 			if isLvalue {
 				// It's a function pointer variable (from extrn declaration)
@@ -722,11 +731,30 @@ func parsePostfix(l *Lexer, c *Compiler) (value.Value, bool, error) {
 			// Perform the call
 			var result value.Value
 			if fnDirect, ok := fn.(*ir.Func); ok {
+				c.CheckFormatCall(callPos, fnDirect, args)
+
+				// An external routine called without arguments gets a zero
+				// word, so that optional arguments (as in exit()) read as 0
+				if len(args) == 0 && fnDirect.Sig.Variadic && len(fnDirect.Params) == 0 && len(fnDirect.Blocks) == 0 {
+					args = append(args, constant.NewInt(c.WordType(), 0))
+				}
+				// Likewise a missing fixed argument is a zero word
+				for len(args) < len(fnDirect.Params) {
+					args = append(args, constant.NewInt(c.WordType(), 0))
+				}
+
 				// Direct call to known function
-				// If the callee is declared fully variadic with zero fixed params,
-				// specify one fixed argument type at the call site to ensure proper
-				// calling convention on platforms like arm64.
-				if fnDirect.Sig != nil && fnDirect.Sig.Variadic && len(fnDirect.Params) == 0 && len(args) >= 1 {
+				if callee := c.fixedCallee(fnDirect); callee != nil {
+					// Its parameters are known: one word for each, zero
+					// when missing; extra arguments are dropped
+					for len(args) < len(callee.Params) {
+						args = append(args, constant.NewInt(c.WordType(), 0))
+					}
+					result = c.builder.NewCall(callee, args[:len(callee.Params)]...)
+				} else if fnDirect.Sig != nil && fnDirect.Sig.Variadic && len(fnDirect.Params) == 0 && len(args) >= 1 {
+					// If the callee is declared fully variadic with zero fixed params,
+					// specify one fixed argument type at the call site to ensure proper
+					// calling convention on platforms like arm64.
 					// Build a variadic function type with the first argument as a fixed param
 					firstArgType := args[0].Type()
 					fnType := types.NewFunc(c.WordType(), firstArgType)
@@ -734,8 +762,10 @@ func parsePostfix(l *Lexer, c *Compiler) (value.Value, bool, error) {
 					fnPtrType := types.NewPointer(fnType)
 					// Bitcast the direct function symbol to the new pointer-to-function type
 					casted := c.builder.NewBitCast(fnDirect, fnPtrType)
+					c.passArgCount(len(args))
 					result = c.builder.NewCall(casted, args...)
 				} else {
+					c.passArgCount(len(args))
 					result = c.builder.NewCall(fnDirect, args...)
 				}
 			} else {
@@ -748,6 +778,11 @@ func parsePostfix(l *Lexer, c *Compiler) (value.Value, bool, error) {
 				// For B language functions, they are typically variadic with the first parameter as fixed
 				// Create a single, global variadic function type to avoid va_start declaration conflicts
 				var fnType *types.FuncType
+				if len(args) == 0 && c.args.IsWasm() {
+					// WebAssembly checks the signature of indirect calls:
+					// pass a zero word, as to an external routine
+					args = append(args, constant.NewInt(c.WordType(), 0))
+				}
 				if len(args) >= 1 {
 					// Create variadic function type with the first argument as a fixed parameter
 					// This matches the B language semantics where functions are variadic
@@ -761,6 +796,7 @@ func parsePostfix(l *Lexer, c *Compiler) (value.Value, bool, error) {
 				fnPtr := c.builder.NewIntToPtr(fnAddr, fnPtrType)
 
 				// Call through the pointer
+				c.passArgCount(len(args))
 				result = c.builder.NewCall(fnPtr, args...)
 			}
 			val = result
@@ -877,6 +913,7 @@ func parsePrimary(l *Lexer, c *Compiler) (value.Value, bool, error) {
 		if err != nil {
 			return nil, false, err
 		}
+		pos := l.Pos()
 
 		// Peek ahead to see if this is a function call
 		if err := l.Whitespace(); err != nil {
@@ -892,11 +929,13 @@ func parsePrimary(l *Lexer, c *Compiler) (value.Value, bool, error) {
 		if isCall {
 			// Check for a declared function in module
 			if fn := c.findFuncByName(name); fn != nil {
+				c.reference(name, RefCall, pos)
 				return fn, false, nil
 			}
 
 			// Check extrn variable in CURRENT context only
 			if gVal, ok := c.globals[name]; ok {
+				c.reference(name, RefIndirectCall, pos)
 				return gVal, true, nil
 			}
 
@@ -905,6 +944,7 @@ func parsePrimary(l *Lexer, c *Compiler) (value.Value, bool, error) {
 			if fn == nil {
 				return nil, false, fmt.Errorf("cannot declare function '%s'", name)
 			}
+			c.reference(name, RefCall, pos)
 			return fn, false, nil
 		}
 
@@ -912,6 +952,10 @@ func parsePrimary(l *Lexer, c *Compiler) (value.Value, bool, error) {
 		addr, found := c.GetAddress(name)
 		if found {
 			// It's a variable known in current context; return as lvalue
+			if _, local := c.locals[name]; !local {
+				c.reference(name, RefUse, pos)
+			}
+			c.indexed = name
 			return addr, true, nil
 		}
 
@@ -931,10 +975,12 @@ func parsePrimary(l *Lexer, c *Compiler) (value.Value, bool, error) {
 		// Otherwise, allow using a function symbol as a value (address)
 		// if such function is known or can be auto-declared
 		if fn := c.findFuncByName(name); fn != nil {
+			c.reference(name, RefAddress, pos)
 			fnPtr := c.builder.NewPtrToInt(fn, c.WordType())
 			return fnPtr, false, nil
 		}
 		if fn := c.GetOrDeclareFunction(name); fn != nil {
+			c.reference(name, RefAddress, pos)
 			fnPtr := c.builder.NewPtrToInt(fn, c.WordType())
 			return fnPtr, false, nil
 		}
@@ -0,0 +1,1051 @@
+package compiler
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/llir/llvm/ir"
+	"github.com/llir/llvm/ir/constant"
+	"github.com/llir/llvm/ir/enum"
+	"github.com/llir/llvm/ir/types"
+	"github.com/llir/llvm/ir/value"
+)
+
+// Memory layout of the interpreter. Addresses below nullGuard are never
+// mapped, so that null pointer accesses are caught. The stack comes next and
+// grows downwards, with locals laid out as in compiled code. Globals and the
+// heap follow the stack and grow upwards with sbrk().
+// Functions get addresses of their own, far above any memory. Each call
+// takes a frame of two words, as the return address and frame pointer
+// of compiled code, besides its locals; with -fstack-check functions
+// stop short of the last stackMargin bytes.
+const (
+	nullGuard   = 0x10000
+	stackSize   = 8 << 20
+	callFrame   = 16
+	stackMargin = 64 << 10
+	heapLimit   = 1 << 31
+	funcBase    = 0x7f0000000000
+	funcAlign   = 16
+)
+
+// Interp executes the LLVM IR produced by the compiler directly, without
+// clang and the runtime library. Memory is a flat array of bytes holding
+// 64-bit little-endian words, as on the targets of the compiled path.
+type Interp struct {
+	Stdin  io.Reader // input of read(), getstr() and nread(0, ...)
+	Stdout io.Writer // file descriptor 1
+	Stderr io.Writer // file descriptor 2
+	Env    []string  // environment strings for getenv()
+
+	args     *CompileOptions
+	mem      []byte // whole address space, starting at address 0
+	sp       int64  // stack pointer, grows downwards
+	brk      int64  // end of globals and heap
+	in       *bufio.Reader
+	out      *bufio.Writer
+	globals  map[string]int64     // global name -> address
+	sizes    map[string]int64     // global name -> size of its storage
+	private  map[*ir.Global]int64 // addresses of module-private globals (strings)
+	funcs    map[string]*interpFunc
+	byAddr   map[int64]*interpFunc
+	handlers []int64        // functions registered with atexit()
+	coverage []int64        // descriptors of counters registered by b..cov
+	profile  *interpProfile // calls counted by b..prof.enter, nil until the first
+	environ  int64          // vector of environment strings
+
+	// State of getvec() and rlsevec()
+	freelist  int64
+	arenaNext int64
+	arenaEnd  int64
+}
+
+// interpFunc is a function known to the interpreter: either a definition
+// from a loaded module or a built-in routine of the runtime library.
+type interpFunc struct {
+	name    string
+	addr    int64
+	def     *ir.Func
+	code    *funcCode
+	builtin func(in *Interp, args []int64) int64
+}
+
+// funcCode is a function body translated into closures.
+type funcCode struct {
+	nslots int   // number of SSA values
+	params []int // slots of the parameters
+	entry  *blockCode
+}
+
+// blockCode is a translated basic block.
+type blockCode struct {
+	phis  []phiCode
+	insts []func(f *frame)
+	term  func(f *frame) (*blockCode, int64)
+}
+
+// phiCode selects a value by the block the control came from.
+type phiCode struct {
+	slot  int
+	preds []*blockCode
+	vals  []operand
+}
+
+// frame holds the state of one function activation.
+type frame struct {
+	vals     []int64
+	args     []int64
+	nextArg  int         // index of the next argument returned by va_arg
+	tail     *interpFunc // callee of a musttail call, made after return
+	tailArgs []int64
+}
+
+// operand is either an SSA value (slot >= 0) or a constant.
+type operand struct {
+	slot int
+	k    int64
+}
+
+func (o operand) get(f *frame) int64 {
+	if o.slot < 0 {
+		return o.k
+	}
+	return f.vals[o.slot]
+}
+
+// interpFault is a run-time error of the interpreted program.
+type interpFault struct {
+	msg string
+}
+
+func (e *interpFault) Error() string {
+	return e.msg
+}
+
+// interpExit unwinds the interpreter when the program terminates.
+type interpExit struct {
+	status int64
+}
+
+func (e *interpExit) Error() string {
+	return fmt.Sprintf("exit status %d", e.status&0xff)
+}
+
+// faultf stops the program with a run-time error.
+func faultf(format string, args ...interface{}) {
+	panic(&interpFault{msg: fmt.Sprintf(format, args...)})
+}
+
+// NewInterp creates an interpreter with empty memory and the built-in
+// routines of the runtime library.
+func NewInterp(args *CompileOptions) *Interp {
+	in := &Interp{
+		Stdin:   os.Stdin,
+		Stdout:  os.Stdout,
+		Stderr:  os.Stderr,
+		Env:     os.Environ(),
+		args:    args,
+		mem:     make([]byte, nullGuard+stackSize),
+		sp:      nullGuard + stackSize,
+		brk:     nullGuard + stackSize,
+		globals: make(map[string]int64),
+		sizes:   make(map[string]int64),
+		private: make(map[*ir.Global]int64),
+		funcs:   make(map[string]*interpFunc),
+		byAddr:  make(map[int64]*interpFunc),
+	}
+	in.registerBuiltins()
+	return in
+}
+
+// catch converts the termination of the program into results.
+func (in *Interp) catch(status *int, err *error) {
+	r := recover()
+	switch e := r.(type) {
+	case nil:
+	case *interpExit:
+		*status = int(e.status & 0xff)
+	case *interpFault:
+		*err = e
+	default:
+		panic(r)
+	}
+	in.flush()
+}
+
+// Load adds the globals and functions of a compiled module. Globals with
+// the same name share storage, a later non-zero initializer wins; a later
+// function definition replaces an earlier one.
+func (in *Interp) Load(m *ir.Module) (err error) {
+	var status int
+	defer in.catch(&status, &err)
+
+	// Allocate storage first, so that initializers may refer to any global.
+	var inits []*ir.Global
+	for _, g := range m.Globals {
+		if g.Init == nil {
+			continue
+		}
+		size := sizeOf(g.ContentType)
+		if g.Linkage == enum.LinkagePrivate {
+			in.private[g] = in.alloc(size)
+			inits = append(inits, g)
+			continue
+		}
+		name := g.Name()
+		addr, ok := in.globals[name]
+		if ok && size <= in.sizes[name] {
+			if isZeroConst(g.Init) {
+				continue
+			}
+		} else {
+			newAddr := in.alloc(size)
+			if ok {
+				// Grow the storage; translated code refers to the old address.
+				copy(in.mem[newAddr:], in.mem[addr:addr+in.sizes[name]])
+				in.invalidate()
+			}
+			in.globals[name] = newAddr
+			in.sizes[name] = size
+		}
+		inits = append(inits, g)
+	}
+	for _, g := range inits {
+		in.storeConst(in.globalAddr(g), g.Init)
+	}
+
+	for _, f := range m.Funcs {
+		fn := in.function(f.Name())
+		if len(f.Blocks) > 0 {
+			fn.def = f
+			fn.code = nil
+		}
+	}
+	return nil
+}
+
+// invalidate discards all translated code, to be redone on next call.
+func (in *Interp) invalidate() {
+	for _, fn := range in.funcs {
+		fn.code = nil
+	}
+}
+
+// function returns the function with the given name, creating
+// an entry with a fresh address when the name is new.
+func (in *Interp) function(name string) *interpFunc {
+	if fn, ok := in.funcs[name]; ok {
+		return fn
+	}
+	fn := &interpFunc{
+		name: name,
+		addr: funcBase + int64(len(in.funcs))*funcAlign,
+	}
+	in.funcs[name] = fn
+	in.byAddr[fn.addr] = fn
+	return fn
+}
+
+// Undefined returns the names of functions which are referenced
+// but neither defined in a loaded module nor built in.
+func (in *Interp) Undefined() []string {
+	var names []string
+	for name, fn := range in.funcs {
+		if fn.def == nil && fn.builtin == nil && !strings.HasPrefix(name, "llvm.") {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Run calls main() with the given command line arguments, the first of
+// them being the program name, and returns the exit status.
+func (in *Interp) Run(argv []string) (status int, err error) {
+	if undef := in.Undefined(); len(undef) > 0 {
+		return 0, fmt.Errorf("undefined reference to '%s'", strings.Join(undef, "', '"))
+	}
+	main, ok := in.funcs["main"]
+	if !ok || main.def == nil {
+		return 0, fmt.Errorf("undefined reference to 'main'")
+	}
+	defer in.catch(&status, &err)
+
+	in.setupArgs(argv)
+	ret := in.callB(main, []int64{in.loadWord(in.globals[in.args.GlobalPrefix+"argv"])})
+	in.exit(ret)
+	return 0, nil
+}
+
+// Call invokes a function by name and returns its result. A run-time error
+// or the termination of the program by exit() is returned as an error;
+// the interpreter remains usable afterwards.
+func (in *Interp) Call(name string, args ...int64) (result int64, err error) {
+	fn, ok := in.funcs[name]
+	if !ok || (fn.def == nil && fn.builtin == nil) {
+		return 0, fmt.Errorf("undefined reference to '%s'", name)
+	}
+	sp := in.sp
+	defer func() {
+		in.sp = sp
+		switch e := recover().(type) {
+		case nil:
+		case *interpExit:
+			err = e
+		case *interpFault:
+			err = e
+		default:
+			panic(e)
+		}
+		in.flush()
+	}()
+	return in.callB(fn, args), nil
+}
+
+// callB invokes a function from Go, passing the number of arguments
+// as a call compiled from B does, for the thunk of a B function.
+func (in *Interp) callB(fn *interpFunc, args []int64) int64 {
+	in.storeWord(in.globals[in.args.GlobalPrefix+argCount], int64(len(args)))
+	return in.call(fn, args)
+}
+
+// setupArgs places the arguments and environment in memory,
+// as the startup code of the runtime library does.
+func (in *Interp) setupArgs(argv []string) {
+	vec := in.alloc(int64(len(argv)+1) * 8)
+	in.storeWord(vec, int64(len(argv)))
+	for i, arg := range argv {
+		in.storeWord(vec+int64(i+1)*8, in.allocString(arg))
+	}
+	in.storeWord(in.globals[in.args.GlobalPrefix+"argv"], vec)
+
+	in.environ = in.alloc(int64(len(in.Env)+1) * 8)
+	for i, s := range in.Env {
+		in.storeWord(in.environ+int64(i)*8, in.allocString(s))
+	}
+}
+
+// call invokes a function with the given arguments.
+func (in *Interp) call(fn *interpFunc, args []int64) int64 {
+	if fn.def == nil {
+		if fn.builtin != nil {
+			return fn.builtin(in, args)
+		}
+		faultf("undefined reference to '%s'", fn.name)
+	}
+	if fn.code == nil {
+		fn.code = in.translate(fn.def)
+	}
+	return in.exec(fn.code, args)
+}
+
+// callAddr invokes a function by its address.
+func (in *Interp) callAddr(addr int64, args []int64) int64 {
+	fn, ok := in.byAddr[addr]
+	if !ok {
+		faultf("segmentation fault: call to invalid address %#x", addr)
+	}
+	return in.call(fn, args)
+}
+
+// exec runs a translated function body. A musttail call at its end
+// runs in its place, so that tail recursion takes no stack.
+func (in *Interp) exec(fc *funcCode, args []int64) int64 {
+	sp := in.sp
+	for {
+		ret, f := in.run(fc, args)
+		in.sp = sp
+		if f.tail == nil {
+			return ret
+		}
+		if f.tail.def == nil {
+			return in.call(f.tail, f.tailArgs)
+		}
+		if f.tail.code == nil {
+			f.tail.code = in.translate(f.tail.def)
+		}
+		fc, args = f.tail.code, f.tailArgs
+	}
+}
+
+// run runs a translated function body, and returns its result and frame.
+func (in *Interp) run(fc *funcCode, args []int64) (int64, *frame) {
+	f := &frame{vals: make([]int64, fc.nslots), args: args}
+	for i, slot := range fc.params {
+		if i < len(args) {
+			f.vals[slot] = args[i]
+		}
+	}
+	in.stackAlloc(callFrame)
+	var prev *blockCode
+	for b := fc.entry; ; {
+		if len(b.phis) > 0 {
+			enterBlock(f, prev, b)
+		}
+		for _, inst := range b.insts {
+			inst(f)
+		}
+		next, ret := b.term(f)
+		if next == nil {
+			return ret, f
+		}
+		prev, b = b, next
+	}
+}
+
+// enterBlock assigns the phi nodes of block b reached from block prev.
+// All incoming values are read before any of them is assigned.
+func enterBlock(f *frame, prev, b *blockCode) {
+	vals := make([]int64, len(b.phis))
+	for i, phi := range b.phis {
+		for j, pred := range phi.preds {
+			if pred == prev {
+				vals[i] = phi.vals[j].get(f)
+				break
+			}
+		}
+	}
+	for i, phi := range b.phis {
+		f.vals[phi.slot] = vals[i]
+	}
+}
+
+// exit runs the handlers registered with atexit() in reverse order
+// and terminates the program.
+func (in *Interp) exit(status int64) {
+	for len(in.handlers) > 0 {
+		f := in.handlers[len(in.handlers)-1]
+		in.handlers = in.handlers[:len(in.handlers)-1]
+		in.storeWord(in.globals[in.args.GlobalPrefix+argCount], 0)
+		in.callAddr(f, nil)
+	}
+	in.writeCoverage()
+	in.writeProfile()
+	panic(&interpExit{status: status})
+}
+
+//
+// Memory
+//
+
+// alloc reserves zeroed memory at the end of the address space.
+func (in *Interp) alloc(size int64) int64 {
+	addr := in.brk
+	in.brk += (size + 7) &^ 7
+	if in.brk > int64(len(in.mem)) {
+		n := 2 * int64(len(in.mem))
+		if n < in.brk {
+			n = in.brk
+		}
+		mem := make([]byte, n)
+		copy(mem, in.mem)
+		in.mem = mem
+	}
+	return addr
+}
+
+// allocString places a NUL-terminated copy of s in memory.
+func (in *Interp) allocString(s string) int64 {
+	addr := in.alloc(int64(len(s)) + 1)
+	copy(in.mem[addr:], s)
+	return addr
+}
+
+// check verifies that size bytes at addr are accessible.
+func (in *Interp) check(addr, size int64) {
+	if addr < nullGuard || addr > int64(len(in.mem))-size {
+		faultf("segmentation fault: invalid address %#x", addr)
+	}
+}
+
+func (in *Interp) loadWord(addr int64) int64 {
+	in.check(addr, 8)
+	return int64(binary.LittleEndian.Uint64(in.mem[addr:]))
+}
+
+func (in *Interp) storeWord(addr, v int64) {
+	in.check(addr, 8)
+	binary.LittleEndian.PutUint64(in.mem[addr:], uint64(v))
+}
+
+// load reads a zero-extended integer of 1, 2, 4 or 8 bytes.
+func (in *Interp) load(addr, size int64) int64 {
+	in.check(addr, size)
+	switch size {
+	case 1:
+		return int64(in.mem[addr])
+	case 2:
+		return int64(binary.LittleEndian.Uint16(in.mem[addr:]))
+	case 4:
+		return int64(binary.LittleEndian.Uint32(in.mem[addr:]))
+	default:
+		return int64(binary.LittleEndian.Uint64(in.mem[addr:]))
+	}
+}
+
+// store writes the low size bytes of v.
+func (in *Interp) store(addr, size, v int64) {
+	in.check(addr, size)
+	switch size {
+	case 1:
+		in.mem[addr] = byte(v)
+	case 2:
+		binary.LittleEndian.PutUint16(in.mem[addr:], uint16(v))
+	case 4:
+		binary.LittleEndian.PutUint32(in.mem[addr:], uint32(v))
+	default:
+		binary.LittleEndian.PutUint64(in.mem[addr:], uint64(v))
+	}
+}
+
+// sizeOf returns the size of a type in memory.
+func sizeOf(t types.Type) int64 {
+	switch t := t.(type) {
+	case *types.IntType:
+		return int64(t.BitSize+7) / 8
+	case *types.PointerType:
+		return 8
+	case *types.ArrayType:
+		return int64(t.Len) * sizeOf(t.ElemType)
+	default:
+		faultf("unsupported type %s", t)
+		return 0
+	}
+}
+
+// bitSize returns the width of an integer type, or 64 for pointers.
+func bitSize(t types.Type) uint64 {
+	if it, ok := t.(*types.IntType); ok {
+		return it.BitSize
+	}
+	return 64
+}
+
+// truncBits keeps the low bits of v; values narrower than
+// a word are kept zero-extended.
+func truncBits(v int64, bits uint64) int64 {
+	if bits >= 64 {
+		return v
+	}
+	return v & (1<<bits - 1)
+}
+
+// signExtend converts a zero-extended value of the given width to signed.
+func signExtend(v int64, bits uint64) int64 {
+	if bits >= 64 {
+		return v
+	}
+	shift := 64 - bits
+	return v << shift >> shift
+}
+
+//
+// Constants
+//
+
+// globalAddr returns the address of a global variable.
+func (in *Interp) globalAddr(g *ir.Global) int64 {
+	if addr, ok := in.private[g]; ok {
+		return addr
+	}
+	addr, ok := in.globals[g.Name()]
+	if !ok {
+		faultf("undefined reference to '%s'", g.Name())
+	}
+	return addr
+}
+
+// constValue evaluates a scalar constant.
+func (in *Interp) constValue(c constant.Constant) int64 {
+	switch c := c.(type) {
+	case *constant.Int:
+		return truncBits(c.X.Int64(), c.Typ.BitSize)
+	case *constant.Null, *constant.ZeroInitializer, *constant.Undef:
+		return 0
+	case *ir.Global:
+		return in.globalAddr(c)
+	case *ir.Func:
+		return in.function(c.Name()).addr
+	case *constant.Index:
+		return in.constValue(c.Constant)
+	case *constant.ExprGetElementPtr:
+		addr := in.constValue(c.Src)
+		gepScales(c.ElemType, len(c.Indices), func(i int, scale int64) {
+			addr += in.constValue(c.Indices[i]) * scale
+		})
+		return addr
+	case *constant.ExprPtrToInt:
+		return in.constValue(c.From)
+	case *constant.ExprIntToPtr:
+		return in.constValue(c.From)
+	case *constant.ExprBitCast:
+		return in.constValue(c.From)
+	default:
+		faultf("unsupported constant %s", c)
+		return 0
+	}
+}
+
+// storeConst writes the initializer of a global to memory.
+func (in *Interp) storeConst(addr int64, c constant.Constant) {
+	switch c := c.(type) {
+	case *constant.Array:
+		size := sizeOf(c.Typ.ElemType)
+		for i, elem := range c.Elems {
+			in.storeConst(addr+int64(i)*size, elem)
+		}
+	case *constant.CharArray:
+		in.check(addr, int64(len(c.X)))
+		copy(in.mem[addr:], c.X)
+	case *constant.ZeroInitializer:
+		in.check(addr, sizeOf(c.Typ))
+		for i := int64(0); i < sizeOf(c.Typ); i++ {
+			in.mem[addr+i] = 0
+		}
+	default:
+		in.store(addr, sizeOf(c.Type()), in.constValue(c))
+	}
+}
+
+// isZeroConst reports whether an initializer is all zeros.
+func isZeroConst(c constant.Constant) bool {
+	switch c := c.(type) {
+	case *constant.Int:
+		return c.X.Sign() == 0
+	case *constant.ZeroInitializer, *constant.Null:
+		return true
+	case *constant.Array:
+		for _, elem := range c.Elems {
+			if !isZeroConst(elem) {
+				return false
+			}
+		}
+		return true
+	default:
+		return false
+	}
+}
+
+// gepScales calls fn with the byte scale of each getelementptr index.
+func gepScales(elem types.Type, nindices int, fn func(i int, scale int64)) {
+	t := elem
+	for i := 0; i < nindices; i++ {
+		if i > 0 {
+			at, ok := t.(*types.ArrayType)
+			if !ok {
+				faultf("unsupported getelementptr into %s", t)
+			}
+			t = at.ElemType
+		}
+		fn(i, sizeOf(t))
+	}
+}
+
+//
+// Translation of function bodies
+//
+
+// translator holds the state of translating one function.
+type translator struct {
+	in     *Interp
+	fn     *ir.Func
+	slots  map[value.Value]int
+	blocks map[*ir.Block]*blockCode
+}
+
+// translate converts a function definition into closures.
+func (in *Interp) translate(fn *ir.Func) *funcCode {
+	t := &translator{
+		in:     in,
+		fn:     fn,
+		slots:  make(map[value.Value]int),
+		blocks: make(map[*ir.Block]*blockCode),
+	}
+	fc := &funcCode{}
+	for _, p := range fn.Params {
+		fc.params = append(fc.params, t.slot(p))
+	}
+	for _, b := range fn.Blocks {
+		t.blocks[b] = &blockCode{}
+		for _, inst := range b.Insts {
+			if v, ok := inst.(value.Value); ok && !types.Equal(v.Type(), types.Void) {
+				t.slot(v)
+			}
+		}
+	}
+	for _, b := range fn.Blocks {
+		bc := t.blocks[b]
+		for _, inst := range b.Insts {
+			if phi, ok := inst.(*ir.InstPhi); ok {
+				pc := phiCode{slot: t.slots[phi]}
+				for _, inc := range phi.Incs {
+					pc.preds = append(pc.preds, t.blocks[inc.Pred.(*ir.Block)])
+					pc.vals = append(pc.vals, t.operand(inc.X))
+				}
+				bc.phis = append(bc.phis, pc)
+				continue
+			}
+			bc.insts = append(bc.insts, t.inst(inst))
+		}
+		bc.term = t.term(b.Term)
+	}
+	fc.nslots = len(t.slots)
+	fc.entry = t.blocks[fn.Blocks[0]]
+	return fc
+}
+
+func (t *translator) slot(v value.Value) int {
+	if s, ok := t.slots[v]; ok {
+		return s
+	}
+	s := len(t.slots)
+	t.slots[v] = s
+	return s
+}
+
+func (t *translator) operand(v value.Value) operand {
+	if s, ok := t.slots[v]; ok {
+		return operand{slot: s}
+	}
+	if c, ok := v.(constant.Constant); ok {
+		return operand{slot: -1, k: t.in.constValue(c)}
+	}
+	faultf("%s: unsupported operand %s", t.fn.Name(), v.Ident())
+	return operand{}
+}
+
+// inst translates a non-terminator instruction.
+func (t *translator) inst(inst ir.Instruction) func(f *frame) {
+	in := t.in
+	switch inst := inst.(type) {
+	case *ir.InstAlloca:
+		dst := t.slots[inst]
+		size := sizeOf(inst.ElemType)
+		if inst.NElems != nil {
+			n := t.operand(inst.NElems)
+			return func(f *frame) { f.vals[dst] = in.stackAlloc(size * n.get(f)) }
+		}
+		return func(f *frame) { f.vals[dst] = in.stackAlloc(size) }
+
+	case *ir.InstLoad:
+		dst, src := t.slots[inst], t.operand(inst.Src)
+		size := sizeOf(inst.ElemType)
+		if size == 8 {
+			return func(f *frame) { f.vals[dst] = in.loadWord(src.get(f)) }
+		}
+		return func(f *frame) { f.vals[dst] = in.load(src.get(f), size) }
+
+	case *ir.InstStore:
+		src, ptr := t.operand(inst.Src), t.operand(inst.Dst)
+		size := sizeOf(inst.Src.Type())
+		if size == 8 {
+			return func(f *frame) { in.storeWord(ptr.get(f), src.get(f)) }
+		}
+		return func(f *frame) { in.store(ptr.get(f), size, src.get(f)) }
+
+	case *ir.InstGetElementPtr:
+		dst, src := t.slots[inst], t.operand(inst.Src)
+		var offset int64
+		var idx []operand
+		var scales []int64
+		gepScales(inst.ElemType, len(inst.Indices), func(i int, scale int64) {
+			op := t.operand(inst.Indices[i])
+			if op.slot < 0 {
+				offset += op.k * scale
+			} else {
+				idx = append(idx, op)
+				scales = append(scales, scale)
+			}
+		})
+		if len(idx) == 1 {
+			x, scale := idx[0], scales[0]
+			return func(f *frame) { f.vals[dst] = src.get(f) + offset + x.get(f)*scale }
+		}
+		return func(f *frame) {
+			addr := src.get(f) + offset
+			for i, x := range idx {
+				addr += x.get(f) * scales[i]
+			}
+			f.vals[dst] = addr
+		}
+
+	case *ir.InstPtrToInt:
+		return t.unary(inst, inst.From, func(v int64) int64 { return v })
+	case *ir.InstIntToPtr:
+		return t.unary(inst, inst.From, func(v int64) int64 { return v })
+	case *ir.InstBitCast:
+		return t.unary(inst, inst.From, func(v int64) int64 { return v })
+	case *ir.InstZExt:
+		return t.unary(inst, inst.From, func(v int64) int64 { return v })
+	case *ir.InstSExt:
+		from, to := bitSize(inst.From.Type()), bitSize(inst.To)
+		return t.unary(inst, inst.From, func(v int64) int64 { return truncBits(signExtend(v, from), to) })
+	case *ir.InstTrunc:
+		to := bitSize(inst.To)
+		return t.unary(inst, inst.From, func(v int64) int64 { return truncBits(v, to) })
+
+	case *ir.InstAdd:
+		return t.binary(inst, inst.X, inst.Y, false, func(a, b int64) int64 { return a + b })
+	case *ir.InstSub:
+		return t.binary(inst, inst.X, inst.Y, false, func(a, b int64) int64 { return a - b })
+	case *ir.InstMul:
+		return t.binary(inst, inst.X, inst.Y, false, func(a, b int64) int64 { return a * b })
+	case *ir.InstSDiv:
+		return t.binary(inst, inst.X, inst.Y, true, func(a, b int64) int64 {
+			if b == 0 {
+				faultf("floating point exception: division by zero")
+			}
+			return a / b
+		})
+	case *ir.InstSRem:
+		return t.binary(inst, inst.X, inst.Y, true, func(a, b int64) int64 {
+			if b == 0 {
+				faultf("floating point exception: division by zero")
+			}
+			return a % b
+		})
+	case *ir.InstUDiv:
+		return t.binary(inst, inst.X, inst.Y, false, func(a, b int64) int64 {
+			if b == 0 {
+				faultf("floating point exception: division by zero")
+			}
+			return int64(uint64(a) / uint64(b))
+		})
+	case *ir.InstURem:
+		return t.binary(inst, inst.X, inst.Y, false, func(a, b int64) int64 {
+			if b == 0 {
+				faultf("floating point exception: division by zero")
+			}
+			return int64(uint64(a) % uint64(b))
+		})
+	case *ir.InstAnd:
+		return t.binary(inst, inst.X, inst.Y, false, func(a, b int64) int64 { return a & b })
+	case *ir.InstOr:
+		return t.binary(inst, inst.X, inst.Y, false, func(a, b int64) int64 { return a | b })
+	case *ir.InstXor:
+		return t.binary(inst, inst.X, inst.Y, false, func(a, b int64) int64 { return a ^ b })
+	case *ir.InstShl:
+		// Shift counts are taken modulo the word size, as the hardware does.
+		return t.binary(inst, inst.X, inst.Y, false, func(a, b int64) int64 { return a << (uint64(b) & 63) })
+	case *ir.InstAShr:
+		return t.binary(inst, inst.X, inst.Y, true, func(a, b int64) int64 { return a >> (uint64(b) & 63) })
+	case *ir.InstLShr:
+		return t.binary(inst, inst.X, inst.Y, false, func(a, b int64) int64 { return int64(uint64(a) >> (uint64(b) & 63)) })
+
+	case *ir.InstICmp:
+		dst, x, y := t.slots[inst], t.operand(inst.X), t.operand(inst.Y)
+		bits := bitSize(inst.X.Type())
+		var cmp func(a, b int64) bool
+		switch inst.Pred {
+		case enum.IPredEQ:
+			cmp = func(a, b int64) bool { return a == b }
+		case enum.IPredNE:
+			cmp = func(a, b int64) bool { return a != b }
+		case enum.IPredSLT:
+			cmp = func(a, b int64) bool { return signExtend(a, bits) < signExtend(b, bits) }
+		case enum.IPredSLE:
+			cmp = func(a, b int64) bool { return signExtend(a, bits) <= signExtend(b, bits) }
+		case enum.IPredSGT:
+			cmp = func(a, b int64) bool { return signExtend(a, bits) > signExtend(b, bits) }
+		case enum.IPredSGE:
+			cmp = func(a, b int64) bool { return signExtend(a, bits) >= signExtend(b, bits) }
+		case enum.IPredULT:
+			cmp = func(a, b int64) bool { return uint64(a) < uint64(b) }
+		case enum.IPredULE:
+			cmp = func(a, b int64) bool { return uint64(a) <= uint64(b) }
+		case enum.IPredUGT:
+			cmp = func(a, b int64) bool { return uint64(a) > uint64(b) }
+		case enum.IPredUGE:
+			cmp = func(a, b int64) bool { return uint64(a) >= uint64(b) }
+		default:
+			faultf("%s: unsupported comparison %s", t.fn.Name(), inst.Pred)
+		}
+		return func(f *frame) {
+			if cmp(x.get(f), y.get(f)) {
+				f.vals[dst] = 1
+			} else {
+				f.vals[dst] = 0
+			}
+		}
+
+	case *ir.InstSelect:
+		dst, cond := t.slots[inst], t.operand(inst.Cond)
+		x, y := t.operand(inst.ValueTrue), t.operand(inst.ValueFalse)
+		return func(f *frame) {
+			if cond.get(f) != 0 {
+				f.vals[dst] = x.get(f)
+			} else {
+				f.vals[dst] = y.get(f)
+			}
+		}
+
+	case *ir.InstVAArg:
+		dst := t.slots[inst]
+		return func(f *frame) {
+			// Missing arguments read as zero.
+			f.vals[dst] = 0
+			if f.nextArg < len(f.args) {
+				f.vals[dst] = f.args[f.nextArg]
+			}
+			f.nextArg++
+		}
+
+	case *ir.InstCall:
+		return t.call(inst)
+
+	default:
+		faultf("%s: unsupported instruction %s", t.fn.Name(), inst.LLString())
+		return nil
+	}
+}
+
+func (t *translator) unary(inst value.Value, x value.Value, op func(v int64) int64) func(f *frame) {
+	dst, a := t.slots[inst], t.operand(x)
+	return func(f *frame) { f.vals[dst] = op(a.get(f)) }
+}
+
+// binary translates an arithmetic instruction. Operands narrower than
+// a word are sign-extended first when the operation is signed.
+func (t *translator) binary(inst value.Value, x, y value.Value, signed bool, op func(a, b int64) int64) func(f *frame) {
+	dst, a, b := t.slots[inst], t.operand(x), t.operand(y)
+	bits := bitSize(inst.Type())
+	if bits >= 64 {
+		return func(f *frame) { f.vals[dst] = op(a.get(f), b.get(f)) }
+	}
+	return func(f *frame) {
+		va, vb := a.get(f), b.get(f)
+		if signed {
+			va, vb = signExtend(va, bits), signExtend(vb, bits)
+		}
+		f.vals[dst] = truncBits(op(va, vb), bits)
+	}
+}
+
+// call translates a call instruction.
+func (t *translator) call(inst *ir.InstCall) func(f *frame) {
+	in := t.in
+	dst := -1
+	if !types.Equal(inst.Type(), types.Void) {
+		dst = t.slots[inst]
+	}
+	args := make([]operand, len(inst.Args))
+	for i, arg := range inst.Args {
+		args[i] = t.operand(arg)
+	}
+	eval := func(f *frame) []int64 {
+		vals := make([]int64, len(args))
+		for i, arg := range args {
+			vals[i] = arg.get(f)
+		}
+		return vals
+	}
+	result := func(f *frame, v int64) {
+		if dst >= 0 {
+			f.vals[dst] = v
+		}
+	}
+
+	// Find a direct callee, possibly cast to another function type.
+	callee := inst.Callee
+	if cast, ok := callee.(*ir.InstBitCast); ok {
+		if fn, ok := cast.From.(*ir.Func); ok {
+			callee = fn
+		}
+	}
+	if cast, ok := callee.(*constant.ExprBitCast); ok {
+		if fn, ok := cast.From.(*ir.Func); ok {
+			callee = fn
+		}
+	}
+	if fn, ok := callee.(*ir.Func); ok {
+		switch name := fn.Name(); {
+		case name == "llvm.va_start":
+			nfixed := len(t.fn.Params)
+			return func(f *frame) { f.nextArg = nfixed }
+		case name == "llvm.va_end":
+			return func(f *frame) {}
+		case name == "llvm.stacksave":
+			return func(f *frame) { result(f, in.sp) }
+		case strings.HasPrefix(name, "llvm."):
+			faultf("%s: unsupported intrinsic %s", t.fn.Name(), name)
+		}
+		target := in.function(fn.Name())
+		if inst.Tail == enum.TailMustTail {
+			return func(f *frame) { f.tail, f.tailArgs = target, eval(f) }
+		}
+		return func(f *frame) { result(f, in.call(target, eval(f))) }
+	}
+
+	addr := t.operand(inst.Callee)
+	return func(f *frame) { result(f, in.callAddr(addr.get(f), eval(f))) }
+}
+
+// term translates a terminator. It returns the next block,
+// or nil and the result of the function.
+func (t *translator) term(term ir.Terminator) func(f *frame) (*blockCode, int64) {
+	switch term := term.(type) {
+	case *ir.TermRet:
+		if term.X == nil {
+			return func(f *frame) (*blockCode, int64) { return nil, 0 }
+		}
+		x := t.operand(term.X)
+		return func(f *frame) (*blockCode, int64) { return nil, x.get(f) }
+
+	case *ir.TermBr:
+		target := t.blocks[term.Target.(*ir.Block)]
+		return func(f *frame) (*blockCode, int64) { return target, 0 }
+
+	case *ir.TermCondBr:
+		cond := t.operand(term.Cond)
+		yes := t.blocks[term.TargetTrue.(*ir.Block)]
+		no := t.blocks[term.TargetFalse.(*ir.Block)]
+		return func(f *frame) (*blockCode, int64) {
+			if cond.get(f) != 0 {
+				return yes, 0
+			}
+			return no, 0
+		}
+
+	case *ir.TermSwitch:
+		x := t.operand(term.X)
+		def := t.blocks[term.TargetDefault.(*ir.Block)]
+		cases := make(map[int64]*blockCode)
+		for _, c := range term.Cases {
+			k := t.in.constValue(c.X.(constant.Constant))
+			if _, dup := cases[k]; !dup {
+				cases[k] = t.blocks[c.Target.(*ir.Block)]
+			}
+		}
+		return func(f *frame) (*blockCode, int64) {
+			if b, ok := cases[x.get(f)]; ok {
+				return b, 0
+			}
+			return def, 0
+		}
+
+	case *ir.TermUnreachable:
+		name := t.fn.Name()
+		return func(f *frame) (*blockCode, int64) {
+			faultf("%s: reached unreachable code", name)
+			return nil, 0
+		}
+
+	default:
+		faultf("%s: unsupported terminator %s", t.fn.Name(), term.LLString())
+		return nil
+	}
+}
+
+// stackAlloc reserves memory on the stack of the current function.
+func (in *Interp) stackAlloc(size int64) int64 {
+	in.sp -= (size + 7) &^ 7
+	if in.sp < nullGuard {
+		faultf("segmentation fault: stack overflow")
+	}
+	return in.sp
+}
@@ -0,0 +1,817 @@
+package compiler
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Built-in routines of the interpreter. They mirror the C sources of the
+// runtime library in runtime/, including their treatment of missing or
+// unusual arguments, so that programs behave the same in both modes.
+
+const (
+	maxHandlers = 32   // size of the atexit() table
+	arenaChunk  = 8192 // words requested from sbrk() by getvec()
+	errBadFile  = -9   // -EBADF, as returned by a failing system call
+)
+
+// Conversion flags of printf().
+const (
+	fmtLeft = 1 // left-justify within the field
+	fmtZero = 2 // pad numbers with zeros instead of blanks
+)
+
+// registerBuiltins defines the routines and globals of the runtime library.
+func (in *Interp) registerBuiltins() {
+	builtins := map[string]func(in *Interp, args []int64) int64{
+		"atexit":  bAtexit,
+		"atoi":    bAtoi,
+		"char":    bChar,
+		"compare": bCompare,
+		"concat":  bConcat,
+		"exit":    bExit,
+		"flush":   bFlush,
+		"getarg":  bGetarg,
+		"getenv":  bGetenv,
+		"getstr":  bGetstr,
+		"getvec":  bGetvec,
+		"itoa":    bItoa,
+		"lchar":   bLchar,
+		"length":  bLength,
+		"nread":   bNread,
+		"nwrite":  bNwrite,
+		"printd":  bPrintd,
+		"printf":  bPrintf,
+		"printo":  bPrinto,
+		"putstr":  bPutstr,
+		"read":    bRead,
+		"rlsevec": bRlsevec,
+		"sbrk":    bSbrk,
+		"write":   bWrite,
+		"writeb":  bWriteb,
+
+		boundsHandler: bBounds,
+		trapHandler:   bTrap,
+		coverHandler:  bCov,
+		profEnter:     bProfEnter,
+		profLeave:     bProfLeave,
+	}
+	for name, f := range builtins {
+		in.function(in.args.GlobalPrefix + name).builtin = f
+	}
+	for _, name := range []string{"argv", "fout", stackLimit, argCount} {
+		name = in.args.GlobalPrefix + name
+		in.globals[name] = in.alloc(8)
+		in.sizes[name] = 8
+	}
+	// Room is left below the limit for the report of an overflow
+	in.storeWord(in.globals[in.args.GlobalPrefix+stackLimit], nullGuard+stackMargin)
+}
+
+// arg returns the i-th argument of a call, or zero when it is missing.
+func arg(args []int64, i int) int64 {
+	if i < len(args) {
+		return args[i]
+	}
+	return 0
+}
+
+//
+// Input and output
+//
+
+func (in *Interp) stdin() *bufio.Reader {
+	if in.in == nil {
+		in.in = bufio.NewReader(in.Stdin)
+	}
+	return in.in
+}
+
+func (in *Interp) stdout() *bufio.Writer {
+	if in.out == nil {
+		in.out = bufio.NewWriter(in.Stdout)
+	}
+	return in.out
+}
+
+// flush writes any buffered output.
+func (in *Interp) flush() {
+	if in.out != nil {
+		in.out.Flush()
+	}
+}
+
+// writeFile writes bytes to a file descriptor, as the write system call.
+func (in *Interp) writeFile(fd int64, p []byte) int64 {
+	switch fd {
+	case 1:
+		n, _ := in.stdout().Write(p)
+		return int64(n)
+	case 2:
+		in.flush()
+		n, _ := in.Stderr.Write(p)
+		return int64(n)
+	default:
+		return errBadFile
+	}
+}
+
+// readFile reads bytes from a file descriptor, as the read system call.
+func (in *Interp) readFile(fd int64, p []byte) int64 {
+	if fd != 0 {
+		return errBadFile
+	}
+	in.flush()
+	n, _ := in.stdin().Read(p)
+	return int64(n)
+}
+
+// output writes to the current output unit, selected by fout.
+func (in *Interp) output(p []byte) {
+	fout := in.loadWord(in.globals[in.args.GlobalPrefix+"fout"])
+	in.writeFile(fout+1, p)
+}
+
+// bytes returns a slice of memory, checking its bounds.
+func (in *Interp) bytes(addr, n int64) []byte {
+	if n <= 0 {
+		return nil
+	}
+	in.check(addr, n)
+	return in.mem[addr : addr+n]
+}
+
+// char returns the i-th character of a string, as a signed byte.
+func (in *Interp) char(s, i int64) int64 {
+	in.check(s+i, 1)
+	return int64(int8(in.mem[s+i]))
+}
+
+// strlen returns the length of a NUL-terminated string.
+func (in *Interp) strlen(s int64) int64 {
+	n := int64(0)
+	for in.char(s, n) != 0 {
+		n++
+	}
+	return n
+}
+
+func bChar(in *Interp, args []int64) int64 {
+	return in.char(arg(args, 0), arg(args, 1))
+}
+
+func bLchar(in *Interp, args []int64) int64 {
+	in.store(arg(args, 0)+arg(args, 1), 1, arg(args, 2))
+	return 0
+}
+
+func bRead(in *Interp, args []int64) int64 {
+	var c [1]byte
+	if in.readFile(0, c[:]) != 1 {
+		return 4 // ETX
+	}
+	if c[0] > 0 && c[0] <= 127 {
+		return int64(c[0])
+	}
+	return 0
+}
+
+func bNread(in *Interp, args []int64) int64 {
+	return in.readFile(arg(args, 0), in.bytes(arg(args, 1), arg(args, 2)))
+}
+
+func bWrite(in *Interp, args []int64) int64 {
+	var buf []byte
+	input := uint64(arg(args, 0))
+	for n := 0; n < 8; n, input = n+1, input<<8 {
+		b := byte(input >> 56)
+		if b != 0 || len(buf) > 0 || n == 7 {
+			buf = append(buf, b)
+		}
+	}
+	in.output(buf)
+	return 0
+}
+
+func bWriteb(in *Interp, args []int64) int64 {
+	in.output([]byte{byte(arg(args, 0))})
+	return 0
+}
+
+func bNwrite(in *Interp, args []int64) int64 {
+	return in.writeFile(arg(args, 0), in.bytes(arg(args, 1), arg(args, 2)))
+}
+
+func bFlush(in *Interp, args []int64) int64 {
+	in.flush()
+	return 0
+}
+
+//
+// Formatted output
+//
+
+// convertDigits converts an unsigned value to the given base
+func convertDigits(value uint64, base uint64) []byte {
+	var digits []byte
+	for {
+		digits = append(digits, "0123456789abcdef"[value%base])
+		value /= base
+		if value == 0 {
+			break
+		}
+	}
+	for i, j := 0, len(digits)-1; i < j; i, j = i+1, j-1 {
+		digits[i], digits[j] = digits[j], digits[i]
+	}
+	return digits
+}
+
+// formatField appends a converted field after the given number of
+// leading zeros, justified within width. The sign, if any, is written
+// before the zero padding.
+func formatField(out []byte, sign string, zeros int64, p []byte, width int64, flags int) []byte {
+	zeros = max(zeros, 0)
+	gap := width - int64(len(p)) - int64(len(sign)) - zeros
+	pad := func(n int64, c byte) {
+		for i := int64(0); i < n; i++ {
+			out = append(out, c)
+		}
+	}
+	if flags&fmtLeft == 0 && flags&fmtZero == 0 {
+		pad(gap, ' ')
+	}
+	out = append(out, sign...)
+	if flags&fmtLeft == 0 && flags&fmtZero != 0 {
+		pad(gap, '0')
+	}
+	pad(zeros, '0')
+	out = append(out, p...)
+	if flags&fmtLeft != 0 {
+		pad(gap, ' ')
+	}
+	return out
+}
+
+// formatNumber appends a value converted to the given base, with at
+// least prec digits
+func formatNumber(out []byte, sign string, value uint64, base uint64, prec, width int64, flags int) []byte {
+	p := convertDigits(value, base)
+	return formatField(out, sign, prec-int64(len(p)), p, width, flags)
+}
+
+func bPrintf(in *Interp, args []int64) int64 {
+	format := arg(args, 0)
+	next := 1
+	nextArg := func() int64 {
+		next++
+		return arg(args, next-1)
+	}
+
+	var out []byte
+	i := int64(0)
+	for {
+		// Copy text up to the next percent sign.
+		start := i
+		c := in.char(format, i)
+		for c != '%' && c != 0 {
+			i++
+			c = in.char(format, i)
+		}
+		out = append(out, in.bytes(format+start, i-start)...)
+		if c == 0 {
+			break
+		}
+
+		// Parse flags, width and precision.
+		start = i
+		i++
+		flags, width, prec := 0, int64(0), int64(-1)
+		for ; ; i++ {
+			c = in.char(format, i)
+			if c == '-' {
+				flags |= fmtLeft
+			} else if c == '0' {
+				flags |= fmtZero
+			} else {
+				break
+			}
+		}
+		for c = in.char(format, i); c >= '0' && c <= '9'; c = in.char(format, i) {
+			width = width*10 + c - '0'
+			i++
+		}
+		if c == '.' {
+			prec = 0
+			for {
+				i++
+				c = in.char(format, i)
+				if c < '0' || c > '9' {
+					break
+				}
+				prec = prec*10 + c - '0'
+			}
+		}
+		if c != 0 {
+			i++
+		}
+
+		switch c {
+		case 'd':
+			x := nextArg()
+			if x < 0 {
+				out = formatNumber(out, "-", -uint64(x), 10, prec, width, flags)
+			} else {
+				out = formatNumber(out, "", uint64(x), 10, prec, width, flags)
+			}
+		case 'u':
+			out = formatNumber(out, "", uint64(nextArg()), 10, prec, width, flags)
+		case 'o':
+			out = formatNumber(out, "", uint64(nextArg()), 8, prec, width, flags)
+		case 'x':
+			out = formatNumber(out, "", uint64(nextArg()), 16, prec, width, flags)
+		case 'b':
+			out = formatNumber(out, "", uint64(nextArg()), 2, prec, width, flags)
+		case 'c':
+			// Character constant, big-endian packed.
+			x := uint64(nextArg())
+			var buf [8]byte
+			p := len(buf)
+			for {
+				p--
+				buf[p] = byte(x)
+				x >>= 8
+				if x == 0 {
+					break
+				}
+			}
+			out = formatField(out, "", 0, buf[p:], width, flags&fmtLeft)
+		case 's':
+			x := nextArg()
+			j := int64(0)
+			for in.char(x, j) != 0 && (prec < 0 || j < prec) {
+				j++
+			}
+			out = formatField(out, "", 0, in.bytes(x, j), width, flags&fmtLeft)
+		case '%':
+			out = append(out, '%')
+		default:
+			// Unknown format: print it verbatim.
+			out = append(out, in.bytes(format+start, i-start)...)
+		}
+		if c == 0 {
+			break
+		}
+	}
+	in.output(out)
+	return 0
+}
+
+func bPrintd(in *Interp, args []int64) int64 {
+	n := arg(args, 0)
+	if n < 0 {
+		in.output(append([]byte{'-'}, convertDigits(-uint64(n), 10)...))
+	} else {
+		in.output(convertDigits(uint64(n), 10))
+	}
+	return 0
+}
+
+func bPrinto(in *Interp, args []int64) int64 {
+	in.output(convertDigits(uint64(arg(args, 0)), 8))
+	return 0
+}
+
+//
+// Memory allocation
+//
+
+func bSbrk(in *Interp, args []int64) int64 {
+	return in.sbrk(arg(args, 0))
+}
+
+// sbrk extends the heap by incr bytes, rounded up to whole words.
+func (in *Interp) sbrk(incr int64) int64 {
+	incr = (incr + 7) &^ 7
+	if incr < 0 || in.brk+incr > heapLimit {
+		return -1
+	}
+	return in.alloc(incr)
+}
+
+// takeFree finds a released block of at least nwords words.
+func (in *Interp) takeFree(nwords int64) int64 {
+	prev := int64(0) // zero stands for the list head
+	for p := in.freelist; p != 0; prev, p = p, in.loadWord(p+8) {
+		size := in.loadWord(p)
+		if size < nwords {
+			continue
+		}
+		next := in.loadWord(p + 8)
+		if size >= nwords+2 {
+			tail := p + 8*(1+nwords)
+			in.storeWord(tail, size-nwords-1)
+			in.storeWord(tail+8, next)
+			in.storeWord(p, nwords)
+			next = tail
+		}
+		if prev == 0 {
+			in.freelist = next
+		} else {
+			in.storeWord(prev+8, next)
+		}
+		return p
+	}
+	return 0
+}
+
+// takeArena carves a block of nwords words from the arena.
+func (in *Interp) takeArena(nwords int64) int64 {
+	need := nwords + 1
+	if (in.arenaEnd-in.arenaNext)/8 < need {
+		chunk := need
+		if chunk < arenaChunk {
+			chunk = arenaChunk
+		}
+		addr := in.sbrk(chunk * 8)
+		if addr == -1 {
+			return 0
+		}
+		if addr != in.arenaEnd && (in.arenaEnd-in.arenaNext)/8 >= 2 {
+			in.storeWord(in.arenaNext, (in.arenaEnd-in.arenaNext)/8-1)
+			bRlsevec(in, []int64{in.arenaNext + 8})
+		}
+		if addr != in.arenaEnd {
+			in.arenaNext = addr
+		}
+		in.arenaEnd = addr + chunk*8
+	}
+	p := in.arenaNext
+	in.arenaNext = p + need*8
+	in.storeWord(p, nwords)
+	return p
+}
+
+func bGetvec(in *Interp, args []int64) int64 {
+	n := arg(args, 0)
+	if n < 0 {
+		return 0
+	}
+	p := in.takeFree(n + 1)
+	if p == 0 {
+		p = in.takeArena(n + 1)
+		if p == 0 {
+			return 0
+		}
+	}
+	for i := int64(1); i <= in.loadWord(p); i++ {
+		in.storeWord(p+8*i, 0)
+	}
+	return p + 8
+}
+
+func bRlsevec(in *Interp, args []int64) int64 {
+	v := arg(args, 0)
+	if v == 0 {
+		return 0
+	}
+	p := v - 8
+	in.storeWord(p+8, in.freelist)
+	in.freelist = p
+	return 0
+}
+
+//
+// Strings and numbers
+//
+
+func bLength(in *Interp, args []int64) int64 {
+	return in.strlen(arg(args, 0))
+}
+
+func bConcat(in *Interp, args []int64) int64 {
+	a, s1, s2 := arg(args, 0), arg(args, 1), arg(args, 2)
+	n := in.strlen(s1)
+	if a != s1 {
+		for i := int64(0); i < n; i++ {
+			in.store(a+i, 1, in.char(s1, i))
+		}
+	}
+	for i := int64(0); ; i++ {
+		c := in.char(s2, i)
+		in.store(a+n+i, 1, c)
+		if c == 0 {
+			break
+		}
+	}
+	return a
+}
+
+func bCompare(in *Interp, args []int64) int64 {
+	p, q := arg(args, 0), arg(args, 1)
+	for in.char(p, 0) != 0 && in.char(p, 0) == in.char(q, 0) {
+		p++
+		q++
+	}
+	return in.load(p, 1) - in.load(q, 1)
+}
+
+func bGetstr(in *Interp, args []int64) int64 {
+	s := arg(args, 0)
+	n := int64(0)
+	for {
+		c := bRead(in, nil)
+		if c == '\n' {
+			break
+		}
+		if c == 4 {
+			if n == 0 {
+				in.store(s, 1, 0)
+				return 0
+			}
+			break
+		}
+		in.store(s+n, 1, c)
+		n++
+	}
+	in.store(s+n, 1, 0)
+	return s
+}
+
+func bPutstr(in *Interp, args []int64) int64 {
+	s := arg(args, 0)
+	in.output(in.bytes(s, in.strlen(s)))
+	return s
+}
+
+func bAtoi(in *Interp, args []int64) int64 {
+	p := arg(args, 0)
+	value := uint64(0)
+	negative := false
+	for in.char(p, 0) == ' ' || in.char(p, 0) == '\t' {
+		p++
+	}
+	if c := in.char(p, 0); c == '-' || c == '+' {
+		negative = c == '-'
+		p++
+	}
+	for c := in.char(p, 0); c >= '0' && c <= '9'; c = in.char(p, 0) {
+		value = value*10 + uint64(c-'0')
+		p++
+	}
+	if negative {
+		return -int64(value)
+	}
+	return int64(value)
+}
+
+func bItoa(in *Interp, args []int64) int64 {
+	n, s, base := arg(args, 0), arg(args, 1), arg(args, 2)
+	if base < 2 || base > 16 {
+		base = 10
+	}
+	dst := s
+	value := uint64(n)
+	if base == 10 && n < 0 {
+		value = -value
+		in.store(dst, 1, '-')
+		dst++
+	}
+	digits := convertDigits(value, uint64(base))
+	for _, c := range digits {
+		in.store(dst, 1, int64(c))
+		dst++
+	}
+	in.store(dst, 1, 0)
+	return s
+}
+
+func bGetarg(in *Interp, args []int64) int64 {
+	s, p, i := arg(args, 0), arg(args, 1), arg(args, 2)
+	blank := func(c int64) bool { return c == ' ' || c == '\t' }
+	for {
+		for blank(in.char(p, 0)) {
+			p++
+		}
+		if in.char(p, 0) == 0 {
+			in.store(s, 1, 0)
+			return 0
+		}
+		if i == 0 {
+			break
+		}
+		i--
+		for c := in.char(p, 0); c != 0 && !blank(c); c = in.char(p, 0) {
+			p++
+		}
+	}
+	dst := s
+	for c := in.char(p, 0); c != 0 && !blank(c); c = in.char(p, 0) {
+		in.store(dst, 1, c)
+		dst++
+		p++
+	}
+	in.store(dst, 1, 0)
+	return s
+}
+
+func bGetenv(in *Interp, args []int64) int64 {
+	key := arg(args, 0)
+	if in.environ == 0 {
+		return 0
+	}
+	for env := in.environ; in.loadWord(env) != 0; env += 8 {
+		p := in.loadWord(env)
+		i := int64(0)
+		for in.char(key, i) != 0 && in.char(key, i) == in.char(p, i) {
+			i++
+		}
+		if in.char(key, i) == 0 && in.char(p, i) == '=' {
+			return p + i + 1
+		}
+	}
+	return 0
+}
+
+//
+// Program termination
+//
+
+func bAtexit(in *Interp, args []int64) int64 {
+	if len(in.handlers) >= maxHandlers {
+		return -1
+	}
+	in.handlers = append(in.handlers, arg(args, 0))
+	return 0
+}
+
+func bExit(in *Interp, args []int64) int64 {
+	in.exit(arg(args, 0))
+	return 0
+}
+
+// bCov registers the counters of a file compiled with --coverage,
+// which are written at exit.
+func bCov(in *Interp, args []int64) int64 {
+	desc := arg(args, 0)
+	if in.loadWord(desc) != 0 {
+		return 0
+	}
+	in.storeWord(desc, 1)
+	in.coverage = append(in.coverage, desc)
+	return 0
+}
+
+// writeCoverage appends the stamp, the number and the counters of each
+// registered file to its file of counts, as a line of text.
+func (in *Interp) writeCoverage() {
+	for _, desc := range in.coverage {
+		name := string(in.bytes(in.loadWord(desc+8), in.strlen(in.loadWord(desc+8))))
+		line := fmt.Sprintf("%d %d", in.loadWord(desc+16), in.loadWord(desc+24))
+		counts := in.loadWord(desc + 32)
+		for i := int64(0); i < in.loadWord(desc+24); i++ {
+			line += fmt.Sprintf(" %d", in.loadWord(counts+i*8))
+		}
+		f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err == nil {
+			_, err = f.WriteString(line + "\n")
+			f.Close()
+		}
+		if err != nil {
+			in.writeFile(2, []byte("cannot write coverage counts to "+name+"\n"))
+		}
+	}
+	in.coverage = nil
+}
+
+// interpProfile is the state of profiling, kept as by the runtime
+// library: the records are updated in memory, the ticks are
+// nanoseconds since the first call.
+type interpProfile struct {
+	start   time.Time
+	records []int64                // in order of registration
+	arcs    map[[2]int64]*[3]int64 // caller and callee -> calls, ticks and calls in progress
+	order   [][2]int64             // arcs in order of the first call
+	stack   []profFrame
+}
+
+// profFrame is a call in progress.
+type profFrame struct {
+	rec, start, child int64
+	arc               *[3]int64 // nil for the first call
+}
+
+// bProfEnter counts the call of a function compiled with -p, whose
+// record is the argument.
+func bProfEnter(in *Interp, args []int64) int64 {
+	rec := arg(args, 0)
+	p := in.profile
+	if p == nil {
+		p = &interpProfile{start: time.Now(), arcs: map[[2]int64]*[3]int64{}}
+		in.profile = p
+	}
+	if in.loadWord(rec) == 0 {
+		in.storeWord(rec, 1)
+		p.records = append(p.records, rec)
+	}
+	in.storeWord(rec+16, in.loadWord(rec+16)+1)
+	in.storeWord(rec+40, in.loadWord(rec+40)+1)
+
+	f := profFrame{rec: rec}
+	if n := len(p.stack); n > 0 {
+		key := [2]int64{p.stack[n-1].rec, rec}
+		f.arc = p.arcs[key]
+		if f.arc == nil {
+			f.arc = new([3]int64)
+			p.arcs[key] = f.arc
+			p.order = append(p.order, key)
+		}
+		f.arc[0]++
+		f.arc[2]++
+	}
+	f.start = time.Since(p.start).Nanoseconds()
+	p.stack = append(p.stack, f)
+	return 0
+}
+
+// bProfLeave ends the last call counted by bProfEnter.
+func bProfLeave(in *Interp, args []int64) int64 {
+	if in.profile != nil && len(in.profile.stack) > 0 {
+		in.popProfile(time.Since(in.profile.start).Nanoseconds())
+	}
+	return 0
+}
+
+// popProfile ends the last call in progress at the given time: the
+// ticks are added to the function and to the arc, unless they are
+// still in progress further down, and to the time of the caller in its
+// callees.
+func (in *Interp) popProfile(now int64) {
+	p := in.profile
+	f := p.stack[len(p.stack)-1]
+	p.stack = p.stack[:len(p.stack)-1]
+
+	elapsed := now - f.start
+	in.storeWord(f.rec+24, in.loadWord(f.rec+24)+elapsed-f.child)
+	active := in.loadWord(f.rec+40) - 1
+	in.storeWord(f.rec+40, active)
+	if active == 0 {
+		in.storeWord(f.rec+32, in.loadWord(f.rec+32)+elapsed)
+	}
+	if f.arc != nil {
+		if f.arc[2]--; f.arc[2] == 0 {
+			f.arc[1] += elapsed
+		}
+	}
+	if n := len(p.stack); n > 0 {
+		p.stack[n-1].child += elapsed
+	}
+}
+
+// writeProfile ends the calls in progress and writes the profile to
+// bmon.out, in the format of the runtime library.
+func (in *Interp) writeProfile() {
+	p := in.profile
+	if p == nil {
+		return
+	}
+	now := time.Since(p.start).Nanoseconds()
+	for len(p.stack) > 0 {
+		in.popProfile(now)
+	}
+	str := func(s int64) string { return string(in.bytes(s, in.strlen(s))) }
+	var b strings.Builder
+	fmt.Fprintf(&b, "rate %d\n", time.Second.Nanoseconds())
+	for _, rec := range p.records {
+		fmt.Fprintf(&b, "f %s %d %d %d\n", str(in.loadWord(rec+8)),
+			in.loadWord(rec+16), in.loadWord(rec+24), in.loadWord(rec+32))
+	}
+	for _, key := range p.order {
+		arc := p.arcs[key]
+		fmt.Fprintf(&b, "a %s %s %d %d\n", str(in.loadWord(key[0]+8)), str(in.loadWord(key[1]+8)), arc[0], arc[1])
+	}
+	if err := os.WriteFile(ProfileFile, []byte(b.String()), 0644); err != nil {
+		in.writeFile(2, []byte("cannot write profile to "+ProfileFile+"\n"))
+	}
+	in.profile = nil
+}
+
+// bBounds reports an index out of the range of a vector, as checked
+// by code compiled with -fbounds-check.
+func bBounds(in *Interp, args []int64) int64 {
+	str := func(s int64) string { return string(in.bytes(s, in.strlen(s))) }
+	faultf("%s: in %s(): index %d out of range of vector %s[%d]",
+		str(arg(args, 0)), str(arg(args, 1)), arg(args, 3), str(arg(args, 2)), arg(args, 4))
+	return 0
+}
+
+// bTrap reports a division without result, as checked by code
+// compiled with -ftrapv.
+func bTrap(in *Interp, args []int64) int64 {
+	str := func(s int64) string { return string(in.bytes(s, in.strlen(s))) }
+	faultf("%s: in %s(): %s", str(arg(args, 0)), str(arg(args, 1)), str(arg(args, 2)))
+	return 0
+}
@@ -0,0 +1,210 @@
+package compiler
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+)
+
+// interpretFiles runs B source files with the interpreter and
+// returns stdout, the exit status and the error, if any.
+func interpretFiles(t *testing.T, files []string, input string, argv ...string) (string, int, error) {
+	t.Helper()
+	args := NewCompileOptions("blang", files)
+	interp := NewInterp(args)
+	var stdout bytes.Buffer
+	interp.Stdin = strings.NewReader(input)
+	interp.Stdout = &stdout
+	interp.Env = []string{"HOME=/home/b"}
+	for _, file := range files {
+		module, err := ParseFile(args, file)
+		if err != nil {
+			t.Fatalf("ParseFile(%s) failed: %v", file, err)
+		}
+		if err := interp.Load(module); err != nil {
+			t.Fatalf("Load(%s) failed: %v", file, err)
+		}
+	}
+	status, err := interp.Run(append([]string{"prog"}, argv...))
+	return stdout.String(), status, err
+}
+
+// TestInterpExamples runs the example programs with the interpreter
+func TestInterpExamples(t *testing.T) {
+	tests := []struct {
+		name       string
+		inputFile  string
+		wantStdout string
+	}{
+		{"hello_write", "../examples/hello.b", "Hello, World!"},
+		{"hello_printf", "../examples/helloworld.b", "Hello, World!"},
+		{"example_fibonacci", "../examples/fibonacci.b", "55\n"},
+		{"example_fizzbuzz", "../examples/fizzbuzz.b", "FizzBuzz"},
+		{"example_showcase", "../examples/showcase.b", "Fibonacci(10) = 55"},
+		{"example_e2", "../examples/e-2.b", "71828 18284 59045 23536 02874"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, status, err := interpretFiles(t, []string{tt.inputFile}, "")
+			if err != nil {
+				t.Fatalf("Run failed: %v", err)
+			}
+			if status != 0 {
+				t.Errorf("Exit code = %d, want 0", status)
+			}
+			if !strings.Contains(got, tt.wantStdout) {
+				t.Errorf("Stdout = %q, want substring %q", got, tt.wantStdout)
+			}
+		})
+	}
+}
+
+// TestInterpPDP7CompilerB runs the PDP-7 B compiler on its own source
+// and compares the result with the expected PDP-7 code
+func TestInterpPDP7CompilerB(t *testing.T) {
+	src, err := os.ReadFile("../examples/b.b")
+	if err != nil {
+		t.Fatalf("Failed to read file: %v", err)
+	}
+	want, err := os.ReadFile("../examples/b.pdp7")
+	if err != nil {
+		t.Fatalf("Failed to read file: %v", err)
+	}
+	got, _, err := interpretFiles(t, []string{"../examples/b.b"}, string(src))
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if got != string(want) {
+		t.Errorf("output mismatch (-want +got):\n%s", buildLineDiff(string(want), got))
+	}
+}
+
+// TestInterpInput tests read() and getstr() on the interpreter's standard input
+func TestInterpInput(t *testing.T) {
+	const readProg = `main() {
+    auto c;
+    while ((c = read()) != 4)
+        printf("%d ", c);
+    printf("EOF=%d*n", c);
+}`
+	got, _, err := interpretFromCode(t, "read_prog", readProg, "AB\xc3\x04C", nil)
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if want := "65 66 0 EOF=4\n"; got != want {
+		t.Errorf("read: got %q, want %q", got, want)
+	}
+
+	const getstrProg = `main() {
+    auto line[10];
+    while (getstr(line))
+        printf("<%s> %d*n", line, length(line));
+}`
+	got, _, err = interpretFromCode(t, "getstr_prog", getstrProg, "first line\n\nlast", nil)
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if want := "<first line> 10\n<> 0\n<last> 4\n"; got != want {
+		t.Errorf("getstr: got %q, want %q", got, want)
+	}
+}
+
+// TestInterpArgs tests arguments, environment and the exit status
+func TestInterpArgs(t *testing.T) {
+	dir := t.TempDir()
+	file := writeTempFile(t, dir, "args.b", `main(argv) {
+    extrn argv;
+    auto i;
+    i = 1;
+    while (i <= argv[0]) {
+        printf("%d: %s*n", i, argv[i]);
+        i++;
+    }
+    printf("HOME=%s missing=%d*n", getenv("HOME"), getenv("NO_SUCH_VARIABLE"));
+    return (argv[0] + 256);
+}`)
+	got, status, err := interpretFiles(t, []string{file}, "", "one", "two words")
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	want := "1: prog\n2: one\n3: two words\nHOME=/home/b missing=0\n"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if status != 3 {
+		t.Errorf("exit code = %d, want 3", status)
+	}
+}
+
+// TestInterpExit tests exit() and the handlers registered with atexit()
+func TestInterpExit(t *testing.T) {
+	code := `first() { printf("first*n"); }
+second() { printf("second*n"); exit(9); }
+main() {
+    atexit(first);
+    atexit(second);
+    exit(5);
+    printf("not reached*n");
+}`
+	got, status, err := interpretFromCode(t, "exit_prog", code, "", nil)
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if want := "second\nfirst\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if status != 9 {
+		t.Errorf("exit code = %d, want 9", status)
+	}
+}
+
+// TestInterpMultipleFiles tests functions and globals shared between files
+func TestInterpMultipleFiles(t *testing.T) {
+	dir := t.TempDir()
+	main := writeTempFile(t, dir, "main.b", `main() {
+    extrn counter, table;
+    bump(); bump();
+    printf("%d %d %s*n", counter, table[2], "main");
+}`)
+	lib := writeTempFile(t, dir, "lib.b", `counter 40;
+table[3] 7, 8, 9;
+bump() {
+    extrn counter;
+    counter++;
+    printf("%s ", "lib");
+}`)
+	got, _, err := interpretFiles(t, []string{main, lib}, "")
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if want := "lib lib 42 9 main\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+// TestInterpFaults tests run-time errors of interpreted programs
+func TestInterpFaults(t *testing.T) {
+	tests := []struct {
+		name    string
+		code    string
+		wantErr string
+	}{
+		{"null_pointer", `main() { auto p; p = 0; return (*p); }`, "invalid address 0x0"},
+		{"division_by_zero", `main() { auto z; z = 0; return (1 / z); }`, "division by zero"},
+		{"bad_call", `fp 12345; main() { extrn fp; fp(); }`, "call to invalid address"},
+		{"recursion", `f(n) { return (f(n + 1) + 1); } main() { f(0); }`, "stack overflow"},
+		{"undefined", `main() { nosuch(); }`, "undefined reference to 'b.nosuch'"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := writeTempFile(t, t.TempDir(), tt.name+".b", tt.code)
+			_, _, err := interpretFiles(t, []string{file}, "")
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -1,7 +1,8 @@
-package main
+package compiler
 
 import (
 	"fmt"
+	"slices"
 
 	"github.com/llir/llvm/ir"
 	"github.com/llir/llvm/ir/constant"
@@ -29,13 +30,34 @@ type Compiler struct {
 	functionTypes map[string]*types.FuncType // signature -> function type
 	// Names that have been used as functions (call sites), for cross-decl collision checks
 	usedAsFunction map[string]bool
+	// Warnings collected while compiling
+	warnings []Diagnostic
+	// Extents of the vectors, for -fbounds-check
+	localVectors  map[string]*vector
+	globalVectors map[*ir.Global]*vector
+	indexed       string // name of the variable just parsed, which may be indexed
+	// Execution counters, for --coverage
+	counters     []counter
+	coverCounts  *ir.Global // array of the counters
+	coverDesc    *ir.Global // descriptor passed to the runtime
+	coveredBlock *ir.Block  // block and line of the last counter
+	coveredLine  int
+	// Records of the functions, for -p
+	profRecords map[string]*ir.Global
+	// Bodies with fixed parameters of the functions defined in the module
+	bodies map[*ir.Func]*ir.Func
+	// B names of the functions declared, and of their bodies
+	funcNames map[*ir.Func]string
+	// Blocks returning the result of a call, in the current function
+	tailCalls []*ir.Block
 }
 
 // globalName returns the fully qualified global symbol name, applying the
 // configured prefix except for special cases like the program entry point
-// ("main") and private names that already start with a dot.
+// ("main") and private names that already start with a dot. In a hosted
+// program main() belongs to the C library, which calls b.main.
 func (c *Compiler) globalName(name string) string {
-	if name == "main" {
+	if name == "main" && !c.args.IsHosted() {
 		return name
 	}
 	return c.args.GlobalPrefix + name
@@ -43,9 +65,14 @@ func (c *Compiler) globalName(name string) string {
 
 // NewCompiler creates a new compiler structure
 func NewCompiler(args *CompileOptions) *Compiler {
+	module := ir.NewModule()
+	if t, ok := llvmTargets[args.Target]; ok {
+		module.TargetTriple = t.triple
+		module.DataLayout = t.dataLayout
+	}
 	return &Compiler{
 		args:           args,
-		module:         ir.NewModule(),
+		module:         module,
 		locals:         make(map[string]value.Value),
 		globals:        make(map[string]value.Value),
 		functions:      make(map[string]*ir.Func),
@@ -54,6 +81,11 @@ func NewCompiler(args *CompileOptions) *Compiler {
 		functionParams: make(map[string][]string),
 		functionTypes:  make(map[string]*types.FuncType),
 		usedAsFunction: make(map[string]bool),
+		localVectors:   make(map[string]*vector),
+		globalVectors:  make(map[*ir.Global]*vector),
+		profRecords:    make(map[string]*ir.Global),
+		bodies:         make(map[*ir.Func]*ir.Func),
+		funcNames:      make(map[*ir.Func]string),
 	}
 }
 
@@ -108,6 +140,20 @@ func (c *Compiler) GetModule() *ir.Module {
 	return c.module
 }
 
+// Warnf records a warning at the given source position
+func (c *Compiler) Warnf(pos Pos, format string, args ...interface{}) {
+	c.warnings = append(c.warnings, Diagnostic{
+		Severity: SeverityWarning,
+		Pos:      pos,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// Warnings returns the warnings collected so far
+func (c *Compiler) Warnings() []Diagnostic {
+	return c.warnings
+}
+
 // WordType returns the B word type (i64)
 func (c *Compiler) WordType() *types.IntType {
 	return types.I64
@@ -182,6 +228,7 @@ func (c *Compiler) DeclareGlobalArray(name string, size int64, init []constant.C
 
 		global := c.module.NewGlobalDef(c.globalName(name), constant.NewArray(wrapperType, ptrAsInt))
 		c.globals[name] = global
+		c.globalVectors[global] = &vector{data: ptrAsInt, size: size}
 		return global
 	}
 
@@ -216,12 +263,33 @@ func (c *Compiler) DeclareGlobalArray(name string, size int64, init []constant.C
 	global.Init = constant.NewArray(arrayType, initVals...)
 
 	c.globals[name] = global
+	c.globalVectors[global] = &vector{data: ptrAsInt, size: size}
 	return global
 }
 
-// DeclareFunction declares a function
+// DeclareFunction declares a function and returns the function to
+// build its body in.
+//
+// A function with parameters has two parts. Its body is an internal
+// function taking one word per parameter, which callers that know it
+// call directly, with missing arguments as zero words. The symbol of
+// the function is variadic with one fixed word, as any routine of the
+// runtime: a thunk, called through pointers, from other files and from
+// C, which takes the arguments from its va_list and calls the body.
+// The caller stores the number of its arguments in b..nargs, and the
+// thunk passes zero words for those missing, as a direct call does.
+// A function without parameters needs no thunk, as it is not variadic,
+// except on WebAssembly where it has an unused word. On the PDP-11
+// arguments are on the stack, and the function is still a single
+// variadic one.
 func (c *Compiler) DeclareFunction(name string, paramNames []string) *ir.Func {
 	// Remove any prior function with the same name from the module to enforce no-context
+	if prior := c.findFuncByName(name); prior != nil {
+		if body, ok := c.bodies[prior]; ok {
+			c.module.Funcs = slices.DeleteFunc(c.module.Funcs, func(f *ir.Func) bool { return f == body })
+			delete(c.bodies, prior)
+		}
+	}
 	c.removeFuncByName(name)
 
 	// Store original parameter names for later use in StartFunction
@@ -229,7 +297,12 @@ func (c *Compiler) DeclareFunction(name string, paramNames []string) *ir.Func {
 
 	// B language semantics: functions with parameters are variadic with one fixed parameter
 	var fn *ir.Func
-	if len(paramNames) == 0 {
+	if len(paramNames) == 0 && c.args.IsWasm() {
+		// No parameters on WebAssembly: the signature of every function
+		// is the same, with an unused first word
+		fn = c.module.NewFunc(c.globalName(name), c.WordType(), ir.NewParam("", c.WordType()))
+		fn.Sig.Variadic = true
+	} else if len(paramNames) == 0 {
 		// No parameters: regular function
 		fn = c.module.NewFunc(c.globalName(name), c.WordType())
 	} else {
@@ -240,7 +313,96 @@ func (c *Compiler) DeclareFunction(name string, paramNames []string) *ir.Func {
 	}
 
 	c.functions[name] = fn
-	return fn
+	c.funcNames[fn] = name
+	if !fn.Sig.Variadic || c.args.Target == "pdp11" {
+		return fn
+	}
+
+	// A body with fixed parameters, and the thunk
+	var params []*ir.Param
+	for _, p := range paramNames {
+		params = append(params, ir.NewParam(p, c.WordType()))
+	}
+	body := c.module.NewFunc(".body."+name, c.WordType(), params...)
+	body.Linkage = enum.LinkageInternal
+	c.bodies[fn] = body
+	c.funcNames[body] = name
+
+	c.builder = fn.NewBlock("entry")
+	var args []value.Value
+	if len(paramNames) > 0 {
+		word := c.WordType()
+		nargs := c.builder.NewLoad(word, c.runtimeWord(argCount))
+		passed := func(v value.Value) {
+			given := c.builder.NewICmp(enum.IPredSGT, nargs, constant.NewInt(word, int64(len(args))))
+			args = append(args, c.builder.NewSelect(given, v, constant.NewInt(word, 0)))
+		}
+		passed(fn.Params[0])
+		if len(paramNames) > 1 {
+			c.readVarArgs(len(paramNames)-1, passed)
+		}
+	}
+	call := c.builder.NewCall(body, args...)
+	call.Tail = enum.TailTail
+	c.builder.NewRet(call)
+	c.builder = nil
+	return body
+}
+
+// argCount is the word of the runtime holding the number of arguments
+// of the last call to a function whose parameters are not known
+const argCount = ".nargs"
+
+// passArgCount stores the number of arguments of a call to a function
+// which may be the thunk of a B function, for the thunk to read
+func (c *Compiler) passArgCount(n int) {
+	if c.args.Target != "pdp11" {
+		c.builder.NewStore(constant.NewInt(c.WordType(), int64(n)), c.runtimeWord(argCount))
+	}
+}
+
+// readVarArgs reads n words from the variable arguments of the current
+// function, passing each to the given function.
+func (c *Compiler) readVarArgs(n int, use func(v value.Value)) {
+	// Allocate sufficiently large opaque buffer to hold platform va_list
+	// Use [48 x i8] which covers common ABIs (x86_64, aarch64, riscv64)
+	vaArrayType := types.NewArray(48, types.I8)
+	vaArrayAlloca := c.builder.NewAlloca(vaArrayType)
+	vaArrayAlloca.Align = 16
+	// Pointer to first element as i8* for intrinsics and va_arg
+	vaListPtr := c.builder.NewGetElementPtr(vaArrayType, vaArrayAlloca,
+		constant.NewInt(types.I32, 0),
+		constant.NewInt(types.I32, 0))
+
+	// Initialize va_list using llvm.va_start intrinsic
+	vaStartFunc := c.getOrCreateFunc("llvm.va_start")
+	c.builder.NewCall(vaStartFunc, vaListPtr)
+
+	for i := 0; i < n; i++ {
+		use(c.builder.NewVAArg(vaListPtr, c.WordType()))
+	}
+
+	// Clean up va_list using llvm.va_end intrinsic
+	vaEndFunc := c.getOrCreateFunc("llvm.va_end")
+	c.builder.NewCall(vaEndFunc, vaListPtr)
+}
+
+// currentName returns the B name of the function being compiled
+func (c *Compiler) currentName() string {
+	return c.funcNames[c.currentFn]
+}
+
+// fixedCallee returns the function to call directly for a function
+// with a known number of parameters, or nil: the body of a function
+// defined in the module, or a function which is not variadic.
+func (c *Compiler) fixedCallee(fn *ir.Func) *ir.Func {
+	if body, ok := c.bodies[fn]; ok {
+		return body
+	}
+	if !fn.Sig.Variadic {
+		return fn
+	}
+	return nil
 }
 
 // GetOrDeclareFunction gets an existing function or declares it as external
@@ -266,8 +428,14 @@ func (c *Compiler) GetOrDeclareFunction(name string) *ir.Func {
 	// Enforce no-context: remove any prior transient function of the same name from the module
 	c.removeFuncByName(name)
 
-	// Auto-declare as external variadic function in current context
-	fn := c.module.NewFunc(c.globalName(name), c.WordType())
+	// Auto-declare as external variadic function in current context;
+	// on WebAssembly with the first word fixed, as in the definition
+	var fn *ir.Func
+	if c.args.IsWasm() {
+		fn = c.module.NewFunc(c.globalName(name), c.WordType(), ir.NewParam("", c.WordType()))
+	} else {
+		fn = c.module.NewFunc(c.globalName(name), c.WordType())
+	}
 	fn.Sig.Variadic = true
 	c.functions[name] = fn
 	// Remember name was used as function
@@ -314,20 +482,16 @@ func (c *Compiler) ClearTopLevelContext() {
 func (c *Compiler) StartFunction(fn *ir.Func) {
 	c.currentFn = fn
 	c.locals = make(map[string]value.Value)
+	c.localVectors = make(map[string]*vector)
 	c.labels = make(map[string]*ir.Block)
 	c.builder = fn.NewBlock("entry")
-
-	// Get the function name to look up original parameters
-	var funcName string
-	for name, f := range c.functions {
-		if f == fn {
-			funcName = name
-			break
-		}
+	if c.args.sanitizes("address") {
+		fn.FuncAttrs = append(fn.FuncAttrs, enum.FuncAttrSanitizeAddress)
 	}
+	c.profileEnter()
 
 	// Get original parameter names
-	paramNames, exists := c.functionParams[funcName]
+	paramNames, exists := c.functionParams[c.funcNames[fn]]
 	if !exists {
 		paramNames = []string{}
 	}
@@ -336,53 +500,24 @@ func (c *Compiler) StartFunction(fn *ir.Func) {
 	if len(paramNames) == 0 {
 		// No parameters: nothing to do
 		return
-	} else if len(paramNames) == 1 {
-		// Single parameter: store normally (it's the fixed parameter)
-		param := fn.Params[0]
-		alloca := c.builder.NewAlloca(c.WordType())
-		c.builder.NewStore(param, alloca)
-		c.locals[paramNames[0]] = alloca
-	} else {
-		// Multiple parameters: first is fixed, rest extracted via va_arg
-
-		// Store the first parameter normally
-		firstParam := fn.Params[0]
-		alloca := c.builder.NewAlloca(c.WordType())
-		c.builder.NewStore(firstParam, alloca)
-		c.locals[paramNames[0]] = alloca
-
-		// Set up va_list for remaining parameters
-		// Allocate sufficiently large opaque buffer to hold platform va_list
-		// Use [48 x i8] which covers common ABIs (x86_64, aarch64)
-		vaArrayType := types.NewArray(48, types.I8)
-		vaArrayAlloca := c.builder.NewAlloca(vaArrayType)
-		// Pointer to first element as i8* for intrinsics and va_arg
-		vaListPtr := c.builder.NewGetElementPtr(vaArrayType, vaArrayAlloca,
-			constant.NewInt(types.I32, 0),
-			constant.NewInt(types.I32, 0))
-
-		// Initialize va_list using llvm.va_start intrinsic
-		vaStartFunc := c.getOrCreateFunc("llvm.va_start")
-		c.builder.NewCall(vaStartFunc, vaListPtr)
-
-		// Extract remaining parameters using va_arg
-		for i := 1; i < len(paramNames); i++ {
-			paramName := paramNames[i]
-
-			// Allocate space for this parameter
-			paramAlloca := c.builder.NewAlloca(c.WordType())
-
-			// Extract the parameter using va_arg instruction
-			vaArgResult := c.builder.NewVAArg(vaListPtr, c.WordType())
-
-			// Store the extracted value to the parameter
-			c.builder.NewStore(vaArgResult, paramAlloca)
-			c.locals[paramName] = paramAlloca
+	}
+	// Fixed parameters are stored normally
+	for i, param := range fn.Params {
+		if i < len(paramNames) {
+			alloca := c.builder.NewAlloca(c.WordType())
+			c.builder.NewStore(param, alloca)
+			c.locals[paramNames[i]] = alloca
 		}
-
-		// Clean up va_list using llvm.va_end intrinsic
-		vaEndFunc := c.getOrCreateFunc("llvm.va_end")
-		c.builder.NewCall(vaEndFunc, vaListPtr)
+	}
+	if len(paramNames) > len(fn.Params) {
+		// The rest are extracted via va_arg
+		i := len(fn.Params)
+		c.readVarArgs(len(paramNames)-i, func(v value.Value) {
+			alloca := c.builder.NewAlloca(c.WordType())
+			c.builder.NewStore(v, alloca)
+			c.locals[paramNames[i]] = alloca
+			i++
+		})
 	}
 }
 
@@ -392,9 +527,12 @@ func (c *Compiler) EndFunction() {
 	if c.builder != nil && c.builder.Term == nil {
 		c.builder.NewRet(constant.NewInt(c.WordType(), 0))
 	}
+	c.profileLeave()
+	c.markTailCalls()
 	c.currentFn = nil
 	c.builder = nil
 	c.locals = make(map[string]value.Value)
+	c.localVectors = make(map[string]*vector)
 	c.labels = make(map[string]*ir.Block)
 }
 
@@ -404,6 +542,7 @@ func (c *Compiler) DeclareLocal(name string) value.Value {
 	// Initialize local variables to 0 (B language semantics)
 	c.builder.NewStore(constant.NewInt(c.WordType(), 0), alloca)
 	c.locals[name] = alloca
+	delete(c.localVectors, name)
 	return alloca
 }
 
@@ -437,6 +576,7 @@ func (c *Compiler) DeclareLocalArray(name string, size int64) value.Value {
 
 	// Store the array base address (to first slot which now contains the data pointer)
 	c.locals[name] = firstSlotPtr
+	c.localVectors[name] = &vector{data: ptrAsInt, size: size}
 	return firstSlotPtr
 }
 
@@ -494,6 +634,90 @@ func (c *Compiler) CreateStringConstant(str string) *ir.Global {
 	return global
 }
 
+// stringLiteral returns the contents of a string literal passed as a word
+// value (ptrtoint of a getelementptr into a string constant), as produced
+// by parsePrimary. The second result is false for any other value.
+func stringLiteral(v value.Value) (string, bool) {
+	cast, ok := v.(*ir.InstPtrToInt)
+	if !ok {
+		return "", false
+	}
+	gep, ok := cast.From.(*ir.InstGetElementPtr)
+	if !ok {
+		return "", false
+	}
+	global, ok := gep.Src.(*ir.Global)
+	if !ok {
+		return "", false
+	}
+	arr, ok := global.Init.(*constant.Array)
+	if !ok {
+		return "", false
+	}
+	var buf []byte
+	for _, elem := range arr.Elems {
+		ch, ok := elem.(*constant.Int)
+		if !ok {
+			return "", false
+		}
+		if ch.X.Sign() == 0 {
+			break
+		}
+		buf = append(buf, byte(ch.X.Int64()))
+	}
+	return string(buf), true
+}
+
+// countFormatConversions returns the number of arguments consumed by
+// a printf format string, following the parsing rules of the runtime:
+// flags '-' and '0', a field width and a precision may precede the
+// conversion letter, and unknown conversions consume no argument.
+func countFormatConversions(format string) int {
+	count := 0
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			continue
+		}
+		i++
+		for i < len(format) && (format[i] == '-' || format[i] == '0') {
+			i++
+		}
+		for i < len(format) && format[i] >= '0' && format[i] <= '9' {
+			i++
+		}
+		if i < len(format) && format[i] == '.' {
+			i++
+			for i < len(format) && format[i] >= '0' && format[i] <= '9' {
+				i++
+			}
+		}
+		if i >= len(format) {
+			break
+		}
+		switch format[i] {
+		case 'd', 'u', 'o', 'x', 'b', 'c', 's':
+			count++
+		}
+	}
+	return count
+}
+
+// CheckFormatCall warns when a call to printf with a literal format
+// string passes a different number of arguments than the format consumes
+func (c *Compiler) CheckFormatCall(pos Pos, fn *ir.Func, args []value.Value) {
+	if fn.Name() != c.globalName("printf") || len(args) == 0 {
+		return
+	}
+	format, ok := stringLiteral(args[0])
+	if !ok {
+		return
+	}
+	want := countFormatConversions(format)
+	if got := len(args) - 1; got != want {
+		c.Warnf(pos, "printf format expects %d argument(s), but %d given", want, got)
+	}
+}
+
 // NewBlock creates a new basic block
 func (c *Compiler) NewBlock(name string) *ir.Block {
 	if name == "" {
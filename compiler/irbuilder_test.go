@@ -0,0 +1,213 @@
+package compiler
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/llir/llvm/ir/constant"
+)
+
+func TestGetOrDeclareFunction_WithExtrnReturnsNil(t *testing.T) {
+	c := NewCompiler(NewCompileOptions("blang", nil))
+	// simulate extrn variable present: a zero-initialized global
+	c.DeclareGlobal("foo", constant.NewInt(c.WordType(), 0))
+	if fn := c.GetOrDeclareFunction("foo"); fn != nil {
+		t.Fatalf("expected nil for function pointer variable, got %v", fn)
+	}
+}
+
+func TestGetOrDeclareFunction_NewVariadicExternal(t *testing.T) {
+	c := NewCompiler(NewCompileOptions("blang", nil))
+	fn := c.GetOrDeclareFunction("bar")
+	if fn == nil {
+		t.Fatalf("expected function to be declared")
+	}
+	if !fn.Sig.Variadic {
+		t.Fatalf("expected variadic signature for auto-declared extern")
+	}
+	// second call should return cached
+	if fn2 := c.GetOrDeclareFunction("bar"); fn2 != fn {
+		t.Fatalf("expected cached function on second call")
+	}
+}
+
+func TestNewCompiler_TargetTriple(t *testing.T) {
+	for name, target := range llvmTargets {
+		args := NewCompileOptions("blang", nil)
+		args.Target = name
+		m := NewCompiler(args).GetModule()
+		if m.TargetTriple != target.triple || m.DataLayout != target.dataLayout {
+			t.Errorf("target %s: module has triple %q and data layout %q", name, m.TargetTriple, m.DataLayout)
+		}
+	}
+	if m := NewCompiler(NewCompileOptions("blang", nil)).GetModule(); m.TargetTriple != "" {
+		t.Errorf("host module should not have a triple, got %q", m.TargetTriple)
+	}
+}
+
+func TestNewBlock_AutoName(t *testing.T) {
+	c := NewCompiler(NewCompileOptions("blang", nil))
+	fn := c.DeclareFunction("f", nil)
+	c.StartFunction(fn)
+	defer c.EndFunction()
+	b1 := c.NewBlock("")
+	b2 := c.NewBlock("")
+	if b1 == nil || b2 == nil {
+		t.Fatalf("blocks should be non-nil")
+	}
+	if b1 == b2 {
+		t.Fatalf("auto-named blocks must be distinct")
+	}
+	if b1.Name() == "" || b2.Name() == "" {
+		t.Fatalf("auto-named blocks should have non-empty names")
+	}
+}
+
+func TestDeclareLocalArray_SizeZero(t *testing.T) {
+	c := NewCompiler(NewCompileOptions("blang", nil))
+	fn := c.DeclareFunction("f", nil)
+	c.StartFunction(fn)
+	defer c.EndFunction()
+	if v := c.DeclareLocalArray("a", 0); v == nil {
+		t.Fatal("expected non-nil value for size 0 array")
+	}
+}
+
+func TestCountFormatConversions(t *testing.T) {
+	tests := []struct {
+		format string
+		want   int
+	}{
+		{"hello*n", 0},
+		{"%d %s", 2},
+		{"%% %d", 1},
+		{"%-5d|%05x|%.3s|%10.2s", 4},
+		{"%u %o %b %c", 4},
+		{"%q %5%", 0},
+		{"trailing %", 0},
+	}
+	for _, tt := range tests {
+		if got := countFormatConversions(tt.format); got != tt.want {
+			t.Errorf("countFormatConversions(%q) = %d, want %d", tt.format, got, tt.want)
+		}
+	}
+}
+
+func TestCheckFormatCall_Warnings(t *testing.T) {
+	args := NewCompileOptions("blang", nil)
+	c := NewCompiler(args)
+	l := NewLexer(args, strings.NewReader(`main() {
+    auto f;
+    printf("%d %d*n", 1);
+    printf("%d*n", 1);
+    f = "%d";
+    printf(f);
+    printf("*n", 2);
+}`))
+	l.SetFilename("w.b")
+	if err := ParseDeclarations(l, c); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []string{
+		"w.b:3: printf format expects 2 argument(s), but 1 given",
+		"w.b:7: printf format expects 0 argument(s), but 1 given",
+	}
+	got := c.Warnings()
+	if len(got) != len(want) {
+		t.Fatalf("Warnings() = %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i].Error() != want[i] {
+			t.Errorf("warning %d = %q, want %q", i, got[i], want[i])
+		}
+	}
+}
+
+// TestDeclareFunction_FixedBodyAndThunk tests that missing arguments
+// are zero words, whether f() is called directly, before h() is
+// defined, or through a pointer, in the interpreter as when compiled
+func TestDeclareFunction_FixedBodyAndThunk(t *testing.T) {
+	src := `f(a, b, c) return (a + 10 * b + 100 * c);
+
+main() {
+    extrn g;
+    g = f;
+    printf("%d %d %d %d*n", f(1), f(1, 2, 3, 4), g(1, 2), g(1, 2, 3));
+    printf("%d %d*n", h(1), h(1, 2));
+}
+
+h(x, y) return (x + 10 * y);
+
+g;
+`
+	module, _, err := ParseReader("f.b", strings.NewReader(src))
+	if err != nil {
+		t.Fatalf("ParseReader() failed: %v", err)
+	}
+	ir := module.String()
+	for _, s := range []string{
+		"define internal i64 @.body.f(i64 %a, i64 %b, i64 %c) {",
+		"define i64 @b.f(i64 %a, ...) {",
+		"%0 = load i64, i64* @b..nargs",
+		"%1 = icmp sgt i64 %0, 0",
+		"%2 = select i1 %1, i64 %a, i64 0",
+		"tail call i64 @.body.f(i64 %2, i64 %7, i64 %10)",
+		"store i64 2, i64* @b..nargs",
+		"call i64 @.body.f(i64 1, i64 0, i64 0)",
+		"call i64 @.body.f(i64 1, i64 2, i64 3)",
+	} {
+		if !strings.Contains(ir, s) {
+			t.Errorf("IR has no %q:\n%s", s, ir)
+		}
+	}
+	_, body, _ := strings.Cut(ir, "define internal")
+	if body, _, _ = strings.Cut(body, "\n}\n"); strings.Contains(body, "va_") {
+		t.Errorf("body of f() reads a va_list:\n%s", ir)
+	}
+
+	if out := compileLinkRunFromCode(t, "f", src); out != "1 321 21 321\n1 21\n" {
+		t.Errorf("output %q", out)
+	}
+}
+
+// TestDeclareFunction_SmallArities tests that a function of one
+// parameter has a body too, whose thunk reads no va_list but zero when
+// called without arguments, and that one
+// without parameters, not variadic, is a single function
+func TestDeclareFunction_SmallArities(t *testing.T) {
+	src := `f(a) return (a + 1);
+z() return (7);
+main() {
+    extrn p;
+    p = f;
+    printf("%d %d %d %d*n", f(), f(1, 2), z(3), p());
+}
+
+p;
+`
+	module, _, err := ParseReader("f.b", strings.NewReader(src))
+	if err != nil {
+		t.Fatalf("ParseReader() failed: %v", err)
+	}
+	ir := module.String()
+	for _, s := range []string{
+		"define internal i64 @.body.f(i64 %a) {",
+		"define i64 @b.f(i64 %a, ...) {",
+		"tail call i64 @.body.f(i64 %2)",
+		"call i64 @.body.f(i64 0)",
+		"call i64 @.body.f(i64 1)",
+		"define i64 @b.z() {",
+		"call i64 @b.z()",
+	} {
+		if !strings.Contains(ir, s) {
+			t.Errorf("IR has no %q:\n%s", s, ir)
+		}
+	}
+	if strings.Contains(ir, "va_start") || strings.Contains(ir, "@.body.z") {
+		t.Errorf("IR reads a va_list or splits z():\n%s", ir)
+	}
+
+	if out := compileLinkRunFromCode(t, "f", src); out != "1 2 7 1\n" {
+		t.Errorf("output %q", out)
+	}
+}
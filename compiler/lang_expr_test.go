@@ -1,4 +1,4 @@
-package main
+package compiler
 
 import (
 	"testing"
@@ -6,8 +6,6 @@ import (
 
 // TestPrecedence tests operator precedence (from oldtests/precedence_test.cpp)
 func TestPrecedence(t *testing.T) {
-	ensureLibbOrSkip(t)
-
 	tests := []struct {
 		name       string
 		code       string
@@ -258,8 +256,6 @@ func TestPrecedence(t *testing.T) {
 
 // TestExpressions tests various expression features (from oldtests/expr_test.cpp)
 func TestExpressions(t *testing.T) {
-	ensureLibbOrSkip(t)
-
 	tests := []struct {
 		name       string
 		code       string
@@ -572,8 +568,6 @@ address = 0, 8, 16
 
 // TestUnaryOperators tests comprehensive unary operator functionality
 func TestUnaryOperators(t *testing.T) {
-	ensureLibbOrSkip(t)
-
 	tests := []struct {
 		name       string
 		code       string
@@ -705,8 +699,6 @@ func TestUnaryOperators(t *testing.T) {
 
 // TestCompoundAssignments tests compound assignment operators (from oldtests/assignment_test.cpp)
 func TestCompoundAssignments(t *testing.T) {
-	ensureLibbOrSkip(t)
-
 	tests := []struct {
 		name       string
 		code       string
@@ -741,8 +733,6 @@ func TestCompoundAssignments(t *testing.T) {
 
 // TestStrings tests string and character literal features (from oldtests/string_test.cpp)
 func TestStrings(t *testing.T) {
-	ensureLibbOrSkip(t)
-
 	tests := []struct {
 		name       string
 		code       string
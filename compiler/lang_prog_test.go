@@ -1,8 +1,9 @@
-package main
+package compiler
 
 import (
 	"bytes"
 	"os/exec"
+	"strings"
 	"testing"
 )
 
@@ -10,8 +11,6 @@ import (
 
 // TestFunctions tests various function features (from oldtests/func_test.cpp)
 func TestFunctions(t *testing.T) {
-	ensureLibbOrSkip(t)
-
 	tests := []struct {
 		name       string
 		code       string
@@ -145,8 +144,6 @@ abc(a, b, c) {
 
 // TestIndirectCalls tests indirect function calls through function pointers
 func TestIndirectCalls(t *testing.T) {
-	ensureLibbOrSkip(t)
-
 	tests := []struct {
 		name       string
 		code       string
@@ -199,8 +196,6 @@ mul: 50
 
 // TestNestedLoops tests nested while loops with unique labels
 func TestNestedLoops(t *testing.T) {
-	ensureLibbOrSkip(t)
-
 	tests := []struct {
 		name       string
 		code       string
@@ -256,8 +251,6 @@ func TestNestedLoops(t *testing.T) {
 
 // TestGlobals tests global and local variable features (from oldtests/globals_test.cpp)
 func TestGlobals(t *testing.T) {
-	ensureLibbOrSkip(t)
-
 	tests := []struct {
 		name       string
 		code       string
@@ -330,8 +323,6 @@ offset c = 0
 
 // TestLibbFunctions tests runtime library functions
 func TestLibbFunctions(t *testing.T) {
-	ensureLibbOrSkip(t)
-
 	tests := []struct {
 		name       string
 		code       string
@@ -360,12 +351,37 @@ func TestLibbFunctions(t *testing.T) {
 			wantStdout: `Hello, World!
 % % %%
 format %d: 123 -123
-format %o: 352 -352
+format %o: 352 1777777777777777777426
 format %c: foo bar
 format %s: "Hello" "World"
 unknown format: %q
 `,
 		},
+		{
+			name: "runtime_printf_fields",
+			code: `main() {
+                printf("[%5d] [%-5d] [%05d] [%05d]*n", 42, 42, 42, -42);
+                printf("[%x] [%u] [%b] [%.4d]*n", 255, -1, 10, 7);
+                printf("[%10s] [%-10s] [%.3s] [%8.2s]*n", "hi", "hi", "abcdef", "abcdef");
+                printf("[%4c] [%-4c]*n", 'ab', 'ab');
+                printf("[%-5q] [%%] [%5%]*n");
+            }`,
+			wantStdout: `[   42] [42   ] [00042] [-0042]
+[ff] [18446744073709551615] [1010] [0007]
+[        hi] [hi        ] [abc] [      ab]
+[  ab] [ab  ]
+[%-5q] [%] [%]
+`,
+		},
+		{
+			name: "runtime_printf_precision",
+			code: `main() {
+                printf("[%.300d]*n", 7);
+                printf("[%-304.300x] [%0303.300d]*n", 255, -1);
+            }`,
+			wantStdout: "[" + strings.Repeat("0", 299) + "7]\n[" + strings.Repeat("0", 298) + "ff    ] [-" +
+				strings.Repeat("0", 301) + "1]\n",
+		},
 		{
 			name: "runtime_exit",
 			code: `main() {
@@ -409,6 +425,124 @@ unknown format: %q
             }`,
 			wantStdout: "foobar\n",
 		},
+		{
+			name: "runtime_strings",
+			code: `main() {
+                auto buf[8], word[4];
+
+                printf("%d %d*n", length("hello"), length(""));
+                concat(buf, "foo", "bar");
+                concat(buf, buf, "!");
+                putstr(buf);
+                putstr("*n");
+                printf("%d %d %d*n", compare("abc", "abd") < 0,
+                    compare("abc", "abc"), compare("b", "abc") > 0);
+            }`,
+			wantStdout: "5 0\nfoobar!\n1 0 1\n",
+		},
+		{
+			name: "runtime_numbers",
+			code: `main() {
+                auto buf[4];
+
+                printf("%d %d %d*n", atoi("  -123x"), atoi("+42"), atoi("z"));
+                printf("%s ", itoa(-255, buf, 10));
+                printf("%s ", itoa(255, buf, 16));
+                printf("%s ", itoa(5, buf, 2));
+                printf("%d*n", atoi(itoa(1234567, buf, 10)));
+            }`,
+			wantStdout: "-123 42 0\n-255 ff 101 1234567\n",
+		},
+		{
+			name: "runtime_getarg",
+			code: `main() {
+                auto arg[4], i;
+
+                i = 0;
+                while (getarg(arg, "  cc -o  out*tx.b ", i)) {
+                    printf("%d:%s*n", i, arg);
+                    i++;
+                }
+                printf("%d arguments*n", i);
+            }`,
+			wantStdout: "0:cc\n1:-o\n2:out\n3:x.b\n4 arguments\n",
+		},
+		{
+			name: "runtime_getvec",
+			code: `main() {
+                auto v, i;
+
+                v = getvec(9);
+                i = 0;
+                while (i <= 9) {
+                    v[i] = i * i;
+                    i++;
+                }
+                printf("%d %d %d*n", v[0], v[5], v[9]);
+                rlsevec(v, 9);
+            }`,
+			wantStdout: "0 25 81\n",
+		},
+		{
+			name: "runtime_getvec_reuse",
+			code: `main() {
+                auto v[100], i, n, sum;
+
+                /* Allocate vectors of varying size, release every other one */
+                i = 0;
+                while (i < 100) {
+                    v[i] = getvec(i % 17);
+                    v[i][i % 17] = i;
+                    i++;
+                }
+                i = 0;
+                while (i < 100) {
+                    rlsevec(v[i], i % 17);
+                    i =+ 2;
+                }
+
+                /* Released vectors are reused and come back zeroed */
+                i = 0;
+                n = 0;
+                while (i < 100) {
+                    v[i] = getvec(i % 17);
+                    n =+ v[i][i % 17];
+                    v[i][i % 17] = i;
+                    i =+ 2;
+                }
+
+                sum = 0;
+                i = 0;
+                while (i < 100) {
+                    sum =+ v[i][i % 17];
+                    i++;
+                }
+                printf("zeroed %d, sum %d*n", n, sum);
+
+                /* Many short-lived vectors must not exhaust memory */
+                i = 0;
+                while (i < 100000) {
+                    rlsevec(getvec(50), 50);
+                    i++;
+                }
+                printf("done*n");
+            }`,
+			wantStdout: "zeroed 0, sum 4950\ndone\n",
+		},
+		{
+			name: "runtime_sbrk",
+			code: `main() {
+                auto p, q;
+
+                p = sbrk(64);
+                q = sbrk(64);
+                p[0] = 123;
+                p[7] = 456;
+                q[0] = 789;
+                printf("%d %d %d*n", p[0], p[7], q[0]);
+            }`,
+			wantStdout: "123 456 789\n",
+		},
 	}
 
 	for _, tt := range tests {
@@ -473,3 +607,94 @@ main() {
 		}
 	})
 }
+
+// TestRuntimeGetstr tests reading lines with getstr(), including a last line without newline.
+func TestRuntimeGetstr(t *testing.T) {
+	ensureLibbOrSkip(t)
+
+	const bcode = `
+main() {
+    auto line[10];
+    while (getstr(line)) {
+        printf("<%s> %d*n", line, length(line));
+    }
+}
+`
+	dir, bFile, llFile, exeFile := createTempBFile(t, "getstr_prog", bcode)
+	_ = dir
+	compileToLL(t, bFile, llFile)
+	linkWithClang(t, llFile, exeFile)
+	cmd := exec.Command(exeFile)
+	cmd.Stdin = bytes.NewReader([]byte("first line\n\nlast"))
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	want := "<first line> 10\n<> 0\n<last> 4\n"
+	if string(out) != want {
+		t.Fatalf("unexpected output: got %q, want %q", out, want)
+	}
+}
+
+// TestRuntimeArgs tests command line arguments passed to main() and getenv().
+func TestRuntimeArgs(t *testing.T) {
+	ensureLibbOrSkip(t)
+
+	const bcode = `
+main(argv) {
+    auto i;
+    printf("%d arguments*n", argv[0]);
+    i = 2;
+    while (i <= argv[0]) {
+        printf("%d: %s*n", i, argv[i]);
+        i++;
+    }
+    printf("HOME=%s*n", getenv("HOME"));
+    printf("missing=%d*n", getenv("B_NO_SUCH_VARIABLE"));
+    return(argv[0]);
+}
+`
+	dir, bFile, llFile, exeFile := createTempBFile(t, "args_prog", bcode)
+	_ = dir
+	compileToLL(t, bFile, llFile)
+	linkWithClang(t, llFile, exeFile)
+	cmd := exec.Command(exeFile, "one", "two words")
+	cmd.Env = []string{"HOME=/home/b"}
+	out, err := cmd.Output()
+	code := 0
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		code = exitErr.ExitCode()
+	} else if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	want := "3 arguments\n2: one\n3: two words\nHOME=/home/b\nmissing=0\n"
+	if string(out) != want {
+		t.Fatalf("unexpected output: got %q, want %q", out, want)
+	}
+	if code != 3 {
+		t.Fatalf("exit code = %d, want 3", code)
+	}
+}
+
+// TestRuntimeArgvExtrn tests access to the arguments through the global argv.
+func TestRuntimeArgvExtrn(t *testing.T) {
+	ensureLibbOrSkip(t)
+
+	const bcode = `
+main() {
+    extrn argv;
+    printf("%d %s*n", argv[0], argv[2]);
+}
+`
+	dir, bFile, llFile, exeFile := createTempBFile(t, "argv_prog", bcode)
+	_ = dir
+	compileToLL(t, bFile, llFile)
+	linkWithClang(t, llFile, exeFile)
+	out, err := exec.Command(exeFile, "first").Output()
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if string(out) != "2 first\n" {
+		t.Fatalf("unexpected output: got %q", out)
+	}
+}
@@ -1,4 +1,4 @@
-package main
+package compiler
 
 import (
 	"fmt"
@@ -8,9 +8,11 @@ import (
 
 // Lexer handles tokenization and input reading
 type Lexer struct {
-	args   *CompileOptions
-	reader io.RuneReader
-	buffer []rune // pushback buffer for unread characters
+	args     *CompileOptions
+	reader   io.RuneReader
+	buffer   []rune // pushback buffer for unread characters
+	filename string // name of the source file, for diagnostics
+	line     int    // current line number, starting from 1
 }
 
 // NewLexer creates a new lexer
@@ -19,9 +21,30 @@ func NewLexer(args *CompileOptions, reader io.Reader) *Lexer {
 		args:   args,
 		reader: &runeReaderAdapter{reader},
 		buffer: make([]rune, 0),
+		line:   1,
 	}
 }
 
+// SetFilename sets the source file name reported in diagnostics
+func (l *Lexer) SetFilename(name string) {
+	l.filename = name
+}
+
+// Line returns the current line number
+func (l *Lexer) Line() int {
+	return l.line
+}
+
+// Pos returns the current source position
+func (l *Lexer) Pos() Pos {
+	return Pos{File: l.filename, Line: l.line}
+}
+
+// Position returns the current source position as "file:line"
+func (l *Lexer) Position() string {
+	return l.Pos().String()
+}
+
 // runeReaderAdapter adapts io.Reader to io.RuneReader
 type runeReaderAdapter struct {
 	reader io.Reader
@@ -45,15 +68,24 @@ func (l *Lexer) ReadChar() (rune, error) {
 	if len(l.buffer) > 0 {
 		c := l.buffer[len(l.buffer)-1]
 		l.buffer = l.buffer[:len(l.buffer)-1]
+		if c == '\n' {
+			l.line++
+		}
 		return c, nil
 	}
 
 	c, _, err := l.reader.ReadRune()
+	if err == nil && c == '\n' {
+		l.line++
+	}
 	return c, err
 }
 
 // UnreadChar pushes a character back to be read again
 func (l *Lexer) UnreadChar(c rune) {
+	if c == '\n' {
+		l.line--
+	}
 	l.buffer = append(l.buffer, c)
 }
 
@@ -1,4 +1,4 @@
-package main
+package compiler
 
 import (
 	"strings"
@@ -205,3 +205,26 @@ func TestLexer_ExpectChar_Branches(t *testing.T) {
 		t.Fatalf("want EOF error, got %v", err)
 	}
 }
+
+func TestLexerLineTracking(t *testing.T) {
+	l := newTestLexer(t, "a\nb\n\nc")
+	l.SetFilename("x.b")
+	if l.Position() != "x.b:1" {
+		t.Fatalf("initial position = %q", l.Position())
+	}
+	for _, want := range []int{1, 2, 4} {
+		if _, err := l.Identifier(); err != nil {
+			t.Fatalf("Identifier() error = %v", err)
+		}
+		if l.Line() != want {
+			t.Fatalf("Line() = %d, want %d", l.Line(), want)
+		}
+	}
+	// Pushing back a newline moves to the previous line
+	l = newTestLexer(t, "\nx")
+	c, _ := l.ReadChar()
+	l.UnreadChar(c)
+	if l.Line() != 1 {
+		t.Fatalf("Line() after UnreadChar = %d, want 1", l.Line())
+	}
+}
@@ -0,0 +1,795 @@
+package compiler
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/llir/llvm/ir"
+	"github.com/llir/llvm/ir/constant"
+	"github.com/llir/llvm/ir/enum"
+	"github.com/llir/llvm/ir/types"
+	"github.com/llir/llvm/ir/value"
+)
+
+//
+// Native backend: x86_64 GNU assembly generated directly from the
+// LLVM module, so that programs can be built with binutils alone.
+//
+// The code is simple and stack based. Every value computed by an
+// instruction lives in a slot of the frame; operands are loaded into
+// %rax and %rcx, and the result is stored back. Calls follow the
+// System V ABI, so compiled code links with the runtime library.
+//
+// Frame layout, relative to %rbp:
+//
+//	+16...      arguments passed on the stack (7th and later)
+//	+8          return address
+//	 0          saved %rbp
+//	-48...-8    arguments passed in registers, saved by the prologue
+//	below       locals (allocas), the first one at the highest address
+//	below       values of instructions
+//
+
+// Registers for passing arguments, in order
+var nativeArgRegs = []string{"%rdi", "%rsi", "%rdx", "%rcx", "%r8", "%r9"}
+
+// Size of the area where register arguments are saved
+const nativeSaveArea = 48
+
+// nativeError reports a construct the backend cannot translate.
+type nativeError struct {
+	msg string
+}
+
+func (e *nativeError) Error() string {
+	return e.msg
+}
+
+func nativeErrorf(format string, args ...interface{}) {
+	panic(&nativeError{msg: fmt.Sprintf(format, args...)})
+}
+
+// nativeGen holds the state of generating assembly for one module.
+type nativeGen struct {
+	out    strings.Builder
+	nfunc  int // number of functions, for unique labels
+	nlabel int // number of local labels
+
+	// State of the current function
+	fn      *ir.Func
+	slots   map[value.Value]int64 // frame offsets of values
+	locals  map[value.Value]int64 // frame offsets of static allocas
+	params  map[value.Value]int   // index of each parameter
+	labels  map[*ir.Block]string  // labels of blocks
+	stubs   []func()              // pending edges with phi copies
+	varargs bool                  // register arguments are saved
+}
+
+// GenerateNative translates a module into x86_64 assembly for the
+// GNU assembler.
+func GenerateNative(m *ir.Module) (asm string, err error) {
+	defer func() {
+		switch e := recover().(type) {
+		case nil:
+		case *nativeError:
+			err = e
+		case *interpFault:
+			// Raised by the type helpers shared with the interpreter
+			err = &nativeError{msg: e.msg}
+		default:
+			panic(e)
+		}
+	}()
+
+	g := &nativeGen{}
+	g.emit("\t.text")
+	for _, fn := range m.Funcs {
+		if len(fn.Blocks) > 0 {
+			g.function(fn)
+		}
+	}
+	for _, global := range m.Globals {
+		g.global(global)
+	}
+	g.emit("\t.section .note.GNU-stack,\"\",@progbits")
+	return g.out.String(), nil
+}
+
+// emit writes a line of assembly.
+func (g *nativeGen) emit(format string, args ...interface{}) {
+	fmt.Fprintf(&g.out, format, args...)
+	g.out.WriteByte('\n')
+}
+
+// newLabel returns a fresh local label.
+func (g *nativeGen) newLabel() string {
+	g.nlabel++
+	return fmt.Sprintf(".Ltmp%d", g.nlabel)
+}
+
+// symbol returns the assembler name of a global or function.
+func symbol(name string, linkage enum.Linkage) string {
+	if linkage == enum.LinkagePrivate || linkage == enum.LinkageInternal {
+		// Local symbols are not put into the object file
+		return ".L" + strings.TrimLeft(name, ".")
+	}
+	return name
+}
+
+func isLocal(linkage enum.Linkage) bool {
+	return linkage == enum.LinkagePrivate || linkage == enum.LinkageInternal
+}
+
+//
+// Data
+//
+
+// global emits the definition of a global variable. Zero-initialized
+// globals are common symbols, so that a variable declared by 'extrn'
+// in several files shares storage with its definition.
+func (g *nativeGen) global(global *ir.Global) {
+	if global.Init == nil {
+		return
+	}
+	name := symbol(global.Name(), global.Linkage)
+	size := sizeOf(global.ContentType)
+	if isZeroConst(global.Init) && !isLocal(global.Linkage) {
+		g.emit("\t.comm %s,%d,8", name, size)
+		return
+	}
+	if global.Immutable {
+		g.emit("\t.section .rodata")
+	} else {
+		g.emit("\t.data")
+	}
+	if !isLocal(global.Linkage) {
+		g.emit("\t.globl %s", name)
+	}
+	if _, isString := stringData(global.Init); !isString {
+		g.emit("\t.p2align 3")
+	}
+	g.emit("\t.type %s,@object", name)
+	g.emit("\t.size %s,%d", name, size)
+	g.emit("%s:", name)
+	g.data(global.Init)
+}
+
+// data emits the contents of an initializer.
+func (g *nativeGen) data(c constant.Constant) {
+	switch c := c.(type) {
+	case *constant.Array, *constant.CharArray:
+		if str, ok := stringData(c); ok {
+			g.emit("\t.ascii \"%s\"", escapeASCII(str))
+			return
+		}
+		for _, elem := range c.(*constant.Array).Elems {
+			g.data(elem)
+		}
+	case *constant.ZeroInitializer:
+		g.emit("\t.zero %d", sizeOf(c.Typ))
+	default:
+		sym, off := g.constant(c)
+		directive := map[int64]string{1: ".byte", 2: ".short", 4: ".long", 8: ".quad"}[sizeOf(c.Type())]
+		if directive == "" {
+			nativeErrorf("unsupported initializer %s", c)
+		}
+		g.emit("\t%s %s", directive, address(sym, off))
+	}
+}
+
+// stringData returns the bytes of an array of characters.
+func stringData(c constant.Constant) ([]byte, bool) {
+	switch c := c.(type) {
+	case *constant.CharArray:
+		return c.X, true
+	case *constant.Array:
+		if !types.Equal(c.Typ.ElemType, types.I8) {
+			return nil, false
+		}
+		str := make([]byte, len(c.Elems))
+		for i, elem := range c.Elems {
+			k, ok := elem.(*constant.Int)
+			if !ok {
+				return nil, false
+			}
+			str[i] = byte(k.X.Int64())
+		}
+		return str, true
+	}
+	return nil, false
+}
+
+// escapeASCII quotes bytes for the .ascii directive.
+func escapeASCII(b []byte) string {
+	var s strings.Builder
+	for _, c := range b {
+		switch {
+		case c == '"' || c == '\\':
+			s.WriteByte('\\')
+			s.WriteByte(c)
+		case c >= ' ' && c < 0x7f:
+			s.WriteByte(c)
+		default:
+			fmt.Fprintf(&s, "\\%03o", c)
+		}
+	}
+	return s.String()
+}
+
+// address formats a symbol with an offset, or a plain number.
+func address(sym string, off int64) string {
+	switch {
+	case sym == "":
+		return fmt.Sprint(off)
+	case off == 0:
+		return sym
+	default:
+		return fmt.Sprintf("%s%+d", sym, off)
+	}
+}
+
+// constant evaluates a constant to a symbol plus offset; the symbol
+// is empty for plain numbers.
+func (g *nativeGen) constant(c constant.Constant) (string, int64) {
+	switch c := c.(type) {
+	case *constant.Int:
+		return "", truncBits(c.X.Int64(), c.Typ.BitSize)
+	case *constant.Null, *constant.ZeroInitializer, *constant.Undef:
+		return "", 0
+	case *ir.Global:
+		return symbol(c.Name(), c.Linkage), 0
+	case *ir.Func:
+		return symbol(c.Name(), c.Linkage), 0
+	case *constant.Index:
+		return g.constant(c.Constant)
+	case *constant.ExprGetElementPtr:
+		sym, off := g.constant(c.Src)
+		gepScales(c.ElemType, len(c.Indices), func(i int, scale int64) {
+			off += g.index(c.Indices[i]) * scale
+		})
+		return sym, off
+	case *constant.ExprPtrToInt:
+		return g.constant(c.From)
+	case *constant.ExprIntToPtr:
+		return g.constant(c.From)
+	case *constant.ExprBitCast:
+		return g.constant(c.From)
+	default:
+		nativeErrorf("unsupported constant %s", c)
+		return "", 0
+	}
+}
+
+// index evaluates a constant getelementptr index, which is signed.
+func (g *nativeGen) index(v value.Value) int64 {
+	_, k := g.constant(v.(constant.Constant))
+	return signExtend(k, bitSize(v.Type()))
+}
+
+//
+// Functions
+//
+
+// function emits the code of a function definition.
+func (g *nativeGen) function(fn *ir.Func) {
+	g.nfunc++
+	g.fn = fn
+	g.slots = make(map[value.Value]int64)
+	g.locals = make(map[value.Value]int64)
+	g.params = make(map[value.Value]int)
+	g.labels = make(map[*ir.Block]string)
+	g.varargs = len(fn.Params) > 0 || fn.Sig.Variadic
+
+	// Assign frame offsets
+	var frame int64
+	if g.varargs {
+		frame = nativeSaveArea
+	}
+	for i, p := range fn.Params {
+		g.params[p] = i
+	}
+	for _, inst := range fn.Blocks[0].Insts {
+		if a, ok := inst.(*ir.InstAlloca); ok && isStaticAlloca(a) {
+			frame += (allocaSize(a) + 7) &^ 7
+			g.locals[a] = -frame
+		}
+	}
+	for i, b := range fn.Blocks {
+		g.labels[b] = fmt.Sprintf(".LBB%d_%d", g.nfunc, i)
+		for _, inst := range b.Insts {
+			v, ok := inst.(value.Value)
+			if !ok || types.Equal(v.Type(), types.Void) {
+				continue
+			}
+			if _, static := g.locals[v]; !static {
+				frame += 8
+				g.slots[v] = -frame
+			}
+		}
+	}
+	frame = (frame + 15) &^ 15
+
+	// Prologue
+	name := symbol(fn.Name(), fn.Linkage)
+	g.emit("")
+	if !isLocal(fn.Linkage) {
+		g.emit("\t.globl %s", name)
+	}
+	g.emit("\t.p2align 4")
+	g.emit("\t.type %s,@function", name)
+	g.emit("%s:", name)
+	g.emit("\tpushq %%rbp")
+	g.emit("\tmovq %%rsp, %%rbp")
+	if frame > 0 {
+		g.emit("\tsubq $%d, %%rsp", frame)
+	}
+	if g.varargs {
+		for i, reg := range nativeArgRegs {
+			g.emit("\tmovq %s, %d(%%rbp)", reg, 8*i-nativeSaveArea)
+		}
+	}
+
+	for _, b := range fn.Blocks {
+		g.emit("%s:", g.labels[b])
+		for _, inst := range b.Insts {
+			g.inst(inst)
+		}
+		g.term(b)
+		for _, stub := range g.stubs {
+			stub()
+		}
+		g.stubs = nil
+	}
+	g.emit("\t.size %s, .-%s", name, name)
+}
+
+// isStaticAlloca reports whether an alloca has a constant size.
+func isStaticAlloca(a *ir.InstAlloca) bool {
+	if a.NElems == nil {
+		return true
+	}
+	_, ok := a.NElems.(*constant.Int)
+	return ok
+}
+
+// allocaSize returns the size of a static alloca in bytes.
+func allocaSize(a *ir.InstAlloca) int64 {
+	size := sizeOf(a.ElemType)
+	if n, ok := a.NElems.(*constant.Int); ok {
+		size *= n.X.Int64()
+	}
+	return size
+}
+
+// load puts the value of an operand into a register.
+func (g *nativeGen) load(v value.Value, reg string) {
+	if off, ok := g.slots[v]; ok {
+		g.emit("\tmovq %d(%%rbp), %s", off, reg)
+		return
+	}
+	if off, ok := g.locals[v]; ok {
+		g.emit("\tleaq %d(%%rbp), %s", off, reg)
+		return
+	}
+	if i, ok := g.params[v]; ok {
+		g.emit("\tmovq %d(%%rbp), %s", paramOffset(i), reg)
+		return
+	}
+	c, ok := v.(constant.Constant)
+	if !ok {
+		nativeErrorf("%s: unsupported operand %s", g.fn.Name(), v.Ident())
+	}
+	sym, off := g.constant(c)
+	switch {
+	case sym != "":
+		g.emit("\tleaq %s(%%rip), %s", address(sym, off), reg)
+	case off == int64(int32(off)):
+		g.emit("\tmovq $%d, %s", off, reg)
+	default:
+		g.emit("\tmovabsq $%d, %s", off, reg)
+	}
+}
+
+// paramOffset returns the frame offset of the i-th argument.
+func paramOffset(i int) int {
+	if i < len(nativeArgRegs) {
+		return 8*i - nativeSaveArea
+	}
+	return 16 + 8*(i-len(nativeArgRegs))
+}
+
+// store saves %rax as the value of an instruction.
+func (g *nativeGen) store(v value.Value) {
+	g.emit("\tmovq %%rax, %d(%%rbp)", g.slots[v])
+}
+
+// signExtendReg widens a value of the given width in a register.
+func (g *nativeGen) signExtendReg(reg string, bits uint64) {
+	if bits < 64 {
+		g.emit("\tshlq $%d, %s", 64-bits, reg)
+		g.emit("\tsarq $%d, %s", 64-bits, reg)
+	}
+}
+
+// truncReg keeps the low bits of a register, zero-extended.
+func (g *nativeGen) truncReg(reg string, bits uint64) {
+	if bits < 64 {
+		g.emit("\tshlq $%d, %s", 64-bits, reg)
+		g.emit("\tshrq $%d, %s", 64-bits, reg)
+	}
+}
+
+// Condition codes of comparisons
+var nativeConds = map[enum.IPred]string{
+	enum.IPredEQ: "e", enum.IPredNE: "ne",
+	enum.IPredSLT: "l", enum.IPredSLE: "le", enum.IPredSGT: "g", enum.IPredSGE: "ge",
+	enum.IPredULT: "b", enum.IPredULE: "be", enum.IPredUGT: "a", enum.IPredUGE: "ae",
+}
+
+// inst emits the code of a non-terminator instruction.
+func (g *nativeGen) inst(inst ir.Instruction) {
+	switch inst := inst.(type) {
+	case *ir.InstPhi:
+		// Set on the edges into the block
+
+	case *ir.InstAlloca:
+		if _, static := g.locals[inst]; static {
+			return
+		}
+		// Allocate on the stack, keeping it aligned for calls
+		if inst.NElems != nil {
+			g.load(inst.NElems, "%rax")
+			g.emit("\timulq $%d, %%rax", sizeOf(inst.ElemType))
+		} else {
+			g.emit("\tmovq $%d, %%rax", sizeOf(inst.ElemType))
+		}
+		g.emit("\taddq $15, %%rax")
+		g.emit("\tandq $-16, %%rax")
+		g.emit("\tsubq %%rax, %%rsp")
+		g.emit("\tmovq %%rsp, %%rax")
+		g.store(inst)
+
+	case *ir.InstLoad:
+		g.load(inst.Src, "%rax")
+		switch sizeOf(inst.ElemType) {
+		case 1:
+			g.emit("\tmovzbq (%%rax), %%rax")
+		case 2:
+			g.emit("\tmovzwq (%%rax), %%rax")
+		case 4:
+			g.emit("\tmovl (%%rax), %%eax")
+		case 8:
+			g.emit("\tmovq (%%rax), %%rax")
+		default:
+			nativeErrorf("%s: unsupported load of %s", g.fn.Name(), inst.ElemType)
+		}
+		g.store(inst)
+
+	case *ir.InstStore:
+		g.load(inst.Src, "%rax")
+		g.load(inst.Dst, "%rcx")
+		switch sizeOf(inst.Src.Type()) {
+		case 1:
+			g.emit("\tmovb %%al, (%%rcx)")
+		case 2:
+			g.emit("\tmovw %%ax, (%%rcx)")
+		case 4:
+			g.emit("\tmovl %%eax, (%%rcx)")
+		case 8:
+			g.emit("\tmovq %%rax, (%%rcx)")
+		default:
+			nativeErrorf("%s: unsupported store of %s", g.fn.Name(), inst.Src.Type())
+		}
+
+	case *ir.InstGetElementPtr:
+		g.load(inst.Src, "%rax")
+		var offset int64
+		gepScales(inst.ElemType, len(inst.Indices), func(i int, scale int64) {
+			if _, ok := inst.Indices[i].(constant.Constant); ok {
+				offset += g.index(inst.Indices[i]) * scale
+				return
+			}
+			g.load(inst.Indices[i], "%rcx")
+			g.signExtendReg("%rcx", bitSize(inst.Indices[i].Type()))
+			switch scale {
+			case 1, 2, 4, 8:
+				g.emit("\tleaq (%%rax,%%rcx,%d), %%rax", scale)
+			default:
+				g.emit("\timulq $%d, %%rcx", scale)
+				g.emit("\taddq %%rcx, %%rax")
+			}
+		})
+		if offset == int64(int32(offset)) {
+			if offset != 0 {
+				g.emit("\taddq $%d, %%rax", offset)
+			}
+		} else {
+			g.emit("\tmovabsq $%d, %%rcx", offset)
+			g.emit("\taddq %%rcx, %%rax")
+		}
+		g.store(inst)
+
+	case *ir.InstPtrToInt:
+		g.load(inst.From, "%rax")
+		g.store(inst)
+	case *ir.InstIntToPtr:
+		g.load(inst.From, "%rax")
+		g.store(inst)
+	case *ir.InstBitCast:
+		g.load(inst.From, "%rax")
+		g.store(inst)
+	case *ir.InstZExt:
+		g.load(inst.From, "%rax")
+		g.store(inst)
+	case *ir.InstSExt:
+		g.load(inst.From, "%rax")
+		g.signExtendReg("%rax", bitSize(inst.From.Type()))
+		g.truncReg("%rax", bitSize(inst.To))
+		g.store(inst)
+	case *ir.InstTrunc:
+		g.load(inst.From, "%rax")
+		g.truncReg("%rax", bitSize(inst.To))
+		g.store(inst)
+
+	case *ir.InstAdd:
+		g.binary(inst, inst.X, inst.Y, false, "\taddq %rcx, %rax")
+	case *ir.InstSub:
+		g.binary(inst, inst.X, inst.Y, false, "\tsubq %rcx, %rax")
+	case *ir.InstMul:
+		g.binary(inst, inst.X, inst.Y, false, "\timulq %rcx, %rax")
+	case *ir.InstSDiv:
+		g.binary(inst, inst.X, inst.Y, true, "\tcqto\n\tidivq %rcx")
+	case *ir.InstSRem:
+		g.binary(inst, inst.X, inst.Y, true, "\tcqto\n\tidivq %rcx\n\tmovq %rdx, %rax")
+	case *ir.InstUDiv:
+		g.binary(inst, inst.X, inst.Y, false, "\txorl %edx, %edx\n\tdivq %rcx")
+	case *ir.InstURem:
+		g.binary(inst, inst.X, inst.Y, false, "\txorl %edx, %edx\n\tdivq %rcx\n\tmovq %rdx, %rax")
+	case *ir.InstAnd:
+		g.binary(inst, inst.X, inst.Y, false, "\tandq %rcx, %rax")
+	case *ir.InstOr:
+		g.binary(inst, inst.X, inst.Y, false, "\torq %rcx, %rax")
+	case *ir.InstXor:
+		g.binary(inst, inst.X, inst.Y, false, "\txorq %rcx, %rax")
+	case *ir.InstShl:
+		g.binary(inst, inst.X, inst.Y, false, "\tshlq %cl, %rax")
+	case *ir.InstAShr:
+		g.binary(inst, inst.X, inst.Y, true, "\tsarq %cl, %rax")
+	case *ir.InstLShr:
+		g.binary(inst, inst.X, inst.Y, false, "\tshrq %cl, %rax")
+
+	case *ir.InstICmp:
+		cond, ok := nativeConds[inst.Pred]
+		if !ok {
+			nativeErrorf("%s: unsupported comparison %s", g.fn.Name(), inst.Pred)
+		}
+		g.load(inst.X, "%rax")
+		g.load(inst.Y, "%rcx")
+		if bits := bitSize(inst.X.Type()); bits < 64 {
+			g.signExtendReg("%rax", bits)
+			g.signExtendReg("%rcx", bits)
+		}
+		g.emit("\tcmpq %%rcx, %%rax")
+		g.emit("\tset%s %%al", cond)
+		g.emit("\tmovzbq %%al, %%rax")
+		g.store(inst)
+
+	case *ir.InstSelect:
+		g.load(inst.ValueTrue, "%rax")
+		g.load(inst.ValueFalse, "%rcx")
+		g.load(inst.Cond, "%rdx")
+		g.emit("\ttestq %%rdx, %%rdx")
+		g.emit("\tcmoveq %%rcx, %%rax")
+		g.store(inst)
+
+	case *ir.InstVAArg:
+		// The va_list holds the index of the next argument; missing
+		// arguments read whatever was in their registers.
+		stack, done := g.newLabel(), g.newLabel()
+		g.load(inst.ArgList, "%rcx")
+		g.emit("\tmovq (%%rcx), %%rdx")
+		g.emit("\taddq $1, (%%rcx)")
+		g.emit("\tcmpq $%d, %%rdx", len(nativeArgRegs))
+		g.emit("\tjae %s", stack)
+		g.emit("\tmovq %d(%%rbp,%%rdx,8), %%rax", paramOffset(0))
+		g.emit("\tjmp %s", done)
+		g.emit("%s:", stack)
+		g.emit("\tmovq %d(%%rbp,%%rdx,8), %%rax", paramOffset(len(nativeArgRegs))-8*len(nativeArgRegs))
+		g.emit("%s:", done)
+		g.store(inst)
+
+	case *ir.InstCall:
+		g.call(inst)
+
+	default:
+		nativeErrorf("%s: unsupported instruction %s", g.fn.Name(), inst.LLString())
+	}
+}
+
+// binary emits an arithmetic instruction with operands in %rax and
+// %rcx. Operands narrower than a word are sign-extended first when
+// the operation is signed.
+func (g *nativeGen) binary(inst value.Value, x, y value.Value, signed bool, code string) {
+	bits := bitSize(inst.Type())
+	g.load(x, "%rax")
+	g.load(y, "%rcx")
+	if signed {
+		g.signExtendReg("%rax", bits)
+		g.signExtendReg("%rcx", bits)
+	}
+	g.emit("%s", code)
+	g.truncReg("%rax", bits)
+	g.store(inst)
+}
+
+// call emits a call, passing arguments by the System V convention.
+func (g *nativeGen) call(inst *ir.InstCall) {
+	// Find a direct callee, possibly cast to another function type
+	callee := inst.Callee
+	if cast, ok := callee.(*ir.InstBitCast); ok {
+		if fn, ok := cast.From.(*ir.Func); ok {
+			callee = fn
+		}
+	}
+	if cast, ok := callee.(*constant.ExprBitCast); ok {
+		if fn, ok := cast.From.(*ir.Func); ok {
+			callee = fn
+		}
+	}
+	fn, direct := callee.(*ir.Func)
+	if direct {
+		switch name := fn.Name(); {
+		case name == "llvm.va_start":
+			g.load(inst.Args[0], "%rcx")
+			g.emit("\tmovq $%d, (%%rcx)", len(g.fn.Params))
+			return
+		case name == "llvm.va_end":
+			return
+		case name == "llvm.stacksave":
+			g.emit("\tmovq %%rsp, %%rax")
+			g.store(inst)
+			return
+		case strings.HasPrefix(name, "llvm."):
+			nativeErrorf("%s: unsupported intrinsic %s", g.fn.Name(), name)
+		}
+	}
+
+	// A musttail call in registers jumps to the callee with the frame
+	// of the caller released
+	if direct && inst.Tail == enum.TailMustTail && len(inst.Args) <= len(nativeArgRegs) {
+		for i, arg := range inst.Args {
+			g.load(arg, nativeArgRegs[i])
+		}
+		g.emit("\tleave")
+		g.emit("\tjmp %s", symbol(fn.Name(), fn.Linkage))
+		return
+	}
+
+	// Arguments past the sixth go on the stack, which stays aligned
+	nstack := len(inst.Args) - len(nativeArgRegs)
+	if nstack < 0 {
+		nstack = 0
+	}
+	if nstack%2 != 0 {
+		g.emit("\tsubq $8, %%rsp")
+	}
+	for i := len(inst.Args) - 1; i >= len(nativeArgRegs); i-- {
+		g.load(inst.Args[i], "%rax")
+		g.emit("\tpushq %%rax")
+	}
+	if !direct {
+		g.load(inst.Callee, "%r11")
+	}
+	for i, arg := range inst.Args {
+		if i < len(nativeArgRegs) {
+			g.load(arg, nativeArgRegs[i])
+		}
+	}
+
+	// No vector registers are used by variadic calls
+	g.emit("\txorl %%eax, %%eax")
+	if direct {
+		g.emit("\tcall %s", symbol(fn.Name(), fn.Linkage))
+	} else {
+		g.emit("\tcall *%%r11")
+	}
+	if nstack > 0 {
+		g.emit("\taddq $%d, %%rsp", 8*(nstack+nstack%2))
+	}
+	if _, ok := g.slots[inst]; ok {
+		g.store(inst)
+	}
+}
+
+// term emits the code of a terminator.
+func (g *nativeGen) term(b *ir.Block) {
+	switch term := b.Term.(type) {
+	case *ir.TermRet:
+		if term.X != nil {
+			g.load(term.X, "%rax")
+		}
+		g.emit("\tleave")
+		g.emit("\tret")
+
+	case *ir.TermBr:
+		g.jump(b, term.Target.(*ir.Block))
+
+	case *ir.TermCondBr:
+		g.load(term.Cond, "%rax")
+		g.emit("\ttestq %%rax, %%rax")
+		g.emit("\tjz %s", g.edge(b, term.TargetFalse.(*ir.Block)))
+		g.jump(b, term.TargetTrue.(*ir.Block))
+
+	case *ir.TermSwitch:
+		g.load(term.X, "%rax")
+		for _, c := range term.Cases {
+			_, k := g.constant(c.X.(constant.Constant))
+			if k == int64(int32(k)) {
+				g.emit("\tcmpq $%d, %%rax", k)
+			} else {
+				g.emit("\tmovabsq $%d, %%rcx", k)
+				g.emit("\tcmpq %%rcx, %%rax")
+			}
+			g.emit("\tje %s", g.edge(b, c.Target.(*ir.Block)))
+		}
+		g.jump(b, term.TargetDefault.(*ir.Block))
+
+	case *ir.TermUnreachable:
+		g.emit("\tud2")
+
+	default:
+		nativeErrorf("%s: unsupported terminator %s", g.fn.Name(), term.LLString())
+	}
+}
+
+// jump emits an unconditional branch from one block to another.
+func (g *nativeGen) jump(from, to *ir.Block) {
+	g.phiCopies(from, to)
+	g.emit("\tjmp %s", g.labels[to])
+}
+
+// edge returns the label for a conditional branch from one block to
+// another; when the target has phis, the copies go into a stub.
+func (g *nativeGen) edge(from, to *ir.Block) string {
+	if !hasPhis(to) {
+		return g.labels[to]
+	}
+	label := g.newLabel()
+	g.stubs = append(g.stubs, func() {
+		g.emit("%s:", label)
+		g.jump(from, to)
+	})
+	return label
+}
+
+func hasPhis(b *ir.Block) bool {
+	if len(b.Insts) == 0 {
+		return false
+	}
+	_, ok := b.Insts[0].(*ir.InstPhi)
+	return ok
+}
+
+// phiCopies sets the phis of a block for the edge from a predecessor.
+// Values go through the stack, so that phis may refer to each other.
+func (g *nativeGen) phiCopies(from, to *ir.Block) {
+	var phis []*ir.InstPhi
+	for _, inst := range to.Insts {
+		phi, ok := inst.(*ir.InstPhi)
+		if !ok {
+			break
+		}
+		for _, inc := range phi.Incs {
+			if inc.Pred == from {
+				g.load(inc.X, "%rax")
+				g.emit("\tpushq %%rax")
+				phis = append(phis, phi)
+				break
+			}
+		}
+	}
+	for i := len(phis) - 1; i >= 0; i-- {
+		g.emit("\tpopq %%rax")
+		g.store(phis[i])
+	}
+}
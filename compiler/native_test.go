@@ -0,0 +1,167 @@
+package compiler
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestNativeAssembly tests the assembly generated for globals and functions
+func TestNativeAssembly(t *testing.T) {
+	code := `count;
+table[2] 'ab', -1;
+add(a, b) return (a + b);
+main() {
+    extrn count, table;
+    count = add(table[1], 2);
+    printf("%d*n", count);
+}`
+	args := NewCompileOptions("blang", []string{"native.b"})
+	compiler := NewCompiler(args)
+	if err := ParseDeclarations(NewLexer(args, strings.NewReader(code)), compiler); err != nil {
+		t.Fatalf("ParseDeclarations failed: %v", err)
+	}
+	asm, err := GenerateNative(compiler.GetModule())
+	if err != nil {
+		t.Fatalf("GenerateNative failed: %v", err)
+	}
+
+	for _, want := range []string{
+		"\t.comm b.count,8,8\n",
+		"\t.globl b.table\n",
+		"b.table:\n\t.quad b.table+8\n\t.quad 24930\n\t.quad -1\n",
+		".Lstr.0:\n\t.ascii \"%d\\012\\000\"\n",
+		"\t.globl b.add\n",
+		"\t.globl main\n",
+		"\tcall .Lbody.add\n",
+		".Lbody.add:\n",
+		"\tcall b.printf\n",
+		"\t.section .note.GNU-stack",
+	} {
+		if !strings.Contains(asm, want) {
+			t.Errorf("assembly does not contain %q:\n%s", want, asm)
+		}
+	}
+}
+
+// TestNativeExamples builds the example programs with the native backend
+// and compares their output with the interpreter
+func TestNativeExamples(t *testing.T) {
+	if !nativeAvailable() {
+		t.Skip("native backend needs as, ld and runtime/libb.a on x86_64 Linux")
+	}
+	tests := []struct {
+		name  string
+		file  string
+		input string
+	}{
+		{"hello", "../examples/hello.b", ""},
+		{"fizzbuzz", "../examples/fizzbuzz.b", ""},
+		{"showcase", "../examples/showcase.b", ""},
+		{"e2", "../examples/e-2.b", ""},
+		{"pdp7_compiler", "../examples/b.b", "main() { extrn x; x = 'ab' + 1; }"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want, _, err := interpretFiles(t, []string{tt.file}, tt.input)
+			if err != nil {
+				t.Fatalf("Interpreter failed: %v", err)
+			}
+
+			exeFile := filepath.Join(t.TempDir(), tt.name)
+			linkNativeForTest(t, tt.file, exeFile)
+			cmd := exec.Command(exeFile)
+			cmd.Stdin = strings.NewReader(tt.input)
+			got, err := cmd.Output()
+			if err != nil {
+				t.Fatalf("Run failed: %v", err)
+			}
+			if string(got) != want {
+				t.Errorf("output mismatch (-interpreter +native):\n%s", buildLineDiff(want, string(got)))
+			}
+		})
+	}
+}
+
+// TestNativeArgsAndFiles tests arguments and globals shared between files
+func TestNativeArgsAndFiles(t *testing.T) {
+	if !nativeAvailable() {
+		t.Skip("native backend needs as, ld and runtime/libb.a on x86_64 Linux")
+	}
+	dir := t.TempDir()
+	main := writeTempFile(t, dir, "main.b", `main(argv) {
+    extrn argv, counter;
+    bump(); bump();
+    printf("%d %s %d*n", argv[0], argv[2], counter);
+    return (7);
+}`)
+	lib := writeTempFile(t, dir, "lib.b", `counter 40;
+bump() {
+    extrn counter;
+    counter++;
+}`)
+	exeFile := filepath.Join(dir, "prog")
+	args := NewCompileOptions("blang", []string{main, lib})
+	args.Backend = BackendNative
+	args.OutputFile = exeFile
+	args.LibraryDirs = []string{"../runtime"}
+	if err := Compile(args); err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+	out, status := runExecutable(t, exeFile, "arg")
+	if want := "2 arg 42\n"; string(out) != want {
+		t.Errorf("got %q, want %q", out, want)
+	}
+	if status != 7 {
+		t.Errorf("exit code = %d, want 7", status)
+	}
+}
+
+// TestNativeUnsupportedInput tests that LLVM IR input is rejected
+func TestNativeUnsupportedInput(t *testing.T) {
+	dir := t.TempDir()
+	llFile := writeTempFile(t, dir, "x.ll", "define i64 @main() {\n\tret i64 0\n}\n")
+	args := NewCompileOptions("blang", []string{llFile})
+	args.Backend = BackendNative
+	args.OutputType = OutputAssembly
+	args.OutputFile = filepath.Join(dir, "x.s")
+	err := Compile(args)
+	if err == nil || !strings.Contains(err.Error(), "native backend") {
+		t.Errorf("error = %v, want native backend error", err)
+	}
+	if _, err := os.Stat(args.OutputFile); err == nil {
+		t.Errorf("output should not be created")
+	}
+}
+
+// TestNativeTailRecursion tests that tail recursion takes no stack,
+// with one parameter as with two, deeper than the stack of 8 MiB
+func TestNativeTailRecursion(t *testing.T) {
+	if !nativeAvailable() {
+		t.Skip("native backend needs as, ld and runtime/libb.a on x86_64 Linux")
+	}
+	dir := t.TempDir()
+	bFile := writeTempFile(t, dir, "deep.b", `down(n, s) {
+    if (n == 0)
+        return (s);
+    return (down(n - 1, s + n));
+}
+
+count(n) {
+    if (n == 0)
+        return (0);
+    return (count(n - 1));
+}
+
+main() printf("%d %d*n", down(10000000, 0), count(10000000));
+`)
+	exeFile := filepath.Join(dir, "deep")
+	linkNativeForTest(t, bFile, exeFile)
+	out, status := runExecutable(t, exeFile)
+	if want := "50000005000000 0\n"; string(out) != want || status != 0 {
+		t.Errorf("got %q, exit code %d, want %q", out, status, want)
+	}
+}
@@ -0,0 +1,941 @@
+package compiler
+
+import (
+	"math/big"
+
+	"github.com/llir/llvm/ir"
+	"github.com/llir/llvm/ir/constant"
+	"github.com/llir/llvm/ir/enum"
+	"github.com/llir/llvm/ir/types"
+	"github.com/llir/llvm/ir/value"
+)
+
+//
+// Optimization of the IR, with -O1 and above, before it is written
+// with --emit-llvm or passed to clang or the native backend. The
+// compiler translates each statement on its own: every variable lives
+// in memory, every use loads it again, and every condition is turned
+// into a word and back. The passes clean up what it leaves:
+//
+//   - blocks which cannot be reached, as after a return or a goto, are
+//     removed; a block which only jumps is bypassed, and a block with a
+//     single predecessor is joined to it
+//   - scalar variables and parameters whose address is never taken are
+//     promoted from memory to values, with phis where paths join
+//   - expressions of constants are folded, and so are branches on them;
+//     a value which only copies another one, as x + 0 or a phi with a
+//     single incoming value, is replaced by it
+//   - instructions without effect whose results are unused are removed,
+//     then the private constants and declarations no longer used
+//
+// The passes repeat until nothing changes. Clang optimizes further; the
+// passes keep the IR readable, and spare work to the native backend.
+//
+
+// optimize runs the passes over every function of the module
+func optimize(module *ir.Module) {
+	for _, fn := range module.Funcs {
+		if len(fn.Blocks) > 0 {
+			optimizeFunc(fn)
+		}
+	}
+	removeUnusedGlobals(module)
+}
+
+// optimizeFunc runs the passes over a function
+func optimizeFunc(fn *ir.Func) {
+	simplifyCFG(fn)
+	promoteAllocas(fn)
+	for {
+		changed := simplifyInsts(fn)
+		changed = removeDeadInsts(fn) || changed
+		changed = simplifyCFG(fn) || changed
+		if !changed {
+			break
+		}
+	}
+}
+
+//
+// Control flow
+//
+
+// successors returns the targets of a terminator, one per edge. They
+// are read from the operands: llir caches the successors of a
+// terminator, which are out of date once a target is replaced.
+func successors(term ir.Terminator) []*ir.Block {
+	var succs []*ir.Block
+	for _, op := range term.Operands() {
+		if b, ok := (*op).(*ir.Block); ok {
+			succs = append(succs, b)
+		}
+	}
+	return succs
+}
+
+// retarget replaces the target from of a terminator by to
+func retarget(term ir.Terminator, from, to *ir.Block) {
+	for _, op := range term.Operands() {
+		if *op == value.Value(from) {
+			*op = to
+		}
+	}
+	switch term := term.(type) {
+	case *ir.TermBr:
+		term.Successors = nil
+	case *ir.TermCondBr:
+		term.Successors = nil
+	case *ir.TermSwitch:
+		term.Successors = nil
+	}
+}
+
+// predecessors returns the predecessors of every block, one per edge
+func predecessors(fn *ir.Func) map[*ir.Block][]*ir.Block {
+	preds := make(map[*ir.Block][]*ir.Block)
+	for _, b := range fn.Blocks {
+		for _, s := range successors(b.Term) {
+			preds[s] = append(preds[s], b)
+		}
+	}
+	return preds
+}
+
+// phis returns the phis at the start of a block
+func phis(b *ir.Block) []*ir.InstPhi {
+	var list []*ir.InstPhi
+	for _, inst := range b.Insts {
+		phi, ok := inst.(*ir.InstPhi)
+		if !ok {
+			break
+		}
+		list = append(list, phi)
+	}
+	return list
+}
+
+// dropIncoming removes from the phis of a block the value of one edge
+// from pred, or of all of them
+func dropIncoming(b, pred *ir.Block, all bool) {
+	for _, phi := range phis(b) {
+		incs := phi.Incs[:0]
+		dropped := false
+		for _, inc := range phi.Incs {
+			if inc.Pred == value.Value(pred) && (all || !dropped) {
+				dropped = true
+				continue
+			}
+			incs = append(incs, inc)
+		}
+		phi.Incs = incs
+	}
+}
+
+// simplifyCFG removes the blocks which cannot be reached, folds
+// branches whose targets are the same, bypasses blocks which only
+// jump and joins blocks to their single predecessor. It reports
+// whether the function changed.
+func simplifyCFG(fn *ir.Func) bool {
+	changed := false
+	for removeUnreachable(fn) || simplifyBranch(fn) {
+		changed = true
+	}
+	return changed
+}
+
+// removeUnreachable removes the blocks not reached from the entry
+func removeUnreachable(fn *ir.Func) bool {
+	reached := map[*ir.Block]bool{}
+	var visit func(b *ir.Block)
+	visit = func(b *ir.Block) {
+		if reached[b] {
+			return
+		}
+		reached[b] = true
+		for _, s := range successors(b.Term) {
+			visit(s)
+		}
+	}
+	visit(fn.Blocks[0])
+	if len(reached) == len(fn.Blocks) {
+		return false
+	}
+
+	var kept []*ir.Block
+	for _, b := range fn.Blocks {
+		if reached[b] {
+			kept = append(kept, b)
+			continue
+		}
+		for _, s := range successors(b.Term) {
+			if reached[s] {
+				dropIncoming(s, b, true)
+			}
+		}
+	}
+	fn.Blocks = kept
+	return true
+}
+
+// simplifyBranch makes one change to the branches, if any
+func simplifyBranch(fn *ir.Func) bool {
+	preds := predecessors(fn)
+	entry := fn.Blocks[0]
+	for i, b := range fn.Blocks {
+		switch term := b.Term.(type) {
+		case *ir.TermCondBr:
+			if term.TargetTrue == term.TargetFalse {
+				target := term.TargetTrue.(*ir.Block)
+				dropIncoming(target, b, false)
+				b.Term = ir.NewBr(target)
+				return true
+			}
+
+		case *ir.TermBr:
+			target := term.Target.(*ir.Block)
+			if target == b || target == entry {
+				continue
+			}
+
+			// A block which only jumps: its predecessors jump further
+			if b != entry && len(b.Insts) == 0 && len(phis(target)) == 0 {
+				for _, p := range preds[b] {
+					retarget(p.Term, b, target)
+				}
+				fn.Blocks = append(fn.Blocks[:i], fn.Blocks[i+1:]...)
+				return true
+			}
+
+			// The single predecessor of the target: join them
+			if len(preds[target]) == 1 {
+				repl := map[value.Value]value.Value{}
+				for _, phi := range phis(target) {
+					repl[phi] = phi.Incs[0].X
+				}
+				b.Insts = append(b.Insts, target.Insts[len(repl):]...)
+				b.Term = target.Term
+				for _, s := range successors(b.Term) {
+					for _, phi := range phis(s) {
+						for _, inc := range phi.Incs {
+							if inc.Pred == value.Value(target) {
+								inc.Pred = b
+							}
+						}
+					}
+				}
+				for j, t := range fn.Blocks {
+					if t == target {
+						fn.Blocks = append(fn.Blocks[:j], fn.Blocks[j+1:]...)
+						break
+					}
+				}
+				replaceUses(fn, repl)
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// replaceUses replaces the operands of the function found in repl
+func replaceUses(fn *ir.Func, repl map[value.Value]value.Value) {
+	if len(repl) == 0 {
+		return
+	}
+	resolve := func(op *value.Value) {
+		for {
+			v, ok := repl[*op]
+			if !ok {
+				return
+			}
+			*op = v
+		}
+	}
+	for _, b := range fn.Blocks {
+		for _, inst := range b.Insts {
+			for _, op := range inst.Operands() {
+				resolve(op)
+			}
+		}
+		for _, op := range b.Term.Operands() {
+			resolve(op)
+		}
+	}
+}
+
+//
+// Promotion of variables
+//
+
+// dominators returns the immediate dominator of every block reached
+// from the entry, which is its own, by the algorithm of Cooper, Harvey
+// and Kennedy, and the blocks in reverse postorder
+func dominators(fn *ir.Func) (map[*ir.Block]*ir.Block, []*ir.Block) {
+	var order []*ir.Block
+	seen := map[*ir.Block]bool{}
+	var visit func(b *ir.Block)
+	visit = func(b *ir.Block) {
+		seen[b] = true
+		for _, s := range successors(b.Term) {
+			if !seen[s] {
+				visit(s)
+			}
+		}
+		order = append(order, b)
+	}
+	visit(fn.Blocks[0])
+	number := map[*ir.Block]int{}
+	for i, j := 0, len(order)-1; i < j; i, j = i+1, j-1 {
+		order[i], order[j] = order[j], order[i]
+	}
+	for i, b := range order {
+		number[b] = i
+	}
+
+	preds := predecessors(fn)
+	idom := map[*ir.Block]*ir.Block{order[0]: order[0]}
+	intersect := func(a, b *ir.Block) *ir.Block {
+		for a != b {
+			for number[a] > number[b] {
+				a = idom[a]
+			}
+			for number[b] > number[a] {
+				b = idom[b]
+			}
+		}
+		return a
+	}
+	for changed := true; changed; {
+		changed = false
+		for _, b := range order[1:] {
+			var dom *ir.Block
+			for _, p := range preds[b] {
+				if idom[p] == nil {
+					continue
+				}
+				if dom == nil {
+					dom = p
+				} else {
+					dom = intersect(p, dom)
+				}
+			}
+			if idom[b] != dom {
+				idom[b] = dom
+				changed = true
+			}
+		}
+	}
+	return idom, order
+}
+
+// promotable returns the allocas of scalars which are only loaded and
+// stored to, so that their values can be followed without memory.
+// A B program may reach the variables next to one whose address it
+// takes, as the arguments after the first: then none is promoted.
+func promotable(fn *ir.Func) map[*ir.InstAlloca]bool {
+	allocas := map[*ir.InstAlloca]bool{}
+	for _, b := range fn.Blocks {
+		for _, inst := range b.Insts {
+			if a, ok := inst.(*ir.InstAlloca); ok && a.NElems == nil {
+				if _, ok := a.ElemType.(*types.IntType); ok {
+					allocas[a] = true
+				}
+			}
+		}
+	}
+	if escapes(allocas, fn) {
+		return nil
+	}
+	return allocas
+}
+
+// escapes reports whether the address of one of the allocas is used in
+// the function otherwise than to load or store a value
+func escapes(allocas map[*ir.InstAlloca]bool, fn *ir.Func) bool {
+	escaped := false
+	escape := func(v value.Value) {
+		if a, ok := v.(*ir.InstAlloca); ok && allocas[a] {
+			escaped = true
+		}
+	}
+	for _, b := range fn.Blocks {
+		for _, inst := range b.Insts {
+			switch inst := inst.(type) {
+			case *ir.InstLoad:
+				// The address loaded from does not escape
+			case *ir.InstStore:
+				escape(inst.Src)
+			default:
+				for _, op := range inst.Operands() {
+					escape(*op)
+				}
+			}
+		}
+		for _, op := range b.Term.Operands() {
+			escape(*op)
+		}
+	}
+	return escaped
+}
+
+// promoteAllocas replaces the loads and stores of promotable variables
+// by the values stored, with phis in the blocks where different values
+// meet. A variable read before any store has the value 0.
+func promoteAllocas(fn *ir.Func) {
+	allocas := promotable(fn)
+	if len(allocas) == 0 {
+		return
+	}
+	idom, order := dominators(fn)
+	preds := predecessors(fn)
+
+	// Dominance frontiers
+	frontier := map[*ir.Block][]*ir.Block{}
+	for _, b := range order {
+		if len(preds[b]) < 2 {
+			continue
+		}
+		for _, p := range preds[b] {
+			for runner := p; runner != idom[b]; runner = idom[runner] {
+				frontier[runner] = append(frontier[runner], b)
+			}
+		}
+	}
+
+	// Phis where the stores of each variable meet
+	defs := map[*ir.InstAlloca][]*ir.Block{}
+	for _, b := range order {
+		for _, inst := range b.Insts {
+			if st, ok := inst.(*ir.InstStore); ok {
+				if a, ok := st.Dst.(*ir.InstAlloca); ok && allocas[a] {
+					defs[a] = append(defs[a], b)
+				}
+			}
+		}
+	}
+	phiOf := map[*ir.InstPhi]*ir.InstAlloca{}
+	for _, b := range order {
+		// Visit the variables in a fixed order, so that the output is stable
+		for _, inst := range b.Insts {
+			a, ok := inst.(*ir.InstAlloca)
+			if !ok || !allocas[a] {
+				continue
+			}
+			placed := map[*ir.Block]bool{}
+			work := append([]*ir.Block(nil), defs[a]...)
+			for len(work) > 0 {
+				d := work[len(work)-1]
+				work = work[:len(work)-1]
+				for _, y := range frontier[d] {
+					if placed[y] {
+						continue
+					}
+					placed[y] = true
+					phi := &ir.InstPhi{Typ: a.ElemType}
+					phiOf[phi] = a
+					y.Insts = append([]ir.Instruction{phi}, y.Insts...)
+					work = append(work, y)
+				}
+			}
+		}
+	}
+
+	// Follow the values along the dominator tree
+	children := map[*ir.Block][]*ir.Block{}
+	for _, b := range order[1:] {
+		children[idom[b]] = append(children[idom[b]], b)
+	}
+	repl := map[value.Value]value.Value{}
+	resolve := func(v value.Value) value.Value {
+		for {
+			r, ok := repl[v]
+			if !ok {
+				return v
+			}
+			v = r
+		}
+	}
+	var rename func(b *ir.Block, current map[*ir.InstAlloca]value.Value)
+	rename = func(b *ir.Block, current map[*ir.InstAlloca]value.Value) {
+		insts := b.Insts[:0]
+		for _, inst := range b.Insts {
+			switch inst := inst.(type) {
+			case *ir.InstPhi:
+				if a, ok := phiOf[inst]; ok {
+					current[a] = inst
+				}
+			case *ir.InstAlloca:
+				if allocas[inst] {
+					continue
+				}
+			case *ir.InstLoad:
+				if a, ok := inst.Src.(*ir.InstAlloca); ok && allocas[a] {
+					repl[inst] = current[a]
+					continue
+				}
+			case *ir.InstStore:
+				if a, ok := inst.Dst.(*ir.InstAlloca); ok && allocas[a] {
+					current[a] = resolve(inst.Src)
+					continue
+				}
+			}
+			insts = append(insts, inst)
+		}
+		b.Insts = insts
+		for _, s := range successors(b.Term) {
+			for _, phi := range phis(s) {
+				if a, ok := phiOf[phi]; ok {
+					phi.Incs = append(phi.Incs, ir.NewIncoming(resolve(current[a]), b))
+				}
+			}
+		}
+		for _, c := range children[b] {
+			inner := make(map[*ir.InstAlloca]value.Value, len(current))
+			for a, v := range current {
+				inner[a] = v
+			}
+			rename(c, inner)
+		}
+	}
+	initial := map[*ir.InstAlloca]value.Value{}
+	for a := range allocas {
+		initial[a] = constant.NewInt(a.ElemType.(*types.IntType), 0)
+	}
+	rename(order[0], initial)
+	replaceUses(fn, repl)
+}
+
+//
+// Instructions
+//
+
+// simplifyInsts folds constants and propagates copies, then folds the
+// branches on constants. It reports whether the function changed.
+func simplifyInsts(fn *ir.Func) bool {
+	changed := false
+	repl := map[value.Value]value.Value{}
+	for _, b := range fn.Blocks {
+		insts := b.Insts[:0]
+		for _, inst := range b.Insts {
+			for _, op := range inst.Operands() {
+				for v, ok := repl[*op]; ok; v, ok = repl[*op] {
+					*op = v
+				}
+			}
+			if v := simplify(inst); v != nil {
+				repl[inst.(value.Value)] = v
+				changed = true
+				continue
+			}
+			insts = append(insts, inst)
+		}
+		b.Insts = insts
+	}
+	replaceUses(fn, repl)
+
+	for _, b := range fn.Blocks {
+		term, ok := b.Term.(*ir.TermCondBr)
+		if !ok {
+			continue
+		}
+		if k, ok := term.Cond.(*constant.Int); ok {
+			taken, other := term.TargetTrue.(*ir.Block), term.TargetFalse.(*ir.Block)
+			if k.X.Sign() == 0 {
+				taken, other = other, taken
+			}
+			dropIncoming(other, b, false)
+			b.Term = ir.NewBr(taken)
+			changed = true
+		}
+	}
+	return changed
+}
+
+// simplify returns the value an instruction always has, or nil
+func simplify(inst ir.Instruction) value.Value {
+	switch inst := inst.(type) {
+	case *ir.InstAdd:
+		return simplifyBinary('+', inst.X, inst.Y)
+	case *ir.InstSub:
+		return simplifyBinary('-', inst.X, inst.Y)
+	case *ir.InstMul:
+		return simplifyBinary('*', inst.X, inst.Y)
+	case *ir.InstSDiv:
+		return simplifyBinary('/', inst.X, inst.Y)
+	case *ir.InstSRem:
+		return simplifyBinary('%', inst.X, inst.Y)
+	case *ir.InstAnd:
+		return simplifyBinary('&', inst.X, inst.Y)
+	case *ir.InstOr:
+		return simplifyBinary('|', inst.X, inst.Y)
+	case *ir.InstXor:
+		return simplifyBinary('^', inst.X, inst.Y)
+	case *ir.InstShl:
+		return simplifyBinary('<', inst.X, inst.Y)
+	case *ir.InstAShr:
+		return simplifyBinary('>', inst.X, inst.Y)
+	case *ir.InstLShr:
+		return simplifyBinary('}', inst.X, inst.Y)
+	case *ir.InstICmp:
+		return simplifyICmp(inst)
+	case *ir.InstZExt:
+		if k, ok := inst.From.(*constant.Int); ok {
+			return newInt(inst.To, unsigned(k))
+		}
+	case *ir.InstSExt:
+		if k, ok := inst.From.(*constant.Int); ok {
+			return newInt(inst.To, signed(k))
+		}
+	case *ir.InstTrunc:
+		if k, ok := inst.From.(*constant.Int); ok {
+			return newInt(inst.To, k.X)
+		}
+	case *ir.InstSelect:
+		if k, ok := inst.Cond.(*constant.Int); ok {
+			if k.X.Sign() != 0 {
+				return inst.ValueTrue
+			}
+			return inst.ValueFalse
+		}
+		if inst.ValueTrue == inst.ValueFalse {
+			return inst.ValueTrue
+		}
+	case *ir.InstPhi:
+		// A phi whose incoming values are itself or one other value
+		var only value.Value
+		for _, x := range incoming(inst) {
+			if x == value.Value(inst) || x == only {
+				continue
+			}
+			if only != nil {
+				return nil
+			}
+			only = x
+		}
+		return only
+	}
+	return nil
+}
+
+// incoming returns the incoming values of a phi
+func incoming(phi *ir.InstPhi) []value.Value {
+	vals := make([]value.Value, len(phi.Incs))
+	for i, inc := range phi.Incs {
+		vals[i] = inc.X
+	}
+	return vals
+}
+
+// simplifyBinary folds a binary operation on two constants, or one
+// whose result is an operand or zero
+func simplifyBinary(op rune, x, y value.Value) value.Value {
+	typ, ok := x.Type().(*types.IntType)
+	if !ok {
+		return nil
+	}
+	kx, constX := x.(*constant.Int)
+	ky, constY := y.(*constant.Int)
+	if constX && constY {
+		if r := fold(op, signed(kx), signed(ky), typ.BitSize); r != nil {
+			return newInt(typ, r)
+		}
+		return nil
+	}
+
+	is := func(k *constant.Int, ok bool, n int64) bool {
+		return ok && signed(k).IsInt64() && signed(k).Int64() == n
+	}
+	switch {
+	case is(ky, constY, 0) && (op == '+' || op == '-' || op == '|' || op == '^' || op == '<' || op == '>' || op == '}'):
+		return x
+	case is(kx, constX, 0) && (op == '+' || op == '|' || op == '^'):
+		return y
+	case is(ky, constY, 1) && (op == '*' || op == '/'):
+		return x
+	case is(kx, constX, 1) && op == '*':
+		return y
+	case is(ky, constY, -1) && op == '&':
+		return x
+	case is(kx, constX, -1) && op == '&':
+		return y
+	case (is(kx, constX, 0) || is(ky, constY, 0)) && (op == '*' || op == '&'):
+		return constant.NewInt(typ, 0)
+	case x == y && (op == '-' || op == '^'):
+		return constant.NewInt(typ, 0)
+	case x == y && (op == '&' || op == '|'):
+		return x
+	}
+	return nil
+}
+
+// fold computes a binary operation on words of the given size, or
+// returns nil when its result is undefined
+func fold(op rune, x, y *big.Int, bits uint64) *big.Int {
+	r := new(big.Int)
+	switch op {
+	case '+':
+		return r.Add(x, y)
+	case '-':
+		return r.Sub(x, y)
+	case '*':
+		return r.Mul(x, y)
+	case '/', '%':
+		min := new(big.Int).Neg(new(big.Int).Lsh(big.NewInt(1), uint(bits-1)))
+		if y.Sign() == 0 || (x.Cmp(min) == 0 && y.Cmp(big.NewInt(-1)) == 0) {
+			return nil
+		}
+		if op == '/' {
+			return r.Quo(x, y)
+		}
+		return r.Rem(x, y)
+	case '&':
+		return r.And(x, y)
+	case '|':
+		return r.Or(x, y)
+	case '^':
+		return r.Xor(x, y)
+	}
+
+	// Shifts by the size of a word or more are undefined
+	if y.Sign() < 0 || y.Cmp(big.NewInt(int64(bits))) >= 0 {
+		return nil
+	}
+	n := uint(y.Int64())
+	switch op {
+	case '<':
+		return r.Lsh(x, n)
+	case '>':
+		return r.Rsh(x, n)
+	default:
+		return r.Rsh(wrapUnsigned(x, bits), n)
+	}
+}
+
+// simplifyICmp folds a comparison of constants or of a value with
+// itself, and the test of a condition turned into a word
+func simplifyICmp(inst *ir.InstICmp) value.Value {
+	kx, constX := inst.X.(*constant.Int)
+	ky, constY := inst.Y.(*constant.Int)
+	if constX && constY {
+		x, y := signed(kx), signed(ky)
+		ux, uy := unsigned(kx), unsigned(ky)
+		var r bool
+		switch inst.Pred {
+		case enum.IPredEQ:
+			r = x.Cmp(y) == 0
+		case enum.IPredNE:
+			r = x.Cmp(y) != 0
+		case enum.IPredSLT:
+			r = x.Cmp(y) < 0
+		case enum.IPredSLE:
+			r = x.Cmp(y) <= 0
+		case enum.IPredSGT:
+			r = x.Cmp(y) > 0
+		case enum.IPredSGE:
+			r = x.Cmp(y) >= 0
+		case enum.IPredULT:
+			r = ux.Cmp(uy) < 0
+		case enum.IPredULE:
+			r = ux.Cmp(uy) <= 0
+		case enum.IPredUGT:
+			r = ux.Cmp(uy) > 0
+		case enum.IPredUGE:
+			r = ux.Cmp(uy) >= 0
+		default:
+			return nil
+		}
+		return constant.NewBool(r)
+	}
+	if inst.X == inst.Y {
+		switch inst.Pred {
+		case enum.IPredEQ, enum.IPredSLE, enum.IPredSGE, enum.IPredULE, enum.IPredUGE:
+			return constant.True
+		case enum.IPredNE, enum.IPredSLT, enum.IPredSGT, enum.IPredULT, enum.IPredUGT:
+			return constant.False
+		}
+	}
+
+	// The condition c of 'zext c != 0'
+	if z, ok := inst.X.(*ir.InstZExt); ok && inst.Pred == enum.IPredNE && constY && ky.X.Sign() == 0 {
+		if t, ok := z.From.Type().(*types.IntType); ok && t.BitSize == 1 {
+			return z.From
+		}
+	}
+	return nil
+}
+
+// signed returns the value of a constant as a signed number of its size
+func signed(k *constant.Int) *big.Int {
+	return wrapSigned(k.X, k.Typ.BitSize)
+}
+
+// unsigned returns the value of a constant as an unsigned number
+func unsigned(k *constant.Int) *big.Int {
+	return wrapUnsigned(k.X, k.Typ.BitSize)
+}
+
+// wrapUnsigned returns x modulo 2 to the power of bits
+func wrapUnsigned(x *big.Int, bits uint64) *big.Int {
+	mod := new(big.Int).Lsh(big.NewInt(1), uint(bits))
+	return new(big.Int).Mod(x, mod)
+}
+
+// wrapSigned returns x wrapped around to a signed number of the size
+func wrapSigned(x *big.Int, bits uint64) *big.Int {
+	r := wrapUnsigned(x, bits)
+	if r.Bit(int(bits-1)) != 0 {
+		r.Sub(r, new(big.Int).Lsh(big.NewInt(1), uint(bits)))
+	}
+	return r
+}
+
+// newInt returns the constant of the type which has the value x,
+// wrapped around to its size
+func newInt(typ types.Type, x *big.Int) value.Value {
+	t, ok := typ.(*types.IntType)
+	if !ok {
+		return nil
+	}
+	if t.BitSize == 1 {
+		return constant.NewBool(x.Bit(0) != 0)
+	}
+	k := constant.NewInt(t, 0)
+	k.X = wrapSigned(x, t.BitSize)
+	return k
+}
+
+// removeDeadInsts removes the instructions without effect whose
+// results are not used, even by each other in a loop. It reports
+// whether the function changed.
+func removeDeadInsts(fn *ir.Func) bool {
+	live := map[ir.Instruction]bool{}
+	var work []ir.Instruction
+	mark := func(ops []*value.Value) {
+		for _, op := range ops {
+			if inst, ok := (*op).(ir.Instruction); ok && !live[inst] {
+				live[inst] = true
+				work = append(work, inst)
+			}
+		}
+	}
+	for _, b := range fn.Blocks {
+		for _, inst := range b.Insts {
+			if !pure(inst) {
+				live[inst] = true
+				work = append(work, inst)
+			}
+		}
+		mark(b.Term.Operands())
+	}
+	for len(work) > 0 {
+		inst := work[len(work)-1]
+		work = work[:len(work)-1]
+		mark(inst.Operands())
+	}
+
+	changed := false
+	for _, b := range fn.Blocks {
+		insts := b.Insts[:0]
+		for _, inst := range b.Insts {
+			if live[inst] {
+				insts = append(insts, inst)
+			} else {
+				changed = true
+			}
+		}
+		b.Insts = insts
+	}
+	return changed
+}
+
+// pure reports whether an instruction has no effect but its result
+func pure(inst ir.Instruction) bool {
+	switch inst.(type) {
+	case *ir.InstAdd, *ir.InstSub, *ir.InstMul, *ir.InstSDiv, *ir.InstSRem, *ir.InstUDiv, *ir.InstURem,
+		*ir.InstAnd, *ir.InstOr, *ir.InstXor, *ir.InstShl, *ir.InstAShr, *ir.InstLShr,
+		*ir.InstICmp, *ir.InstZExt, *ir.InstSExt, *ir.InstTrunc, *ir.InstSelect, *ir.InstPhi,
+		*ir.InstPtrToInt, *ir.InstIntToPtr, *ir.InstBitCast, *ir.InstGetElementPtr, *ir.InstAlloca:
+		return true
+	}
+	return false
+}
+
+// removeUnusedGlobals removes the private globals, as strings, and the
+// declarations of functions which are no longer used
+func removeUnusedGlobals(module *ir.Module) {
+	used := map[value.Value]bool{}
+	known := true
+	var walk func(c constant.Constant)
+	walk = func(c constant.Constant) {
+		switch c := c.(type) {
+		case *ir.Global:
+			if !used[c] {
+				used[c] = true
+				if c.Init != nil {
+					walk(c.Init)
+				}
+			}
+		case *ir.Func:
+			used[c] = true
+		case *constant.ExprGetElementPtr:
+			walk(c.Src)
+			for _, index := range c.Indices {
+				walk(index)
+			}
+		case *constant.ExprPtrToInt:
+			walk(c.From)
+		case *constant.ExprIntToPtr:
+			walk(c.From)
+		case *constant.ExprBitCast:
+			walk(c.From)
+		case *constant.Array:
+			for _, elem := range c.Elems {
+				walk(elem)
+			}
+		case *constant.Struct:
+			for _, field := range c.Fields {
+				walk(field)
+			}
+		case constant.Expression:
+			known = false
+		}
+	}
+	walkOperands := func(ops []*value.Value) {
+		for _, op := range ops {
+			if c, ok := (*op).(constant.Constant); ok {
+				walk(c)
+			}
+		}
+	}
+	for _, g := range module.Globals {
+		if g.Linkage != enum.LinkagePrivate {
+			walk(g)
+		}
+	}
+	for _, fn := range module.Funcs {
+		for _, b := range fn.Blocks {
+			for _, inst := range b.Insts {
+				walkOperands(inst.Operands())
+			}
+			walkOperands(b.Term.Operands())
+		}
+	}
+	if !known {
+		return
+	}
+
+	globals := module.Globals[:0]
+	for _, g := range module.Globals {
+		if used[g] || g.Linkage != enum.LinkagePrivate {
+			globals = append(globals, g)
+		}
+	}
+	module.Globals = globals
+	funcs := module.Funcs[:0]
+	for _, fn := range module.Funcs {
+		if used[fn] || len(fn.Blocks) > 0 {
+			funcs = append(funcs, fn)
+		}
+	}
+	module.Funcs = funcs
+}
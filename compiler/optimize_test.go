@@ -0,0 +1,194 @@
+package compiler
+
+import (
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestOptimizePrograms tests that the passes keep the output of programs
+func TestOptimizePrograms(t *testing.T) {
+	programs := map[string]string{
+		"dead code": `main() {
+    auto i;
+    i = 1;
+    goto skip;
+    i = 2;
+skip:
+    printf("%d*n", i);
+    return (i);
+    printf("never*n");
+}`,
+		"loops and switch": `main() {
+    auto i, s, c;
+    i = s = 0;
+    while (i < 10) {
+        switch (i % 3) {
+        case 0:
+            s =+ i;
+        case 1:
+            s =+ 100;
+            goto next;
+        case 2:
+            if (i > 4) {
+                auto t;
+                t =+ i;
+                s = s - t;
+            }
+        }
+    next:
+        i++;
+    }
+    c = i > 5 ? s : -s;
+    printf("%d %d %d*n", i, s, c);
+}`,
+		"constants": `main() {
+    auto x, y, z;
+    x = 1 << 62;
+    y = x + x + x;
+    z = (x * 4) / -1;
+    printf("%d %d %d*n", y, z, -9 % 4);
+    printf("%d %d %d*n", -9 / 4, -1 >> 3, (7 & 3) | 8);
+    printf("%d %d %d*n", 3 < 4, 4 <= 3, 5 == 5);
+    if (0)
+        printf("never*n");
+    while (1) {
+        if (x == 1 << 62)
+            goto out;
+    }
+out:
+    return (x != 0);
+}`,
+		"neighbours": `f(a, b, c) {
+    auto p;
+    p = &a;
+    return (p[0] + p[1] + p[2]);
+}
+
+main() {
+    auto e, d, p;
+    d = 4;
+    e = 5;
+    p = &d;
+    printf("%d %d %d*n", f(1, 2, 3), p[0], p[1]);
+}`,
+		"swap in loop": `main() {
+    auto a, b, t, n;
+    a = 0;
+    b = 1;
+    n = 0;
+    while (n < 20) {
+        t = a;
+        a = b;
+        b = t + b;
+        n++;
+    }
+    printf("%d %d*n", a, b);
+}`,
+	}
+	files, _ := filepath.Glob("../examples/*.b")
+	for _, file := range files {
+		if name := filepath.Base(file); name == "e-2.b" || name == "b.b" {
+			continue // long, or waiting for input
+		}
+		src, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		programs[filepath.Base(file)] = string(src)
+	}
+
+	for name, src := range programs {
+		t.Run(name, func(t *testing.T) {
+			run := func(level int) string {
+				out, status, err := interpretFromCode(t, "prog", src, "", []Option{WithOptimize(level)})
+				if err != nil {
+					t.Fatalf("Run at -O%d failed: %v", level, err)
+				}
+				return fmt.Sprintf("%s(exit %d)", out, status)
+			}
+			want := run(0)
+			if got := run(1); got != want {
+				t.Errorf("optimized output differs:\n%s", buildLineDiff(want, got))
+			}
+		})
+	}
+}
+
+// TestOptimizeIR tests the IR of -O1: variables promoted, conditions
+// tested directly, dead code removed, and constants folded
+func TestOptimizeIR(t *testing.T) {
+	src := []byte(`f(n) {
+    auto i, s;
+    s = 0;
+    i = 0;
+    while (i < n) {
+        s =+ i * (2 + 3);
+        i++;
+    }
+    if (n >= 0)
+        return (s);
+    else
+        return (-1);
+    printf("never*n");
+}
+`)
+	build := func(opts ...Option) string {
+		t.Helper()
+		out, _, err := Build([]Source{{Name: "f.b", Code: src}}, append(opts, WithOutputType(OutputIR))...)
+		if err != nil {
+			t.Fatalf("Build() failed: %v", err)
+		}
+		return string(out)
+	}
+
+	plain := build(WithOptimize(0))
+	if !strings.Contains(plain, "alloca") || !strings.Contains(plain, "@.str") {
+		t.Errorf("IR of -O0 is optimized:\n%s", plain)
+	}
+
+	ir := bodyIR(build(WithOptimize(1)), "f")
+	for _, s := range []string{"alloca", "load", "store", "zext", "@.str", "printf"} {
+		if strings.Contains(ir, s) {
+			t.Errorf("IR of -O1 has %q:\n%s", s, ir)
+		}
+	}
+	for _, s := range []string{"phi i64 [ 0, %entry ]", "mul i64 %", ", 5", "icmp slt i64"} {
+		if !strings.Contains(ir, s) {
+			t.Errorf("IR of -O1 has no %q:\n%s", s, ir)
+		}
+	}
+}
+
+// TestFold tests constant folding at the size of the word
+func TestFold(t *testing.T) {
+	tests := []struct {
+		op   rune
+		x, y int64
+		bits uint64
+		want string
+	}{
+		{'+', 1 << 62, 1 << 62, 64, "-9223372036854775808"},
+		{'*', 300, 300, 16, "24464"},
+		{'/', -7, 2, 64, "-3"},
+		{'%', -7, 2, 64, "-1"},
+		{'/', 5, 0, 64, "<nil>"},
+		{'/', -1 << 15, -1, 16, "<nil>"},
+		{'<', 1, 15, 16, "-32768"},
+		{'>', -16, 2, 64, "-4"},
+		{'}', -16, 60, 64, "15"},
+		{'<', 1, 64, 64, "<nil>"},
+	}
+	for _, tt := range tests {
+		got := "<nil>"
+		if r := fold(tt.op, big.NewInt(tt.x), big.NewInt(tt.y), tt.bits); r != nil {
+			got = wrapSigned(r, tt.bits).String()
+		}
+		if got != tt.want {
+			t.Errorf("%d %c %d on %d bits = %s, want %s", tt.x, tt.op, tt.y, tt.bits, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package compiler
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/fatih/color"
+)
+
+// OutputType represents different output formats
+type OutputType int
+
+const (
+	OutputExecutable OutputType = iota // default: executable
+	OutputObject                       // -c: object file
+	OutputAssembly                     // -S: assembly file
+	OutputIR                           // --emit-llvm: LLVM IR
+)
+
+// Backend selects how machine code is generated
+type Backend int
+
+const (
+	BackendLLVM   Backend = iota // default: LLVM IR compiled by clang
+	BackendNative                // x86_64 assembly, built by as and ld
+)
+
+// llvmTarget describes a machine, other than the host, for which
+// LLVM IR is generated
+type llvmTarget struct {
+	triple     string // target triple of the module
+	dataLayout string // data layout of the module
+}
+
+// Machines accepted by --target which are compiled through LLVM;
+// the key is also the name of the directory of their runtime library
+var llvmTargets = map[string]llvmTarget{
+	"x86_64-linux-gnu": {
+		triple:     "x86_64-unknown-linux-gnu",
+		dataLayout: "e-m:e-p270:32:32-p271:32:32-p272:64:64-i64:64-f80:128-n8:16:32:64-S128",
+	},
+	"aarch64-linux-gnu": {
+		triple:     "aarch64-unknown-linux-gnu",
+		dataLayout: "e-m:e-i8:8:32-i16:16:32-i64:64-i128:128-n32:64-S128",
+	},
+	"riscv64-linux-gnu": {
+		triple:     "riscv64-unknown-linux-gnu",
+		dataLayout: "e-m:e-p:64:64-i64:64-i128:128-n32:64-S128",
+	},
+	"wasm32-wasi": {
+		triple:     "wasm32-unknown-wasi",
+		dataLayout: "e-m:e-p:32:32-p10:10:20-i64:64-n32:64-S128-ni:1:10:20",
+	},
+}
+
+// CompileOptions holds the compiler state
+type CompileOptions struct {
+	Arg0         string     // name of the executable
+	OutputFile   string     // output file
+	InputFiles   []string   // input files
+	WordSize     int        // size of the B data type (8 for x86_64)
+	SaveTemps    bool       // should temporary files get deleted?
+	OutputType   OutputType // type of output to generate
+	Optimize     int        // optimization level (0-3)
+	DebugInfo    bool       // include debug information
+	Verbose      bool       // verbose output
+	LibraryDirs  []string   // library search directories
+	Libraries    []string   // libraries to link
+	GlobalPrefix string     // prefix for global symbols to avoid C clashes
+	Backend      Backend    // code generator (-fbackend=)
+	Target       string     // target machine, empty for the host
+	Sysroot      string     // root directory of the target system (--sysroot)
+	BoundsCheck  bool       // check the indices of vectors (-fbounds-check)
+	Sanitize     []string   // sanitizers to build with (-fsanitize=)
+	Arith        Arith      // semantics of division and shifts (-fwrapv, -ftrapv)
+	Coverage     bool       // count the execution of source lines (--coverage)
+	Profile      bool       // count calls and time of functions (-p)
+	StackCheck   bool       // check the stack for overflow (-fstack-check)
+	Cache        bool       // reuse the outputs of unchanged sources (off with --no-cache)
+
+	// Sources holds the text of input files by name, which are then
+	// not read from disk
+	Sources map[string][]byte
+
+	// OnDiagnostic receives the warnings; when nil, they are printed
+	// to stderr
+	OnDiagnostic func(Diagnostic)
+
+	// OnReference, when set, receives the definitions and uses of
+	// global names as they are parsed
+	OnReference func(Reference)
+
+	cache *buildCache // cache of the outputs, while compiling
+}
+
+// NewCompileOptions creates a new structure with default values
+func NewCompileOptions(arg0 string, inputFiles []string) *CompileOptions {
+	return &CompileOptions{
+		Arg0:         arg0,
+		InputFiles:   inputFiles,
+		WordSize:     8, // x86_64 word size
+		OutputType:   OutputExecutable,
+		Optimize:     1, // optimization level -O1 by default
+		GlobalPrefix: "b.",
+	}
+}
+
+// IsWasm reports whether code is generated for WebAssembly, where
+// every call must match the signature of the callee exactly
+func (args *CompileOptions) IsWasm() bool {
+	return strings.HasPrefix(args.Target, "wasm")
+}
+
+// IsHosted reports whether programs are linked with the C library, as
+// the sanitizers need. The runtime then defines main(), which calls
+// the main() of B under the name b.main.
+func (args *CompileOptions) IsHosted() bool {
+	return len(args.Sanitize) > 0
+}
+
+// sanitizes reports whether code is instrumented by the sanitizer given
+func (args *CompileOptions) sanitizes(name string) bool {
+	return slices.Contains(args.Sanitize, name)
+}
+
+// sanitizeFlag returns the -fsanitize option of clang
+func (args *CompileOptions) sanitizeFlag() string {
+	return "-fsanitize=" + strings.Join(args.Sanitize, ",")
+}
+
+// report passes a warning to the handler of the options, or prints it
+func (args *CompileOptions) report(d Diagnostic) {
+	if args.OnDiagnostic != nil {
+		args.OnDiagnostic(d)
+		return
+	}
+	Wprintf(args.Arg0, "%s\n", d)
+}
+
+// Eprintf prints an error message with prefix
+func Eprintf(arg0 string, format string, args ...interface{}) {
+	color.New(color.FgWhite, color.Bold).Fprintf(os.Stderr, "%s: ", arg0)
+	color.New(color.FgRed, color.Bold).Fprintf(os.Stderr, "error: ")
+	fmt.Fprintf(os.Stderr, format, args...)
+}
+
+// Wprintf prints a warning message with prefix
+func Wprintf(arg0 string, format string, args ...interface{}) {
+	color.New(color.FgWhite, color.Bold).Fprintf(os.Stderr, "%s: ", arg0)
+	color.New(color.FgMagenta, color.Bold).Fprintf(os.Stderr, "warning: ")
+	fmt.Fprintf(os.Stderr, format, args...)
+}
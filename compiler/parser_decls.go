@@ -1,4 +1,4 @@
-package main
+package compiler
 
 import (
 	"fmt"
@@ -19,6 +19,7 @@ func ParseDeclarations(l *Lexer, c *Compiler) error {
 		if name == "" {
 			break
 		}
+		pos := l.Pos()
 
 		ch, err := l.ReadChar()
 		if err != nil {
@@ -30,12 +31,14 @@ func ParseDeclarations(l *Lexer, c *Compiler) error {
 
 		switch ch {
 		case '(':
+			c.reference(name, RefFunction, pos)
 			if err := parseFunction(l, c, name); err != nil {
 				return err
 			}
 			// Clear context after each top-level declaration
 			c.ClearTopLevelContext()
 		case '[':
+			c.reference(name, RefVector, pos)
 			if err := parseVector(l, c, name); err != nil {
 				return err
 			}
@@ -43,6 +46,7 @@ func ParseDeclarations(l *Lexer, c *Compiler) error {
 			c.ClearTopLevelContext()
 		default:
 			l.UnreadChar(ch)
+			c.reference(name, RefGlobal, pos)
 			if err := parseGlobal(l, c, name); err != nil {
 				return err
 			}
@@ -261,11 +265,14 @@ func parseFunction(l *Lexer, c *Compiler, name string) error {
 
 	fn := c.DeclareFunction(name, paramNames)
 	c.StartFunction(fn)
+	pos := l.Pos()
+	c.coverFunction(name, pos)
 
 	if err := parseStatementWithSwitch(l, c, -1, nil); err != nil {
 		return err
 	}
 
+	c.checkStack(pos)
 	c.EndFunction()
 	return nil
 }
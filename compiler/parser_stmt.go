@@ -1,4 +1,4 @@
-package main
+package compiler
 
 import (
 	"fmt"
@@ -20,6 +20,7 @@ func parseStatementWithSwitch(l *Lexer, c *Compiler, switchID int64, cases *[]in
 	if err := l.Whitespace(); err != nil {
 		return err
 	}
+	c.coverLine(l.Pos())
 
 	ch, err := l.ReadChar()
 	if err != nil {
@@ -168,6 +169,7 @@ func parseReturn(l *Lexer, c *Compiler) error {
 		if err := l.ExpectChar(';', "expect ';' after 'return' statement"); err != nil {
 			return err
 		}
+		c.returnCall(val)
 		c.builder.NewRet(val)
 	} else {
 		c.builder.NewRet(constant.NewInt(c.WordType(), 0))
@@ -302,6 +304,7 @@ func parseExtrn(l *Lexer, c *Compiler) error {
 		if err != nil || name == "" {
 			return fmt.Errorf("expect identifier after 'extrn'")
 		}
+		c.reference(name, RefExtrn, l.Pos())
 
 		// extrn declares a reference in the CURRENT declaration context only.
 		// Ensure a module-level global exists (to share storage across functions),
@@ -445,6 +448,7 @@ func parseWhile(l *Lexer, c *Compiler) error {
 	// Jump to condition
 	c.builder.NewBr(condBlock)
 	c.SetInsertPoint(condBlock)
+	c.coverLine(l.Pos())
 
 	// Evaluate condition
 	cond, err := parseExpression(l, c)
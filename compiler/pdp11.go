@@ -0,0 +1,707 @@
+package compiler
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/llir/llvm/ir"
+	"github.com/llir/llvm/ir/constant"
+	"github.com/llir/llvm/ir/enum"
+	"github.com/llir/llvm/ir/types"
+	"github.com/llir/llvm/ir/value"
+)
+
+//
+// PDP-11 backend: threaded code in the syntax of the Unix assembler,
+// in the manner of the original B compiler. A B word is 16 bits.
+//
+// A function starts with 'jsr r3,b.entry' followed by the size of its
+// frame; the rest is a list of operations, each the address of a routine
+// of the runtime (runtime/pdp11/brt.s) followed by its operands. Register
+// r3 points to the next operation, r4 to the frame, and operands are
+// pushed on the stack. Every value computed by an instruction lives in a
+// slot of the frame, so the stack is empty between instructions.
+//
+// Frame layout, relative to r4:
+//
+//	+6...       arguments, pushed by the caller, the first one lowest
+//	+4          return address
+//	+2          saved r3
+//	 0          saved r4
+//	below       locals (allocas), the first one at the highest address
+//	below       values of instructions
+//
+
+// Offset of the first argument from the frame pointer
+const pdpArgBase = 6
+
+// pdpOps lists the names of threaded operations, which the runtime defines
+var pdpOps = map[string]string{
+	"add": "b.add", "sub": "b.sub", "mul": "b.mul", "sdiv": "b.div", "srem": "b.mod",
+	"udiv": "b.udiv", "urem": "b.urem", "and": "b.and", "or": "b.or", "xor": "b.xor",
+	"shl": "b.shl", "ashr": "b.shr", "lshr": "b.ushr",
+}
+
+// Threaded operations of comparisons
+var pdpConds = map[enum.IPred]string{
+	enum.IPredEQ: "b.eq", enum.IPredNE: "b.ne",
+	enum.IPredSLT: "b.lt", enum.IPredSLE: "b.le", enum.IPredSGT: "b.gt", enum.IPredSGE: "b.ge",
+	enum.IPredULT: "b.ult", enum.IPredULE: "b.ule", enum.IPredUGT: "b.ugt", enum.IPredUGE: "b.uge",
+}
+
+// pdpGen holds the state of generating threaded code for one module.
+type pdpGen struct {
+	args   *CompileOptions
+	text   strings.Builder
+	data   strings.Builder
+	globls map[string]bool // symbols to declare global
+	nfunc  int             // number of functions, for unique labels
+	nlabel int             // number of edge labels
+
+	// State of the current function
+	fn     *ir.Func
+	slots  map[value.Value]int64 // frame offsets of values
+	locals map[value.Value]int64 // frame offsets of static allocas
+	params map[value.Value]int   // index of each parameter
+	labels map[*ir.Block]string  // labels of blocks
+	stubs  []func()              // pending edges with phi copies
+	next   *ir.Block             // block which follows the current one
+}
+
+// GeneratePDP11 translates a module into threaded code for the PDP-11.
+func GeneratePDP11(args *CompileOptions, m *ir.Module) (asm string, err error) {
+	defer func() {
+		switch e := recover().(type) {
+		case nil:
+		case *nativeError:
+			err = e
+		case *interpFault:
+			err = &nativeError{msg: e.msg}
+		default:
+			panic(e)
+		}
+	}()
+
+	g := &pdpGen{args: args, globls: make(map[string]bool)}
+	for _, fn := range m.Funcs {
+		if len(fn.Blocks) > 0 {
+			g.function(fn)
+		}
+	}
+	for _, global := range m.Globals {
+		g.global(global)
+	}
+
+	var out strings.Builder
+	var globls []string
+	for name := range g.globls {
+		globls = append(globls, name)
+	}
+	sort.Strings(globls)
+	for _, name := range globls {
+		fmt.Fprintf(&out, ".globl\t%s\n", name)
+	}
+	if g.text.Len() > 0 {
+		out.WriteString(".text\n")
+		out.WriteString(g.text.String())
+	}
+	if g.data.Len() > 0 {
+		out.WriteString(".data\n")
+		out.WriteString(g.data.String())
+	}
+	return out.String(), nil
+}
+
+// emit writes a line of code.
+func (g *pdpGen) emit(format string, args ...interface{}) {
+	fmt.Fprintf(&g.text, format, args...)
+	g.text.WriteByte('\n')
+}
+
+// op emits a threaded operation with its operands.
+func (g *pdpGen) op(name string, operands ...string) {
+	g.globls[name] = true
+	g.emit("\t%s", strings.Join(append([]string{name}, operands...), "; "))
+}
+
+// symbol returns the assembler name of a global or function: B names
+// get an underscore, as C names do; local names start with 'L'.
+func (g *pdpGen) symbol(name string, linkage enum.Linkage) string {
+	if isLocal(linkage) {
+		return "L" + strings.ReplaceAll(name, ".", "")
+	}
+	return "_" + strings.TrimPrefix(name, g.args.GlobalPrefix)
+}
+
+// extern returns the name of a global or function, declaring it global.
+func (g *pdpGen) extern(name string, linkage enum.Linkage) string {
+	sym := g.symbol(name, linkage)
+	if !isLocal(linkage) {
+		g.globls[sym] = true
+	}
+	return sym
+}
+
+// pdpNumber formats a word as a decimal number.
+func pdpNumber(v int64) string {
+	return fmt.Sprintf("%d.", int16(v))
+}
+
+// pdpSizeOf returns the size of a type in bytes: integers wider than
+// a byte and pointers take one 16-bit word.
+func pdpSizeOf(t types.Type) int64 {
+	switch t := t.(type) {
+	case *types.IntType:
+		if t.BitSize <= 8 {
+			return 1
+		}
+		return 2
+	case *types.PointerType:
+		return 2
+	case *types.ArrayType:
+		return int64(t.Len) * pdpSizeOf(t.ElemType)
+	default:
+		nativeErrorf("unsupported type %s", t)
+		return 0
+	}
+}
+
+// pdpBits returns the width of a value, at most one word.
+func pdpBits(t types.Type) uint64 {
+	if bits := bitSize(t); bits < 16 {
+		return bits
+	}
+	return 16
+}
+
+// pdpScales calls fn with the byte scale of each getelementptr index.
+func pdpScales(elem types.Type, nindices int, fn func(i int, scale int64)) {
+	t := elem
+	for i := 0; i < nindices; i++ {
+		if i > 0 {
+			at, ok := t.(*types.ArrayType)
+			if !ok {
+				nativeErrorf("unsupported getelementptr into %s", t)
+			}
+			t = at.ElemType
+		}
+		fn(i, pdpSizeOf(t))
+	}
+}
+
+//
+// Data
+//
+
+// global emits the definition of a global variable. As in the native
+// backend, zero-initialized globals are common symbols.
+func (g *pdpGen) global(global *ir.Global) {
+	if global.Init == nil {
+		return
+	}
+	name := g.extern(global.Name(), global.Linkage)
+	if isZeroConst(global.Init) && !isLocal(global.Linkage) {
+		fmt.Fprintf(&g.data, ".comm\t%s,%d.\n", name, pdpSizeOf(global.ContentType))
+		return
+	}
+	fmt.Fprintf(&g.data, "%s:\n", name)
+	g.initializer(global.Init)
+	if pdpSizeOf(global.ContentType)%2 != 0 {
+		g.data.WriteString(".even\n")
+	}
+}
+
+// initializer emits the contents of a global.
+func (g *pdpGen) initializer(c constant.Constant) {
+	switch c := c.(type) {
+	case *constant.Array, *constant.CharArray:
+		if str, ok := stringData(c); ok {
+			g.ascii(str)
+			return
+		}
+		for _, elem := range c.(*constant.Array).Elems {
+			g.initializer(elem)
+		}
+	case *constant.ZeroInitializer:
+		fmt.Fprintf(&g.data, "\t.=.+%d.\n", pdpSizeOf(c.Typ))
+	default:
+		if pdpSizeOf(c.Type()) == 1 {
+			_, k := g.constant(c)
+			fmt.Fprintf(&g.data, "\t.byte\t%d.\n", k&0xff)
+			return
+		}
+		fmt.Fprintf(&g.data, "\t%s\n", g.word(c))
+	}
+}
+
+// ascii emits bytes as a string in angle brackets.
+func (g *pdpGen) ascii(str []byte) {
+	var s strings.Builder
+	for _, c := range str {
+		switch {
+		case c == 0:
+			s.WriteString(`\0`)
+		case c == '\n':
+			s.WriteString(`\n`)
+		case c == '\t':
+			s.WriteString(`\t`)
+		case c == '\\' || c == '>':
+			s.WriteByte('\\')
+			s.WriteByte(c)
+		case c >= ' ' && c < 0x7f:
+			s.WriteByte(c)
+		default:
+			// Other bytes go between strings
+			if s.Len() > 0 {
+				fmt.Fprintf(&g.data, "\t<%s>\n", s.String())
+				s.Reset()
+			}
+			fmt.Fprintf(&g.data, "\t.byte\t%o\n", c)
+		}
+	}
+	if s.Len() > 0 {
+		fmt.Fprintf(&g.data, "\t<%s>\n", s.String())
+	}
+}
+
+// word formats a constant as an assembler expression.
+func (g *pdpGen) word(c constant.Constant) string {
+	sym, off := g.constant(c)
+	switch {
+	case sym == "":
+		return pdpNumber(off)
+	case off == 0:
+		return sym
+	default:
+		return fmt.Sprintf("%s%+d.", sym, off)
+	}
+}
+
+// constant evaluates a constant to a symbol plus offset; the symbol
+// is empty for plain numbers.
+func (g *pdpGen) constant(c constant.Constant) (string, int64) {
+	switch c := c.(type) {
+	case *constant.Int:
+		return "", truncBits(c.X.Int64(), c.Typ.BitSize)
+	case *constant.Null, *constant.ZeroInitializer, *constant.Undef:
+		return "", 0
+	case *ir.Global:
+		return g.extern(c.Name(), c.Linkage), 0
+	case *ir.Func:
+		return g.extern(c.Name(), c.Linkage), 0
+	case *constant.Index:
+		return g.constant(c.Constant)
+	case *constant.ExprGetElementPtr:
+		sym, off := g.constant(c.Src)
+		pdpScales(c.ElemType, len(c.Indices), func(i int, scale int64) {
+			off += g.index(c.Indices[i]) * scale
+		})
+		return sym, off
+	case *constant.ExprPtrToInt:
+		return g.constant(c.From)
+	case *constant.ExprIntToPtr:
+		return g.constant(c.From)
+	case *constant.ExprBitCast:
+		return g.constant(c.From)
+	default:
+		nativeErrorf("unsupported constant %s", c)
+		return "", 0
+	}
+}
+
+// index evaluates a constant getelementptr index, which is signed.
+func (g *pdpGen) index(v value.Value) int64 {
+	_, k := g.constant(v.(constant.Constant))
+	return signExtend(k, bitSize(v.Type()))
+}
+
+//
+// Functions
+//
+
+// function emits the threaded code of a function definition.
+func (g *pdpGen) function(fn *ir.Func) {
+	g.nfunc++
+	g.fn = fn
+	g.slots = make(map[value.Value]int64)
+	g.locals = make(map[value.Value]int64)
+	g.params = make(map[value.Value]int)
+	g.labels = make(map[*ir.Block]string)
+
+	// Assign frame offsets
+	var frame int64
+	for i, p := range fn.Params {
+		g.params[p] = i
+	}
+	for _, inst := range fn.Blocks[0].Insts {
+		if a, ok := inst.(*ir.InstAlloca); ok && isStaticAlloca(a) {
+			size := pdpSizeOf(a.ElemType)
+			if n, ok := a.NElems.(*constant.Int); ok {
+				size *= n.X.Int64()
+			}
+			frame += (size + 1) &^ 1
+			g.locals[a] = -frame
+		}
+	}
+	for i, b := range fn.Blocks {
+		g.labels[b] = fmt.Sprintf("L%d_%d", g.nfunc, i)
+		for _, inst := range b.Insts {
+			v, ok := inst.(value.Value)
+			if !ok || types.Equal(v.Type(), types.Void) {
+				continue
+			}
+			if _, static := g.locals[v]; !static {
+				frame += 2
+				g.slots[v] = -frame
+			}
+		}
+	}
+
+	name := g.extern(fn.Name(), fn.Linkage)
+	g.globls["b.entry"] = true
+	g.emit("")
+	g.emit("/ %s", strings.TrimPrefix(fn.Name(), g.args.GlobalPrefix))
+	g.emit("%s:", name)
+	g.emit("\tjsr\tr3,b.entry")
+	g.emit("\t%d.", frame)
+	for i, b := range fn.Blocks {
+		g.next = nil
+		if i+1 < len(fn.Blocks) {
+			g.next = fn.Blocks[i+1]
+		}
+		g.emit("%s:", g.labels[b])
+		for _, inst := range b.Insts {
+			g.inst(inst)
+		}
+		g.term(b)
+		for _, stub := range g.stubs {
+			stub()
+		}
+		g.stubs = nil
+	}
+}
+
+// push emits an operation to push the value of an operand.
+func (g *pdpGen) push(v value.Value) {
+	if off, ok := g.slots[v]; ok {
+		g.op("b.lv", pdpNumber(off))
+		return
+	}
+	if off, ok := g.locals[v]; ok {
+		g.op("b.la", pdpNumber(off))
+		return
+	}
+	if i, ok := g.params[v]; ok {
+		g.op("b.lv", pdpNumber(int64(pdpArgBase+2*i)))
+		return
+	}
+	c, ok := v.(constant.Constant)
+	if !ok {
+		nativeErrorf("%s: unsupported operand %s", g.fn.Name(), v.Ident())
+	}
+	g.op("b.lc", g.word(c))
+}
+
+// pushSigned pushes an operand narrower than a word, sign-extended.
+func (g *pdpGen) pushSigned(v value.Value, bits uint64) {
+	g.push(v)
+	if bits < 16 {
+		g.op("b.lc", pdpNumber(int64(16-bits)))
+		g.op("b.shl")
+		g.op("b.lc", pdpNumber(int64(16-bits)))
+		g.op("b.shr")
+	}
+}
+
+// result pops the value of an instruction into its slot, keeping the
+// low bits of values narrower than a word.
+func (g *pdpGen) result(v value.Value) {
+	if bits := pdpBits(v.Type()); bits < 16 {
+		g.op("b.lc", pdpNumber(1<<bits-1))
+		g.op("b.and")
+	}
+	g.op("b.sv", pdpNumber(g.slots[v]))
+}
+
+// inst emits the code of a non-terminator instruction.
+func (g *pdpGen) inst(inst ir.Instruction) {
+	switch inst := inst.(type) {
+	case *ir.InstPhi:
+		// Set on the edges into the block
+
+	case *ir.InstAlloca:
+		if _, static := g.locals[inst]; static {
+			return
+		}
+		if inst.NElems != nil {
+			g.push(inst.NElems)
+			g.op("b.lc", pdpNumber(pdpSizeOf(inst.ElemType)))
+			g.op("b.mul")
+		} else {
+			g.op("b.lc", pdpNumber(pdpSizeOf(inst.ElemType)))
+		}
+		g.op("b.alloc")
+		g.result(inst)
+
+	case *ir.InstLoad:
+		g.push(inst.Src)
+		if pdpSizeOf(inst.ElemType) == 1 {
+			g.op("b.ldb")
+		} else {
+			g.op("b.ld")
+		}
+		g.result(inst)
+
+	case *ir.InstStore:
+		g.push(inst.Src)
+		g.push(inst.Dst)
+		if pdpSizeOf(inst.Src.Type()) == 1 {
+			g.op("b.stb")
+		} else {
+			g.op("b.st")
+		}
+
+	case *ir.InstGetElementPtr:
+		g.push(inst.Src)
+		var offset int64
+		pdpScales(inst.ElemType, len(inst.Indices), func(i int, scale int64) {
+			if _, ok := inst.Indices[i].(constant.Constant); ok {
+				offset += g.index(inst.Indices[i]) * scale
+				return
+			}
+			g.pushSigned(inst.Indices[i], pdpBits(inst.Indices[i].Type()))
+			if scale != 1 {
+				g.op("b.lc", pdpNumber(scale))
+				g.op("b.mul")
+			}
+			g.op("b.add")
+		})
+		if int16(offset) != 0 {
+			g.op("b.lc", pdpNumber(offset))
+			g.op("b.add")
+		}
+		g.result(inst)
+
+	case *ir.InstPtrToInt:
+		g.push(inst.From)
+		g.result(inst)
+	case *ir.InstIntToPtr:
+		g.push(inst.From)
+		g.result(inst)
+	case *ir.InstBitCast:
+		g.push(inst.From)
+		g.result(inst)
+	case *ir.InstZExt:
+		g.push(inst.From)
+		g.result(inst)
+	case *ir.InstSExt:
+		g.pushSigned(inst.From, pdpBits(inst.From.Type()))
+		g.result(inst)
+	case *ir.InstTrunc:
+		g.push(inst.From)
+		g.result(inst)
+
+	case *ir.InstAdd:
+		g.binary(inst, inst.X, inst.Y, "add", false)
+	case *ir.InstSub:
+		g.binary(inst, inst.X, inst.Y, "sub", false)
+	case *ir.InstMul:
+		g.binary(inst, inst.X, inst.Y, "mul", false)
+	case *ir.InstSDiv:
+		g.binary(inst, inst.X, inst.Y, "sdiv", true)
+	case *ir.InstSRem:
+		g.binary(inst, inst.X, inst.Y, "srem", true)
+	case *ir.InstUDiv:
+		g.binary(inst, inst.X, inst.Y, "udiv", false)
+	case *ir.InstURem:
+		g.binary(inst, inst.X, inst.Y, "urem", false)
+	case *ir.InstAnd:
+		g.binary(inst, inst.X, inst.Y, "and", false)
+	case *ir.InstOr:
+		g.binary(inst, inst.X, inst.Y, "or", false)
+	case *ir.InstXor:
+		g.binary(inst, inst.X, inst.Y, "xor", false)
+	case *ir.InstShl:
+		g.binary(inst, inst.X, inst.Y, "shl", false)
+	case *ir.InstAShr:
+		g.binary(inst, inst.X, inst.Y, "ashr", true)
+	case *ir.InstLShr:
+		g.binary(inst, inst.X, inst.Y, "lshr", false)
+
+	case *ir.InstICmp:
+		op, ok := pdpConds[inst.Pred]
+		if !ok {
+			nativeErrorf("%s: unsupported comparison %s", g.fn.Name(), inst.Pred)
+		}
+		bits := uint64(16)
+		switch inst.Pred {
+		case enum.IPredSLT, enum.IPredSLE, enum.IPredSGT, enum.IPredSGE:
+			bits = pdpBits(inst.X.Type())
+		}
+		g.pushSigned(inst.X, bits)
+		g.pushSigned(inst.Y, bits)
+		g.op(op)
+		g.op("b.sv", pdpNumber(g.slots[inst]))
+
+	case *ir.InstSelect:
+		g.push(inst.Cond)
+		g.push(inst.ValueTrue)
+		g.push(inst.ValueFalse)
+		g.op("b.sel")
+		g.result(inst)
+
+	case *ir.InstVAArg:
+		g.push(inst.ArgList)
+		g.op("b.vaarg")
+		g.result(inst)
+
+	case *ir.InstCall:
+		g.call(inst)
+
+	default:
+		nativeErrorf("%s: unsupported instruction %s", g.fn.Name(), inst.LLString())
+	}
+}
+
+// binary emits an arithmetic operation. Operands narrower than a word
+// are sign-extended first when the operation is signed.
+func (g *pdpGen) binary(inst value.Value, x, y value.Value, name string, signed bool) {
+	bits := uint64(16)
+	if signed {
+		bits = pdpBits(inst.Type())
+	}
+	g.pushSigned(x, bits)
+	g.pushSigned(y, bits)
+	g.op(pdpOps[name])
+	g.result(inst)
+}
+
+// call emits a call: the arguments are pushed in reverse order, then
+// the function; the operation pops them and pushes the result.
+func (g *pdpGen) call(inst *ir.InstCall) {
+	callee := inst.Callee
+	if cast, ok := callee.(*ir.InstBitCast); ok {
+		if fn, ok := cast.From.(*ir.Func); ok {
+			callee = fn
+		}
+	}
+	if cast, ok := callee.(*constant.ExprBitCast); ok {
+		if fn, ok := cast.From.(*ir.Func); ok {
+			callee = fn
+		}
+	}
+	if fn, ok := callee.(*ir.Func); ok {
+		switch name := fn.Name(); {
+		case name == "llvm.va_start":
+			g.push(inst.Args[0])
+			g.op("b.vast", pdpNumber(int64(len(g.fn.Params))))
+			return
+		case name == "llvm.va_end":
+			return
+		case strings.HasPrefix(name, "llvm."):
+			nativeErrorf("%s: unsupported intrinsic %s", g.fn.Name(), name)
+		}
+	}
+
+	for i := len(inst.Args) - 1; i >= 0; i-- {
+		g.push(inst.Args[i])
+	}
+	g.push(callee)
+	g.op("b.call", pdpNumber(int64(len(inst.Args))))
+	if _, ok := g.slots[inst]; ok {
+		g.result(inst)
+	} else {
+		g.op("b.drop")
+	}
+}
+
+// term emits the code of a terminator.
+func (g *pdpGen) term(b *ir.Block) {
+	switch term := b.Term.(type) {
+	case *ir.TermRet:
+		if term.X != nil {
+			g.push(term.X)
+		} else {
+			g.op("b.lc", "0.")
+		}
+		g.op("b.ret")
+
+	case *ir.TermBr:
+		g.fallThrough(b, term.Target.(*ir.Block))
+
+	case *ir.TermCondBr:
+		g.push(term.Cond)
+		g.op("b.bz", g.edge(b, term.TargetFalse.(*ir.Block)))
+		g.fallThrough(b, term.TargetTrue.(*ir.Block))
+
+	case *ir.TermSwitch:
+		// A table of values and labels; when none matches,
+		// execution goes on after the table
+		g.push(term.X)
+		g.op("b.swit", pdpNumber(int64(len(term.Cases))))
+		for _, c := range term.Cases {
+			_, k := g.constant(c.X.(constant.Constant))
+			g.emit("\t%s; %s", pdpNumber(k), g.edge(b, c.Target.(*ir.Block)))
+		}
+		g.fallThrough(b, term.TargetDefault.(*ir.Block))
+
+	case *ir.TermUnreachable:
+		// Nothing to do
+
+	default:
+		nativeErrorf("%s: unsupported terminator %s", g.fn.Name(), term.LLString())
+	}
+}
+
+// jump emits an unconditional branch from one block to another.
+func (g *pdpGen) jump(from, to *ir.Block) {
+	g.phiCopies(from, to)
+	g.op("b.br", g.labels[to])
+}
+
+// fallThrough ends a block with a branch, which is omitted when the
+// target follows and no stubs come in between.
+func (g *pdpGen) fallThrough(from, to *ir.Block) {
+	if to == g.next && len(g.stubs) == 0 {
+		g.phiCopies(from, to)
+		return
+	}
+	g.jump(from, to)
+}
+
+// edge returns the label for a conditional branch from one block to
+// another; when the target has phis, the copies go into a stub.
+func (g *pdpGen) edge(from, to *ir.Block) string {
+	if !hasPhis(to) {
+		return g.labels[to]
+	}
+	g.nlabel++
+	label := fmt.Sprintf("E%d", g.nlabel)
+	g.stubs = append(g.stubs, func() {
+		g.emit("%s:", label)
+		g.jump(from, to)
+	})
+	return label
+}
+
+// phiCopies sets the phis of a block for the edge from a predecessor.
+func (g *pdpGen) phiCopies(from, to *ir.Block) {
+	var phis []*ir.InstPhi
+	for _, inst := range to.Insts {
+		phi, ok := inst.(*ir.InstPhi)
+		if !ok {
+			break
+		}
+		for _, inc := range phi.Incs {
+			if inc.Pred == from {
+				g.push(inc.X)
+				phis = append(phis, phi)
+				break
+			}
+		}
+	}
+	for i := len(phis) - 1; i >= 0; i-- {
+		g.op("b.sv", pdpNumber(g.slots[phis[i]]))
+	}
+}
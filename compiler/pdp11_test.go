@@ -0,0 +1,116 @@
+package compiler
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// compilePDP11 compiles a B file for the PDP-11 and returns the assembly
+func compilePDP11(t *testing.T, bFile string) (string, error) {
+	t.Helper()
+	args := NewCompileOptions("blang", []string{bFile})
+	args.Target = "pdp11"
+	args.WordSize = 2
+	args.OutputType = OutputAssembly
+	args.OutputFile = filepath.Join(t.TempDir(), "out.s")
+	if err := Compile(args); err != nil {
+		return "", err
+	}
+	asm, err := os.ReadFile(args.OutputFile)
+	if err != nil {
+		t.Fatalf("Assembly file not created: %v", err)
+	}
+	return string(asm), nil
+}
+
+// TestPDP11Golden compiles the programs in testdata/pdp11 and compares
+// the assembly with the .s files next to them; run with -update to
+// rewrite those after an intended change of the generated code
+func TestPDP11Golden(t *testing.T) {
+	files, err := filepath.Glob("testdata/pdp11/*.b")
+	if err != nil || len(files) == 0 {
+		t.Fatalf("No test programs in testdata/pdp11: %v", err)
+	}
+	for _, bFile := range files {
+		name := strings.TrimSuffix(filepath.Base(bFile), ".b")
+		t.Run(name, func(t *testing.T) {
+			got, err := compilePDP11(t, bFile)
+			if err != nil {
+				t.Fatalf("Compile failed: %v", err)
+			}
+			golden := strings.TrimSuffix(bFile, ".b") + ".s"
+			if *updateGolden {
+				if err := os.WriteFile(golden, []byte(got), 0644); err != nil {
+					t.Fatalf("Cannot update %s: %v", golden, err)
+				}
+				return
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("Cannot read golden file: %v", err)
+			}
+			if got != string(want) {
+				t.Errorf("Assembly differs from %s:\n%s", golden, buildLineDiff(string(want), got))
+			}
+		})
+	}
+}
+
+// TestPDP11Runtime checks that the library of the PDP-11 runtime compiles
+// and that the assembly routines define every threaded operation
+func TestPDP11Runtime(t *testing.T) {
+	asm, err := compilePDP11(t, "../runtime/pdp11/lib.b")
+	if err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+	for _, want := range []string{"_printf:", "_printn:", "_printd:", "_printo:", "_putstr:"} {
+		if !strings.Contains(asm, want) {
+			t.Errorf("Library does not define %s", strings.TrimSuffix(want, ":"))
+		}
+	}
+
+	brt, err := os.ReadFile("../runtime/pdp11/brt.s")
+	if err != nil {
+		t.Fatalf("Cannot read brt.s: %v", err)
+	}
+	ops := []string{"b.entry", "b.ret", "b.call", "b.drop"}
+	for _, op := range pdpOps {
+		ops = append(ops, op)
+	}
+	for _, op := range pdpConds {
+		ops = append(ops, op)
+	}
+	ops = append(ops, "b.lv", "b.sv", "b.la", "b.lc", "b.ld", "b.ldb", "b.st", "b.stb",
+		"b.sel", "b.br", "b.bz", "b.swit", "b.vast", "b.vaarg", "b.alloc")
+	for _, op := range ops {
+		if !strings.Contains(string(brt), "\n"+op+":\n") {
+			t.Errorf("brt.s does not define %s", op)
+		}
+	}
+}
+
+// TestPDP11Errors tests the limits of the PDP-11 target
+func TestPDP11Errors(t *testing.T) {
+	tmpDir := t.TempDir()
+	bFile := filepath.Join(tmpDir, "wide.b")
+	if err := os.WriteFile(bFile, []byte("main() { write('abc'); }\n"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	if _, err := compilePDP11(t, bFile); err == nil {
+		t.Errorf("Three characters should not fit in a 16-bit word")
+	}
+
+	args := NewCompileOptions("blang", []string{"testdata/pdp11/hello.b"})
+	args.Target = "pdp11"
+	args.OutputType = OutputObject
+	args.OutputFile = filepath.Join(tmpDir, "hello.o")
+	err := Compile(args)
+	if err == nil || !strings.Contains(err.Error(), "supports only assembly output") {
+		t.Errorf("Compile() error = %v, want assembly only error", err)
+	}
+}
@@ -0,0 +1,238 @@
+package compiler
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/llir/llvm/ir"
+	"github.com/llir/llvm/ir/constant"
+	"github.com/llir/llvm/ir/enum"
+	"github.com/llir/llvm/ir/types"
+)
+
+//
+// Profiling, enabled by -p (or -pg). Every function has a record,
+// private to its file:
+//
+//	word 0  next record registered, 0 until registered
+//	word 1  name of the function
+//	word 2  number of calls
+//	word 3  ticks spent in the function itself
+//	word 4  ticks spent in the function and the functions it calls
+//	word 5  number of its calls in progress, for recursion
+//
+// A function calls b..prof.enter with its record on entry, and
+// b..prof.leave before it returns. The runtime library keeps a stack
+// of the calls in progress, reading the cycle counter of the machine,
+// counts the calls from each function to each other, and at exit
+// writes the profile to bmon.out in the current directory, as text:
+//
+//	rate <ticks per second, 0 when unknown>
+//	f <name> <calls> <self ticks> <total ticks>
+//	a <caller> <callee> <calls> <ticks in the callee>
+//
+// 'blang prof' reads it and prints a flat profile and the call graph.
+//
+
+// Routines of the runtime called on entry and exit of a function
+const (
+	profEnter = ".prof.enter"
+	profLeave = ".prof.leave"
+)
+
+// ProfileFile is the file written by a profiled program
+const ProfileFile = "bmon.out"
+
+// profileEnter emits the call of the entry hook at the start of the
+// current function
+func (c *Compiler) profileEnter() {
+	if !c.args.Profile {
+		return
+	}
+	word := c.WordType()
+	name := c.currentName()
+	rec, ok := c.profRecords[name]
+	if !ok {
+		zero := constant.NewInt(word, 0)
+		rec = c.module.NewGlobalDef(".prof."+name, constant.NewArray(types.NewArray(6, word),
+			zero, c.stringWord(name), zero, zero, zero, zero))
+		rec.Linkage = enum.LinkagePrivate
+		c.profRecords[name] = rec
+	}
+	c.builder.NewCall(c.runtimeRoutine(profEnter), constant.NewPtrToInt(rec, word))
+}
+
+// profileLeave emits the call of the exit hook before every return of
+// the current function
+func (c *Compiler) profileLeave() {
+	if !c.args.Profile {
+		return
+	}
+	name := c.currentName()
+	rec := constant.NewPtrToInt(c.profRecords[name], c.WordType())
+	for _, block := range c.currentFn.Blocks {
+		if _, ok := block.Term.(*ir.TermRet); ok {
+			block.NewCall(c.runtimeRoutine(profLeave), rec)
+		}
+	}
+}
+
+// ProfFunc is the time spent in a function
+type ProfFunc struct {
+	Name  string
+	Calls int64
+	Self  int64 // ticks in the function itself
+	Total int64 // ticks in the function and the functions it calls
+}
+
+// ProfArc is the calls from a function to another
+type ProfArc struct {
+	Caller string
+	Callee string
+	Calls  int64
+	Ticks  int64 // ticks in the callee during these calls
+}
+
+// Profile is the profile written by a program compiled with -p
+type Profile struct {
+	Rate  int64 // ticks per second, 0 when unknown
+	Funcs []*ProfFunc
+	Arcs  []*ProfArc
+}
+
+// ReadProfile reads a profile written at exit by a program compiled
+// with -p
+func ReadProfile(r io.Reader) (*Profile, error) {
+	p := &Profile{}
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		fields := strings.Fields(scanner.Text())
+		var nums []int64
+		for _, f := range fields[min(len(fields), 1):] {
+			if v, err := strconv.ParseInt(f, 10, 64); err == nil {
+				nums = append(nums, v)
+			}
+		}
+		switch {
+		case len(fields) == 0:
+		case fields[0] == "rate" && len(fields) == 2 && len(nums) == 1:
+			p.Rate = nums[0]
+		case fields[0] == "f" && len(fields) == 5 && len(nums) == 3:
+			p.Funcs = append(p.Funcs, &ProfFunc{Name: fields[1], Calls: nums[0], Self: nums[1], Total: nums[2]})
+		case fields[0] == "a" && len(fields) == 5 && len(nums) == 2:
+			p.Arcs = append(p.Arcs, &ProfArc{Caller: fields[1], Callee: fields[2], Calls: nums[0], Ticks: nums[1]})
+		default:
+			return nil, fmt.Errorf("line %d: malformed profile", n)
+		}
+	}
+	return p, scanner.Err()
+}
+
+// ticks returns the total of the time spent in all functions
+func (p *Profile) ticks() int64 {
+	var sum int64
+	for _, f := range p.Funcs {
+		sum += f.Self
+	}
+	return sum
+}
+
+// time formats ticks in seconds, or as they are when the rate is unknown
+func (p *Profile) time(ticks int64) string {
+	if p.Rate == 0 {
+		return strconv.FormatInt(ticks, 10)
+	}
+	return fmt.Sprintf("%.6f", float64(ticks)/float64(p.Rate))
+}
+
+// unit returns the unit of the times printed
+func (p *Profile) unit() string {
+	if p.Rate == 0 {
+		return "ticks"
+	}
+	return "s"
+}
+
+// percent returns the share of ticks in the whole run
+func (p *Profile) percent(ticks int64) float64 {
+	if sum := p.ticks(); sum > 0 {
+		return 100 * float64(ticks) / float64(sum)
+	}
+	return 0
+}
+
+// WriteFlat writes the functions by the time spent in each of them
+// itself, as the flat profile of gprof
+func (p *Profile) WriteFlat(w io.Writer) error {
+	funcs := append([]*ProfFunc(nil), p.Funcs...)
+	sort.SliceStable(funcs, func(i, j int) bool {
+		a, b := funcs[i], funcs[j]
+		if a.Self != b.Self {
+			return a.Self > b.Self
+		}
+		if a.Calls != b.Calls {
+			return a.Calls > b.Calls
+		}
+		return a.Name < b.Name
+	})
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Flat profile, %s %s in all:\n\n", p.time(p.ticks()), p.unit())
+	fmt.Fprintf(&b, "%7s %12s %12s %10s  %s\n", "%time", "self "+p.unit(), "total "+p.unit(), "calls", "name")
+	for _, f := range funcs {
+		fmt.Fprintf(&b, "%7.2f %12s %12s %10d  %s\n", p.percent(f.Self), p.time(f.Self), p.time(f.Total), f.Calls, f.Name)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// WriteCallGraph writes each function, by the time spent in it and its
+// callees, with the functions which call it and those it calls
+func (p *Profile) WriteCallGraph(w io.Writer) error {
+	funcs := append([]*ProfFunc(nil), p.Funcs...)
+	sort.SliceStable(funcs, func(i, j int) bool {
+		if funcs[i].Total != funcs[j].Total {
+			return funcs[i].Total > funcs[j].Total
+		}
+		return funcs[i].Name < funcs[j].Name
+	})
+	index := map[string]int{}
+	for i, f := range funcs {
+		index[f.Name] = i + 1
+	}
+	arcs := append([]*ProfArc(nil), p.Arcs...)
+	sort.SliceStable(arcs, func(i, j int) bool {
+		if index[arcs[i].Caller] != index[arcs[j].Caller] {
+			return index[arcs[i].Caller] < index[arcs[j].Caller]
+		}
+		return index[arcs[i].Callee] < index[arcs[j].Callee]
+	})
+
+	var b strings.Builder
+	b.WriteString("Call graph:\n")
+	for _, f := range funcs {
+		fmt.Fprintf(&b, "\n[%d] %s: %.2f%%, %s %s, %d call(s)\n",
+			index[f.Name], f.Name, p.percent(f.Total), p.time(f.Total), p.unit(), f.Calls)
+		called := false
+		for _, a := range arcs {
+			if a.Callee == f.Name {
+				fmt.Fprintf(&b, "    called by %s [%d]: %d call(s)\n", a.Caller, index[a.Caller], a.Calls)
+				called = true
+			}
+		}
+		if !called {
+			b.WriteString("    called by <spontaneous>\n")
+		}
+		for _, a := range arcs {
+			if a.Caller == f.Name {
+				fmt.Fprintf(&b, "    calls %s [%d]: %d call(s), %s %s\n", a.Callee, index[a.Callee], a.Calls, p.time(a.Ticks), p.unit())
+			}
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
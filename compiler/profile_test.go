@@ -0,0 +1,183 @@
+package compiler
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// runProfiled interprets a program compiled with -p in a temporary
+// directory, and returns the profile it wrote there
+func runProfiled(t *testing.T, src string) *Profile {
+	t.Helper()
+	t.Chdir(t.TempDir())
+	if _, _, err := interpretFromCode(t, "fib", src, "", []Option{WithProfile()}); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	f, err := os.Open(ProfileFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	p, err := ReadProfile(f)
+	if err != nil {
+		t.Fatalf("ReadProfile() failed: %v", err)
+	}
+	return p
+}
+
+// TestProfile tests the calls counted in each function and between them,
+// and the time of the recursive calls of fib(), counted once
+func TestProfile(t *testing.T) {
+	p := runProfiled(t, coverageProgram)
+	if p.Rate != 1000000000 {
+		t.Errorf("rate %d", p.Rate)
+	}
+	calls := map[string]int64{}
+	for _, f := range p.Funcs {
+		calls[f.Name] = f.Calls
+		if f.Self < 0 || f.Self > f.Total {
+			t.Errorf("%s: self %d, total %d", f.Name, f.Self, f.Total)
+		}
+	}
+	if len(calls) != 2 || calls["main"] != 1 || calls["fib"] != 19 {
+		t.Errorf("calls %v", calls)
+	}
+	arcs := map[string]int64{}
+	for _, a := range p.Arcs {
+		arcs[a.Caller+" "+a.Callee] = a.Calls
+	}
+	if len(arcs) != 2 || arcs["main fib"] != 5 || arcs["fib fib"] != 14 {
+		t.Errorf("arcs %v", arcs)
+	}
+	checkArcTicks(t, p)
+}
+
+// checkArcTicks checks that the ticks of the calls on each arc, counted
+// once for recursive calls, are within the total of the callee
+func checkArcTicks(t *testing.T, p *Profile) {
+	t.Helper()
+	totals := map[string]int64{}
+	for _, f := range p.Funcs {
+		totals[f.Name] = f.Total
+	}
+	for _, a := range p.Arcs {
+		if a.Ticks < 0 || a.Ticks > totals[a.Callee] {
+			t.Errorf("%s -> %s: %d ticks, total of %s %d", a.Caller, a.Callee, a.Ticks, a.Callee, totals[a.Callee])
+		}
+	}
+}
+
+// recursiveProgram spends most of its time in calls of fib() from fib()
+const recursiveProgram = `fib(n) {
+    if (n < 2)
+        return (n);
+    return (fib(n - 1) + fib(n - 2));
+}
+
+main() printf("%d*n", fib(15));
+`
+
+// TestProfileRecursion tests the time of the recursive calls, counted
+// once on their arc, in the interpreter and in the runtime library
+// with the native backend
+func TestProfileRecursion(t *testing.T) {
+	native := nativeAvailable()
+	libDir, err := filepath.Abs("../runtime")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkArcTicks(t, runProfiled(t, recursiveProgram))
+	if !native {
+		t.Skip("native backend needs as, ld and runtime/libb.a on x86_64 Linux")
+	}
+	dir := t.TempDir()
+	bFile := writeTempFile(t, dir, "fib.b", recursiveProgram)
+	exeFile := filepath.Join(dir, "fib")
+	args := NewOptions([]string{bFile}, WithOutput(exeFile), WithOutputType(OutputExecutable),
+		WithBackend(BackendNative), WithProfile(), WithLibraryDirs(libDir))
+	if err := Compile(args); err != nil {
+		t.Fatalf("Compile() failed: %v", err)
+	}
+	t.Chdir(dir)
+	if out, status := runExecutable(t, exeFile); string(out) != "610\n" || status != 0 {
+		t.Fatalf("output %q, exit code %d", out, status)
+	}
+	f, err := os.Open(ProfileFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	p, err := ReadProfile(f)
+	if err != nil {
+		t.Fatalf("ReadProfile() failed: %v", err)
+	}
+	checkArcTicks(t, p)
+}
+
+// TestProfileReport tests the flat profile and the call graph of a
+// profile read from text
+func TestProfileReport(t *testing.T) {
+	p, err := ReadProfile(strings.NewReader("rate 1000\nf main 1 100 400\nf fib 19 300 300\n\na main fib 5 300\na fib fib 14 200\n"))
+	if err != nil {
+		t.Fatalf("ReadProfile() failed: %v", err)
+	}
+
+	var flat strings.Builder
+	p.WriteFlat(&flat)
+	want := "Flat profile, 0.400000 s in all:\n\n" +
+		"  %time       self s      total s      calls  name\n" +
+		"  75.00     0.300000     0.300000         19  fib\n" +
+		"  25.00     0.100000     0.400000          1  main\n"
+	if flat.String() != want {
+		t.Errorf("flat profile:\n%s\nwant:\n%s", flat.String(), want)
+	}
+
+	var graph strings.Builder
+	p.WriteCallGraph(&graph)
+	want = "Call graph:\n\n" +
+		"[1] main: 100.00%, 0.400000 s, 1 call(s)\n" +
+		"    called by <spontaneous>\n" +
+		"    calls fib [2]: 5 call(s), 0.300000 s\n\n" +
+		"[2] fib: 75.00%, 0.300000 s, 19 call(s)\n" +
+		"    called by main [1]: 5 call(s)\n" +
+		"    called by fib [2]: 14 call(s)\n" +
+		"    calls fib [2]: 14 call(s), 0.200000 s\n"
+	if graph.String() != want {
+		t.Errorf("call graph:\n%s\nwant:\n%s", graph.String(), want)
+	}
+
+	if _, err := ReadProfile(strings.NewReader("rate 1000\nf main x 1 2\n")); err == nil || err.Error() != "line 2: malformed profile" {
+		t.Errorf("malformed profile: error = %v", err)
+	}
+}
+
+// TestProfileIR tests the hooks around the body of each function, and
+// the targets which cannot profile
+func TestProfileIR(t *testing.T) {
+	src := "f(x) {\n    if (x)\n        return (1);\n    return (2);\n}\n\nmain() {\n    f(0);\n}\n"
+	module, _, err := ParseReader("p.b", strings.NewReader(src), WithProfile())
+	if err != nil {
+		t.Fatalf("ParseReader() failed: %v", err)
+	}
+	ir := module.String()
+	for _, s := range []string{
+		"@.prof.f = private global [6 x i64]",
+		"call i64 (i64, ...) @b..prof.enter(i64 ptrtoint ([6 x i64]* @.prof.f to i64))",
+	} {
+		if !strings.Contains(ir, s) {
+			t.Errorf("IR has no %q:\n%s", s, ir)
+		}
+	}
+	if n := strings.Count(ir, "@b..prof.leave(i64 ptrtoint ([6 x i64]* @.prof.f to i64))"); n != 2 {
+		t.Errorf("%d calls of the exit hook in f(), want one per return:\n%s", n, ir)
+	}
+
+	for _, target := range []string{"pdp11", "wasm32-wasi"} {
+		_, _, err := Build([]Source{{Name: "p.b", Code: []byte(src)}}, WithOutputType(OutputAssembly), WithTarget(target), WithProfile())
+		if err == nil || !strings.Contains(err.Error(), "profiling") {
+			t.Errorf("%s with -p: error = %v", target, err)
+		}
+	}
+}
@@ -0,0 +1,397 @@
+package compiler
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/llir/llvm/ir"
+)
+
+// Repl is an interactive session on top of the interpreter. Top-level
+// definitions are added to the program as they are entered; statements
+// and expressions are compiled into a temporary function and executed
+// at once, and the value of an expression is printed.
+type Repl struct {
+	Prompt bool // print prompts, for interactive use
+
+	args    *CompileOptions
+	interp  *Interp
+	count   int             // number of temporary functions
+	defined map[string]bool // names of globals and functions entered
+}
+
+// Kinds of input
+const (
+	replDefinition = iota // top-level declaration
+	replStatement         // statement, executed
+	replExpression        // expression statement, executed and printed
+)
+
+// Keywords which start a statement
+var replKeywords = map[string]bool{
+	"auto": true, "extrn": true, "if": true, "while": true,
+	"switch": true, "case": true, "goto": true, "return": true,
+}
+
+// NewRepl creates a session using the given interpreter.
+func NewRepl(args *CompileOptions, interp *Interp) *Repl {
+	interp.setupArgs([]string{args.Arg0})
+	return &Repl{
+		args:    args,
+		interp:  interp,
+		defined: make(map[string]bool),
+	}
+}
+
+// Load adds the definitions of a compiled module to the session.
+func (r *Repl) Load(m *ir.Module) error {
+	if err := r.interp.Load(m); err != nil {
+		return err
+	}
+	prefix := r.args.GlobalPrefix
+	for _, g := range m.Globals {
+		if name := strings.TrimPrefix(g.Name(), prefix); name != g.Name() && !strings.Contains(name, ".") {
+			r.defined[name] = true
+		}
+	}
+	for _, f := range m.Funcs {
+		if name := strings.TrimPrefix(f.Name(), prefix); len(f.Blocks) > 0 && !strings.Contains(name, ".") {
+			r.defined[name] = true
+		}
+	}
+	return nil
+}
+
+// Run reads and evaluates input until end of file or ':quit'.
+func (r *Repl) Run() error {
+	out := r.interp.stdout()
+	if r.Prompt {
+		fmt.Fprintln(out, "B interpreter; enter ':help' for help.")
+	}
+	var text strings.Builder
+	for {
+		if r.Prompt {
+			if text.Len() == 0 {
+				fmt.Fprint(out, "b> ")
+			} else {
+				fmt.Fprint(out, "... ")
+			}
+		}
+		r.interp.flush()
+		line, err := r.interp.stdin().ReadString('\n')
+		text.WriteString(line)
+
+		// An empty line ends an incomplete input as well
+		if err != nil || replComplete(text.String()) || (strings.TrimSpace(line) == "" && text.Len() > len(line)) {
+			quit := r.Eval(text.String())
+			text.Reset()
+			if quit {
+				return nil
+			}
+		}
+		if err == io.EOF {
+			if r.Prompt {
+				fmt.Fprintln(out)
+			}
+			r.interp.flush()
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Eval evaluates one complete input and reports whether to quit.
+func (r *Repl) Eval(text string) bool {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return false
+	}
+	if text[0] == ':' {
+		return r.command(text)
+	}
+
+	var err error
+	switch r.classify(text) {
+	case replDefinition:
+		err = r.define(text)
+	case replStatement:
+		err = r.execute(text, false)
+	case replExpression:
+		err = r.execute(text, true)
+	}
+	if e, ok := err.(*interpExit); ok {
+		// Handlers registered with atexit() have run; the session goes on
+		r.interp.flush()
+		fmt.Fprintf(r.interp.Stderr, "%s\n", e)
+	} else if err != nil {
+		r.errorf("%s", err)
+	}
+	return false
+}
+
+// errorf reports an error after any pending output.
+func (r *Repl) errorf(format string, args ...interface{}) {
+	r.interp.flush()
+	fmt.Fprintf(r.interp.Stderr, "error: "+format+"\n", args...)
+}
+
+// compile translates source text into a module.
+func (r *Repl) compile(src string) (*ir.Module, error) {
+	compiler := NewCompiler(r.args)
+	err := ParseDeclarations(NewLexer(r.args, strings.NewReader(src)), compiler)
+	if err != nil {
+		return nil, err
+	}
+	for _, w := range compiler.Warnings() {
+		r.interp.flush()
+		fmt.Fprintf(r.interp.Stderr, "warning: %s\n", w)
+	}
+	return compiler.GetModule(), nil
+}
+
+// define adds top-level declarations, replacing earlier ones.
+func (r *Repl) define(text string) error {
+	m, err := r.compile(text)
+	if err != nil {
+		return err
+	}
+	return r.Load(m)
+}
+
+// execute runs a statement in a temporary function, with all globals
+// visible. The value of an expression is printed; when the input does
+// not parse as an expression it is tried as a statement.
+func (r *Repl) execute(text string, expr bool) error {
+	r.count++
+	name := fmt.Sprintf("_repl%d", r.count)
+
+	var globals []string
+	for g := range r.interp.globals {
+		if n := strings.TrimPrefix(g, r.args.GlobalPrefix); n != g && !strings.Contains(n, ".") {
+			globals = append(globals, n)
+		}
+	}
+	sort.Strings(globals)
+	extrn := ""
+	if len(globals) > 0 {
+		extrn = "extrn " + strings.Join(globals, ", ") + "; "
+	}
+
+	var m *ir.Module
+	var err error
+	if expr {
+		body := strings.TrimSuffix(text, ";")
+		m, err = r.compile(fmt.Sprintf("%s() { %sreturn (%s); }", name, extrn, body))
+	}
+	if !expr || err != nil {
+		expr = false
+		m, err = r.compile(fmt.Sprintf("%s() { %s%s\n}", name, extrn, text))
+		if err != nil {
+			return err
+		}
+	}
+	if err := r.interp.Load(m); err != nil {
+		return err
+	}
+	v, err := r.interp.Call(r.args.GlobalPrefix + name)
+	if err != nil {
+		return err
+	}
+	if expr {
+		fmt.Fprintln(r.interp.stdout(), formatWord(v))
+	}
+	return nil
+}
+
+// formatWord shows a word in decimal and octal.
+func formatWord(v int64) string {
+	return fmt.Sprintf("%d (0%s)", v, strconv.FormatUint(uint64(v), 8))
+}
+
+// command executes a session command.
+func (r *Repl) command(text string) bool {
+	out := r.interp.stdout()
+	switch fields := strings.Fields(text); fields[0] {
+	case ":q", ":quit":
+		return true
+	case ":h", ":help":
+		fmt.Fprint(out, `Enter B definitions, statements or expressions; the value of an
+expression is printed in decimal and octal. A definition replaces an
+earlier one with the same name. Globals are visible without 'extrn'.
+Commands:
+  :globals    show the values of globals
+  :funcs      list the defined functions
+  :help       show this text
+  :quit       leave the session
+`)
+	case ":globals":
+		for _, name := range r.names(false) {
+			fmt.Fprintln(out, r.describeGlobal(name))
+		}
+	case ":funcs":
+		for _, name := range r.names(true) {
+			fmt.Fprintf(out, "%s()\n", name)
+		}
+	default:
+		r.errorf("unknown command '%s', enter ':help' for help", fields[0])
+	}
+	r.interp.flush()
+	return false
+}
+
+// names returns the sorted names of functions or globals entered.
+func (r *Repl) names(funcs bool) []string {
+	var names []string
+	for name := range r.defined {
+		_, isGlobal := r.interp.globals[r.args.GlobalPrefix+name]
+		if isGlobal != funcs {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// describeGlobal formats the contents of a global: a scalar, a vector
+// (whose first word points to the elements) or a list of words.
+func (r *Repl) describeGlobal(name string) string {
+	const maxWords = 8
+	in := r.interp
+	sym := r.args.GlobalPrefix + name
+	addr, nwords := in.globals[sym], in.sizes[sym]/8
+	first := in.loadWord(addr)
+
+	words := func(addr, n int64) string {
+		var list []string
+		for i := int64(0); i < n && i < maxWords; i++ {
+			list = append(list, strconv.FormatInt(in.loadWord(addr+8*i), 10))
+		}
+		if n > maxWords {
+			list = append(list, "...")
+		}
+		return strings.Join(list, " ")
+	}
+	if nwords > 1 && first == addr+8 {
+		return fmt.Sprintf("%s[%d] = %s", name, nwords-1, words(addr+8, nwords-1))
+	}
+	if data, ok := in.globals[sym+".data"]; ok && first == data {
+		n := in.sizes[sym+".data"] / 8
+		return fmt.Sprintf("%s[%d] = %s", name, n, words(data, n))
+	}
+	if nwords > 1 {
+		return fmt.Sprintf("%s = %s", name, words(addr, nwords))
+	}
+	return fmt.Sprintf("%s = %s", name, formatWord(first))
+}
+
+// classify decides how to treat an input by its first tokens. A name
+// followed by an initializer, or by a parameter list and a body, starts
+// a definition; a name already defined starts an expression.
+func (r *Repl) classify(text string) int {
+	i := 0
+	for i < len(text) && (isIdentRune(rune(text[i]))) {
+		i++
+	}
+	name := text[:i]
+	if name == "" || replKeywords[name] || unicode.IsDigit(rune(name[0])) {
+		if text[0] == '{' || replKeywords[name] {
+			return replStatement
+		}
+		return replExpression
+	}
+
+	rest := strings.TrimLeft(text[i:], " \t\r\n")
+	if rest == "" {
+		return replExpression
+	}
+	switch c := rest[0]; {
+	case c == '(':
+		end := strings.IndexByte(rest, ')')
+		if end < 0 {
+			return replExpression
+		}
+		after := strings.TrimLeft(rest[end+1:], " \t\r\n")
+		if isParamList(rest[1:end]) && after != "" && (after[0] == '{' || isIdentRune(rune(after[0]))) {
+			return replDefinition
+		}
+		return replExpression
+	case c == '\'' || c == '"' || (c >= '0' && c <= '9'):
+		return replDefinition
+	case c == ';' || c == '[' || c == '-':
+		if r.defined[name] || r.isGlobal(name) {
+			return replExpression
+		}
+		return replDefinition
+	default:
+		return replExpression
+	}
+}
+
+// isGlobal reports whether a name refers to a global of the program.
+func (r *Repl) isGlobal(name string) bool {
+	_, ok := r.interp.globals[r.args.GlobalPrefix+name]
+	return ok
+}
+
+func isIdentRune(c rune) bool {
+	return unicode.IsLetter(c) || unicode.IsDigit(c) || c == '_'
+}
+
+// isParamList reports whether s is a comma-separated list of names.
+func isParamList(s string) bool {
+	if strings.TrimSpace(s) == "" {
+		return true
+	}
+	for _, p := range strings.Split(s, ",") {
+		p = strings.TrimSpace(p)
+		if p == "" || strings.IndexFunc(p, func(c rune) bool { return !isIdentRune(c) }) >= 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// replComplete reports whether the input is complete: brackets are
+// balanced outside of strings and comments, and the text ends with
+// ';' or '}'. Commands take a single line.
+func replComplete(text string) bool {
+	text = strings.TrimSpace(text)
+	if text == "" || text[0] == ':' {
+		return true
+	}
+	depth := 0
+	for i := 0; i < len(text); i++ {
+		switch c := text[i]; c {
+		case '(', '[', '{':
+			depth++
+		case ')', ']', '}':
+			depth--
+		case '"', '\'':
+			// Skip the literal; '*' escapes the next character
+			for i++; i < len(text) && text[i] != c; i++ {
+				if text[i] == '*' {
+					i++
+				}
+			}
+			if i >= len(text) {
+				return false
+			}
+		case '/':
+			if i+1 < len(text) && text[i+1] == '*' {
+				end := strings.Index(text[i+2:], "*/")
+				if end < 0 {
+					return false
+				}
+				i += end + 3
+			}
+		}
+	}
+	last := text[len(text)-1]
+	return depth <= 0 && (last == ';' || last == '}')
+}
@@ -0,0 +1,128 @@
+package compiler
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// runRepl feeds a script to a session and returns stdout and stderr.
+func runRepl(t *testing.T, script string) (string, string) {
+	t.Helper()
+	args := NewCompileOptions("blang", nil)
+	interp := NewInterp(args)
+	var stdout, stderr bytes.Buffer
+	interp.Stdin = strings.NewReader(script)
+	interp.Stdout = &stdout
+	interp.Stderr = &stderr
+	if err := NewRepl(args, interp).Run(); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	return stdout.String(), stderr.String()
+}
+
+// TestReplSession tests definitions, statements and expressions
+func TestReplSession(t *testing.T) {
+	tests := []struct {
+		name       string
+		script     string
+		wantStdout string
+		wantStderr string
+	}{
+		{
+			name:       "expressions",
+			script:     "2 + 3 * 4;\n-1;\n'a';\n",
+			wantStdout: "14 (016)\n-1 (01777777777777777777777)\n97 (0141)\n",
+		},
+		{
+			name:       "globals",
+			script:     "x 5;\nx;\nx = x * 8;\nx;\n",
+			wantStdout: "5 (05)\n40 (050)\n40 (050)\n",
+		},
+		{
+			name: "functions",
+			script: `fib(n) return (n < 2 ? n : fib(n-1) + fib(n-2));
+fib(10);
+sum(a, b) {
+    return (a + b);
+}
+sum(fib(5), 1);
+`,
+			wantStdout: "55 (067)\n6 (06)\n",
+		},
+		{
+			name: "redefine",
+			script: `f() return (1);
+g() return (f() * 10);
+g();
+f() return (2);
+g();
+`,
+			wantStdout: "10 (012)\n20 (024)\n",
+		},
+		{
+			name:       "statements",
+			script:     "{ auto i; i = 0; while (i < 3) printf(\"%d \", i++); }\nif (1) write('ok*n');\n",
+			wantStdout: "0 1 2 ok\n",
+		},
+		{
+			name:       "inspect",
+			script:     "v[3] 1, 2, 3;\nbig[20];\nbig[4] = 9;\nw 7, 8;\nn -4;\nf() return (0);\ng(a, b) return (a + b);\n:globals\n:funcs\n",
+			wantStdout: "9 (011)\nbig[20] = 0 0 0 0 9 0 0 0 ...\nn = -4 (01777777777777777777774)\nv[3] = 1 2 3\nw = 7 8\nf()\ng()\n",
+		},
+		{
+			name:       "errors",
+			script:     "1 / 0;\nnosuch();\nx = ;\n:bogus\n3;\n",
+			wantStdout: "3 (03)\n",
+			wantStderr: "error: floating point exception: division by zero\n" +
+				"error: undefined reference to 'b.nosuch'\n" +
+				"error: undefined identifier 'x'\n" +
+				"error: unknown command ':bogus', enter ':help' for help\n",
+		},
+		{
+			name:       "exit",
+			script:     "bye() printf(\"bye*n\");\natexit(bye);\nexit(3);\n1;\n",
+			wantStdout: "0 (00)\nbye\n1 (01)\n",
+			wantStderr: "exit status 3\n",
+		},
+		{
+			name:       "multiline_and_quit",
+			script:     "2 +\n  3;\n/* ( */ 4;\n:quit\n5;\n",
+			wantStdout: "5 (05)\n4 (04)\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout, stderr := runRepl(t, tt.script)
+			if stdout != tt.wantStdout {
+				t.Errorf("Stdout = %q, want %q", stdout, tt.wantStdout)
+			}
+			if stderr != tt.wantStderr {
+				t.Errorf("Stderr = %q, want %q", stderr, tt.wantStderr)
+			}
+		})
+	}
+}
+
+// TestReplComplete tests detection of complete input
+func TestReplComplete(t *testing.T) {
+	tests := []struct {
+		text string
+		want bool
+	}{
+		{"x;", true},
+		{"f(a) {", false},
+		{"f(a) {\n return (a);\n}", true},
+		{"printf(\"}*\"\");", true},
+		{"printf(\";", false},
+		{"x /* ; */", false},
+		{":globals", true},
+		{"", true},
+	}
+	for _, tt := range tests {
+		if got := replComplete(tt.text); got != tt.want {
+			t.Errorf("replComplete(%q) = %v, want %v", tt.text, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package compiler
+
+import (
+	"github.com/llir/llvm/ir"
+	"github.com/llir/llvm/ir/enum"
+	"github.com/llir/llvm/ir/types"
+	"github.com/llir/llvm/ir/value"
+)
+
+//
+// Deep recursion. A call whose result is returned at once, as in
+// return (f(x)), is marked as a tail call, so that LLVM may reuse the
+// frame of the caller; a musttail call, when the caller and the callee
+// have the same fixed parameters, always does. Neither is possible when
+// the callee may reach a variable of the caller, that is when the
+// caller takes the address of one.
+//
+// With -fstack-check every function compares the stack pointer with
+// the limit set by the runtime library at startup, from the limit of
+// the size of the stack, and calls b..trap on overflow, so that a
+// program stops with "stack overflow" and the function instead of a
+// segmentation fault.
+//
+
+// stackLimit is the word of the runtime holding the lowest address the
+// stack of B functions may reach
+const stackLimit = ".stack.limit"
+
+// returnCall notes a call whose result the current function returns,
+// when nothing was emitted after it
+func (c *Compiler) returnCall(val value.Value) {
+	insts := c.builder.Insts
+	if call, ok := val.(*ir.InstCall); ok && insts[len(insts)-1] == call {
+		c.tailCalls = append(c.tailCalls, c.builder)
+	}
+}
+
+// markTailCalls marks the calls noted by returnCall in the current
+// function, unless an address of its stack escapes
+func (c *Compiler) markTailCalls() {
+	blocks := c.tailCalls
+	c.tailCalls = nil
+	fn := c.currentFn
+	allocas := map[*ir.InstAlloca]bool{}
+	for _, b := range fn.Blocks {
+		for _, inst := range b.Insts {
+			if a, ok := inst.(*ir.InstAlloca); ok {
+				allocas[a] = true
+			}
+		}
+	}
+	if len(blocks) == 0 || escapes(allocas, fn) {
+		return
+	}
+	for _, b := range blocks {
+		ret, _ := b.Term.(*ir.TermRet)
+		if ret == nil {
+			continue
+		}
+		call, ok := ret.X.(*ir.InstCall)
+		if !ok {
+			continue
+		}
+		call.Tail = enum.TailTail
+		if b.Insts[len(b.Insts)-1] != call || c.args.IsWasm() {
+			continue
+		}
+		callee, ok := call.Callee.(*ir.Func)
+		if ok && !fn.Sig.Variadic && types.Equal(callee.Sig, fn.Sig) {
+			call.Tail = enum.TailMustTail
+		}
+	}
+}
+
+// checkStack makes the current function test the stack pointer on
+// entry. The check goes into a new entry block, with the allocas of
+// the former one, so that they are still allocated with the frame.
+func (c *Compiler) checkStack(pos Pos) {
+	if !c.args.StackCheck {
+		return
+	}
+	fn := c.currentFn
+	body := fn.Blocks[0]
+	entry := ir.NewBlock("stack.check")
+	entry.Parent = fn
+	insts := body.Insts[:0]
+	for _, inst := range body.Insts {
+		if a, ok := inst.(*ir.InstAlloca); ok {
+			entry.Insts = append(entry.Insts, a)
+		} else {
+			insts = append(insts, inst)
+		}
+	}
+	body.Insts = insts
+
+	word := c.WordType()
+	sp := entry.NewPtrToInt(entry.NewCall(c.intrinsic("llvm.stacksave", types.I8Ptr)), word)
+	limit := entry.NewLoad(word, c.runtimeWord(stackLimit))
+	trap := ir.NewBlock("stack.overflow")
+	trap.Parent = fn
+	entry.NewCondBr(entry.NewICmp(enum.IPredULT, sp, limit), trap, body)
+	trap.NewCall(c.runtimeTrap(trapHandler),
+		c.stringWord(pos.String()), c.stringWord(c.currentName()), c.stringWord("stack overflow"))
+	trap.NewUnreachable()
+
+	fn.Blocks = append(append([]*ir.Block{entry}, fn.Blocks...), trap)
+}
+
+// intrinsic returns the LLVM intrinsic of the given name, without
+// parameters
+func (c *Compiler) intrinsic(name string, result types.Type) *ir.Func {
+	for _, fn := range c.module.Funcs {
+		if fn.Name() == name {
+			return fn
+		}
+	}
+	return c.module.NewFunc(name, result)
+}
+
+// runtimeWord returns a word defined by the runtime library
+func (c *Compiler) runtimeWord(name string) *ir.Global {
+	if g := c.findGlobalByName(name); g != nil {
+		return g
+	}
+	g := c.module.NewGlobal(c.globalName(name), c.WordType())
+	g.Linkage = enum.LinkageExternal
+	return g
+}
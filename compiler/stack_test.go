@@ -0,0 +1,93 @@
+package compiler
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestTailCalls tests the calls marked as tail calls: musttail between
+// bodies with the same parameters, tail otherwise, and none when the
+// address of a variable escapes
+func TestTailCalls(t *testing.T) {
+	src := `down(n, s) {
+    if (n == 0)
+        return (s);
+    return (down(n - 1, s + n));
+}
+
+half(n) {
+    if (n > 1)
+        return (half(n / 2));
+    return (n);
+}
+
+twice(n) return (down(n, n));
+
+escape(n) {
+    auto x;
+    x = n;
+    return (half(&x));
+}
+`
+	module, _, err := ParseReader("t.b", strings.NewReader(src))
+	if err != nil {
+		t.Fatalf("ParseReader() failed: %v", err)
+	}
+	ir := module.String()
+	for _, s := range []string{
+		"musttail call i64 @.body.down(i64 %",
+		"musttail call i64 @.body.half(i64 %",
+		"tail call i64 @.body.down(i64 %",
+	} {
+		if !strings.Contains(ir, s) {
+			t.Errorf("IR has no %q:\n%s", s, ir)
+		}
+	}
+	if n := strings.Count(ir, "tail call"); n != 7 {
+		t.Errorf("%d tail calls, want 7 with those of the thunks:\n%s", n, ir)
+	}
+}
+
+// deepSource recurses deeper than the stack: by tail calls with two
+// parameters and with one, which take no stack, then without end
+const deepSource = `down(n, s) {
+    if (n == 0)
+        return (s);
+    return (down(n - 1, s + n));
+}
+
+count(n) {
+    if (n == 0)
+        return (0);
+    return (count(n - 1));
+}
+
+forever(n) {
+    return (1 + forever(n + 1));
+}
+
+main() {
+    printf("%d %d*n", down(1000000, 0), count(1000000));
+    forever(0);
+}
+`
+
+// TestStackCheck tests the report of a stack overflow, and that tail
+// recursion takes no stack in the interpreter, with one parameter as
+// with two
+func TestStackCheck(t *testing.T) {
+	out, _, err := interpretFromCode(t, "deep", deepSource, "", []Option{WithStackCheck()})
+	if err == nil || err.Error() != "deep.b:13: in forever(): stack overflow" {
+		t.Errorf("error = %v", err)
+	}
+	if out != "500000500000 0\n" {
+		t.Errorf("output %q", out)
+	}
+
+	for _, target := range []string{"pdp11", "wasm32-wasi"} {
+		_, _, err := Build([]Source{{Name: "deep.b", Code: []byte(deepSource)}}, WithOutputType(OutputAssembly), WithTarget(target), WithStackCheck())
+		if err == nil || !strings.Contains(err.Error(), "-fstack-check") {
+			t.Errorf("%s with -fstack-check: error = %v", target, err)
+		}
+	}
+}
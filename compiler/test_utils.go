@@ -0,0 +1,396 @@
+package compiler
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/atombender/go-diff"
+)
+
+// Prevent "unused" linter warnings in tools that don't analyze test files together.
+var _ = []interface{}{
+	ensureLibbOrSkip,
+	writeTempFile,
+	createTempBFile,
+	compileToLL,
+	linkWithClang,
+	nativeAvailable,
+	linkNativeForTest,
+	runExecutable,
+	compileLinkRunFromBFile,
+	compileLinkRunFromCode,
+	interpretFromCode,
+	runWithTimeout,
+	hasSubstring,
+	contains,
+	buildLineDiff,
+}
+
+// ensureLibbOrSkip skips the test if runtime object file is missing.
+func ensureLibbOrSkip(t testing.TB) {
+	t.Helper()
+	if _, err := os.Stat("../runtime/libb.a"); err != nil {
+		t.Skip("../runtime/libb.a not found, run 'make' first")
+	}
+}
+
+// writeTempFile writes a file in the specified directory and returns its path.
+func writeTempFile(t testing.TB, dir, name, content string) string {
+	t.Helper()
+	p := filepath.Join(dir, name)
+	if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write %s: %v", p, err)
+	}
+	return p
+}
+
+// createTempBFile creates a temporary directory with a B source and returns useful paths.
+func createTempBFile(t testing.TB, name, code string) (tmpDir, bFile, llFile, exeFile string) {
+	t.Helper()
+	tmpDir = t.TempDir()
+	bFile = writeTempFile(t, tmpDir, name+".b", code)
+	llFile = filepath.Join(tmpDir, name+".ll")
+	exeFile = filepath.Join(tmpDir, name)
+	return
+}
+
+// compileToLL compiles a B source file into an LLVM IR file.
+func compileToLL(t testing.TB, input string, llOut string) {
+	t.Helper()
+	args := NewCompileOptions("blang", []string{input})
+	args.OutputFile = llOut
+	args.OutputType = OutputIR
+	if err := Compile(args); err != nil {
+		t.Fatalf("Compile(%s) failed: %v", input, err)
+	}
+}
+
+// linkWithClang links an LLVM IR file with B library into an executable.
+func linkWithClang(t testing.TB, llFile, exeFile string) {
+	t.Helper()
+	cmdArgs := []string{llFile, "../runtime/libb.a", "-o", exeFile}
+	if runtime.GOOS == "darwin" {
+		cmdArgs = append(cmdArgs, "-Wl,-e,_b_start")
+	}
+	cmd := exec.Command("clang", cmdArgs...)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("Linking failed: %v\nOutput: %s", err, out)
+	}
+}
+
+// nativeAvailable reports whether programs can be built with the native backend.
+func nativeAvailable() bool {
+	if checkNativeHost() != nil {
+		return false
+	}
+	for _, tool := range []string{"as", "ld"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			return false
+		}
+	}
+	_, err := os.Stat("../runtime/libb.a")
+	return err == nil
+}
+
+// linkNativeForTest builds an executable from a B file with the native backend.
+func linkNativeForTest(t testing.TB, bFile, exeFile string) {
+	t.Helper()
+	args := NewCompileOptions("blang", []string{bFile})
+	args.Backend = BackendNative
+	args.OutputFile = exeFile
+	args.LibraryDirs = []string{"../runtime"}
+	if err := Compile(args); err != nil {
+		t.Fatalf("Compile(%s) with native backend failed: %v", bFile, err)
+	}
+}
+
+// wasmAvailable reports whether WebAssembly modules can be built and run:
+// it needs clang with wasm-ld, wasmtime, and the runtime built by 'make wasm'.
+func wasmAvailable() bool {
+	for _, tool := range []string{"clang", "wasm-ld", "wasmtime"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			return false
+		}
+	}
+	_, err := os.Stat("../runtime/wasm32-wasi/libb.a")
+	return err == nil
+}
+
+// linkWasmForTest builds a WebAssembly module from a B file.
+func linkWasmForTest(t testing.TB, bFile, wasmFile string) {
+	t.Helper()
+	args := NewCompileOptions("blang", []string{bFile})
+	args.Target = "wasm32-wasi"
+	args.OutputFile = wasmFile
+	args.LibraryDirs = []string{"../runtime"}
+	if err := Compile(args); err != nil {
+		t.Fatalf("Compile(%s) for wasm32-wasi failed: %v", bFile, err)
+	}
+}
+
+// runExecutable runs an executable with arguments and returns its stdout and exit code.
+func runExecutable(t testing.TB, exeFile string, argv ...string) ([]byte, int) {
+	t.Helper()
+	cmd := exec.Command(exeFile, argv...)
+	stdout, err := cmd.Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			return stdout, exitErr.ExitCode()
+		}
+		t.Fatalf("Failed to run executable: %v", err)
+	}
+	return stdout, 0
+}
+
+// compileLinkRunFromBFile compiles, links, and runs from an existing B file.
+func compileLinkRunFromBFile(t testing.TB, bFile string) (string, int) {
+	t.Helper()
+	ensureLibbOrSkip(t)
+	dir := filepath.Dir(bFile)
+	llFile := filepath.Join(dir, "test.ll")
+	exeFile := filepath.Join(dir, "test")
+	compileToLL(t, bFile, llFile)
+	linkWithClang(t, llFile, exeFile)
+	out, code := runExecutable(t, exeFile)
+	return string(out), code
+}
+
+// compileLinkRunFromCode compiles, links, and runs from in-memory code, returning stdout.
+// The program is also run by the interpreter, which must give the same output;
+// without the runtime library only the interpreter is used.
+func compileLinkRunFromCode(t testing.TB, name, code string) string {
+	t.Helper()
+	interpOut, _, err := interpretFromCode(t, name, code, "", nil)
+	if err != nil {
+		t.Fatalf("Run(%s) failed: %v", name, err)
+	}
+	if _, err := os.Stat("../runtime/libb.a"); err != nil {
+		return interpOut
+	}
+	dir, bFile, llFile, exeFile := createTempBFile(t, name, code)
+	if nativeAvailable() {
+		nativeExe := filepath.Join(dir, name+".native")
+		linkNativeForTest(t, bFile, nativeExe)
+		out, _ := runExecutable(t, nativeExe)
+		if string(out) != interpOut {
+			t.Errorf("interpreter output differs from native program:\n%s", buildLineDiff(string(out), interpOut))
+		}
+	}
+	if wasmAvailable() {
+		wasmFile := filepath.Join(dir, name+".wasm")
+		linkWasmForTest(t, bFile, wasmFile)
+		out, _ := runExecutable(t, "wasmtime", wasmFile)
+		if string(out) != interpOut {
+			t.Errorf("interpreter output differs from WebAssembly program:\n%s", buildLineDiff(string(out), interpOut))
+		}
+	}
+	compileToLL(t, bFile, llFile)
+	linkWithClang(t, llFile, exeFile)
+	out, _ := runExecutable(t, exeFile)
+	if string(out) != interpOut {
+		t.Errorf("interpreter output differs from compiled program:\n%s", buildLineDiff(string(out), interpOut))
+	}
+	return string(out)
+}
+
+// interpretFromCode runs in-memory code, named name.b, with the
+// interpreter, feeding it the given input. The code is compiled with
+// the options given, at -O0 unless they set the level, and optimized
+// as the driver does. It returns stdout, the exit status and the
+// error which stopped the program, if any.
+func interpretFromCode(t testing.TB, name, code, input string, opts []Option, argv ...string) (string, int, error) {
+	t.Helper()
+	file := name + ".b"
+	opts = append([]Option{WithSource(file, []byte(code)), WithOptimize(0)}, opts...)
+	args := NewOptions([]string{file}, opts...)
+	module, err := ParseFile(args, file)
+	if err != nil {
+		t.Fatalf("ParseFile(%s) failed: %v", file, err)
+	}
+	if args.Optimize > 0 {
+		optimize(module)
+	}
+	interp := NewInterp(args)
+	var stdout bytes.Buffer
+	interp.Stdin = strings.NewReader(input)
+	interp.Stdout = &stdout
+	if err := interp.Load(module); err != nil {
+		t.Fatalf("Load(%s) failed: %v", file, err)
+	}
+	status, err := interp.Run(append([]string{filepath.Base(name)}, argv...))
+	return stdout.String(), status, err
+}
+
+// runWithTimeout runs an executable with a timeout and returns its stdout and exit code.
+func runWithTimeout(t testing.TB, exeFile string, timeout time.Duration) ([]byte, int) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, exeFile)
+	stdout, err := cmd.Output()
+	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			// Preserve wording from existing tests.
+			t.Fatal("Program exceeded 30 second timeout")
+		}
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			return stdout, exitErr.ExitCode()
+		}
+		t.Fatalf("Failed to run executable: %v", err)
+	}
+	return stdout, 0
+}
+
+// contains reports whether substr is within s.
+func contains(s, substr string) bool {
+	return strings.Contains(s, substr)
+}
+
+// hasSubstring is a simple substring search used by tests.
+func hasSubstring(s, substr string) bool {
+	return strings.Contains(s, substr)
+}
+
+// ---- Lexer test helpers ----
+
+// bodyIR returns the definition of the body of the function name in ir,
+// without its thunk
+func bodyIR(ir, name string) string {
+	_, body, _ := strings.Cut(ir, "define internal i64 @.body."+name+"(")
+	body, _, _ = strings.Cut(body, "\n}\n")
+	return body
+}
+
+// newTestLexer creates a lexer for the provided input.
+func newTestLexer(t testing.TB, input string) *Lexer {
+	t.Helper()
+	args := NewCompileOptions("test", nil)
+	return NewLexer(args, strings.NewReader(input))
+}
+
+// lexIdentifier returns the parsed identifier from input.
+func lexIdentifier(t testing.TB, input string) string {
+	t.Helper()
+	l := newTestLexer(t, input)
+	got, err := l.Identifier()
+	if err != nil {
+		t.Fatalf("Identifier() error = %v", err)
+	}
+	return got
+}
+
+// lexNumber returns the parsed number from input.
+func lexNumber(t testing.TB, input string) int64 {
+	t.Helper()
+	l := newTestLexer(t, input)
+	got, err := l.Number()
+	if err != nil {
+		t.Fatalf("Number() error = %v", err)
+	}
+	return got
+}
+
+// lexStringLiteral parses a string literal input, assuming leading '"'.
+func lexStringLiteral(t testing.TB, input string) string {
+	t.Helper()
+	l := newTestLexer(t, input)
+	// Skip opening quote
+	if _, err := l.ReadChar(); err != nil {
+		t.Fatalf("ReadChar() error = %v", err)
+	}
+	got, err := l.String()
+	if err != nil {
+		t.Fatalf("String() error = %v", err)
+	}
+	return got
+}
+
+// lexCharacterLiteral parses a character literal input, assuming leading '\”.
+func lexCharacterLiteral(t testing.TB, input string) int64 {
+	t.Helper()
+	l := newTestLexer(t, input)
+	// Skip opening quote
+	if _, err := l.ReadChar(); err != nil {
+		t.Fatalf("ReadChar() error = %v", err)
+	}
+	got, err := l.Character()
+	if err != nil {
+		t.Fatalf("Character() error = %v", err)
+	}
+	return got
+}
+
+// lexWhitespaceNextRune consumes whitespace/comments and returns the next rune.
+func lexWhitespaceNextRune(t testing.TB, input string) rune {
+	t.Helper()
+	l := newTestLexer(t, input)
+	if err := l.Whitespace(); err != nil {
+		t.Fatalf("Whitespace() error = %v", err)
+	}
+	got, err := l.ReadChar()
+	if err != nil {
+		t.Fatalf("ReadChar() error = %v", err)
+	}
+	return got
+}
+
+// lexCommentRest skips an opening comment and returns the remaining text after it.
+func lexCommentRest(t testing.TB, input string) string {
+	t.Helper()
+	l := newTestLexer(t, input)
+	// Skip opening /*
+	if _, err := l.ReadChar(); err != nil {
+		t.Fatalf("ReadChar() error = %v", err)
+	}
+	if _, err := l.ReadChar(); err != nil {
+		t.Fatalf("ReadChar() error = %v", err)
+	}
+	if err := l.Comment(); err != nil {
+		t.Fatalf("Comment() error = %v", err)
+	}
+	var rest []rune
+	for {
+		c, err := l.ReadChar()
+		if err != nil {
+			break
+		}
+		rest = append(rest, c)
+	}
+	return string(rest)
+}
+
+// buildLineDiff returns a unified-style diff of want vs got with the given
+// number of context lines and a maximum number of printed lines.
+func buildLineDiff(want, got string) string {
+	// Compute the diff
+	hunks := diff.Diff(strings.Split(want, "\n"), strings.Split(got, "\n"))
+
+	// Optionally prune to remove all unchanged lines (2 context)
+	hunks = diff.PruneContext(hunks, 2)
+
+	var buf strings.Builder
+	var prevNum int
+	for _, hunk := range hunks {
+		if prevNum > 0 && hunk.LineNum > prevNum+1 {
+			buf.WriteString("........\n")
+			break
+		}
+		switch hunk.Operation {
+		case diff.OpUnchanged:
+			buf.WriteString(" " + hunk.Line + "\n")
+		case diff.OpDelete:
+			buf.WriteString("-" + hunk.Line + "\n")
+		case diff.OpInsert:
+			buf.WriteString("+" + hunk.Line + "\n")
+		}
+		prevNum = hunk.LineNum
+	}
+	return buf.String()
+}
@@ -0,0 +1,16 @@
+/* Parameters and indirect calls */
+sum(n, a, b, c) {
+    if (n == 1)
+        return (a);
+    if (n == 2)
+        return (a + b);
+    return (a + b + c);
+}
+
+apply(f, x) {
+    return ((f)(x, 1, 2, 3));
+}
+
+main(argv) {
+    return (apply(sum, argv[0]) + sum(2, 5, 6));
+}
@@ -0,0 +1,196 @@
+.globl	_apply
+.globl	_main
+.globl	_sum
+.globl	b.add
+.globl	b.bz
+.globl	b.call
+.globl	b.entry
+.globl	b.eq
+.globl	b.la
+.globl	b.lc
+.globl	b.ld
+.globl	b.lv
+.globl	b.ne
+.globl	b.ret
+.globl	b.st
+.globl	b.sv
+.globl	b.vaarg
+.globl	b.vast
+.text
+
+/ sum
+_sum:
+	jsr	r3,b.entry
+	98.
+L1_0:
+	b.lv; 6.
+	b.la; -2.
+	b.st
+	b.la; -50.
+	b.sv; -58.
+	b.lv; -58.
+	b.vast; 1.
+	b.lv; -58.
+	b.vaarg
+	b.sv; -60.
+	b.lv; -60.
+	b.la; -52.
+	b.st
+	b.lv; -58.
+	b.vaarg
+	b.sv; -62.
+	b.lv; -62.
+	b.la; -54.
+	b.st
+	b.lv; -58.
+	b.vaarg
+	b.sv; -64.
+	b.lv; -64.
+	b.la; -56.
+	b.st
+	b.la; -2.
+	b.ld
+	b.sv; -66.
+	b.lv; -66.
+	b.lc; 1.
+	b.eq
+	b.sv; -68.
+	b.lv; -68.
+	b.sv; -70.
+	b.lv; -70.
+	b.lc; 0.
+	b.ne
+	b.sv; -72.
+	b.lv; -72.
+	b.bz; L1_2
+L1_1:
+	b.la; -52.
+	b.ld
+	b.sv; -74.
+	b.lv; -74.
+	b.ret
+L1_2:
+L1_3:
+	b.la; -2.
+	b.ld
+	b.sv; -76.
+	b.lv; -76.
+	b.lc; 2.
+	b.eq
+	b.sv; -78.
+	b.lv; -78.
+	b.sv; -80.
+	b.lv; -80.
+	b.lc; 0.
+	b.ne
+	b.sv; -82.
+	b.lv; -82.
+	b.bz; L1_5
+L1_4:
+	b.la; -52.
+	b.ld
+	b.sv; -84.
+	b.la; -54.
+	b.ld
+	b.sv; -86.
+	b.lv; -84.
+	b.lv; -86.
+	b.add
+	b.sv; -88.
+	b.lv; -88.
+	b.ret
+L1_5:
+L1_6:
+	b.la; -52.
+	b.ld
+	b.sv; -90.
+	b.la; -54.
+	b.ld
+	b.sv; -92.
+	b.lv; -90.
+	b.lv; -92.
+	b.add
+	b.sv; -94.
+	b.la; -56.
+	b.ld
+	b.sv; -96.
+	b.lv; -94.
+	b.lv; -96.
+	b.add
+	b.sv; -98.
+	b.lv; -98.
+	b.ret
+
+/ apply
+_apply:
+	jsr	r3,b.entry
+	64.
+L2_0:
+	b.lv; 6.
+	b.la; -2.
+	b.st
+	b.la; -50.
+	b.sv; -54.
+	b.lv; -54.
+	b.vast; 1.
+	b.lv; -54.
+	b.vaarg
+	b.sv; -56.
+	b.lv; -56.
+	b.la; -52.
+	b.st
+	b.la; -2.
+	b.ld
+	b.sv; -58.
+	b.la; -52.
+	b.ld
+	b.sv; -60.
+	b.lv; -58.
+	b.sv; -62.
+	b.lc; 3.
+	b.lc; 2.
+	b.lc; 1.
+	b.lv; -60.
+	b.lv; -62.
+	b.call; 4.
+	b.sv; -64.
+	b.lv; -64.
+	b.ret
+
+/ main
+_main:
+	jsr	r3,b.entry
+	18.
+L3_0:
+	b.lv; 6.
+	b.la; -2.
+	b.st
+	b.lc; _sum
+	b.sv; -4.
+	b.la; -2.
+	b.ld
+	b.sv; -6.
+	b.lv; -6.
+	b.sv; -8.
+	b.lv; -8.
+	b.sv; -10.
+	b.lv; -10.
+	b.ld
+	b.sv; -12.
+	b.lv; -12.
+	b.lv; -4.
+	b.lc; _apply
+	b.call; 2.
+	b.sv; -14.
+	b.lc; 6.
+	b.lc; 5.
+	b.lc; 2.
+	b.lc; _sum
+	b.call; 3.
+	b.sv; -16.
+	b.lv; -14.
+	b.lv; -16.
+	b.add
+	b.sv; -18.
+	b.lv; -18.
+	b.ret
@@ -0,0 +1,32 @@
+/* Branches, loops and switches */
+classify(c) {
+    switch (c) {
+    case 'a':
+    case 'e':
+        return (1);
+    case 0177:
+        return (2);
+    case 0100000:
+        return (3);
+    }
+    return (0);
+}
+
+main() {
+    auto i, n;
+
+    i = n = 0;
+    while (i < 10) {
+        if (classify(i) == 0)
+            n++;
+        else
+            n--;
+        i++;
+    }
+again:
+    if (n > 0) {
+        n = n - 3;
+        goto again;
+    }
+    return (n);
+}
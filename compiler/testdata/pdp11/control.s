@@ -0,0 +1,185 @@
+.globl	_classify
+.globl	_main
+.globl	b.add
+.globl	b.br
+.globl	b.bz
+.globl	b.call
+.globl	b.entry
+.globl	b.eq
+.globl	b.gt
+.globl	b.la
+.globl	b.lc
+.globl	b.ld
+.globl	b.lt
+.globl	b.lv
+.globl	b.ne
+.globl	b.ret
+.globl	b.st
+.globl	b.sub
+.globl	b.sv
+.globl	b.swit
+.text
+
+/ classify
+_classify:
+	jsr	r3,b.entry
+	4.
+L1_0:
+	b.lv; 6.
+	b.la; -2.
+	b.st
+	b.la; -2.
+	b.ld
+	b.sv; -4.
+	b.br; L1_2
+L1_1:
+	b.br; L1_4
+L1_2:
+	b.lv; -4.
+	b.swit; 4.
+	97.; L1_4
+	101.; L1_5
+	127.; L1_6
+	-32768.; L1_7
+L1_3:
+	b.lc; 0.
+	b.ret
+L1_4:
+L1_5:
+	b.lc; 1.
+	b.ret
+L1_6:
+	b.lc; 2.
+	b.ret
+L1_7:
+	b.lc; 3.
+	b.ret
+
+/ main
+_main:
+	jsr	r3,b.entry
+	48.
+L2_0:
+	b.lc; 0.
+	b.la; -2.
+	b.st
+	b.lc; 0.
+	b.la; -4.
+	b.st
+	b.lc; 0.
+	b.la; -4.
+	b.st
+	b.lc; 0.
+	b.la; -2.
+	b.st
+L2_1:
+	b.la; -2.
+	b.ld
+	b.sv; -6.
+	b.lv; -6.
+	b.lc; 10.
+	b.lt
+	b.sv; -8.
+	b.lv; -8.
+	b.sv; -10.
+	b.lv; -10.
+	b.lc; 0.
+	b.ne
+	b.sv; -12.
+	b.lv; -12.
+	b.bz; L2_3
+L2_2:
+	b.la; -2.
+	b.ld
+	b.sv; -14.
+	b.lv; -14.
+	b.lc; _classify
+	b.call; 1.
+	b.sv; -16.
+	b.lv; -16.
+	b.lc; 0.
+	b.eq
+	b.sv; -18.
+	b.lv; -18.
+	b.sv; -20.
+	b.lv; -20.
+	b.lc; 0.
+	b.ne
+	b.sv; -22.
+	b.lv; -22.
+	b.bz; L2_5
+	b.br; L2_4
+L2_3:
+	b.br; L2_7
+L2_4:
+	b.la; -4.
+	b.ld
+	b.sv; -24.
+	b.lv; -24.
+	b.lc; 1.
+	b.add
+	b.sv; -26.
+	b.lv; -26.
+	b.la; -4.
+	b.st
+	b.br; L2_6
+L2_5:
+	b.la; -4.
+	b.ld
+	b.sv; -28.
+	b.lv; -28.
+	b.lc; 1.
+	b.sub
+	b.sv; -30.
+	b.lv; -30.
+	b.la; -4.
+	b.st
+L2_6:
+	b.la; -2.
+	b.ld
+	b.sv; -32.
+	b.lv; -32.
+	b.lc; 1.
+	b.add
+	b.sv; -34.
+	b.lv; -34.
+	b.la; -2.
+	b.st
+	b.br; L2_1
+L2_7:
+	b.la; -4.
+	b.ld
+	b.sv; -36.
+	b.lv; -36.
+	b.lc; 0.
+	b.gt
+	b.sv; -38.
+	b.lv; -38.
+	b.sv; -40.
+	b.lv; -40.
+	b.lc; 0.
+	b.ne
+	b.sv; -42.
+	b.lv; -42.
+	b.bz; L2_9
+L2_8:
+	b.la; -4.
+	b.ld
+	b.sv; -44.
+	b.lv; -44.
+	b.lc; 3.
+	b.sub
+	b.sv; -46.
+	b.lv; -46.
+	b.la; -4.
+	b.st
+	b.br; L2_7
+L2_9:
+L2_10:
+	b.la; -4.
+	b.ld
+	b.sv; -48.
+	b.lv; -48.
+	b.ret
+L2_11:
+	b.br; L2_10
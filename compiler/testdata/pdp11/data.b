@@ -0,0 +1,18 @@
+/* Globals, vectors and strings */
+count;
+limit 100;
+table[3] 1, -2, 'ab';
+names[] "one", "two";
+message "text*t*"quoted*"*n";
+
+main() {
+    extrn count, limit, table, names, message;
+    auto buf[4], p;
+
+    p = &table[1];
+    *p = limit;
+    buf[2] = names[1];
+    count = char(message, 3) + buf[2][0];
+    lchar(buf, 0, 'x');
+    return (count);
+}
@@ -0,0 +1,166 @@
+.globl	_char
+.globl	_count
+.globl	_lchar
+.globl	_limit
+.globl	_main
+.globl	_message
+.globl	_names
+.globl	_table
+.globl	b.add
+.globl	b.call
+.globl	b.entry
+.globl	b.la
+.globl	b.lc
+.globl	b.ld
+.globl	b.lv
+.globl	b.ret
+.globl	b.st
+.globl	b.sv
+.text
+
+/ main
+_main:
+	jsr	r3,b.entry
+	80.
+L1_0:
+	b.la; -10.
+	b.lc; 2.
+	b.add
+	b.sv; -14.
+	b.lv; -14.
+	b.sv; -16.
+	b.la; -10.
+	b.sv; -18.
+	b.lv; -16.
+	b.lv; -18.
+	b.st
+	b.lc; 0.
+	b.la; -12.
+	b.st
+	b.lc; _table
+	b.sv; -20.
+	b.lv; -20.
+	b.ld
+	b.sv; -22.
+	b.lv; -22.
+	b.sv; -24.
+	b.lv; -24.
+	b.lc; 2.
+	b.add
+	b.sv; -26.
+	b.lv; -26.
+	b.sv; -28.
+	b.lv; -28.
+	b.la; -12.
+	b.st
+	b.la; -12.
+	b.ld
+	b.sv; -30.
+	b.lv; -30.
+	b.sv; -32.
+	b.lc; _limit
+	b.ld
+	b.sv; -34.
+	b.lv; -34.
+	b.lv; -32.
+	b.st
+	b.lv; -18.
+	b.ld
+	b.sv; -36.
+	b.lv; -36.
+	b.sv; -38.
+	b.lv; -38.
+	b.lc; 4.
+	b.add
+	b.sv; -40.
+	b.lc; _names
+	b.sv; -42.
+	b.lv; -42.
+	b.ld
+	b.sv; -44.
+	b.lv; -44.
+	b.sv; -46.
+	b.lv; -46.
+	b.lc; 2.
+	b.add
+	b.sv; -48.
+	b.lv; -48.
+	b.ld
+	b.sv; -50.
+	b.lv; -50.
+	b.lv; -40.
+	b.st
+	b.lc; _message
+	b.ld
+	b.sv; -52.
+	b.lc; _char
+	b.sv; -54.
+	b.lc; 3.
+	b.lv; -52.
+	b.lc; _char
+	b.call; 2.
+	b.sv; -56.
+	b.lv; -18.
+	b.ld
+	b.sv; -58.
+	b.lv; -58.
+	b.sv; -60.
+	b.lv; -60.
+	b.lc; 4.
+	b.add
+	b.sv; -62.
+	b.lv; -62.
+	b.ld
+	b.sv; -64.
+	b.lv; -64.
+	b.sv; -66.
+	b.lv; -66.
+	b.sv; -68.
+	b.lv; -68.
+	b.ld
+	b.sv; -70.
+	b.lv; -56.
+	b.lv; -70.
+	b.add
+	b.sv; -72.
+	b.lv; -72.
+	b.lc; _count
+	b.st
+	b.lv; -18.
+	b.ld
+	b.sv; -74.
+	b.lc; _lchar
+	b.sv; -76.
+	b.lc; 120.
+	b.lc; 0.
+	b.lv; -74.
+	b.lc; _lchar
+	b.call; 3.
+	b.sv; -78.
+	b.lc; _count
+	b.ld
+	b.sv; -80.
+	b.lv; -80.
+	b.ret
+.data
+.comm	_count,2.
+_limit:
+	100.
+_table:
+	_table+2.
+	1.
+	-2.
+	24930.
+Lstr0:
+	<one\0>
+Lstr1:
+	<two\0>
+_names:
+	_names+2.
+	Lstr0
+	Lstr1
+Lstr2:
+	<text\t"quoted"\n\0>
+.even
+_message:
+	Lstr2
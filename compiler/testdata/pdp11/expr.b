@@ -0,0 +1,21 @@
+/* Operators on 16-bit words */
+calc(a, b) {
+    auto x;
+
+    x = a + b * 3 - a / b + a % b;
+    x = (a & 0377) | b << 2;
+    x = a >> 1;
+    x =+ -a;
+    x =* !b;
+    x = -x;
+    return (a < b ? a <= x : a > b & b >= x | a == b & b != x);
+}
+
+main() {
+    auto p;
+
+    p = 0;
+    p++;
+    --p;
+    return (calc(40000, -2) + calc(p, 1));
+}
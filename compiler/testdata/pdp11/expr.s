@@ -0,0 +1,333 @@
+.globl	_calc
+.globl	_main
+.globl	b.add
+.globl	b.and
+.globl	b.br
+.globl	b.bz
+.globl	b.call
+.globl	b.div
+.globl	b.entry
+.globl	b.eq
+.globl	b.ge
+.globl	b.gt
+.globl	b.la
+.globl	b.lc
+.globl	b.ld
+.globl	b.le
+.globl	b.lt
+.globl	b.lv
+.globl	b.mod
+.globl	b.mul
+.globl	b.ne
+.globl	b.or
+.globl	b.ret
+.globl	b.shl
+.globl	b.shr
+.globl	b.st
+.globl	b.sub
+.globl	b.sv
+.globl	b.vaarg
+.globl	b.vast
+.text
+
+/ calc
+_calc:
+	jsr	r3,b.entry
+	176.
+L1_0:
+	b.lv; 6.
+	b.la; -2.
+	b.st
+	b.la; -50.
+	b.sv; -56.
+	b.lv; -56.
+	b.vast; 1.
+	b.lv; -56.
+	b.vaarg
+	b.sv; -58.
+	b.lv; -58.
+	b.la; -52.
+	b.st
+	b.lc; 0.
+	b.la; -54.
+	b.st
+	b.la; -2.
+	b.ld
+	b.sv; -60.
+	b.la; -52.
+	b.ld
+	b.sv; -62.
+	b.lv; -62.
+	b.lc; 3.
+	b.mul
+	b.sv; -64.
+	b.lv; -60.
+	b.lv; -64.
+	b.add
+	b.sv; -66.
+	b.la; -2.
+	b.ld
+	b.sv; -68.
+	b.la; -52.
+	b.ld
+	b.sv; -70.
+	b.lv; -68.
+	b.lv; -70.
+	b.div
+	b.sv; -72.
+	b.lv; -66.
+	b.lv; -72.
+	b.sub
+	b.sv; -74.
+	b.la; -2.
+	b.ld
+	b.sv; -76.
+	b.la; -52.
+	b.ld
+	b.sv; -78.
+	b.lv; -76.
+	b.lv; -78.
+	b.mod
+	b.sv; -80.
+	b.lv; -74.
+	b.lv; -80.
+	b.add
+	b.sv; -82.
+	b.lv; -82.
+	b.la; -54.
+	b.st
+	b.la; -2.
+	b.ld
+	b.sv; -84.
+	b.lv; -84.
+	b.lc; 255.
+	b.and
+	b.sv; -86.
+	b.la; -52.
+	b.ld
+	b.sv; -88.
+	b.lv; -88.
+	b.lc; 2.
+	b.shl
+	b.sv; -90.
+	b.lv; -86.
+	b.lv; -90.
+	b.or
+	b.sv; -92.
+	b.lv; -92.
+	b.la; -54.
+	b.st
+	b.la; -2.
+	b.ld
+	b.sv; -94.
+	b.lv; -94.
+	b.lc; 1.
+	b.shr
+	b.sv; -96.
+	b.lv; -96.
+	b.la; -54.
+	b.st
+	b.la; -2.
+	b.ld
+	b.sv; -98.
+	b.lc; 0.
+	b.lv; -98.
+	b.sub
+	b.sv; -100.
+	b.la; -54.
+	b.ld
+	b.sv; -102.
+	b.lv; -102.
+	b.lv; -100.
+	b.add
+	b.sv; -104.
+	b.lv; -104.
+	b.la; -54.
+	b.st
+	b.la; -52.
+	b.ld
+	b.sv; -106.
+	b.lv; -106.
+	b.lc; 0.
+	b.eq
+	b.sv; -108.
+	b.lv; -108.
+	b.sv; -110.
+	b.la; -54.
+	b.ld
+	b.sv; -112.
+	b.lv; -112.
+	b.lv; -110.
+	b.mul
+	b.sv; -114.
+	b.lv; -114.
+	b.la; -54.
+	b.st
+	b.la; -54.
+	b.ld
+	b.sv; -116.
+	b.lc; 0.
+	b.lv; -116.
+	b.sub
+	b.sv; -118.
+	b.lv; -118.
+	b.la; -54.
+	b.st
+	b.la; -2.
+	b.ld
+	b.sv; -120.
+	b.la; -52.
+	b.ld
+	b.sv; -122.
+	b.lv; -120.
+	b.lv; -122.
+	b.lt
+	b.sv; -124.
+	b.lv; -124.
+	b.sv; -126.
+	b.lv; -126.
+	b.lc; 0.
+	b.ne
+	b.sv; -128.
+	b.lv; -128.
+	b.bz; L1_2
+L1_1:
+	b.la; -2.
+	b.ld
+	b.sv; -130.
+	b.la; -54.
+	b.ld
+	b.sv; -132.
+	b.lv; -130.
+	b.lv; -132.
+	b.le
+	b.sv; -134.
+	b.lv; -134.
+	b.sv; -136.
+	b.lv; -136.
+	b.sv; -176.
+	b.br; L1_3
+L1_2:
+	b.la; -2.
+	b.ld
+	b.sv; -138.
+	b.la; -52.
+	b.ld
+	b.sv; -140.
+	b.lv; -138.
+	b.lv; -140.
+	b.gt
+	b.sv; -142.
+	b.lv; -142.
+	b.sv; -144.
+	b.la; -52.
+	b.ld
+	b.sv; -146.
+	b.la; -54.
+	b.ld
+	b.sv; -148.
+	b.lv; -146.
+	b.lv; -148.
+	b.ge
+	b.sv; -150.
+	b.lv; -150.
+	b.sv; -152.
+	b.lv; -144.
+	b.lv; -152.
+	b.and
+	b.sv; -154.
+	b.la; -2.
+	b.ld
+	b.sv; -156.
+	b.la; -52.
+	b.ld
+	b.sv; -158.
+	b.lv; -156.
+	b.lv; -158.
+	b.eq
+	b.sv; -160.
+	b.lv; -160.
+	b.sv; -162.
+	b.la; -52.
+	b.ld
+	b.sv; -164.
+	b.la; -54.
+	b.ld
+	b.sv; -166.
+	b.lv; -164.
+	b.lv; -166.
+	b.ne
+	b.sv; -168.
+	b.lv; -168.
+	b.sv; -170.
+	b.lv; -162.
+	b.lv; -170.
+	b.and
+	b.sv; -172.
+	b.lv; -154.
+	b.lv; -172.
+	b.or
+	b.sv; -174.
+	b.lv; -174.
+	b.sv; -176.
+L1_3:
+	b.lv; -176.
+	b.ret
+
+/ main
+_main:
+	jsr	r3,b.entry
+	22.
+L2_0:
+	b.lc; 0.
+	b.la; -2.
+	b.st
+	b.lc; 0.
+	b.la; -2.
+	b.st
+	b.la; -2.
+	b.ld
+	b.sv; -4.
+	b.lv; -4.
+	b.lc; 1.
+	b.add
+	b.sv; -6.
+	b.lv; -6.
+	b.la; -2.
+	b.st
+	b.la; -2.
+	b.ld
+	b.sv; -8.
+	b.lv; -8.
+	b.lc; 1.
+	b.sub
+	b.sv; -10.
+	b.lv; -10.
+	b.la; -2.
+	b.st
+	b.la; -2.
+	b.ld
+	b.sv; -12.
+	b.lc; 0.
+	b.lc; 2.
+	b.sub
+	b.sv; -14.
+	b.lv; -14.
+	b.lc; -25536.
+	b.lc; _calc
+	b.call; 2.
+	b.sv; -16.
+	b.la; -2.
+	b.ld
+	b.sv; -18.
+	b.lc; 1.
+	b.lv; -18.
+	b.lc; _calc
+	b.call; 2.
+	b.sv; -20.
+	b.lv; -16.
+	b.lv; -20.
+	b.add
+	b.sv; -22.
+	b.lv; -22.
+	b.ret
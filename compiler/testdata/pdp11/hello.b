@@ -0,0 +1,6 @@
+/* Text output through the runtime */
+main() {
+    write('Hi');
+    write(' *n');
+    printf("Hello, %s!*n", "PDP-11");
+}
@@ -0,0 +1,51 @@
+.globl	_main
+.globl	_printf
+.globl	_write
+.globl	b.call
+.globl	b.entry
+.globl	b.lc
+.globl	b.lv
+.globl	b.ret
+.globl	b.sv
+.text
+
+/ main
+_main:
+	jsr	r3,b.entry
+	20.
+L1_0:
+	b.lc; _write
+	b.sv; -2.
+	b.lc; 18537.
+	b.lc; _write
+	b.call; 1.
+	b.sv; -4.
+	b.lc; _write
+	b.sv; -6.
+	b.lc; 8202.
+	b.lc; _write
+	b.call; 1.
+	b.sv; -8.
+	b.lc; Lstr0
+	b.sv; -10.
+	b.lv; -10.
+	b.sv; -12.
+	b.lc; Lstr1
+	b.sv; -14.
+	b.lv; -14.
+	b.sv; -16.
+	b.lc; _printf
+	b.sv; -18.
+	b.lv; -16.
+	b.lv; -12.
+	b.lc; _printf
+	b.call; 2.
+	b.sv; -20.
+	b.lc; 0.
+	b.ret
+.data
+Lstr0:
+	<Hello, %s!\n\0>
+Lstr1:
+	<PDP-11\0>
+.even
@@ -0,0 +1,90 @@
+package compiler
+
+import (
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// TestWasmIR tests the IR generated for WebAssembly, where every function
+// takes at least one word so that callers and callees agree on the signature
+func TestWasmIR(t *testing.T) {
+	code := `add(a, b) return (a + b);
+main() {
+    printf("%d*n", add(2, 3));
+    flush();
+    (add)();
+}`
+	irFor := func(target string) string {
+		args := NewCompileOptions("blang", []string{"wasm.b"})
+		args.Target = target
+		compiler := NewCompiler(args)
+		if err := ParseDeclarations(NewLexer(args, strings.NewReader(code)), compiler); err != nil {
+			t.Fatalf("ParseDeclarations failed: %v", err)
+		}
+		return compiler.GetModule().String()
+	}
+
+	ir := irFor("wasm32-wasi")
+	for _, want := range []string{
+		`target triple = "wasm32-unknown-wasi"`,
+		`target datalayout = "e-m:e-p:32:32`,
+		"define i64 @main(i64 %0, ...)",
+		"define i64 @b.add(i64 %a, ...)",
+		"declare i64 @b.flush(i64 %0, ...)",
+		"@b.flush(i64 0)",
+	} {
+		if !strings.Contains(ir, want) {
+			t.Errorf("IR does not contain %q:\n%s", want, ir)
+		}
+	}
+
+	if !regexp.MustCompile(`call i64 \(i64, \.\.\.\) %\d+\(i64 0\)`).MatchString(ir) {
+		t.Errorf("indirect call without arguments should pass a zero word:\n%s", ir)
+	}
+
+	host := irFor("")
+	if strings.Contains(host, "target triple") {
+		t.Errorf("host IR should not set a target triple:\n%s", host)
+	}
+	if !strings.Contains(host, "define i64 @main()") {
+		t.Errorf("host IR should keep main without parameters:\n%s", host)
+	}
+}
+
+// TestWasmExamples builds the example programs as WebAssembly modules
+// and compares their output under wasmtime with the interpreter
+func TestWasmExamples(t *testing.T) {
+	if !wasmAvailable() {
+		t.Skip("wasm32-wasi target needs clang, wasm-ld, wasmtime and runtime/wasm32-wasi/libb.a")
+	}
+	for _, name := range []string{"hello", "fizzbuzz", "showcase", "e-2"} {
+		t.Run(name, func(t *testing.T) {
+			file := filepath.Join("..", "examples", name+".b")
+			want, _, err := interpretFiles(t, []string{file}, "")
+			if err != nil {
+				t.Fatalf("Interpreter failed: %v", err)
+			}
+			wasmFile := filepath.Join(t.TempDir(), name+".wasm")
+			linkWasmForTest(t, file, wasmFile)
+			got, _ := runExecutable(t, "wasmtime", wasmFile)
+			if string(got) != want {
+				t.Errorf("output mismatch (-interpreter +wasm):\n%s", buildLineDiff(want, string(got)))
+			}
+		})
+	}
+}
+
+// TestWasmNativeBackend tests that the native backend refuses WebAssembly
+func TestWasmNativeBackend(t *testing.T) {
+	args := NewCompileOptions("blang", []string{"../examples/hello.b"})
+	args.Target = "wasm32-wasi"
+	args.Backend = BackendNative
+	args.OutputType = OutputAssembly
+	args.OutputFile = filepath.Join(t.TempDir(), "hello.s")
+	err := Compile(args)
+	if err == nil || !strings.Contains(err.Error(), "needs the LLVM backend") {
+		t.Errorf("Compile() error = %v, want LLVM backend error", err)
+	}
+}
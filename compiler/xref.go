@@ -0,0 +1,239 @@
+package compiler
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// RefKind tells how a global name occurs in the source
+type RefKind int
+
+const (
+	RefFunction     RefKind = iota // definition of a function
+	RefVector                      // definition of a global vector
+	RefGlobal                      // definition of a global scalar
+	RefExtrn                       // declaration by extrn in a function
+	RefUse                         // value read or assigned
+	RefCall                        // direct call
+	RefIndirectCall                // call through a variable: the target is unknown
+	RefAddress                     // function name used as a value
+)
+
+var refKindNames = []string{"function", "vector", "global", "extrn", "use", "call", "indirect call", "address"}
+
+// String returns the name of the kind as printed in listings
+func (k RefKind) String() string {
+	return refKindNames[k]
+}
+
+// MarshalText encodes the kind by its name
+func (k RefKind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+// isDefinition reports whether the kind defines a name at top level
+func (k RefKind) isDefinition() bool {
+	return k <= RefGlobal
+}
+
+// Reference is an occurrence of a global name in the source
+type Reference struct {
+	Name string  `json:"-"`
+	Kind RefKind `json:"kind"`
+	Pos  Pos     `json:"pos"`
+	Func string  `json:"function,omitempty"` // function where it occurs, empty at top level
+}
+
+// reference passes an occurrence of a global name to args.OnReference
+func (c *Compiler) reference(name string, kind RefKind, pos Pos) {
+	if c.args.OnReference == nil {
+		return
+	}
+	ref := Reference{Name: name, Kind: kind, Pos: pos}
+	if !kind.isDefinition() && c.currentFn != nil {
+		ref.Func = c.currentName()
+	}
+	c.args.OnReference(ref)
+}
+
+// XrefSymbol is a global name with its definition and uses
+type XrefSymbol struct {
+	Name string      `json:"name"`
+	Kind string      `json:"kind"`          // function, vector, global, or external when not defined
+	Def  *Pos        `json:"def,omitempty"` // nil for external names
+	Refs []Reference `json:"refs"`          // in source order, other than the definition
+}
+
+// Call is an edge of the call graph: the calls from one function to
+// another, or through a variable when the target is unknown
+type Call struct {
+	Caller string `json:"caller"`
+	Callee string `json:"callee,omitempty"` // empty when unknown
+	Via    string `json:"via,omitempty"`    // variable of an indirect call
+	Sites  []Pos  `json:"sites"`
+}
+
+// Xref is the cross-reference of a program: its global names, sorted,
+// and the call graph between its functions
+type Xref struct {
+	Symbols []*XrefSymbol `json:"symbols"`
+	Calls   []*Call       `json:"calls"`
+}
+
+// NewXref builds the cross-reference from the references of the
+// program, in the order they were parsed
+func NewXref(refs []Reference) *Xref {
+	x := &Xref{Symbols: []*XrefSymbol{}, Calls: []*Call{}}
+	symbols := map[string]*XrefSymbol{}
+	calls := map[[3]string]*Call{}
+	for _, ref := range refs {
+		sym := symbols[ref.Name]
+		if sym == nil {
+			sym = &XrefSymbol{Name: ref.Name, Kind: "external", Refs: []Reference{}}
+			symbols[ref.Name] = sym
+			x.Symbols = append(x.Symbols, sym)
+		}
+		if ref.Kind.isDefinition() && sym.Def == nil {
+			pos := ref.Pos
+			sym.Def = &pos
+			sym.Kind = ref.Kind.String()
+			continue
+		}
+		sym.Refs = append(sym.Refs, ref)
+
+		var key [3]string
+		switch ref.Kind {
+		case RefCall:
+			key = [3]string{ref.Func, ref.Name, ""}
+		case RefIndirectCall:
+			key = [3]string{ref.Func, "", ref.Name}
+		default:
+			continue
+		}
+		call := calls[key]
+		if call == nil {
+			call = &Call{Caller: key[0], Callee: key[1], Via: key[2]}
+			calls[key] = call
+			x.Calls = append(x.Calls, call)
+		}
+		call.Sites = append(call.Sites, ref.Pos)
+	}
+	sort.Slice(x.Symbols, func(i, j int) bool { return x.Symbols[i].Name < x.Symbols[j].Name })
+	sort.SliceStable(x.Calls, func(i, j int) bool {
+		a, b := x.Calls[i], x.Calls[j]
+		if a.Caller != b.Caller {
+			return a.Caller < b.Caller
+		}
+		if a.Callee != b.Callee {
+			return a.Callee < b.Callee
+		}
+		return a.Via < b.Via
+	})
+	return x
+}
+
+// CrossReference parses the B files and returns their cross-reference.
+// Names are matched across files, so a function defined in one file
+// and called in another is not external. Warnings are not reported.
+func CrossReference(files []string, opts ...Option) (*Xref, error) {
+	var refs []Reference
+	args := NewOptions(files, opts...)
+	args.OnReference = func(ref Reference) { refs = append(refs, ref) }
+	args.OnDiagnostic = func(Diagnostic) {}
+	for _, file := range files {
+		if _, err := ParseFile(args, file); err != nil {
+			return nil, err
+		}
+	}
+	return NewXref(refs), nil
+}
+
+// WriteText writes the listing of the symbols: the kind and definition
+// of each, then its uses grouped by function
+func (x *Xref) WriteText(w io.Writer) error {
+	var b strings.Builder
+	for _, sym := range x.Symbols {
+		if sym.Def != nil {
+			fmt.Fprintf(&b, "%s (%s, %s)\n", sym.Name, sym.Kind, sym.Def)
+		} else {
+			fmt.Fprintf(&b, "%s (%s)\n", sym.Name, sym.Kind)
+		}
+
+		// Uses in each function, in order of appearance
+		var funcs []string
+		uses := map[string][]string{}
+		for _, ref := range sym.Refs {
+			fn := ref.Func
+			if fn == "" {
+				fn = "top level"
+			}
+			if _, ok := uses[fn]; !ok {
+				funcs = append(funcs, fn)
+			}
+			list := uses[fn]
+			if n := len(list); n > 0 && strings.HasPrefix(list[n-1], ref.Kind.String()+" ") {
+				list[n-1] += " " + ref.Pos.String()
+			} else {
+				list = append(list, ref.Kind.String()+" "+ref.Pos.String())
+			}
+			uses[fn] = list
+		}
+		for _, fn := range funcs {
+			fmt.Fprintf(&b, "    %s: %s\n", fn, strings.Join(uses[fn], "; "))
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// WriteDOT writes the call graph for Graphviz. External routines are
+// dashed; an indirect call goes to a diamond named after the variable.
+func (x *Xref) WriteDOT(w io.Writer) error {
+	var b strings.Builder
+	b.WriteString("digraph calls {\n")
+	b.WriteString("    node [shape=box];\n")
+	for _, sym := range x.Symbols {
+		switch {
+		case sym.Kind == "function":
+			fmt.Fprintf(&b, "    %q;\n", sym.Name)
+		case sym.Kind == "external" && x.called(sym.Name):
+			fmt.Fprintf(&b, "    %q [style=dashed];\n", sym.Name)
+		}
+	}
+	unknown := map[string]bool{}
+	for _, call := range x.Calls {
+		if call.Callee != "" {
+			fmt.Fprintf(&b, "    %q -> %q;\n", call.Caller, call.Callee)
+			continue
+		}
+		node := "*" + call.Via
+		if !unknown[node] {
+			unknown[node] = true
+			fmt.Fprintf(&b, "    %q [shape=diamond, style=dashed, label=%q];\n", node, "? via "+call.Via)
+		}
+		fmt.Fprintf(&b, "    %q -> %q [style=dashed];\n", call.Caller, node)
+	}
+	b.WriteString("}\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// called reports whether the name is the target of a direct call
+func (x *Xref) called(name string) bool {
+	for _, call := range x.Calls {
+		if call.Callee == name {
+			return true
+		}
+	}
+	return false
+}
+
+// WriteJSON writes the symbols and the call graph as JSON
+func (x *Xref) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(x)
+}
@@ -0,0 +1,104 @@
+package compiler
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// xrefProgram has a global, calls to a local and an external function,
+// and a call through a variable
+const xrefProgram = `count 0;
+handler;
+
+add(a, b) {
+    extrn count;
+    count++;
+    return (a + b);
+}
+
+main() {
+    extrn handler, count;
+    handler = add;
+    printf("%d*n", add(1, 2));
+    handler(3, 4);
+    return (count);
+}
+`
+
+// TestCrossReference tests the listing, call graph and JSON of a program
+func TestCrossReference(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "x.b")
+	if err := os.WriteFile(file, []byte(xrefProgram), 0644); err != nil {
+		t.Fatal(err)
+	}
+	x, err := CrossReference([]string{file})
+	if err != nil {
+		t.Fatalf("CrossReference() failed: %v", err)
+	}
+
+	var text strings.Builder
+	if err := x.WriteText(&text); err != nil {
+		t.Fatal(err)
+	}
+	want := strings.ReplaceAll(`add (function, @:4)
+    main: address @:12; call @:13
+count (global, @:1)
+    add: extrn @:5; use @:6
+    main: extrn @:11; use @:15
+handler (global, @:2)
+    main: extrn @:11; use @:12; indirect call @:14
+main (function, @:10)
+printf (external)
+    main: call @:13
+`, "@", file)
+	if text.String() != want {
+		t.Errorf("listing:\n%s\nwant:\n%s", text.String(), want)
+	}
+
+	var dot strings.Builder
+	if err := x.WriteDOT(&dot); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		`"main" -> "add";`,
+		`"main" -> "printf";`,
+		`"printf" [style=dashed];`,
+		`"*handler" [shape=diamond, style=dashed, label="? via handler"];`,
+		`"main" -> "*handler" [style=dashed];`,
+	} {
+		if !strings.Contains(dot.String(), line) {
+			t.Errorf("call graph lacks %s:\n%s", line, dot.String())
+		}
+	}
+	if strings.Contains(dot.String(), `"count"`) {
+		t.Errorf("call graph has a variable:\n%s", dot.String())
+	}
+
+	var js strings.Builder
+	if err := x.WriteJSON(&js); err != nil {
+		t.Fatal(err)
+	}
+	var decoded struct {
+		Symbols []struct {
+			Name string
+			Kind string
+			Def  *struct{ Line int }
+		}
+		Calls []struct {
+			Caller, Callee, Via string
+			Sites               []struct{ Line int }
+		}
+	}
+	if err := json.Unmarshal([]byte(js.String()), &decoded); err != nil {
+		t.Fatalf("JSON: %v\n%s", err, js.String())
+	}
+	if len(decoded.Symbols) != 5 || decoded.Symbols[4].Kind != "external" || decoded.Symbols[4].Def != nil {
+		t.Errorf("symbols = %+v", decoded.Symbols)
+	}
+	if len(decoded.Calls) != 3 || decoded.Calls[0].Via != "handler" || decoded.Calls[0].Sites[0].Line != 14 {
+		t.Errorf("calls = %+v", decoded.Calls)
+	}
+}
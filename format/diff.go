@@ -0,0 +1,102 @@
+package format
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/atombender/go-diff"
+)
+
+// diffContext is the number of unchanged lines shown around a change
+const diffContext = 3
+
+// Diff returns the differences between two versions of a file in the
+// unified format, or nil when they are equal
+func Diff(name string, old, new []byte) []byte {
+	if bytes.Equal(old, new) {
+		return nil
+	}
+	hunks := group(diff.Diff(lines(old), lines(new)))
+
+	// Lines of each version before every hunk
+	oldAt := make([]int, len(hunks)+1)
+	newAt := make([]int, len(hunks)+1)
+	for i, h := range hunks {
+		oldAt[i+1], newAt[i+1] = oldAt[i], newAt[i]
+		if h.Operation != diff.OpInsert {
+			oldAt[i+1]++
+		}
+		if h.Operation != diff.OpDelete {
+			newAt[i+1]++
+		}
+	}
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", name, name)
+	for i := 0; i < len(hunks); {
+		if hunks[i].Operation == diff.OpUnchanged {
+			i++
+			continue
+		}
+
+		// Join changes which are close enough to share their context
+		end := i
+		for j := i; j < len(hunks) && j-end <= 2*diffContext; j++ {
+			if hunks[j].Operation != diff.OpUnchanged {
+				end = j
+			}
+		}
+		start := max(i-diffContext, 0)
+		stop := min(end+diffContext+1, len(hunks))
+
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n",
+			span(oldAt[start], oldAt[stop]-oldAt[start]),
+			span(newAt[start], newAt[stop]-newAt[start]))
+		for _, h := range hunks[start:stop] {
+			switch h.Operation {
+			case diff.OpUnchanged:
+				out.WriteString(" " + h.Line + "\n")
+			case diff.OpDelete:
+				out.WriteString("-" + h.Line + "\n")
+			case diff.OpInsert:
+				out.WriteString("+" + h.Line + "\n")
+			}
+		}
+		i = stop
+	}
+	return out.Bytes()
+}
+
+// group puts the deleted lines of each change before the inserted ones
+func group(hunks []diff.Hunk) []diff.Hunk {
+	for i := 0; i < len(hunks); {
+		j := i
+		for j < len(hunks) && hunks[j].Operation != diff.OpUnchanged {
+			j++
+		}
+		sort.SliceStable(hunks[i:j], func(a, b int) bool {
+			return hunks[i+a].Operation == diff.OpDelete && hunks[i+b].Operation == diff.OpInsert
+		})
+		i = j + 1
+	}
+	return hunks
+}
+
+// lines splits a text into lines without their newlines
+func lines(text []byte) []string {
+	s := strings.TrimSuffix(string(text), "\n")
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
+
+// span returns the range of a hunk header: the first line and the count
+func span(before, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", before)
+	}
+	return fmt.Sprintf("%d,%d", before+1, count)
+}
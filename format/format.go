@@ -0,0 +1,633 @@
+// Package format lays out B programs in a canonical style, keeping
+// their comments: four spaces of indentation, braces on the line of
+// the statement they belong to, one statement per line, spaces around
+// binary operators and after commas and keywords. Labels and case
+// prefixes are outdented by one level. Line breaks inside expressions
+// and initializer lists are kept, as are single empty lines between
+// declarations and statements.
+//
+// Only the layout changes: the tokens are written back as they are,
+// so the formatted program compiles to the same code, and formatting
+// it again changes nothing.
+package format
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// Error is a syntax error which prevents formatting
+type Error struct {
+	Line int
+	Msg  string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Msg)
+}
+
+// indentUnit is the indentation of one level
+const indentUnit = "    "
+
+// binaryOps are the operators between two operands, including the
+// assignments
+var binaryOps = map[string]bool{
+	"|": true, "&": true, "==": true, "!=": true,
+	"<": true, "<=": true, ">": true, ">=": true, "<<": true, ">>": true,
+	"+": true, "-": true, "*": true, "/": true, "%": true,
+	"=": true, "=|": true, "=&": true, "===": true, "=!=": true,
+	"=<": true, "=<=": true, "=>": true, "=>=": true, "=<<": true, "=>>": true,
+	"=+": true, "=-": true, "=*": true, "=/": true, "=%": true,
+}
+
+// unaryOps are the prefix operators
+var unaryOps = map[string]bool{
+	"-": true, "!": true, "*": true, "&": true, "++": true, "--": true,
+}
+
+// Source returns the source of a B program in the canonical layout.
+// The program must be syntactically correct.
+func Source(src []byte) ([]byte, error) {
+	toks, err := scan(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &printer{toks: toks}
+	if err := p.program(); err != nil {
+		return nil, err
+	}
+	return p.out.Bytes(), nil
+}
+
+// printer parses the tokens and writes them out as it goes
+type printer struct {
+	toks []token
+	pos  int
+
+	out    bytes.Buffer
+	col    int    // bytes written on the current output line
+	indent int    // indentation level of the current line
+	space  bool   // a space is due before the next token
+	wrap   bool   // inside an expression or list: keep its line breaks
+	prev   *token // the token written last
+}
+
+// cur returns the current token
+func (p *printer) cur() *token {
+	return &p.toks[p.pos]
+}
+
+// peek returns the token after the current one
+func (p *printer) peek() *token {
+	if p.pos+1 < len(p.toks) {
+		return &p.toks[p.pos+1]
+	}
+	return &p.toks[len(p.toks)-1]
+}
+
+// errorf returns an error at the current token
+func (p *printer) errorf(format string, a ...interface{}) error {
+	return errorf(p.cur().line, format, a...)
+}
+
+// expect writes the current token if it is the operator given
+func (p *printer) expect(text, msg string) error {
+	if !p.cur().is(text) {
+		return p.errorf("%s", msg)
+	}
+	p.emit()
+	return nil
+}
+
+//
+// Output
+//
+
+// write puts text on the current line, indented when the line is new
+func (p *printer) write(text string) {
+	if p.col == 0 {
+		level := p.indent
+		if level < 0 {
+			level = 0
+		}
+		p.out.WriteString(strings.Repeat(indentUnit, level))
+		p.space = false
+	}
+	if p.space {
+		p.out.WriteByte(' ')
+		p.space = false
+	}
+	p.out.WriteString(text)
+	p.col += len(text)
+}
+
+// newline ends the current line, if anything is on it
+func (p *printer) newline() {
+	if p.col > 0 {
+		p.out.WriteByte('\n')
+		p.col = 0
+	}
+	p.space = false
+}
+
+// blankLine ends the current line and leaves an empty one, except at
+// the start of the file or of a block
+func (p *printer) blankLine() {
+	p.newline()
+	b := p.out.Bytes()
+	if len(b) == 0 || bytes.HasSuffix(b, []byte("\n\n")) || bytes.HasSuffix(b, []byte("{\n")) {
+		return
+	}
+	p.out.WriteByte('\n')
+}
+
+// comments writes the comments before a token, each starting a line
+// unless it follows another on the same line, and breaks the line
+// after them when the token is on a later one
+func (p *printer) comments(t *token) {
+	for i, c := range t.lead {
+		if i > 0 && c.line == t.lead[i-1].endLine {
+			p.space = true
+		} else {
+			if c.blank {
+				p.blankLine()
+			}
+			p.newline()
+		}
+		p.write(c.text)
+	}
+	if n := len(t.lead); n > 0 {
+		if t.lead[n-1].endLine < t.line {
+			if t.blank && !t.is("}") {
+				p.blankLine()
+			}
+			p.newline()
+		} else {
+			p.space = true
+		}
+	}
+	t.lead = nil
+}
+
+// emit writes the current token with its comments and advances.
+// Inside an expression a line break of the source is kept, and the
+// next line is indented by one more level.
+func (p *printer) emit() {
+	t := p.cur()
+	p.comments(t)
+	if p.wrap && p.col > 0 && p.prev != nil && t.line > p.prev.lastLine() {
+		p.newline()
+		p.indent++
+		p.write(t.text)
+		p.indent--
+	} else {
+		if !p.space && p.col > 0 && p.prev != nil && !separate(p.prev.text, t.text) {
+			p.space = true
+		}
+		p.write(t.text)
+	}
+	for _, c := range t.trail {
+		p.space = true
+		p.write(c.text)
+	}
+	if len(t.trail) > 0 {
+		p.space = true
+	}
+	p.prev = t
+	p.pos++
+}
+
+// separate reports whether the two tokens stay apart when written
+// without a space between them
+func separate(a, b string) bool {
+	isWord := func(s string) bool { return isWordChar(s[0]) }
+	if isWord(a) && isWord(b) {
+		return false
+	}
+	toks, err := scan([]byte(a + b))
+	return err == nil && len(toks) == 3 && toks[0].text == a
+}
+
+//
+// Declarations
+//
+
+// program writes the top-level declarations
+func (p *printer) program() error {
+	for first := true; p.cur().kind != tokEOF; first = false {
+		t := p.cur()
+		p.newline()
+		if !first && (t.blank || (len(t.lead) > 0 && t.lead[0].blank)) {
+			p.blankLine()
+		}
+		if t.kind != tokWord || !isWordChar(t.text[0]) {
+			return p.errorf("expect identifier at top level")
+		}
+		p.emit()
+		var err error
+		switch next := p.cur(); {
+		case next.is("(") && next.adjacent:
+			err = p.function()
+		case next.is("[") && next.adjacent:
+			err = p.vector()
+		default:
+			err = p.global()
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	// Comments at the end of the file
+	p.comments(p.cur())
+	p.newline()
+	return nil
+}
+
+// global writes the initializers of a global after its name
+func (p *printer) global() error {
+	if p.cur().is(";") && p.cur().adjacent {
+		p.emit()
+		return nil
+	}
+	p.space = true
+	return p.initializers()
+}
+
+// vector writes a global vector after its name
+func (p *printer) vector() error {
+	p.emit() // [
+	if p.cur().kind == tokNumber {
+		p.emit()
+	}
+	if err := p.expect("]", "expect ']' after vector size"); err != nil {
+		return err
+	}
+	if p.cur().is(";") {
+		p.emit()
+		return nil
+	}
+	p.space = true
+	return p.initializers()
+}
+
+// initializers writes a list of constants ending with ';'
+func (p *printer) initializers() error {
+	p.wrap = true
+	defer func() { p.wrap = false }()
+	for {
+		t := p.cur()
+		switch {
+		case t.is("-") && p.peek().kind == tokNumber:
+			p.emit()
+			p.emit()
+		case t.kind == tokNumber || t.kind == tokChar || t.kind == tokString || t.kind == tokWord:
+			p.emit()
+		default:
+			return p.errorf("expect constant in initializer list")
+		}
+		switch {
+		case p.cur().is(";"):
+			p.emit()
+			return nil
+		case p.cur().is(","):
+			p.emit()
+			p.space = true
+		default:
+			return p.errorf("expect ';' at end of declaration")
+		}
+	}
+}
+
+// function writes a function definition after its name
+func (p *printer) function() error {
+	p.emit() // (
+	p.wrap = true
+	if !p.cur().is(")") {
+		if err := p.names("expect ')' or identifier after function arguments"); err != nil {
+			return err
+		}
+	}
+	if err := p.expect(")", "expect ')' after function arguments"); err != nil {
+		return err
+	}
+	p.wrap = false
+	return p.body()
+}
+
+// names writes a list of names separated by commas
+func (p *printer) names(msg string) error {
+	for {
+		if p.cur().kind != tokWord {
+			return p.errorf("%s", msg)
+		}
+		p.emit()
+		if !p.cur().is(",") {
+			return nil
+		}
+		p.emit()
+		p.space = true
+	}
+}
+
+//
+// Statements
+//
+
+// body writes the statement controlled by a function header, if,
+// else or while: a block on the same line, or any other statement
+// on the next line, indented
+func (p *printer) body() error {
+	if p.cur().is("{") {
+		p.space = true
+		return p.block()
+	}
+	p.indent++
+	err := p.statement()
+	p.indent--
+	return err
+}
+
+// block writes a compound statement
+func (p *printer) block() error {
+	p.emit() // {
+	p.indent++
+	for !p.cur().is("}") {
+		if p.cur().kind == tokEOF {
+			return p.errorf("unexpected end of file, expect '}'")
+		}
+		if err := p.statement(); err != nil {
+			return err
+		}
+	}
+	// Comments before the closing brace belong to the block
+	p.comments(p.cur())
+	p.indent--
+	p.newline()
+	p.emit() // }
+	return nil
+}
+
+// statement writes a statement on a line of its own
+func (p *printer) statement() error {
+	t := p.cur()
+	p.newline()
+	if t.blank || (len(t.lead) > 0 && t.lead[0].blank) {
+		p.blankLine()
+	}
+	switch {
+	case t.kind == tokEOF:
+		return p.errorf("unexpected end of file, expect statement")
+	case t.is("{"):
+		return p.block()
+	case t.is(";"):
+		p.emit()
+		return nil
+	case t.kind == tokWord && !isKeyword(t.text) && p.peek().is(":"):
+		// Label
+		p.comments(t)
+		p.indent--
+		p.emit()
+		p.emit() // :
+		p.indent++
+		return p.statement()
+	case t.is("case"):
+		p.comments(t)
+		p.indent--
+		p.emit()
+		p.space = true
+		if k := p.cur(); k.kind != tokNumber && k.kind != tokChar {
+			return p.errorf("expect constant after 'case'")
+		}
+		p.emit()
+		if err := p.expect(":", "expect ':' after 'case'"); err != nil {
+			return err
+		}
+		p.indent++
+		return p.statement()
+	case t.is("if"):
+		return p.ifStatement()
+	case t.is("while"):
+		p.emit()
+		if err := p.condition("while"); err != nil {
+			return err
+		}
+		return p.body()
+	case t.is("switch"):
+		p.emit()
+		p.space = true
+		if err := p.expression(); err != nil {
+			return err
+		}
+		return p.body()
+	case t.is("return"):
+		p.emit()
+		if !p.cur().is(";") {
+			p.space = true
+			if err := p.condition("return"); err != nil {
+				return err
+			}
+		}
+		return p.end("expect ';' after 'return' statement")
+	case t.is("auto"):
+		return p.auto()
+	case t.is("extrn"):
+		p.emit()
+		p.space = true
+		p.wrap = true
+		if err := p.names("expect identifier after 'extrn'"); err != nil {
+			return err
+		}
+		return p.end("unexpected character, expect ';' or ','")
+	case t.is("goto"):
+		p.emit()
+		p.space = true
+		if p.cur().kind != tokWord {
+			return p.errorf("expect label name after 'goto'")
+		}
+		p.emit()
+		return p.end("expect ';' after 'goto' statement")
+	}
+	if err := p.expression(); err != nil {
+		return err
+	}
+	return p.end("expect ';' after expression statement")
+}
+
+// end writes the ';' which ends a statement
+func (p *printer) end(msg string) error {
+	p.wrap = false
+	return p.expect(";", msg)
+}
+
+// condition writes a parenthesized expression after a keyword
+func (p *printer) condition(keyword string) error {
+	p.space = true
+	if err := p.expect("(", fmt.Sprintf("expect '(' after '%s'", keyword)); err != nil {
+		return err
+	}
+	if err := p.expression(); err != nil {
+		return err
+	}
+	p.wrap = true
+	if err := p.expect(")", fmt.Sprintf("expect ')' after '%s'", keyword)); err != nil {
+		return err
+	}
+	p.wrap = false
+	return nil
+}
+
+// ifStatement writes an if statement with its else part, keeping
+// "else if" chains on one level
+func (p *printer) ifStatement() error {
+	p.emit()
+	if err := p.condition("if"); err != nil {
+		return err
+	}
+	if err := p.body(); err != nil {
+		return err
+	}
+	if !p.cur().is("else") {
+		return nil
+	}
+	if p.prev.is("}") {
+		p.space = true
+	} else {
+		p.newline()
+	}
+	p.emit()
+	if p.cur().is("if") && len(p.cur().lead) == 0 {
+		p.space = true
+		return p.ifStatement()
+	}
+	return p.body()
+}
+
+// auto writes the declaration of automatic variables and vectors
+func (p *printer) auto() error {
+	p.emit()
+	p.space = true
+	p.wrap = true
+	for {
+		if p.cur().kind != tokWord {
+			return p.errorf("expect identifier after 'auto'")
+		}
+		p.emit()
+		if p.cur().is("[") {
+			p.emit()
+			if k := p.cur(); k.kind == tokNumber || k.kind == tokChar {
+				p.emit()
+			}
+			if err := p.expect("]", "expect ']' after array size"); err != nil {
+				return err
+			}
+		}
+		if !p.cur().is(",") {
+			return p.end("unexpected character, expect ';' or ','")
+		}
+		p.emit()
+		p.space = true
+	}
+}
+
+// isKeyword reports whether the name starts a statement
+func isKeyword(name string) bool {
+	switch name {
+	case "auto", "case", "extrn", "goto", "if", "return", "switch", "while":
+		return true
+	}
+	return false
+}
+
+//
+// Expressions
+//
+
+// expression writes an expression: operands separated by binary
+// operators, with spaces around them
+func (p *printer) expression() error {
+	wrap := p.wrap
+	p.wrap = true
+	defer func() { p.wrap = wrap }()
+
+	conditionals := 0 // '?' waiting for their ':'
+	for {
+		if err := p.unary(); err != nil {
+			return err
+		}
+		t := p.cur()
+		switch {
+		case t.kind == tokOp && binaryOps[t.text], t.is("?"):
+			if t.is("?") {
+				conditionals++
+			}
+		case t.is(":") && conditionals > 0:
+			conditionals--
+		default:
+			if conditionals > 0 {
+				return p.errorf("expect ':' in conditional expression")
+			}
+			return nil
+		}
+		p.space = true
+		p.emit()
+		p.space = true
+	}
+}
+
+// unary writes an operand with its prefix and postfix operators
+func (p *printer) unary() error {
+	for p.cur().kind == tokOp && unaryOps[p.cur().text] {
+		p.emit()
+	}
+	t := p.cur()
+	switch {
+	case t.kind == tokWord || t.kind == tokNumber || t.kind == tokChar || t.kind == tokString:
+		p.emit()
+	case t.is("("):
+		p.emit()
+		if err := p.expression(); err != nil {
+			return err
+		}
+		if err := p.expect(")", "expect ')'"); err != nil {
+			return err
+		}
+	case t.kind == tokEOF:
+		return p.errorf("unexpected end of file, expect expression")
+	default:
+		return p.errorf("unexpected '%s', expect expression", t.text)
+	}
+
+	for {
+		switch t := p.cur(); {
+		case t.is("["):
+			p.emit()
+			if err := p.expression(); err != nil {
+				return err
+			}
+			if err := p.expect("]", "expect ']' after index"); err != nil {
+				return err
+			}
+		case t.is("("):
+			p.emit()
+			for !p.cur().is(")") {
+				if err := p.expression(); err != nil {
+					return err
+				}
+				if !p.cur().is(",") {
+					break
+				}
+				p.emit()
+				p.space = true
+			}
+			if err := p.expect(")", "expect ')' after function arguments"); err != nil {
+				return err
+			}
+		case t.is("++"), t.is("--"):
+			p.emit()
+		default:
+			return nil
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package format
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"sergev.org/blang/compiler"
+)
+
+// compileIR returns the LLVM IR of a program
+func compileIR(t *testing.T, name string, src []byte) string {
+	t.Helper()
+	module, _, err := compiler.ParseReader(name, bytes.NewReader(src))
+	if err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+	return module.String()
+}
+
+// TestFormatPrograms formats the example programs and checks that the
+// result compiles to the same IR, and is left alone by formatting again
+func TestFormatPrograms(t *testing.T) {
+	files, _ := filepath.Glob("../examples/*.b")
+	more, _ := filepath.Glob("../compiler/testdata/pdp11/*.b")
+	files = append(files, more...)
+	if len(files) == 0 {
+		t.Fatal("No programs found")
+	}
+	for _, file := range files {
+		t.Run(filepath.Base(file), func(t *testing.T) {
+			src, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			once, err := Source(src)
+			if err != nil {
+				t.Fatalf("Format: %v", err)
+			}
+			twice, err := Source(once)
+			if err != nil {
+				t.Fatalf("Format of formatted: %v", err)
+			}
+			if !bytes.Equal(once, twice) {
+				t.Errorf("Formatting is not idempotent:\n%s", Diff(file, once, twice))
+			}
+			if compileIR(t, file, src) != compileIR(t, file, once) {
+				t.Errorf("Formatting changed the IR:\n%s", Diff(file, src, once))
+			}
+			if bytes.Count(src, []byte("/*")) != bytes.Count(once, []byte("/*")) {
+				t.Errorf("Comments were lost")
+			}
+		})
+	}
+}
+
+// TestFormatLayout tests the canonical layout of constructs
+func TestFormatLayout(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{"globals",
+			"x;y  1;v[3]1,-2 ,'a';s[] \"hi\";",
+			"x;\ny 1;\nv[3] 1, -2, 'a';\ns[] \"hi\";\n"},
+		{"function",
+			"f(a,b){auto x,buf[10];extrn g;x=a+b*2;return(x);}",
+			"f(a, b) {\n    auto x, buf[10];\n    extrn g;\n    x = a + b * 2;\n    return (x);\n}\n"},
+		{"single statement body",
+			"sq(n) return(n*n);",
+			"sq(n)\n    return (n * n);\n"},
+		{"if else chain",
+			"f(){if(a){x;}else if(b)y;else{z;}}",
+			"f() {\n    if (a) {\n        x;\n    } else if (b)\n        y;\n    else {\n        z;\n    }\n}\n"},
+		{"switch and labels",
+			"f(){switch(c){case 'a':case 1:x;}loop:goto loop;}",
+			"f() {\n    switch (c) {\n    case 'a':\n    case 1:\n        x;\n    }\nloop:\n    goto loop;\n}\n"},
+		{"compound assignments stay",
+			"f(){x= -1;x=-1;x= *p;y=!z;i=+1;}",
+			"f() {\n    x = -1;\n    x =- 1;\n    x = *p;\n    y = !z;\n    i =+ 1;\n}\n"},
+		{"unary operators kept apart",
+			"f(){x= - -y;z=a/ *p;w=a++ +b;}",
+			"f() {\n    x = - -y;\n    z = a / *p;\n    w = a++ + b;\n}\n"},
+		{"calls and vectors",
+			"f(){printf(\"%d*n\",v[i],g());c=a?b:d;}",
+			"f() {\n    printf(\"%d*n\", v[i], g());\n    c = a ? b : d;\n}\n"},
+		{"comments",
+			"/* head */\n\n\nf() { /* open */\n  x; /* after */\n\n  /* before */\n  y;\n  /* last */\n}\n/* tail */\n",
+			"/* head */\n\nf() { /* open */\n    x; /* after */\n\n    /* before */\n    y;\n    /* last */\n}\n/* tail */\n"},
+		{"line breaks in lists",
+			"t[] 1,2,\n 3,4;\nf(){x=g(a,\nb);}",
+			"t[] 1, 2,\n    3, 4;\nf() {\n    x = g(a,\n        b);\n}\n"},
+		{"empty", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Source([]byte(tt.src))
+			if err != nil {
+				t.Fatalf("Format: %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, tt.want)
+			}
+			again, err := Source(got)
+			if err != nil || !bytes.Equal(again, got) {
+				t.Errorf("not idempotent:\n%s", again)
+			}
+		})
+	}
+}
+
+// TestFormatErrors tests that malformed programs are refused
+func TestFormatErrors(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{"main() {\n  x = 1\n}\n", "line 3: expect ';' after expression statement"},
+		{"main() {\n  return x;\n}\n", "line 2: expect '(' after 'return'"},
+		{"main() {\n  x = (1;\n}\n", "line 2: expect ')'"},
+		{"/* open\n", "line 1: unclosed comment, expect '*/' to close the comment"},
+		{"main() { x = \"abc; }\n", "line 1: unterminated string literal"},
+		{"main() {\n  x = 1;\n", "line 3: unexpected end of file, expect '}'"},
+		{"1;", "line 1: expect identifier at top level"},
+		{"main() { x = y # 2; }", "line 1: unexpected character '#'"},
+	}
+	for _, tt := range tests {
+		_, err := Source([]byte(tt.src))
+		if err == nil || err.Error() != tt.want {
+			t.Errorf("%q: error %v, want %q", tt.src, err, tt.want)
+		}
+	}
+}
+
+// TestDiff tests the unified diff of two versions
+func TestDiff(t *testing.T) {
+	old := "a\nb\nc\nd\ne\nf\ng\nh\ni\nj\n"
+	new := "a\nB\nc\nd\ne\nf\ng\nh\ni\nj\nk\n"
+	want := strings.Join([]string{
+		"--- x.b",
+		"+++ x.b",
+		"@@ -1,5 +1,5 @@",
+		" a",
+		"-b",
+		"+B",
+		" c",
+		" d",
+		" e",
+		"@@ -8,3 +8,4 @@",
+		" h",
+		" i",
+		" j",
+		"+k",
+		"",
+	}, "\n")
+	if got := string(Diff("x.b", []byte(old), []byte(new))); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+	if got := Diff("x.b", []byte(old), []byte(old)); got != nil {
+		t.Errorf("diff of equal texts: %q", got)
+	}
+}
@@ -0,0 +1,249 @@
+package format
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokEOF  tokenKind = iota
+	tokWord           // identifier or keyword
+	tokNumber
+	tokChar
+	tokString
+	tokOp // operator or punctuation
+)
+
+// comment is a /* ... */ comment with the lines it spans
+type comment struct {
+	text    string
+	line    int
+	endLine int
+	blank   bool // preceded by an empty line
+}
+
+// token is a lexical element with the comments around it. Comments on
+// the line where a token ends follow it; the others precede the next one.
+type token struct {
+	kind     tokenKind
+	text     string // as written in the source
+	line     int
+	endLine  int
+	blank    bool // preceded by an empty line
+	adjacent bool // no space or comment before it
+	lead     []comment
+	trail    []comment
+}
+
+// is reports whether the token is the operator or word given
+func (t *token) is(text string) bool {
+	return (t.kind == tokOp || t.kind == tokWord) && t.text == text
+}
+
+// lastLine returns the line where the token and the comments after it end
+func (t *token) lastLine() int {
+	if n := len(t.trail); n > 0 {
+		return t.trail[n-1].endLine
+	}
+	return t.endLine
+}
+
+// scanner splits B source into tokens. Characters are bytes, and
+// operators are recognized as the compiler does: "x =- 1" is the
+// assignment =-, while "x = -1" assigns a negative value.
+type scanner struct {
+	src  []byte
+	pos  int
+	line int
+}
+
+// errorf returns an error at a line of the source
+func errorf(line int, format string, a ...interface{}) error {
+	return &Error{Line: line, Msg: fmt.Sprintf(format, a...)}
+}
+
+// scan returns the tokens of the source, ending with tokEOF
+func scan(src []byte) ([]token, error) {
+	s := &scanner{src: src, line: 1}
+	var toks []token
+	var pending []comment
+	lastLine := 0     // line where the last token or comment ended
+	separated := true // space or comment since the last token
+	for {
+		start := s.pos
+		s.skipSpace()
+		if s.pos > start {
+			separated = true
+		}
+		if s.peek(0) == '/' && s.peek(1) == '*' {
+			c, err := s.comment()
+			if err != nil {
+				return nil, err
+			}
+			c.blank = lastLine > 0 && c.line > lastLine+1
+			if len(toks) > 0 && len(pending) == 0 && c.line == lastLine {
+				prev := &toks[len(toks)-1]
+				prev.trail = append(prev.trail, c)
+			} else {
+				pending = append(pending, c)
+			}
+			lastLine = c.endLine
+			separated = true
+			continue
+		}
+		t := token{line: s.line, lead: pending, adjacent: !separated}
+		t.blank = lastLine > 0 && t.line > lastLine+1
+		pending = nil
+		if s.pos >= len(s.src) {
+			t.kind = tokEOF
+			t.endLine = s.line
+			return append(toks, t), nil
+		}
+		if err := s.token(&t); err != nil {
+			return nil, err
+		}
+		t.endLine = s.line
+		lastLine = t.endLine
+		separated = false
+		toks = append(toks, t)
+	}
+}
+
+// peek returns the byte at an offset from the current one, or 0 at the end
+func (s *scanner) peek(offset int) byte {
+	if s.pos+offset < len(s.src) {
+		return s.src[s.pos+offset]
+	}
+	return 0
+}
+
+// advance moves over n bytes, counting lines
+func (s *scanner) advance(n int) {
+	for ; n > 0 && s.pos < len(s.src); n-- {
+		if s.src[s.pos] == '\n' {
+			s.line++
+		}
+		s.pos++
+	}
+}
+
+func (s *scanner) skipSpace() {
+	for s.pos < len(s.src) && unicode.IsSpace(rune(s.src[s.pos])) {
+		s.advance(1)
+	}
+}
+
+// comment scans a comment, which starts at the current position
+func (s *scanner) comment() (comment, error) {
+	c := comment{line: s.line}
+	start := s.pos
+	end := strings.Index(string(s.src[s.pos+2:]), "*/")
+	if end < 0 {
+		return c, errorf(c.line, "unclosed comment, expect '*/' to close the comment")
+	}
+	s.advance(end + 4)
+	c.text = string(s.src[start:s.pos])
+	c.endLine = s.line
+	return c, nil
+}
+
+// isWordChar reports whether the byte may be part of a name or number
+func isWordChar(b byte) bool {
+	return unicode.IsLetter(rune(b)) || unicode.IsDigit(rune(b)) || b == '_'
+}
+
+// token scans the token at the current position
+func (s *scanner) token(t *token) error {
+	start := s.pos
+	b := s.peek(0)
+	switch {
+	case isWordChar(b):
+		t.kind = tokWord
+		if unicode.IsDigit(rune(b)) {
+			t.kind = tokNumber
+		}
+		for s.pos < len(s.src) && isWordChar(s.src[s.pos]) {
+			s.advance(1)
+		}
+	case b == '\'' || b == '"':
+		t.kind = tokChar
+		if b == '"' {
+			t.kind = tokString
+		}
+		s.advance(1)
+		for {
+			if s.pos >= len(s.src) {
+				if b == '"' {
+					return errorf(t.line, "unterminated string literal")
+				}
+				return errorf(t.line, "unclosed char literal")
+			}
+			c := s.src[s.pos]
+			s.advance(1)
+			if c == b {
+				break
+			}
+			if c == '*' {
+				s.advance(1)
+			}
+		}
+	default:
+		t.kind = tokOp
+		n := s.operator()
+		if n == 0 {
+			return errorf(t.line, "unexpected character '%c'", b)
+		}
+		s.advance(n)
+	}
+	t.text = string(s.src[start:s.pos])
+	return nil
+}
+
+// operator returns the length of the operator at the current position,
+// or 0 if there is none
+func (s *scanner) operator() int {
+	b, next := s.peek(0), s.peek(1)
+	switch b {
+	case '(', ')', '[', ']', '{', '}', ',', ';', ':', '?', '*', '/', '%', '&', '|':
+		return 1
+	case '+', '-':
+		if next == b {
+			return 2 // ++ or --
+		}
+		return 1
+	case '<', '>':
+		if next == b || next == '=' {
+			return 2 // shift or comparison
+		}
+		return 1
+	case '!':
+		if next == '=' {
+			return 2
+		}
+		return 1
+	case '=':
+		switch next {
+		case '=':
+			if s.peek(2) == '=' {
+				return 3 // ===
+			}
+			return 2
+		case '+', '-', '*', '/', '%', '&', '|':
+			return 2
+		case '<', '>':
+			if s.peek(2) == next || s.peek(2) == '=' {
+				return 3 // =<< =>> =<= =>=
+			}
+			return 2
+		case '!':
+			if s.peek(2) == '=' {
+				return 3 // =!=
+			}
+		}
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,63 @@
+package lsp
+
+// builtin is a routine or a variable of the runtime library
+type builtin struct {
+	name   string
+	params []string // parameters of a routine, nil for a variable
+	doc    string   // one-line description
+}
+
+// Routines and variables of the runtime library, as declared in
+// runtime/runtime.h and described in runtime/README.md
+var builtins = []builtin{
+	{"argv", nil, "Command line arguments: argv[0] is the count, followed by the strings"},
+	{"atexit", []string{"f"}, "Register function f to be called at termination"},
+	{"atoi", []string{"s"}, "Convert leading decimal number, with optional sign"},
+	{"char", []string{"s", "i"}, "Get i-th character from string"},
+	{"compare", []string{"s1", "s2"}, "Compare strings; negative, zero or positive"},
+	{"concat", []string{"a", "s1", "s2"}, "Store s1 followed by s2 in string a; returns a"},
+	{"exit", []string{"n"}, "Run termination handlers and terminate process with status n"},
+	{"flush", []string{}, "No-op (all I/O is unbuffered)"},
+	{"fout", nil, "Output stream: 0 for stdout, 1 for stderr"},
+	{"getarg", []string{"s", "line", "i"}, "Copy i-th blank-separated argument of line to s; returns s, or 0 if none"},
+	{"getenv", []string{"name"}, "Value of environment variable as a string, or 0 if not defined"},
+	{"getstr", []string{"s"}, "Read a line from stdin into s, without newline; returns s, or 0 at end of file"},
+	{"getvec", []string{"n"}, "Allocate a zeroed vector of n+1 words; returns 0 when out of memory"},
+	{"itoa", []string{"n", "s", "base"}, "Convert number to digits in base 2..16; returns s"},
+	{"lchar", []string{"s", "i", "c"}, "Set i-th character in string"},
+	{"length", []string{"s"}, "Number of characters in string"},
+	{"nread", []string{"fd", "buf", "n"}, "Read n bytes from file descriptor"},
+	{"nwrite", []string{"fd", "buf", "n"}, "Write n bytes to file descriptor"},
+	{"printd", []string{"n"}, "Print decimal number, possibly negative"},
+	{"printf", []string{"fmt", "..."}, "Formatted output (%d, %u, %o, %x, %b, %c, %s, %%)"},
+	{"printo", []string{"n"}, "Print octal number, unsigned"},
+	{"putstr", []string{"s"}, "Write string to output; returns s"},
+	{"read", []string{}, "Read character from stdin"},
+	{"rlsevec", []string{"v", "n"}, "Release a vector obtained from getvec() for reuse"},
+	{"sbrk", []string{"n"}, "Extend the data segment by n bytes; returns the old break or -1"},
+	{"write", []string{"c"}, "Write multi-character constant"},
+	{"writeb", []string{"c"}, "Write single byte"},
+}
+
+// findBuiltin returns the runtime routine or variable with the name
+func findBuiltin(name string) *builtin {
+	for i := range builtins {
+		if builtins[i].name == name {
+			return &builtins[i]
+		}
+	}
+	return nil
+}
+
+// Keywords of B, offered by completion
+var keywords = []string{"auto", "case", "else", "extrn", "goto", "if", "return", "switch", "while"}
+
+// isKeyword reports whether the name is a keyword of B
+func isKeyword(name string) bool {
+	for _, k := range keywords {
+		if k == name {
+			return true
+		}
+	}
+	return false
+}
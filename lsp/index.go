@@ -0,0 +1,474 @@
+package lsp
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf16"
+)
+
+//
+// Index of the names of a B document. The compiler generates code in one
+// pass and keeps no positions, so the server scans the text itself: it
+// finds the declarations and resolves every use of a name to a local,
+// a label or a global, which may be defined in another document.
+//
+
+// symbolKind tells what a name was declared as
+type symbolKind int
+
+const (
+	kindFunction symbolKind = iota // function definition
+	kindVector                     // global vector
+	kindGlobal                     // global scalar
+	kindParam                      // parameter of a function
+	kindAuto                       // automatic variable or vector
+	kindExtrn                      // external declaration in a function
+	kindLabel                      // label in a function
+)
+
+// symbol is a name declared in a document
+type symbol struct {
+	name     string
+	kind     symbolKind
+	nameRng  Range     // the name where it is declared
+	fullRng  Range     // the whole declaration
+	params   []string  // parameters of a function
+	size     string    // size of a vector as written
+	isVector bool      // auto declared with brackets
+	fn       *symbol   // function of a local or a label
+	locals   []*symbol // parameters, autos, externals and labels of a function
+}
+
+// reference is an occurrence of a name, its declaration included
+type reference struct {
+	name  string
+	rng   Range
+	local *symbol // local, external or label it resolves to; nil for a global
+	fn    *symbol // function which contains the occurrence
+}
+
+// global reports whether the reference is to a global name
+func (r *reference) global() bool {
+	return r.local == nil || r.local.kind == kindExtrn
+}
+
+// index holds the symbols and references of a document
+type index struct {
+	globals []*symbol
+	refs    []*reference
+}
+
+// tokenKind classifies tokens
+type tokenKind int
+
+const (
+	tokIdent tokenKind = iota
+	tokNumber
+	tokString
+	tokPunct
+)
+
+// token is a lexical unit with its place in the document
+type token struct {
+	kind tokenKind
+	text string
+	rng  Range
+}
+
+// scan splits B source into tokens, skipping comments
+func scan(text string) []token {
+	var toks []token
+	src := []rune(text)
+	line, col := 0, 0 // col counts UTF-16 units
+
+	// advance moves past n runes, updating the position
+	i := 0
+	advance := func(n int) {
+		for ; n > 0 && i < len(src); n-- {
+			if src[i] == '\n' {
+				line++
+				col = 0
+			} else {
+				col += len(utf16.Encode([]rune{src[i]}))
+			}
+			i++
+		}
+	}
+	for i < len(src) {
+		c := src[i]
+		start := Position{line, col}
+		from := i
+		switch {
+		case unicode.IsSpace(c):
+			advance(1)
+			continue
+		case c == '/' && i+1 < len(src) && src[i+1] == '*':
+			advance(2)
+			for i < len(src) && !(src[i] == '*' && i+1 < len(src) && src[i+1] == '/') {
+				advance(1)
+			}
+			advance(2)
+			continue
+		case unicode.IsLetter(c) || c == '_':
+			for i < len(src) && (unicode.IsLetter(src[i]) || unicode.IsDigit(src[i]) || src[i] == '_') {
+				advance(1)
+			}
+			toks = append(toks, token{tokIdent, string(src[from:i]), Range{start, Position{line, col}}})
+		case unicode.IsDigit(c):
+			for i < len(src) && (unicode.IsLetter(src[i]) || unicode.IsDigit(src[i])) {
+				advance(1)
+			}
+			toks = append(toks, token{tokNumber, string(src[from:i]), Range{start, Position{line, col}}})
+		case c == '"' || c == '\'':
+			// Literals end at the matching quote; '*' escapes the next character
+			advance(1)
+			for i < len(src) && src[i] != c && src[i] != '\n' {
+				if src[i] == '*' {
+					advance(1)
+				}
+				advance(1)
+			}
+			advance(1)
+			kind := tokString
+			if c == '\'' {
+				kind = tokNumber
+			}
+			toks = append(toks, token{kind, string(src[from:i]), Range{start, Position{line, col}}})
+		default:
+			advance(1)
+			toks = append(toks, token{tokPunct, string(c), Range{start, Position{line, col}}})
+		}
+	}
+	return toks
+}
+
+// parser walks the tokens of a document to build its index
+type parser struct {
+	toks []token
+	pos  int
+	idx  *index
+}
+
+// buildIndex scans the text and collects its symbols and references
+func buildIndex(text string) *index {
+	p := &parser{toks: scan(text), idx: &index{}}
+	for p.pos < len(p.toks) {
+		p.topLevel()
+	}
+	return p.idx
+}
+
+// peek returns the token at the offset from the current one, or a
+// punctuation token without text past the end
+func (p *parser) peek(offset int) token {
+	if p.pos+offset < len(p.toks) {
+		return p.toks[p.pos+offset]
+	}
+	return token{kind: tokPunct}
+}
+
+// is reports whether the current token is the given punctuation
+func (p *parser) is(text string) bool {
+	t := p.peek(0)
+	return t.kind == tokPunct && t.text == text
+}
+
+// lastEnd returns the end of the last consumed token
+func (p *parser) lastEnd() Position {
+	if p.pos > 0 {
+		return p.toks[p.pos-1].rng.End
+	}
+	return Position{}
+}
+
+// skipTo consumes tokens up to and including the punctuation,
+// at the nesting level where it starts; references found are recorded
+func (p *parser) skipTo(stop string, fn *symbol) {
+	depth := 0
+	for p.pos < len(p.toks) {
+		t := p.toks[p.pos]
+		if t.kind == tokPunct {
+			switch t.text {
+			case "(", "[", "{":
+				depth++
+			case ")", "]", "}":
+				depth--
+			}
+			if depth <= 0 && t.text == stop {
+				p.pos++
+				return
+			}
+		}
+		if t.kind == tokIdent && !isKeyword(t.text) {
+			p.use(t, fn)
+		}
+		p.pos++
+	}
+}
+
+// topLevel parses one declaration of a function, vector or scalar
+func (p *parser) topLevel() {
+	t := p.peek(0)
+	if t.kind != tokIdent {
+		p.pos++
+		return
+	}
+	p.pos++
+	sym := &symbol{name: t.text, nameRng: t.rng}
+	p.idx.globals = append(p.idx.globals, sym)
+	p.idx.refs = append(p.idx.refs, &reference{name: t.text, rng: t.rng})
+
+	switch {
+	case p.is("("):
+		sym.kind = kindFunction
+		p.pos++
+		for !p.is(")") && p.pos < len(p.toks) {
+			if a := p.peek(0); a.kind == tokIdent {
+				param := &symbol{name: a.text, kind: kindParam, nameRng: a.rng, fullRng: a.rng, fn: sym}
+				sym.params = append(sym.params, a.text)
+				sym.locals = append(sym.locals, param)
+				p.idx.refs = append(p.idx.refs, &reference{name: a.text, rng: a.rng, local: param, fn: sym})
+			}
+			p.pos++
+		}
+		p.pos++
+		p.body(sym)
+	case p.is("["):
+		sym.kind = kindVector
+		p.pos++
+		var size []string
+		for !p.is("]") && p.pos < len(p.toks) {
+			size = append(size, p.peek(0).text)
+			p.pos++
+		}
+		sym.size = strings.Join(size, "")
+		p.skipTo(";", nil)
+	default:
+		sym.kind = kindGlobal
+		p.skipTo(";", nil)
+	}
+	sym.fullRng = Range{t.rng.Start, p.lastEnd()}
+}
+
+// body parses the statement of a function: a block up to the matching
+// brace, or a single statement up to its semicolon
+func (p *parser) body(fn *symbol) {
+	var gotos []*reference
+	stop := ";"
+	depth := 0
+	if p.is("{") {
+		stop = "}"
+	}
+	prev := token{kind: tokPunct, text: "{"}
+	for p.pos < len(p.toks) {
+		t := p.toks[p.pos]
+		p.pos++
+		if t.kind == tokPunct {
+			switch t.text {
+			case "(", "[", "{":
+				depth++
+			case ")", "]", "}":
+				depth--
+			}
+			if t.text == stop && depth <= 0 {
+				break
+			}
+			prev = t
+			continue
+		}
+		if t.kind != tokIdent {
+			prev = t
+			continue
+		}
+		switch t.text {
+		case "auto":
+			p.autos(fn)
+			prev = token{kind: tokPunct, text: ";"}
+			continue
+		case "extrn":
+			p.extrns(fn)
+			prev = token{kind: tokPunct, text: ";"}
+			continue
+		case "goto":
+			if l := p.peek(0); l.kind == tokIdent {
+				ref := &reference{name: l.text, rng: l.rng, fn: fn}
+				p.idx.refs = append(p.idx.refs, ref)
+				gotos = append(gotos, ref)
+				p.pos++
+			}
+		default:
+			if isKeyword(t.text) {
+				break
+			}
+			if atStatement(prev) && p.is(":") {
+				label := &symbol{name: t.text, kind: kindLabel, nameRng: t.rng, fullRng: t.rng, fn: fn}
+				fn.locals = append(fn.locals, label)
+				p.idx.refs = append(p.idx.refs, &reference{name: t.text, rng: t.rng, local: label, fn: fn})
+			} else {
+				p.use(t, fn)
+			}
+		}
+		prev = t
+	}
+
+	// Labels may be defined after the goto
+	for _, ref := range gotos {
+		for _, l := range fn.locals {
+			if l.kind == kindLabel && l.name == ref.name {
+				ref.local = l
+			}
+		}
+	}
+}
+
+// atStatement reports whether a name after the token starts a statement
+func atStatement(prev token) bool {
+	if prev.kind == tokIdent {
+		return prev.text == "else"
+	}
+	switch prev.text {
+	case ";", "{", "}", ":", ")":
+		return true
+	}
+	return false
+}
+
+// autos parses the names of an auto statement
+func (p *parser) autos(fn *symbol) {
+	for p.pos < len(p.toks) {
+		t := p.peek(0)
+		if t.kind != tokIdent {
+			p.skipTo(";", fn)
+			return
+		}
+		p.pos++
+		sym := &symbol{name: t.text, kind: kindAuto, nameRng: t.rng, fn: fn}
+		if p.is("[") {
+			sym.isVector = true
+			p.pos++
+			var size []string
+			for !p.is("]") && p.pos < len(p.toks) {
+				size = append(size, p.peek(0).text)
+				p.pos++
+			}
+			sym.size = strings.Join(size, "")
+			p.pos++
+		}
+		sym.fullRng = Range{t.rng.Start, p.lastEnd()}
+		fn.locals = append(fn.locals, sym)
+		p.idx.refs = append(p.idx.refs, &reference{name: t.text, rng: t.rng, local: sym, fn: fn})
+
+		// Skip an initial value up to the next name
+		for !p.is(",") && !p.is(";") && p.pos < len(p.toks) {
+			p.pos++
+		}
+		if p.is(";") {
+			p.pos++
+			return
+		}
+		p.pos++
+	}
+}
+
+// extrns parses the names of an extrn statement
+func (p *parser) extrns(fn *symbol) {
+	for p.pos < len(p.toks) {
+		t := p.peek(0)
+		p.pos++
+		switch {
+		case t.kind == tokIdent:
+			sym := &symbol{name: t.text, kind: kindExtrn, nameRng: t.rng, fullRng: t.rng, fn: fn}
+			fn.locals = append(fn.locals, sym)
+			p.idx.refs = append(p.idx.refs, &reference{name: t.text, rng: t.rng, local: sym, fn: fn})
+		case t.kind == tokPunct && t.text == ";":
+			return
+		}
+	}
+}
+
+// use records an occurrence of a name in an expression
+func (p *parser) use(t token, fn *symbol) {
+	ref := &reference{name: t.text, rng: t.rng, fn: fn}
+	if fn != nil {
+		for _, l := range fn.locals {
+			if l.name == t.text && l.kind != kindLabel {
+				ref.local = l
+			}
+		}
+	}
+	p.idx.refs = append(p.idx.refs, ref)
+}
+
+// referenceAt returns the occurrence of a name at the position
+func (idx *index) referenceAt(pos Position) *reference {
+	for _, ref := range idx.refs {
+		if ref.rng.contains(pos) {
+			return ref
+		}
+	}
+	return nil
+}
+
+// functionAt returns the function whose definition contains the position
+func (idx *index) functionAt(pos Position) *symbol {
+	for _, sym := range idx.globals {
+		if sym.kind == kindFunction && sym.fullRng.contains(pos) {
+			return sym
+		}
+	}
+	return nil
+}
+
+// findGlobal returns the global definition of the name
+func (idx *index) findGlobal(name string) *symbol {
+	for _, sym := range idx.globals {
+		if sym.name == name {
+			return sym
+		}
+	}
+	return nil
+}
+
+// declaration returns the symbol as written in B, for hovers and details
+func (sym *symbol) declaration() string {
+	switch sym.kind {
+	case kindFunction:
+		return sym.name + "(" + strings.Join(sym.params, ", ") + ")"
+	case kindVector:
+		return sym.name + "[" + sym.size + "]"
+	case kindAuto:
+		if sym.isVector {
+			return "auto " + sym.name + "[" + sym.size + "]"
+		}
+		return "auto " + sym.name
+	case kindExtrn:
+		return "extrn " + sym.name
+	case kindLabel:
+		return sym.name + ":"
+	}
+	return sym.name
+}
+
+// description tells in words what the symbol is
+func (sym *symbol) description() string {
+	switch sym.kind {
+	case kindFunction:
+		return "function"
+	case kindVector:
+		return "vector"
+	case kindGlobal:
+		return "global variable"
+	case kindParam:
+		return "parameter of " + sym.fn.declaration()
+	case kindAuto:
+		if sym.isVector {
+			return "automatic vector in " + sym.fn.declaration()
+		}
+		return "automatic variable in " + sym.fn.declaration()
+	case kindExtrn:
+		return "external in " + sym.fn.declaration()
+	case kindLabel:
+		return "label in " + sym.fn.declaration()
+	}
+	return ""
+}
@@ -0,0 +1,106 @@
+package lsp
+
+import (
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+)
+
+const sample = `count 0;
+table[2] 1, 2;
+
+add(a, b) {
+    auto buf[10], n;
+    extrn count;
+loop:
+    n = a + b;
+    count++;
+    if (n) goto loop;
+    return (n ? buf : table);
+}
+`
+
+// TestIndexSymbols tests the declarations found by the index
+func TestIndexSymbols(t *testing.T) {
+	idx := buildIndex(sample)
+	var got []string
+	for _, sym := range idx.globals {
+		got = append(got, sym.declaration())
+		for _, l := range sym.locals {
+			got = append(got, "  "+l.declaration())
+		}
+	}
+	want := []string{"count", "table[2]", "add(a, b)", "  a", "  b", "  auto buf[10]", "  auto n", "  extrn count", "  loop:"}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("symbols:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	add := idx.findGlobal("add")
+	if add.nameRng != (Range{Position{3, 0}, Position{3, 3}}) {
+		t.Errorf("add is at %v", add.nameRng)
+	}
+	if add.fullRng.End != (Position{11, 1}) {
+		t.Errorf("add ends at %v, want its closing brace", add.fullRng.End)
+	}
+}
+
+// TestIndexReferences tests how names are resolved
+func TestIndexReferences(t *testing.T) {
+	idx := buildIndex(sample)
+	tests := []struct {
+		pos    Position
+		name   string
+		global bool
+		kind   symbolKind
+	}{
+		{Position{7, 8}, "a", false, kindParam},
+		{Position{7, 4}, "n", false, kindAuto},
+		{Position{8, 4}, "count", true, kindExtrn},
+		{Position{9, 17}, "loop", false, kindLabel},
+		{Position{10, 23}, "table", true, 0},
+	}
+	for _, tt := range tests {
+		ref := idx.referenceAt(tt.pos)
+		if ref == nil || ref.name != tt.name {
+			t.Errorf("at %v: reference %+v, want %s", tt.pos, ref, tt.name)
+			continue
+		}
+		if ref.global() != tt.global {
+			t.Errorf("%s: global = %v, want %v", tt.name, ref.global(), tt.global)
+		}
+		if ref.local != nil && ref.local.kind != tt.kind {
+			t.Errorf("%s: kind = %v, want %v", tt.name, ref.local.kind, tt.kind)
+		}
+	}
+
+	// Names inside comments and strings are not references
+	idx = buildIndex("/* f */ main() { printf(\"f*\"\"); }")
+	for _, ref := range idx.refs {
+		if ref.name == "f" {
+			t.Errorf("name in a comment or string taken as a reference at %v", ref.rng)
+		}
+	}
+}
+
+// TestBuiltinsMatchRuntime tests that the built-ins offered by completion
+// are those declared in runtime/runtime.h
+func TestBuiltinsMatchRuntime(t *testing.T) {
+	header, err := os.ReadFile("../runtime/runtime.h")
+	if err != nil {
+		t.Fatalf("Cannot read runtime.h: %v", err)
+	}
+	var want []string
+	for _, m := range regexp.MustCompile(`ALIAS\("(\w+)"\)`).FindAllStringSubmatch(string(header), -1) {
+		want = append(want, m[1])
+	}
+	sort.Strings(want)
+	var got []string
+	for _, b := range builtins {
+		got = append(got, b.name)
+	}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("built-ins = %v,\nruntime.h declares %v", got, want)
+	}
+}
@@ -0,0 +1,478 @@
+// Package lsp implements a Language Server Protocol server for B over
+// a pair of streams, normally stdin and stdout of 'blang lsp'. It
+// publishes the diagnostics of the compiler when a document changes,
+// and answers requests for definitions, references, hovers, document
+// symbols and completion from an index of the names of each document.
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"sergev.org/blang/compiler"
+)
+
+// document is a source file opened in the editor
+type document struct {
+	uri   string
+	text  string
+	lines []string
+	idx   *index
+}
+
+// Server answers the requests of one client
+type Server struct {
+	in       *bufio.Reader
+	out      io.Writer
+	docs     map[string]*document
+	shutdown bool // shutdown was requested, exit is expected
+}
+
+// NewServer creates a server which reads requests from r and writes to w
+func NewServer(r io.Reader, w io.Writer) *Server {
+	return &Server{
+		in:   bufio.NewReader(r),
+		out:  w,
+		docs: make(map[string]*document),
+	}
+}
+
+// Run serves requests until the client sends 'exit' or closes the input.
+// The result is the exit status: 0 when a shutdown preceded the exit.
+func (s *Server) Run() int {
+	for {
+		body, err := s.readMessage()
+		if err != nil {
+			return 1
+		}
+		var req request
+		if err := json.Unmarshal(body, &req); err != nil {
+			s.replyError(nil, codeParseError, err.Error())
+			continue
+		}
+		if req.Method == "exit" {
+			if s.shutdown {
+				return 0
+			}
+			return 1
+		}
+		result, rerr := s.handle(&req)
+		if req.ID == nil {
+			continue // notifications get no answer
+		}
+		if rerr != nil {
+			s.replyError(req.ID, rerr.Code, rerr.Message)
+		} else {
+			s.write(response{JSONRPC: "2.0", ID: req.ID, Result: result})
+		}
+	}
+}
+
+// readMessage reads the body of a message with its Content-Length header
+func (s *Server) readMessage() ([]byte, error) {
+	length := -1
+	for {
+		line, err := s.in.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			break
+		}
+		name, value, ok := strings.Cut(line, ":")
+		if ok && strings.EqualFold(strings.TrimSpace(name), "Content-Length") {
+			if length, err = strconv.Atoi(strings.TrimSpace(value)); err != nil {
+				return nil, fmt.Errorf("bad Content-Length: %v", err)
+			}
+		}
+	}
+	if length < 0 {
+		return nil, fmt.Errorf("missing Content-Length")
+	}
+	body := make([]byte, length)
+	_, err := io.ReadFull(s.in, body)
+	return body, err
+}
+
+// write sends a message to the client
+func (s *Server) write(msg interface{}) {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return
+	}
+	fmt.Fprintf(s.out, "Content-Length: %d\r\n\r\n%s", len(body), body)
+}
+
+// replyError answers a request with an error
+func (s *Server) replyError(id *json.RawMessage, code int, message string) {
+	s.write(errorResponse{JSONRPC: "2.0", ID: id, Error: &responseError{Code: code, Message: message}})
+}
+
+// handle dispatches a request or notification by its method
+func (s *Server) handle(req *request) (interface{}, *responseError) {
+	// decode unmarshals the parameters into v
+	decode := func(v interface{}) *responseError {
+		if err := json.Unmarshal(req.Params, v); err != nil {
+			return &responseError{Code: codeInvalidParams, Message: err.Error()}
+		}
+		return nil
+	}
+
+	switch req.Method {
+	case "initialize":
+		return map[string]interface{}{
+			"capabilities": map[string]interface{}{
+				"textDocumentSync":       1, // full text on every change
+				"definitionProvider":     true,
+				"referencesProvider":     true,
+				"hoverProvider":          true,
+				"documentSymbolProvider": true,
+				"completionProvider":     map[string]interface{}{},
+			},
+			"serverInfo": map[string]string{"name": "blang"},
+		}, nil
+	case "shutdown":
+		s.shutdown = true
+		return nil, nil
+	case "textDocument/didOpen":
+		var p didOpenParams
+		if err := decode(&p); err != nil {
+			return nil, err
+		}
+		s.update(p.TextDocument.URI, p.TextDocument.Text)
+		return nil, nil
+	case "textDocument/didChange":
+		var p didChangeParams
+		if err := decode(&p); err != nil {
+			return nil, err
+		}
+		if n := len(p.ContentChanges); n > 0 {
+			s.update(p.TextDocument.URI, p.ContentChanges[n-1].Text)
+		}
+		return nil, nil
+	case "textDocument/didClose":
+		var p didCloseParams
+		if err := decode(&p); err != nil {
+			return nil, err
+		}
+		delete(s.docs, p.TextDocument.URI)
+		s.write(notification{JSONRPC: "2.0", Method: "textDocument/publishDiagnostics",
+			Params: publishDiagnosticsParams{URI: p.TextDocument.URI, Diagnostics: []diagnostic{}}})
+		return nil, nil
+	case "textDocument/definition":
+		var p textDocumentPositionParams
+		if err := decode(&p); err != nil {
+			return nil, err
+		}
+		return s.definition(p.TextDocument.URI, p.Position), nil
+	case "textDocument/references":
+		var p referenceParams
+		if err := decode(&p); err != nil {
+			return nil, err
+		}
+		return s.references(p.TextDocument.URI, p.Position, p.Context.IncludeDeclaration), nil
+	case "textDocument/hover":
+		var p textDocumentPositionParams
+		if err := decode(&p); err != nil {
+			return nil, err
+		}
+		return s.hover(p.TextDocument.URI, p.Position), nil
+	case "textDocument/documentSymbol":
+		var p documentSymbolParams
+		if err := decode(&p); err != nil {
+			return nil, err
+		}
+		return s.documentSymbols(p.TextDocument.URI), nil
+	case "textDocument/completion":
+		var p textDocumentPositionParams
+		if err := decode(&p); err != nil {
+			return nil, err
+		}
+		return s.completion(p.TextDocument.URI, p.Position), nil
+	}
+	if req.ID != nil {
+		return nil, &responseError{Code: codeMethodNotFound, Message: "method not supported: " + req.Method}
+	}
+	return nil, nil // unknown notifications are ignored
+}
+
+// update stores the new text of a document and publishes its diagnostics
+func (s *Server) update(uri, text string) {
+	doc := &document{
+		uri:   uri,
+		text:  text,
+		lines: strings.Split(text, "\n"),
+		idx:   buildIndex(text),
+	}
+	s.docs[uri] = doc
+	s.write(notification{JSONRPC: "2.0", Method: "textDocument/publishDiagnostics",
+		Params: publishDiagnosticsParams{URI: uri, Diagnostics: doc.diagnostics()}})
+}
+
+// diagnostics compiles the document and reports its errors and warnings
+// on the whole line, since the compiler knows no columns
+func (doc *document) diagnostics() (result []diagnostic) {
+	result = []diagnostic{}
+	defer func() {
+		// A crash of the compiler must not take the server down
+		if r := recover(); r != nil {
+			result = append(result, diagnostic{Severity: severityError, Source: "blang",
+				Message: fmt.Sprintf("internal compiler error: %v", r)})
+		}
+	}()
+	_, diags, _ := compiler.ParseReader(uriPath(doc.uri), strings.NewReader(doc.text))
+	for _, d := range diags {
+		line := d.Pos.Line - 1
+		if line >= len(doc.lines) {
+			line = len(doc.lines) - 1
+		}
+		if line < 0 {
+			line = 0
+		}
+		severity := severityError
+		if d.Severity == compiler.SeverityWarning {
+			severity = severityWarning
+		}
+		result = append(result, diagnostic{
+			Range:    Range{Position{line, 0}, Position{line, utf16Len(doc.lines[line])}},
+			Severity: severity,
+			Source:   "blang",
+			Message:  d.Message,
+		})
+	}
+	return result
+}
+
+// uriPath returns the file name of a file URI, for messages of the compiler
+func uriPath(uri string) string {
+	if u, err := url.Parse(uri); err == nil && u.Scheme == "file" {
+		return u.Path
+	}
+	return uri
+}
+
+// utf16Len returns the length of the text in UTF-16 code units
+func utf16Len(text string) int {
+	n := 0
+	for _, r := range text {
+		if r >= 0x10000 {
+			n += 2
+		} else {
+			n++
+		}
+	}
+	return n
+}
+
+// lookup returns the document and the name at the position in it
+func (s *Server) lookup(uri string, pos Position) (*document, *reference) {
+	doc := s.docs[uri]
+	if doc == nil {
+		return nil, nil
+	}
+	return doc, doc.idx.referenceAt(pos)
+}
+
+// globalDefinition finds the definition of a global name, first in the
+// given document, then in the other open ones in a stable order
+func (s *Server) globalDefinition(doc *document, name string) (*document, *symbol) {
+	if sym := doc.idx.findGlobal(name); sym != nil {
+		return doc, sym
+	}
+	for _, uri := range s.uris() {
+		if sym := s.docs[uri].idx.findGlobal(name); sym != nil {
+			return s.docs[uri], sym
+		}
+	}
+	return nil, nil
+}
+
+// uris returns the open documents in a stable order
+func (s *Server) uris() []string {
+	uris := make([]string, 0, len(s.docs))
+	for uri := range s.docs {
+		uris = append(uris, uri)
+	}
+	sort.Strings(uris)
+	return uris
+}
+
+// definition answers textDocument/definition
+func (s *Server) definition(uri string, pos Position) interface{} {
+	doc, ref := s.lookup(uri, pos)
+	if ref == nil {
+		return nil
+	}
+	if !ref.global() {
+		return Location{URI: uri, Range: ref.local.nameRng}
+	}
+	if defDoc, sym := s.globalDefinition(doc, ref.name); sym != nil {
+		return Location{URI: defDoc.uri, Range: sym.nameRng}
+	}
+	return nil
+}
+
+// references answers textDocument/references: the occurrences of a local
+// in its function, or of a global in every open document
+func (s *Server) references(uri string, pos Position, withDecl bool) []Location {
+	doc, ref := s.lookup(uri, pos)
+	result := []Location{}
+	if ref == nil {
+		return result
+	}
+	if !ref.global() {
+		for _, r := range doc.idx.refs {
+			if r.local == ref.local && (withDecl || r.rng != ref.local.nameRng) {
+				result = append(result, Location{URI: uri, Range: r.rng})
+			}
+		}
+		return result
+	}
+	for _, u := range s.uris() {
+		d := s.docs[u]
+		def := d.idx.findGlobal(ref.name)
+		for _, r := range d.idx.refs {
+			if r.name != ref.name || !r.global() {
+				continue
+			}
+			if !withDecl && def != nil && r.rng == def.nameRng {
+				continue
+			}
+			result = append(result, Location{URI: u, Range: r.rng})
+		}
+	}
+	return result
+}
+
+// hover answers textDocument/hover with the declaration of the name
+func (s *Server) hover(uri string, pos Position) interface{} {
+	doc, ref := s.lookup(uri, pos)
+	if ref == nil {
+		return nil
+	}
+	var decl, note string
+	switch {
+	case !ref.global():
+		decl, note = ref.local.declaration(), ref.local.description()
+	default:
+		if _, sym := s.globalDefinition(doc, ref.name); sym != nil {
+			decl, note = sym.declaration(), sym.description()
+		} else if b := findBuiltin(ref.name); b != nil {
+			decl, note = b.declaration(), "runtime library: "+b.doc
+		} else {
+			decl, note = ref.name, "global, not defined in open documents"
+		}
+		if ref.local != nil {
+			note = "external " + note + ", declared in " + ref.local.fn.declaration()
+		}
+	}
+	return hover{
+		Contents: markupContent{Kind: "markdown", Value: "```b\n" + decl + "\n```\n" + note},
+		Range:    ref.rng,
+	}
+}
+
+// declaration returns the built-in as written in B
+func (b *builtin) declaration() string {
+	if b.params == nil {
+		return b.name
+	}
+	return b.name + "(" + strings.Join(b.params, ", ") + ")"
+}
+
+// documentSymbols answers textDocument/documentSymbol: the global
+// declarations, with the locals and labels of functions as children
+func (s *Server) documentSymbols(uri string) []documentSymbol {
+	result := []documentSymbol{}
+	doc := s.docs[uri]
+	if doc == nil {
+		return result
+	}
+	for _, sym := range doc.idx.globals {
+		ds := documentSymbol{
+			Name:           sym.name,
+			Detail:         sym.declaration(),
+			Kind:           symbolKindVariable,
+			Range:          sym.fullRng,
+			SelectionRange: sym.nameRng,
+		}
+		switch sym.kind {
+		case kindFunction:
+			ds.Kind = symbolKindFunction
+		case kindVector:
+			ds.Kind = symbolKindArray
+		}
+		for _, l := range sym.locals {
+			child := documentSymbol{
+				Name:           l.name,
+				Detail:         l.declaration(),
+				Kind:           symbolKindVariable,
+				Range:          l.fullRng,
+				SelectionRange: l.nameRng,
+			}
+			switch {
+			case l.kind == kindLabel:
+				child.Kind = symbolKindKey
+			case l.isVector:
+				child.Kind = symbolKindArray
+			}
+			ds.Children = append(ds.Children, child)
+		}
+		result = append(result, ds)
+	}
+	return result
+}
+
+// completion answers textDocument/completion with the locals of the
+// function at the position, the globals of open documents, the runtime
+// library and the keywords; the client filters them by the typed prefix
+func (s *Server) completion(uri string, pos Position) []completionItem {
+	result := []completionItem{}
+	seen := make(map[string]bool)
+	add := func(item completionItem) {
+		if !seen[item.Label] {
+			seen[item.Label] = true
+			result = append(result, item)
+		}
+	}
+
+	if doc := s.docs[uri]; doc != nil {
+		if fn := doc.idx.functionAt(pos); fn != nil {
+			for _, l := range fn.locals {
+				kind := completionKindVariable
+				if l.kind == kindLabel {
+					kind = completionKindLabel
+				}
+				add(completionItem{Label: l.name, Kind: kind, Detail: l.declaration()})
+			}
+		}
+	}
+	for _, u := range s.uris() {
+		for _, sym := range s.docs[u].idx.globals {
+			kind := completionKindVariable
+			if sym.kind == kindFunction {
+				kind = completionKindFunction
+			}
+			add(completionItem{Label: sym.name, Kind: kind, Detail: sym.declaration()})
+		}
+	}
+	for i := range builtins {
+		b := &builtins[i]
+		kind := completionKindFunction
+		if b.params == nil {
+			kind = completionKindVariable
+		}
+		add(completionItem{Label: b.name, Kind: kind, Detail: b.declaration(), Documentation: b.doc})
+	}
+	for _, k := range keywords {
+		add(completionItem{Label: k, Kind: completionKindKeyword})
+	}
+	return result
+}
@@ -0,0 +1,182 @@
+package lsp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// session runs the server on the messages and returns what it sent
+// back, and its exit status
+func session(t *testing.T, messages ...string) ([]map[string]interface{}, int) {
+	t.Helper()
+	var in bytes.Buffer
+	for _, m := range messages {
+		fmt.Fprintf(&in, "Content-Length: %d\r\n\r\n%s", len(m), m)
+	}
+	var out bytes.Buffer
+	status := NewServer(&in, &out).Run()
+
+	var replies []map[string]interface{}
+	r := bufio.NewReader(&out)
+	for {
+		header, err := r.ReadString('\n')
+		if err == io.EOF {
+			break
+		}
+		length, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(header, "Content-Length:")))
+		if err != nil {
+			t.Fatalf("Bad header %q", header)
+		}
+		r.ReadString('\n')
+		body := make([]byte, length)
+		if _, err := io.ReadFull(r, body); err != nil {
+			t.Fatalf("Short message: %v", err)
+		}
+		var msg map[string]interface{}
+		if err := json.Unmarshal(body, &msg); err != nil {
+			t.Fatalf("Bad JSON %s: %v", body, err)
+		}
+		replies = append(replies, msg)
+	}
+	return replies, status
+}
+
+// position returns the parameters of a request at a place in the document
+func position(id int, method, uri string, line, char int) string {
+	return fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"method":"%s","params":{"textDocument":{"uri":"%s"},"position":{"line":%d,"character":%d},"context":{"includeDeclaration":true}}}`,
+		id, method, uri, line, char)
+}
+
+// open returns a didOpen notification for the text
+func open(uri, text string) string {
+	body, _ := json.Marshal(text)
+	return fmt.Sprintf(`{"jsonrpc":"2.0","method":"textDocument/didOpen","params":{"textDocument":{"uri":"%s","version":1,"text":%s}}}`, uri, body)
+}
+
+// result returns the result of the reply to the request with the ID
+func result(t *testing.T, replies []map[string]interface{}, id int) interface{} {
+	t.Helper()
+	for _, msg := range replies {
+		if v, ok := msg["id"].(float64); ok && int(v) == id {
+			if e, ok := msg["error"]; ok {
+				t.Fatalf("Request %d failed: %v", id, e)
+			}
+			return msg["result"]
+		}
+	}
+	t.Fatalf("No reply to request %d", id)
+	return nil
+}
+
+// TestServer runs a session through the requests of an editor
+func TestServer(t *testing.T) {
+	const main = "file:///src/main.b"
+	const lib = "file:///src/lib.b"
+	replies, status := session(t,
+		`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{}}`,
+		`{"jsonrpc":"2.0","method":"initialized","params":{}}`,
+		open(lib, "total 0;\nbump(n) {\n    extrn total;\n    total =+ n;\n}\n"),
+		open(main, sample+"main() {\n    bump(add(1, 2));\n    printf(\"%d*n\");\n}\n"),
+		position(2, "textDocument/definition", main, 13, 6),
+		position(3, "textDocument/references", lib, 0, 1),
+		position(4, "textDocument/hover", main, 4, 10),
+		position(5, "textDocument/hover", main, 13, 10),
+		position(6, "textDocument/completion", main, 7, 5),
+		`{"jsonrpc":"2.0","id":7,"method":"textDocument/documentSymbol","params":{"textDocument":{"uri":"file:///src/main.b"}}}`,
+		`{"jsonrpc":"2.0","id":8,"method":"workspace/symbol","params":{}}`,
+		`{"jsonrpc":"2.0","id":9,"method":"shutdown"}`,
+		`{"jsonrpc":"2.0","method":"exit"}`,
+	)
+	if status != 0 {
+		t.Errorf("exit status = %d, want 0", status)
+	}
+
+	caps := result(t, replies, 1).(map[string]interface{})["capabilities"].(map[string]interface{})
+	if caps["definitionProvider"] != true || caps["textDocumentSync"] != 1.0 {
+		t.Errorf("capabilities = %v", caps)
+	}
+
+	// Diagnostics of both documents: the warning of printf in main.b
+	var diags []string
+	for _, msg := range replies {
+		if msg["method"] == "textDocument/publishDiagnostics" {
+			p := msg["params"].(map[string]interface{})
+			for _, d := range p["diagnostics"].([]interface{}) {
+				d := d.(map[string]interface{})
+				line := d["range"].(map[string]interface{})["start"].(map[string]interface{})["line"]
+				diags = append(diags, fmt.Sprintf("%s:%v: %v", p["uri"], line, d["message"]))
+			}
+		}
+	}
+	want := main + ":14: printf format expects 1 argument(s), but 0 given"
+	if len(diags) != 1 || diags[0] != want {
+		t.Errorf("diagnostics = %q, want %q", diags, want)
+	}
+
+	// bump is defined in the other document
+	def := result(t, replies, 2).(map[string]interface{})
+	if def["uri"] != lib {
+		t.Errorf("definition = %v, want in %s", def, lib)
+	}
+
+	// total: its definition, the extrn and the assignment
+	if refs := result(t, replies, 3).([]interface{}); len(refs) != 3 {
+		t.Errorf("references = %v, want 3", refs)
+	}
+
+	hovers := []struct {
+		id   int
+		want string
+	}{
+		{4, "```b\nauto buf[10]\n```\nautomatic vector in add(a, b)"},
+		{5, "```b\nadd(a, b)\n```\nfunction"},
+	}
+	for _, h := range hovers {
+		got := result(t, replies, h.id).(map[string]interface{})["contents"].(map[string]interface{})["value"]
+		if got != h.want {
+			t.Errorf("hover %d = %q, want %q", h.id, got, h.want)
+		}
+	}
+
+	labels := map[string]bool{}
+	for _, item := range result(t, replies, 6).([]interface{}) {
+		labels[item.(map[string]interface{})["label"].(string)] = true
+	}
+	for _, name := range []string{"buf", "loop", "table", "bump", "printf", "getvec", "argv", "while"} {
+		if !labels[name] {
+			t.Errorf("completion does not offer %s", name)
+		}
+	}
+
+	var names []string
+	for _, s := range result(t, replies, 7).([]interface{}) {
+		names = append(names, s.(map[string]interface{})["name"].(string))
+	}
+	if got := strings.Join(names, " "); got != "count table add main" {
+		t.Errorf("document symbols = %q", got)
+	}
+
+	for _, msg := range replies {
+		if v, ok := msg["id"].(float64); ok && v == 8 {
+			if msg["error"] == nil {
+				t.Errorf("unsupported request should fail: %v", msg)
+			}
+		}
+	}
+}
+
+// TestServerExitWithoutShutdown tests the exit status of an abrupt end
+func TestServerExitWithoutShutdown(t *testing.T) {
+	if _, status := session(t, `{"jsonrpc":"2.0","method":"exit"}`); status != 1 {
+		t.Errorf("exit status = %d, want 1", status)
+	}
+	if _, status := session(t); status != 1 {
+		t.Errorf("exit status at end of input = %d, want 1", status)
+	}
+}
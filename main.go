@@ -1,12 +1,19 @@
 package main
 
 import (
+	"bytes"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 
 	"github.com/fatih/color"
 	"github.com/spf13/pflag"
+	"sergev.org/blang/compiler"
+	"sergev.org/blang/format"
+	"sergev.org/blang/lsp"
 )
 
 func usage() {
@@ -16,6 +23,13 @@ func usage() {
 	note := color.New(color.Faint)
 
 	hdr.Fprintln(os.Stderr, "Usage: blang [options] file...")
+	hdr.Fprintln(os.Stderr, "       blang run [options] file.b... [--] [argument...]")
+	hdr.Fprintln(os.Stderr, "       blang repl [file.b...]")
+	hdr.Fprintln(os.Stderr, "       blang fmt [-w] [-d] [file.b...]")
+	hdr.Fprintln(os.Stderr, "       blang lsp")
+	hdr.Fprintln(os.Stderr, "       blang xref [--format=text|dot|json] [-o file] file.b...")
+	hdr.Fprintln(os.Stderr, "       blang cov [--format=text|lcov] [-o file] file.b...")
+	hdr.Fprintln(os.Stderr, "       blang prof [--flat] [--graph] [-o file] [bmon.out]")
 	fmt.Fprintln(os.Stderr)
 	fmt.Fprintln(os.Stderr, "blang is a compiler for .b files.")
 	fmt.Fprintln(os.Stderr)
@@ -31,14 +45,480 @@ func usage() {
 	fmt.Fprintf(os.Stderr, "  %s  %s%s%s\n", cmd.Sprint("blang --emit-llvm hello.b"), note.Sprint("    Output LLVM IR '"), out.Sprint("hello.ll"), note.Sprint("'"))
 	fmt.Fprintf(os.Stderr, "  %s  %s\n", cmd.Sprint("blang -O0 -g -o unopt hello.b"), note.Sprint("Unoptimized with debug info"))
 	fmt.Fprintf(os.Stderr, "  %s  %s\n", cmd.Sprint("blang hello.b -o output -O2"), note.Sprint("  Options can be placed after arguments"))
+	fmt.Fprintf(os.Stderr, "  %s  %s\n", cmd.Sprint("blang -fbackend=native hello.b"), note.Sprint("Build with as and ld, without clang"))
+	fmt.Fprintf(os.Stderr, "  %s  %s\n", cmd.Sprint("blang --target=pdp11 -S hello.b"), note.Sprint("Threaded code for the PDP-11"))
+	fmt.Fprintf(os.Stderr, "  %s  %s\n", cmd.Sprint("blang --target=wasm32-wasi hello.b"), note.Sprint("WebAssembly module hello.wasm"))
+	fmt.Fprintf(os.Stderr, "  %s  %s\n", cmd.Sprint("blang --target=aarch64-linux-gnu hello.b"), note.Sprint("Executable for ARM64 Linux"))
+	fmt.Fprintf(os.Stderr, "  %s  %s\n", cmd.Sprint("blang run hello.b a b"), note.Sprint("        Interpret without compiling, passing arguments"))
+	fmt.Fprintf(os.Stderr, "  %s  %s\n", cmd.Sprint("blang repl"), note.Sprint("                   Interactive session"))
+	fmt.Fprintf(os.Stderr, "  %s  %s\n", cmd.Sprint("blang fmt -w *.b"), note.Sprint("             Rewrite sources in the canonical layout"))
+	fmt.Fprintf(os.Stderr, "  %s  %s\n", cmd.Sprint("blang lsp"), note.Sprint("                    Language server for editors, on stdin and stdout"))
+	fmt.Fprintf(os.Stderr, "  %s  %s\n", cmd.Sprint("blang xref --format=dot *.b"), note.Sprint("  Call graph for Graphviz"))
+	fmt.Fprintf(os.Stderr, "  %s  %s\n", cmd.Sprint("blang --coverage hello.b"), note.Sprint("     Count line executions into 'hello.cov'"))
+	fmt.Fprintf(os.Stderr, "  %s  %s\n", cmd.Sprint("blang cov hello.b"), note.Sprint("            Source annotated with the counts"))
+	fmt.Fprintf(os.Stderr, "  %s  %s\n", cmd.Sprint("blang -pg hello.b"), note.Sprint("            Profile calls into 'bmon.out', with debug info"))
+	fmt.Fprintf(os.Stderr, "  %s  %s\n", cmd.Sprint("blang prof"), note.Sprint("                   Flat profile and call graph of 'bmon.out'"))
 	fmt.Fprintf(os.Stderr, "  %s  %s\n", cmd.Sprint("blang -V"), note.Sprint("                     Show version information"))
 	fmt.Fprintf(os.Stderr, "\n")
 	os.Exit(0)
 }
 
+// runCommand implements 'blang run': the leading .b files are interpreted,
+// the remaining arguments (or all after '--') are passed to main().
+func runCommand(argv []string) int {
+	var verbose bool
+	var coverage bool
+	var profile bool
+	var showHelp bool
+	var codegen []string
+
+	flags := pflag.NewFlagSet("blang run", pflag.ContinueOnError)
+	flags.SetInterspersed(false)
+	flags.BoolVarP(&verbose, "verbose", "v", false, "Verbose output")
+	flags.BoolVar(&coverage, "coverage", false, "Count line executions into <file>.cov")
+	flags.BoolVarP(&profile, "profile", "p", false, "Profile the calls of functions into bmon.out")
+	flags.StringArrayVarP(&codegen, "codegen", "f", []string{}, "Code generation option: bounds-check, stack-check, trapv, wrapv")
+	flags.BoolVarP(&showHelp, "help", "h", false, "Display this information")
+	flags.Usage = func() {}
+	if err := flags.Parse(argv); err != nil {
+		compiler.Eprintf("blang", "%s\n", err)
+		return 1
+	}
+	if showHelp {
+		fmt.Fprintln(os.Stderr, "Usage: blang run [options] file.b... [--] [argument...]")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Options:")
+		flags.PrintDefaults()
+		return 0
+	}
+
+	// Source files come first, program arguments follow
+	rest := flags.Args()
+	dash := flags.ArgsLenAtDash()
+	var files []string
+	for len(rest) > 0 && (dash < 0 || len(files) < dash) && filepath.Ext(rest[0]) == ".b" {
+		files = append(files, rest[0])
+		rest = rest[1:]
+	}
+	if len(rest) > 0 && rest[0] == "--" && dash < 0 {
+		rest = rest[1:]
+	}
+	if len(files) == 0 {
+		compiler.Eprintf("blang", "no input files\n")
+		return 1
+	}
+	for _, file := range files {
+		if _, err := os.Stat(file); err != nil {
+			compiler.Eprintf("blang", "cannot access file '%s': %v\n", file, err)
+			return 1
+		}
+	}
+
+	var opts []compiler.Option
+	if verbose {
+		opts = append(opts, compiler.WithVerbose())
+	}
+	if coverage {
+		opts = append(opts, compiler.WithCoverage())
+	}
+	if profile {
+		opts = append(opts, compiler.WithProfile())
+	}
+	for _, opt := range codegen {
+		switch opt {
+		case "bounds-check":
+			opts = append(opts, compiler.WithBoundsCheck())
+		case "stack-check":
+			opts = append(opts, compiler.WithStackCheck())
+		case "trapv":
+			opts = append(opts, compiler.WithArith(compiler.ArithTrap))
+		case "wrapv":
+			opts = append(opts, compiler.WithArith(compiler.ArithWrap))
+		default:
+			compiler.Eprintf("blang", "unknown option '-f%s'\n", opt)
+			return 1
+		}
+	}
+	args := compiler.NewOptions(files, opts...)
+
+	// The program name is the first source without its extension
+	progName := strings.TrimSuffix(files[0], ".b")
+	status, err := compiler.Interpret(args, append([]string{progName}, rest...))
+	if err != nil {
+		compiler.Eprintf("blang", "%s\n", err)
+		return 1
+	}
+	return status
+}
+
+// replCommand implements 'blang repl': an interactive session,
+// starting with the definitions from the given files.
+func replCommand(argv []string) int {
+	var showHelp bool
+
+	flags := pflag.NewFlagSet("blang repl", pflag.ContinueOnError)
+	flags.BoolVarP(&showHelp, "help", "h", false, "Display this information")
+	flags.Usage = func() {}
+	if err := flags.Parse(argv); err != nil {
+		compiler.Eprintf("blang", "%s\n", err)
+		return 1
+	}
+	if showHelp {
+		fmt.Fprintln(os.Stderr, "Usage: blang repl [file.b...]")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Options:")
+		flags.PrintDefaults()
+		return 0
+	}
+
+	args := compiler.NewOptions(flags.Args())
+	repl := compiler.NewRepl(args, compiler.NewInterp(args))
+	for _, file := range args.InputFiles {
+		module, err := compiler.ParseFile(args, file)
+		if err != nil {
+			compiler.Eprintf("blang", "%s\n", err)
+			return 1
+		}
+		if err := repl.Load(module); err != nil {
+			compiler.Eprintf("blang", "%s\n", err)
+			return 1
+		}
+	}
+
+	// Prompt only when reading from a terminal
+	if fi, err := os.Stdin.Stat(); err == nil && fi.Mode()&os.ModeCharDevice != 0 {
+		repl.Prompt = true
+	}
+	if err := repl.Run(); err != nil {
+		compiler.Eprintf("blang", "%s\n", err)
+		return 1
+	}
+	return 0
+}
+
+// fmtCommand implements 'blang fmt': sources are printed in the
+// canonical layout, rewritten in place or compared with it.
+func fmtCommand(argv []string) int {
+	var write, showDiff, showHelp bool
+
+	flags := pflag.NewFlagSet("blang fmt", pflag.ContinueOnError)
+	flags.BoolVarP(&write, "write", "w", false, "Write the result to the source file instead of stdout")
+	flags.BoolVarP(&showDiff, "diff", "d", false, "Display diffs instead of the formatted source")
+	flags.BoolVarP(&showHelp, "help", "h", false, "Display this information")
+	flags.Usage = func() {}
+	if err := flags.Parse(argv); err != nil {
+		compiler.Eprintf("blang", "%s\n", err)
+		return 1
+	}
+	if showHelp {
+		fmt.Fprintln(os.Stderr, "Usage: blang fmt [options] [file.b...]")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Without files, the source is read from stdin.")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Options:")
+		flags.PrintDefaults()
+		return 0
+	}
+
+	files := flags.Args()
+	if len(files) == 0 {
+		if write {
+			compiler.Eprintf("blang", "cannot use -w with standard input\n")
+			return 1
+		}
+		files = []string{"-"}
+	}
+	status := 0
+	for _, file := range files {
+		if err := formatFile(file, write, showDiff); err != nil {
+			compiler.Eprintf("blang", "%s\n", err)
+			status = 1
+		}
+	}
+	return status
+}
+
+// formatFile formats one source, or stdin when the name is "-"
+func formatFile(file string, write, showDiff bool) error {
+	var src []byte
+	var err error
+	var mode os.FileMode
+	if file == "-" {
+		src, err = io.ReadAll(os.Stdin)
+		file = "<stdin>"
+	} else {
+		var fi os.FileInfo
+		if fi, err = os.Stat(file); err == nil {
+			mode = fi.Mode().Perm()
+			src, err = os.ReadFile(file)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	out, err := format.Source(src)
+	if err != nil {
+		if e, ok := err.(*format.Error); ok {
+			return fmt.Errorf("%s:%d: %s", file, e.Line, e.Msg)
+		}
+		return fmt.Errorf("%s: %v", file, err)
+	}
+	if showDiff {
+		os.Stdout.Write(format.Diff(file, src, out))
+	}
+	if write {
+		if bytes.Equal(src, out) {
+			return nil
+		}
+		return os.WriteFile(file, out, mode)
+	}
+	if !showDiff {
+		os.Stdout.Write(out)
+	}
+	return nil
+}
+
+// lspCommand implements 'blang lsp': a language server for editors,
+// which speaks the Language Server Protocol on stdin and stdout.
+func lspCommand(argv []string) int {
+	var showHelp bool
+
+	flags := pflag.NewFlagSet("blang lsp", pflag.ContinueOnError)
+	flags.BoolVarP(&showHelp, "help", "h", false, "Display this information")
+	flags.Usage = func() {}
+	if err := flags.Parse(argv); err != nil {
+		compiler.Eprintf("blang", "%s\n", err)
+		return 1
+	}
+	if showHelp {
+		fmt.Fprintln(os.Stderr, "Usage: blang lsp")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Options:")
+		flags.PrintDefaults()
+		return 0
+	}
+	return lsp.NewServer(os.Stdin, os.Stdout).Run()
+}
+
+// xrefCommand implements 'blang xref': the global names of a program
+// with their definitions and uses, and the call graph.
+func xrefCommand(argv []string) int {
+	var format, output string
+	var showHelp bool
+
+	flags := pflag.NewFlagSet("blang xref", pflag.ContinueOnError)
+	flags.StringVar(&format, "format", "text", "Report format: text, dot or json")
+	flags.StringVarP(&output, "output", "o", "", "Write the report to <file> instead of stdout")
+	flags.BoolVarP(&showHelp, "help", "h", false, "Display this information")
+	flags.Usage = func() {}
+	if err := flags.Parse(argv); err != nil {
+		compiler.Eprintf("blang", "%s\n", err)
+		return 1
+	}
+	if showHelp {
+		fmt.Fprintln(os.Stderr, "Usage: blang xref [options] file.b...")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Options:")
+		flags.PrintDefaults()
+		return 0
+	}
+	if flags.NArg() == 0 {
+		compiler.Eprintf("blang", "no input files\n")
+		return 1
+	}
+
+	var write func(*compiler.Xref, io.Writer) error
+	switch format {
+	case "text":
+		write = (*compiler.Xref).WriteText
+	case "dot":
+		write = (*compiler.Xref).WriteDOT
+	case "json":
+		write = (*compiler.Xref).WriteJSON
+	default:
+		compiler.Eprintf("blang", "unknown report format '%s'\n", format)
+		return 1
+	}
+
+	x, err := compiler.CrossReference(flags.Args())
+	if err != nil {
+		compiler.Eprintf("blang", "%s\n", err)
+		return 1
+	}
+	var buf bytes.Buffer
+	write(x, &buf)
+	if output == "" {
+		os.Stdout.Write(buf.Bytes())
+		return 0
+	}
+	if err := os.WriteFile(output, buf.Bytes(), 0644); err != nil {
+		compiler.Eprintf("blang", "%s\n", err)
+		return 1
+	}
+	return 0
+}
+
+// covCommand implements 'blang cov': the counts of the lines of a program
+// compiled with --coverage, as an annotated listing or an lcov tracefile
+func covCommand(argv []string) int {
+	var format, output string
+	var showHelp bool
+
+	flags := pflag.NewFlagSet("blang cov", pflag.ContinueOnError)
+	flags.StringVar(&format, "format", "text", "Report format: text or lcov")
+	flags.StringVarP(&output, "output", "o", "", "Write the report to <file> instead of stdout")
+	flags.BoolVarP(&showHelp, "help", "h", false, "Display this information")
+	flags.Usage = func() {}
+	if err := flags.Parse(argv); err != nil {
+		compiler.Eprintf("blang", "%s\n", err)
+		return 1
+	}
+	if showHelp {
+		fmt.Fprintln(os.Stderr, "Usage: blang cov [options] file.b...")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Options:")
+		flags.PrintDefaults()
+		return 0
+	}
+	if flags.NArg() == 0 {
+		compiler.Eprintf("blang", "no input files\n")
+		return 1
+	}
+	if format != "text" && format != "lcov" {
+		compiler.Eprintf("blang", "unknown report format '%s'\n", format)
+		return 1
+	}
+
+	var buf bytes.Buffer
+	var files []*compiler.FileCoverage
+	for _, file := range flags.Args() {
+		fc, err := compiler.LoadCoverage(file)
+		if err != nil {
+			compiler.Eprintf("blang", "%s\n", err)
+			return 1
+		}
+		if fc.Stale > 0 {
+			compiler.Eprintf("blang", "%s: ignored %d run(s) of another version of the source\n", file, fc.Stale)
+		}
+		if format == "text" {
+			src, err := os.ReadFile(file)
+			if err != nil {
+				compiler.Eprintf("blang", "%s\n", err)
+				return 1
+			}
+			fc.WriteListing(&buf, src)
+		}
+		files = append(files, fc)
+	}
+	if format == "lcov" {
+		compiler.WriteLcov(&buf, files)
+	}
+	if output == "" {
+		os.Stdout.Write(buf.Bytes())
+		return 0
+	}
+	if err := os.WriteFile(output, buf.Bytes(), 0644); err != nil {
+		compiler.Eprintf("blang", "%s\n", err)
+		return 1
+	}
+	return 0
+}
+
+// profCommand implements 'blang prof': the flat profile and the call
+// graph of a program compiled with -p, from the file it wrote on exit
+func profCommand(argv []string) int {
+	var output string
+	var flat, graph, showHelp bool
+
+	flags := pflag.NewFlagSet("blang prof", pflag.ContinueOnError)
+	flags.BoolVar(&flat, "flat", false, "Print only the flat profile")
+	flags.BoolVar(&graph, "graph", false, "Print only the call graph")
+	flags.StringVarP(&output, "output", "o", "", "Write the report to <file> instead of stdout")
+	flags.BoolVarP(&showHelp, "help", "h", false, "Display this information")
+	flags.Usage = func() {}
+	if err := flags.Parse(argv); err != nil {
+		compiler.Eprintf("blang", "%s\n", err)
+		return 1
+	}
+	if showHelp {
+		fmt.Fprintln(os.Stderr, "Usage: blang prof [options] [bmon.out]")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Options:")
+		flags.PrintDefaults()
+		return 0
+	}
+	if flags.NArg() > 1 {
+		compiler.Eprintf("blang", "too many profiles\n")
+		return 1
+	}
+	file := compiler.ProfileFile
+	if flags.NArg() == 1 {
+		file = flags.Arg(0)
+	}
+	if !flat && !graph {
+		flat, graph = true, true
+	}
+
+	in, err := os.Open(file)
+	if err != nil {
+		compiler.Eprintf("blang", "%s\n", err)
+		return 1
+	}
+	p, err := compiler.ReadProfile(in)
+	in.Close()
+	if err != nil {
+		compiler.Eprintf("blang", "%s: %s\n", file, err)
+		return 1
+	}
+
+	var buf bytes.Buffer
+	if flat {
+		p.WriteFlat(&buf)
+	}
+	if flat && graph {
+		buf.WriteString("\n")
+	}
+	if graph {
+		p.WriteCallGraph(&buf)
+	}
+	if output == "" {
+		os.Stdout.Write(buf.Bytes())
+		return 0
+	}
+	if err := os.WriteFile(output, buf.Bytes(), 0644); err != nil {
+		compiler.Eprintf("blang", "%s\n", err)
+		return 1
+	}
+	return 0
+}
+
 func main() {
+	// Subcommands precede any options
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "run":
+			os.Exit(runCommand(os.Args[2:]))
+		case "repl":
+			os.Exit(replCommand(os.Args[2:]))
+		case "fmt":
+			os.Exit(fmtCommand(os.Args[2:]))
+		case "lsp":
+			os.Exit(lspCommand(os.Args[2:]))
+		case "xref":
+			os.Exit(xrefCommand(os.Args[2:]))
+		case "cov":
+			os.Exit(covCommand(os.Args[2:]))
+		case "prof":
+			os.Exit(profCommand(os.Args[2:]))
+		}
+	}
+
 	var output string
 	var saveTemps bool
+	var noCache bool
+	var coverage bool
+	var profile bool
 	var showVersion bool
 	var showHelp bool
 
@@ -51,15 +531,20 @@ func main() {
 	var optimize string
 	var debugInfo bool
 	var verbose bool
+	var codegen []string
+	var target string
 
 	// Path flags
 	var libraryDirs []string
 	var libraries []string
+	var sysroot string
 
 	// Output control
 	pflag.StringVarP(&output, "output", "o", "", "Place the output into <file>")
 	pflag.BoolVar(&saveTemps, "save-temps", false, "Do not delete intermediate files")
+	pflag.BoolVar(&noCache, "no-cache", false, "Compile every source, without the build cache")
 	pflag.BoolVar(&emitLLVM, "emit-llvm", false, "Emit LLVM IR instead of executable")
+	pflag.BoolVar(&coverage, "coverage", false, "Count line executions into <file>.cov, for 'blang cov'")
 
 	// Compilation stages
 	pflag.BoolVarP(&compileOnly, "compile", "c", false, "Compile and assemble, but do not link")
@@ -68,11 +553,15 @@ func main() {
 	// Optimization and debugging
 	pflag.StringVarP(&optimize, "optimize", "O", "0", "Optimization level (0-3)")
 	pflag.BoolVarP(&debugInfo, "debug", "g", false, "Generate debug information")
+	pflag.BoolVarP(&profile, "profile", "p", false, "Profile the calls of functions into bmon.out, for 'blang prof'")
 	pflag.BoolVarP(&verbose, "verbose", "v", false, "Verbose output")
+	pflag.StringVar(&target, "target", "", "Generate code for the given machine: pdp11, wasm32-wasi, <arch>-linux-gnu")
+	pflag.StringArrayVarP(&codegen, "codegen", "f", []string{}, "Code generation option: backend=llvm|native, bounds-check, sanitize=address,undefined, stack-check, trapv, wrapv")
 
 	// Paths and libraries
 	pflag.StringSliceVarP(&libraryDirs, "library-dir", "L", []string{}, "Add directory to library search path")
 	pflag.StringSliceVarP(&libraries, "library", "l", []string{}, "Link with library")
+	pflag.StringVar(&sysroot, "sysroot", "", "Root directory of the target system, passed to clang")
 
 	// Help and version
 	pflag.BoolVarP(&showVersion, "version", "V", false, "Display compiler version information")
@@ -103,20 +592,20 @@ func main() {
 	}
 
 	if len(files) == 0 {
-		Eprintf("blang", "no input files\ncompilation terminated.\n")
+		compiler.Eprintf("blang", "no input files\ncompilation terminated.\n")
 		os.Exit(1)
 	}
 
 	// Determine output type based on flags
-	var outputType OutputType
+	var outputType compiler.OutputType
 	if assemblyOnly {
-		outputType = OutputAssembly
+		outputType = compiler.OutputAssembly
 	} else if compileOnly {
-		outputType = OutputObject
+		outputType = compiler.OutputObject
 	} else if emitLLVM {
-		outputType = OutputIR
+		outputType = compiler.OutputIR
 	} else {
-		outputType = OutputExecutable
+		outputType = compiler.OutputExecutable
 	}
 
 	// Parse optimization level
@@ -127,33 +616,73 @@ func main() {
 		case "1", "2", "3":
 			optLevel = int(optimize[0] - '0')
 		default:
-			Eprintf("blang", "invalid optimization level: %s\n", optimize)
+			compiler.Eprintf("blang", "invalid optimization level: %s\n", optimize)
 			os.Exit(1)
 		}
 	}
 
+	// Parse code generation options
+	backend := compiler.BackendLLVM
+	boundsCheck := false
+	stackCheck := false
+	arith := compiler.ArithUndefined
+	var sanitize []string
+	for _, opt := range codegen {
+		name, value, _ := strings.Cut(opt, "=")
+		switch name {
+		case "bounds-check":
+			boundsCheck = true
+		case "stack-check":
+			stackCheck = true
+		case "trapv":
+			arith = compiler.ArithTrap
+		case "wrapv":
+			arith = compiler.ArithWrap
+		case "sanitize":
+			for _, s := range strings.Split(value, ",") {
+				if s != "address" && s != "undefined" {
+					compiler.Eprintf("blang", "unknown sanitizer '%s'; expected 'address' or 'undefined'\n", s)
+					os.Exit(1)
+				}
+				if !slices.Contains(sanitize, s) {
+					sanitize = append(sanitize, s)
+				}
+			}
+		case "backend":
+			switch value {
+			case "llvm":
+				backend = compiler.BackendLLVM
+			case "native":
+				backend = compiler.BackendNative
+			default:
+				compiler.Eprintf("blang", "unknown backend '%s'; expected 'llvm' or 'native'\n", value)
+				os.Exit(1)
+			}
+		default:
+			compiler.Eprintf("blang", "unknown option '-f%s'\n", opt)
+			os.Exit(1)
+		}
+	}
+
+	if target != "" && !slices.Contains(compiler.Targets(), target) {
+		compiler.Eprintf("blang", "unknown target '%s'; expected one of %s\n", target, strings.Join(compiler.Targets(), ", "))
+		os.Exit(1)
+	}
+
 	// Validate input file extensions
 	allowedExt := map[string]bool{".b": true, ".ll": true, ".s": true, ".o": true, ".a": true}
 	for _, file := range files {
 		ext := filepath.Ext(file)
 		if !allowedExt[ext] {
-			Eprintf("blang", "unsupported input file extension for '%s'; allowed: .b, .ll, .s, .o, .a\n", file)
+			compiler.Eprintf("blang", "unsupported input file extension for '%s'; allowed: .b, .ll, .s, .o, .a\n", file)
 			os.Exit(1)
 		}
 		if _, err := os.Stat(file); err != nil {
-			Eprintf("blang", "cannot access file '%s': %v\n", file, err)
+			compiler.Eprintf("blang", "cannot access file '%s': %v\n", file, err)
 			os.Exit(1)
 		}
 	}
 
-	// Create compiler args
-	args := NewCompileOptions("blang", files)
-	args.SaveTemps = saveTemps
-	args.OutputType = outputType
-	args.Optimize = optLevel
-	args.DebugInfo = debugInfo
-	args.Verbose = verbose
-
 	// Helper: append path if it exists and is a directory
 	addIfDir := func(dst *[]string, p string) {
 		if fi, err := os.Stat(p); err == nil && fi.IsDir() {
@@ -171,18 +700,52 @@ func main() {
 	addIfDir(&defaults, "/usr/local/lib")
 	addIfDir(&defaults, "/usr/lib")
 
-	// Set library directories: defaults first, then user-specified
-	args.LibraryDirs = append(defaults, libraryDirs...)
-
-	// Set libraries
-	args.Libraries = libraries
-
-	// Set output file when -o provided; otherwise leave empty
-	args.OutputFile = output
+	// Create compiler args; library directories are the defaults first,
+	// then user-specified, and the output file is set only by -o
+	opts := []compiler.Option{
+		compiler.WithOutput(output),
+		compiler.WithOutputType(outputType),
+		compiler.WithOptimize(optLevel),
+		compiler.WithBackend(backend),
+		compiler.WithTarget(target),
+		compiler.WithSysroot(sysroot),
+		compiler.WithLibraryDirs(append(defaults, libraryDirs...)...),
+		compiler.WithLibraries(libraries...),
+	}
+	if saveTemps {
+		opts = append(opts, compiler.WithSaveTemps())
+	}
+	if !noCache {
+		opts = append(opts, compiler.WithCache())
+	}
+	if debugInfo {
+		opts = append(opts, compiler.WithDebugInfo())
+	}
+	if verbose {
+		opts = append(opts, compiler.WithVerbose())
+	}
+	if boundsCheck {
+		opts = append(opts, compiler.WithBoundsCheck())
+	}
+	if stackCheck {
+		opts = append(opts, compiler.WithStackCheck())
+	}
+	if len(sanitize) > 0 {
+		opts = append(opts, compiler.WithSanitize(sanitize...))
+	}
+	if coverage {
+		opts = append(opts, compiler.WithCoverage())
+	}
+	if profile {
+		opts = append(opts, compiler.WithProfile())
+	}
+	if arith != compiler.ArithUndefined {
+		opts = append(opts, compiler.WithArith(arith))
+	}
 
 	// Compile
-	if err := Compile(args); err != nil {
-		Eprintf("blang", "%s\n", err)
+	if err := compiler.Compile(compiler.NewOptions(files, opts...)); err != nil {
+		compiler.Eprintf("blang", "%s\n", err)
 		os.Exit(1)
 	}
 }
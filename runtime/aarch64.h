@@ -24,3 +24,44 @@ static inline long syscall(long n, long a1, long a2, long a3)
 #endif
     return x0;
 }
+
+//
+// Syscall wrapper with six arguments, as needed for mmap()
+//
+static inline long syscall6(long n, long a1, long a2, long a3, long a4, long a5, long a6)
+{
+    register long x0 asm("x0") = a1;
+    register long x1 asm("x1") = a2;
+    register long x2 asm("x2") = a3;
+    register long x3 asm("x3") = a4;
+    register long x4 asm("x4") = a5;
+    register long x5 asm("x5") = a6;
+
+#ifdef linux
+    register long x8 asm("x8") = n;
+    asm volatile("svc #0"
+                 : "+r"(x0)
+                 : "r"(x1), "r"(x2), "r"(x3), "r"(x4), "r"(x5), "r"(x8)
+                 : "memory");
+#endif
+
+#ifdef __APPLE__
+    register long x16 asm("x16") = n;
+    asm volatile("svc #0x80"
+                 : "+r"(x0)
+                 : "r"(x1), "r"(x2), "r"(x3), "r"(x4), "r"(x5), "r"(x16)
+                 : "memory");
+#endif
+    return x0;
+}
+
+//
+// Virtual counter of the generic timer, read by profiled programs
+//
+static inline long ticks(void)
+{
+    long t;
+
+    asm volatile("mrs %0, cntvct_el0" : "=r"(t));
+    return t;
+}
@@ -0,0 +1,26 @@
+#include "runtime.h"
+
+//
+// The decimal number at the beginning of the string s is
+// converted and returned.  Leading blanks and tabs are
+// skipped, and an optional sign is accepted.  Conversion
+// stops at the first character which is not a digit.
+//
+word_t b_atoi(word_t s, ...)
+{
+    const char *p  = (const char *)s;
+    uword_t value = 0;
+    int negative    = 0;
+
+    while (*p == ' ' || *p == '\t') {
+        p++;
+    }
+    if (*p == '-' || *p == '+') {
+        negative = (*p == '-');
+        p++;
+    }
+    while (*p >= '0' && *p <= '9') {
+        value = value * 10 + (*p++ - '0');
+    }
+    return negative ? -(word_t)value : (word_t)value;
+}
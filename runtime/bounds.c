@@ -0,0 +1,26 @@
+#include "runtime.h"
+
+//
+// Called by code compiled with -fbounds-check when a vector is indexed
+// out of its range. The position in the source, the function, the name
+// of the vector, the index and the size are reported on the standard
+// error, then the program stops on a trap, so that a debugger or a core
+// dump shows the failing access.
+//
+word_t b_bounds(word_t where, /*word_t func, word_t name, word_t index, word_t size,*/ ...)
+{
+    va_list ap;
+    word_t func, name, index, size;
+
+    va_start(ap, where);
+    func  = va_arg(ap, word_t);
+    name  = va_arg(ap, word_t);
+    index = va_arg(ap, word_t);
+    size  = va_arg(ap, word_t);
+    va_end(ap);
+
+    b_fout = 1;
+    b_printf((word_t) "%s: in %s(): index %d out of range of vector %s[%d]\n",
+             where, func, index, name, size);
+    __builtin_trap();
+}
@@ -0,0 +1,23 @@
+#include "runtime.h"
+
+//
+// The strings s1 and s2 are compared character by character.
+// The result is negative, zero or positive when s1 is less than,
+// equal to or greater than s2 in lexical order.
+//
+word_t b_compare(word_t s1, /*word_t s2,*/ ...)
+{
+    va_list ap;
+    va_start(ap, s1);
+    word_t s2 = va_arg(ap, word_t);
+    va_end(ap);
+
+    const unsigned char *p = (const unsigned char *)s1;
+    const unsigned char *q = (const unsigned char *)s2;
+
+    while (*p != '\0' && *p == *q) {
+        p++;
+        q++;
+    }
+    return (word_t)*p - (word_t)*q;
+}
@@ -0,0 +1,31 @@
+#include "runtime.h"
+
+//
+// The strings s1 and s2 are concatenated and stored in
+// the string a.  The address of a is returned.  The
+// destination may be the same string as s1.
+//
+word_t b_concat(word_t a, /*word_t s1, word_t s2,*/ ...)
+{
+    va_list ap;
+    va_start(ap, a);
+    word_t s1 = va_arg(ap, word_t);
+    word_t s2 = va_arg(ap, word_t);
+    va_end(ap);
+
+    char *dst        = (char *)a;
+    const char *src1 = (const char *)s1;
+    const char *src2 = (const char *)s2;
+    word_t n         = b_length(s1);
+
+    if (dst != src1) {
+        word_t i;
+        for (i = 0; i < n; i++) {
+            dst[i] = src1[i];
+        }
+    }
+    dst += n;
+    while ((*dst++ = *src2++) != '\0')
+        ;
+    return a;
+}
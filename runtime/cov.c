@@ -0,0 +1,68 @@
+#include "runtime.h"
+#ifndef __wasm__
+#include <fcntl.h>
+
+//
+// Descriptors of the files compiled with --coverage, registered by
+// the first of their functions to run, and linked by their first word;
+// the last one has 1 there. A descriptor holds:
+//
+//  d[0]  next descriptor, 0 until registered
+//  d[1]  name of the file of counts
+//  d[2]  stamp of the layout of the counters
+//  d[3]  number of counters
+//  d[4]  address of the counters
+//
+static word_t *registered = (word_t *)1;
+
+//
+// Append a line with the stamp, the number and the counters to the
+// file of counts of every registered file. Called at exit.
+//
+static word_t b_cov_write(word_t unused, ...)
+{
+    word_t *d, *count, fd, i, fout = b_fout;
+
+    for (d = registered; d != (word_t *)1; d = (word_t *)d[0]) {
+#ifdef SYS_open
+        fd = syscall(SYS_open, d[1], O_WRONLY | O_CREAT | O_APPEND, 0644);
+#else
+        fd = syscall6(SYS_openat, AT_FDCWD, d[1], O_WRONLY | O_CREAT | O_APPEND, 0644, 0, 0);
+#endif
+        if (fd < 0) {
+            b_fout = 1;
+            b_printf((word_t) "cannot write coverage counts to %s\n", d[1]);
+            continue;
+        }
+        b_fout = fd - 1;
+        b_printf((word_t) "%d %d", d[2], d[3]);
+        count = (word_t *)d[4];
+        for (i = 0; i < d[3]; i++) {
+            b_printf((word_t) " %d", count[i]);
+        }
+        b_printf((word_t) "\n");
+        syscall(SYS_close, fd, 0, 0);
+    }
+    b_fout = fout;
+    return 0;
+}
+
+//
+// Called on entry to every function compiled with --coverage, with the
+// descriptor of its file. The counts are written at exit.
+//
+word_t b_cov(word_t desc, ...)
+{
+    word_t *d = (word_t *)desc;
+
+    if (d[0] != 0) {
+        return 0;
+    }
+    if (registered == (word_t *)1) {
+        b_atexit((word_t)b_cov_write);
+    }
+    d[0]       = (word_t)registered;
+    registered = d;
+    return 0;
+}
+#endif
@@ -1,9 +1,52 @@
 #include "runtime.h"
 
 //
-// The current process is terminated.
+// Maximal number of termination handlers.
 //
-void b_exit()
+#define NHANDLERS 32
+
+static word_t handlers[NHANDLERS];
+static word_t nhandlers;
+
+#ifdef HOSTED
+void exit(int status) __attribute__((noreturn));
+#endif
+
+//
+// Function f, given by its address, is registered to be called
+// without arguments, that is with a zero word, when the process
+// terminates, either by return from main() or by exit(). Handlers
+// run in reverse order of their registration. Zero is returned on
+// success, -1 when too many handlers are registered.
+//
+word_t b_atexit(word_t f, ...)
+{
+    if (nhandlers >= NHANDLERS) {
+        return -1;
+    }
+    handlers[nhandlers++] = f;
+    return 0;
+}
+
+//
+// The current process is terminated with the given exit status.
+// Registered termination handlers are called first; a handler
+// may itself call exit(), in which case the remaining handlers
+// still run and the latest status wins. A hosted program exits
+// through the C library, where the sanitizers make their reports.
+//
+word_t b_exit(word_t status, ...)
 {
-    syscall(SYS_exit, 0, 0, 0);
+    while (nhandlers > 0) {
+        word_t (*f)(word_t, ...) = (word_t (*)(word_t, ...))handlers[--nhandlers];
+        b_nargs = 0;
+        f(0);
+    }
+#ifdef HOSTED
+    exit((int)status);
+#else
+    syscall(SYS_exit, status, 0, 0);
+    for (;;)
+        ;
+#endif
 }
@@ -1,6 +1,7 @@
 #include "runtime.h"
 
-void b_flush()
+word_t b_flush(word_t unused, ...)
 {
     // Empty.
+    return 0;
 }
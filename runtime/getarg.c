@@ -0,0 +1,40 @@
+#include "runtime.h"
+
+//
+// The i-th argument (counting from zero) of the string line is
+// copied to the string s.  Arguments are separated by blanks
+// and tabs.  The address of s is returned, or zero when line
+// has no more than i arguments.
+//
+word_t b_getarg(word_t s, /*word_t line, word_t i,*/ ...)
+{
+    va_list ap;
+    va_start(ap, s);
+    word_t line = va_arg(ap, word_t);
+    word_t i    = va_arg(ap, word_t);
+    va_end(ap);
+
+    const char *p = (const char *)line;
+    char *dst     = (char *)s;
+
+    for (;;) {
+        while (*p == ' ' || *p == '\t') {
+            p++;
+        }
+        if (*p == '\0') {
+            *dst = '\0';
+            return 0;
+        }
+        if (i-- == 0) {
+            break;
+        }
+        while (*p != '\0' && *p != ' ' && *p != '\t') {
+            p++;
+        }
+    }
+    while (*p != '\0' && *p != ' ' && *p != '\t') {
+        *dst++ = *p++;
+    }
+    *dst = '\0';
+    return s;
+}
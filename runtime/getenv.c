@@ -0,0 +1,26 @@
+#include "runtime.h"
+
+//
+// The value of the environment variable with the given name
+// is returned as a string, or zero when it is not defined.
+//
+word_t b_getenv(word_t name, ...)
+{
+    const char *key = (const char *)name;
+    word_t *env;
+
+    if (b_environ == 0) {
+        return 0;
+    }
+    for (env = b_environ; *env != 0; env++) {
+        const char *p = (const char *)*env;
+        word_t i;
+
+        for (i = 0; key[i] != '\0' && key[i] == p[i]; i++)
+            ;
+        if (key[i] == '\0' && p[i] == '=') {
+            return (word_t)&p[i + 1];
+        }
+    }
+    return 0;
+}
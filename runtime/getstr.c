@@ -0,0 +1,28 @@
+#include "runtime.h"
+
+//
+// The next line is read from the standard input file into
+// the string s, without the newline.  The address of s is
+// returned, or zero when the end of file is reached before
+// any character is read.
+//
+word_t b_getstr(word_t s, ...)
+{
+    char *dst = (char *)s;
+    word_t n  = 0;
+    word_t c;
+
+    while ((c = b_read(0)) != '\n') {
+        if (c == 4) {
+            // End of file.
+            if (n == 0) {
+                dst[0] = '\0';
+                return 0;
+            }
+            break;
+        }
+        dst[n++] = c;
+    }
+    dst[n] = '\0';
+    return s;
+}
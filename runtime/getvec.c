@@ -0,0 +1,122 @@
+#include "runtime.h"
+
+#ifdef HOSTED
+void *calloc(__SIZE_TYPE__ nmemb, __SIZE_TYPE__ size);
+
+//
+// A program built with -fsanitize takes its vectors from the C
+// library, so that the address sanitizer puts redzones around each
+// of them and reports accesses past their ends, or after rlsevec().
+//
+word_t b_getvec(word_t n, ...)
+{
+    if (n < 0) {
+        return 0;
+    }
+    return (word_t)calloc(n + 1, sizeof(word_t));
+}
+#else
+//
+// Each block handed out by getvec() is preceded by a header word
+// holding the number of data words in the block.  Released blocks
+// are kept on a singly linked free list, threaded through the first
+// data word, and are reused on a first-fit basis.
+//
+word_t *b_freelist;
+
+//
+// Memory obtained from sbrk() but not yet carved into blocks.
+//
+static word_t *arena_next;
+static word_t *arena_end;
+
+//
+// Minimal number of words requested from the system at once.
+//
+#define ARENA_CHUNK 8192
+
+//
+// Take a block of nwords data words from the free list, splitting
+// off the unused tail when it is large enough to form a block itself.
+//
+static word_t *take_free(word_t nwords)
+{
+    word_t **link = &b_freelist;
+    word_t *p;
+
+    for (p = *link; p != 0; link = (word_t **)&p[1], p = *link) {
+        if (p[0] < nwords) {
+            continue;
+        }
+        if (p[0] >= nwords + 2) {
+            word_t *tail = p + 1 + nwords;
+            tail[0]      = p[0] - nwords - 1;
+            tail[1]      = p[1];
+            *link        = tail;
+            p[0]         = nwords;
+        } else {
+            *link = (word_t *)p[1];
+        }
+        return p;
+    }
+    return 0;
+}
+
+//
+// Carve a block of nwords data words from the arena,
+// extending it with sbrk() when needed.
+//
+static word_t *take_arena(word_t nwords)
+{
+    word_t need = nwords + 1;
+    word_t *p;
+
+    if (arena_end - arena_next < need) {
+        word_t chunk = need > ARENA_CHUNK ? need : ARENA_CHUNK;
+        word_t addr  = b_sbrk(chunk * sizeof(word_t));
+
+        if (addr == -1) {
+            return 0;
+        }
+        if ((word_t *)addr != arena_end && arena_end - arena_next >= 2) {
+            // The new memory is not contiguous: keep the leftover.
+            arena_next[0] = arena_end - arena_next - 1;
+            b_rlsevec((word_t)&arena_next[1], arena_next[0] - 1);
+        }
+        if ((word_t *)addr != arena_end) {
+            arena_next = (word_t *)addr;
+        }
+        arena_end = (word_t *)addr + chunk;
+    }
+    p          = arena_next;
+    arena_next = p + need;
+    p[0]       = nwords;
+    return p;
+}
+
+//
+// A vector of n+1 words, v[0] through v[n], is allocated
+// and returned.  All words are set to zero.  Zero is returned
+// when no memory is available.
+//
+word_t b_getvec(word_t n, ...)
+{
+    word_t nwords = n + 1;
+    word_t *p, i;
+
+    if (n < 0) {
+        return 0;
+    }
+    p = take_free(nwords);
+    if (p == 0) {
+        p = take_arena(nwords);
+        if (p == 0) {
+            return 0;
+        }
+    }
+    for (i = 1; i <= p[0]; i++) {
+        p[i] = 0;
+    }
+    return (word_t)&p[1];
+}
+#endif
@@ -0,0 +1,41 @@
+#include "runtime.h"
+
+//
+// The number n is converted to a string of digits in the
+// given base (2 to 16, 10 when out of range) and stored in
+// the string s.  Negative numbers get a minus sign
+// in base 10 and are treated as unsigned in other bases.
+// The address of s is returned.
+//
+word_t b_itoa(word_t n, /*word_t s, word_t base,*/ ...)
+{
+    va_list ap;
+    va_start(ap, n);
+    word_t s    = va_arg(ap, word_t);
+    word_t base = va_arg(ap, word_t);
+    va_end(ap);
+
+    char buf[sizeof(word_t) * 8];
+    char *end       = buf + sizeof(buf);
+    char *p         = end;
+    char *dst       = (char *)s;
+    uword_t value = (uword_t)n;
+
+    if (base < 2 || base > 16) {
+        base = 10;
+    }
+    if (base == 10 && n < 0) {
+        value  = 1 + ~value; // avoid overflow on MIN
+        *dst++ = '-';
+    }
+    do {
+        *--p = "0123456789abcdef"[value % base];
+        value /= base;
+    } while (value != 0);
+
+    while (p < end) {
+        *dst++ = *p++;
+    }
+    *dst = '\0';
+    return s;
+}
@@ -3,7 +3,7 @@
 //
 // The character char is stored in the i-th character of the string.
 //
-void b_lchar(word_t string, /*word_t i, word_t chr,*/ ...)
+word_t b_lchar(word_t string, /*word_t i, word_t chr,*/ ...)
 {
     va_list ap;
     va_start(ap, string);
@@ -12,4 +12,5 @@ void b_lchar(word_t string, /*word_t i, word_t chr,*/ ...)
     va_end(ap);
 
     ((char *)string)[i] = chr;
+    return 0;
 }
@@ -0,0 +1,16 @@
+#include "runtime.h"
+
+//
+// The number of characters in the string, up to the
+// terminating '*e', is returned.
+//
+word_t b_length(word_t string, ...)
+{
+    const char *s = (const char *)string;
+    word_t n      = 0;
+
+    while (s[n] != '\0') {
+        n++;
+    }
+    return n;
+}
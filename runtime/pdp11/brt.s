@@ -0,0 +1,454 @@
+/ B runtime for the PDP-11 target of blang.
+/
+/ Compiled functions are threaded code: a list of addresses of the
+/ routines below, each followed by its operands. Register r3 points
+/ to the next word of the list, r4 to the frame of the function, and
+/ operands are kept on the stack. Every routine ends with 'jmp *(r3)+'.
+/
+/ A function starts with 'jsr r3,b.entry' and the size of its frame.
+/ Functions are called as in C: arguments on the stack, the first one
+/ lowest, and the result in r0. Library routines written in assembly
+/ follow the same convention and may clobber r0 and r1 only.
+/
+/ Requires the EIS instructions (PDP-11/40 and later).
+
+.globl	_main, _argv, _fout
+.globl	b.entry, b.ret, b.call, b.drop
+.globl	b.lv, b.sv, b.la, b.lc, b.ld, b.ldb, b.st, b.stb
+.globl	b.add, b.sub, b.mul, b.div, b.mod, b.udiv, b.urem
+.globl	b.and, b.or, b.xor, b.shl, b.shr, b.ushr
+.globl	b.eq, b.ne, b.lt, b.le, b.gt, b.ge, b.ult, b.ule, b.ugt, b.uge
+.globl	b.sel, b.br, b.bz, b.swit, b.vast, b.vaarg, b.alloc
+.globl	_exit, _write, _read, _nwrite, _nread, _char, _lchar, _flush
+
+.text
+
+/ Program startup: the stack holds the argument count followed by
+/ pointers to the arguments, which is the argument vector of B.
+start:
+	mov	sp,r0
+	mov	r0,_argv
+	mov	r0,-(sp)
+	jsr	pc,_main
+	mov	r0,(sp)
+	jsr	pc,_exit
+
+/ Function entry, with r3 pointing to the frame size
+b.entry:
+	mov	r4,-(sp)
+	mov	sp,r4
+	sub	(r3)+,sp
+	jmp	*(r3)+
+
+/ Return the value on the stack
+b.ret:
+	mov	(sp)+,r0
+	mov	r4,sp
+	mov	(sp)+,r4
+	mov	(sp)+,r3
+	rts	pc
+
+/ Call the function on the stack; the operand is the number of
+/ arguments below it, which are replaced by the result
+b.call:
+	mov	(sp)+,r0
+	jsr	pc,(r0)
+	mov	(r3)+,r1
+	asl	r1
+	add	r1,sp
+	mov	r0,-(sp)
+	jmp	*(r3)+
+
+b.drop:
+	tst	(sp)+
+	jmp	*(r3)+
+
+/ Load and store a word of the frame, at the offset given by the operand
+b.lv:
+	mov	(r3)+,r0
+	add	r4,r0
+	mov	(r0),-(sp)
+	jmp	*(r3)+
+
+b.sv:
+	mov	(r3)+,r0
+	add	r4,r0
+	mov	(sp)+,(r0)
+	jmp	*(r3)+
+
+/ Address of a word of the frame
+b.la:
+	mov	(r3)+,r0
+	add	r4,r0
+	mov	r0,-(sp)
+	jmp	*(r3)+
+
+/ Constant
+b.lc:
+	mov	(r3)+,-(sp)
+	jmp	*(r3)+
+
+/ Load through the pointer on the stack
+b.ld:
+	mov	(sp),r0
+	mov	(r0),(sp)
+	jmp	*(r3)+
+
+b.ldb:
+	mov	(sp),r0
+	movb	(r0),r0
+	bic	$177400,r0
+	mov	r0,(sp)
+	jmp	*(r3)+
+
+/ Store the value below the pointer on the stack
+b.st:
+	mov	(sp)+,r0
+	mov	(sp)+,(r0)
+	jmp	*(r3)+
+
+b.stb:
+	mov	(sp)+,r0
+	movb	(sp)+,(r0)
+	jmp	*(r3)+
+
+/ Binary operations: the right operand is on top of the left one
+b.add:
+	add	(sp)+,(sp)
+	jmp	*(r3)+
+
+b.sub:
+	sub	(sp)+,(sp)
+	jmp	*(r3)+
+
+b.mul:
+	mov	(sp)+,r1
+	mul	(sp),r1
+	mov	r1,(sp)
+	jmp	*(r3)+
+
+b.div:
+	mov	2(sp),r1
+	sxt	r0
+	div	(sp)+,r0
+	mov	r0,(sp)
+	jmp	*(r3)+
+
+b.mod:
+	mov	2(sp),r1
+	sxt	r0
+	div	(sp)+,r0
+	mov	r1,(sp)
+	jmp	*(r3)+
+
+b.udiv:
+	jsr	pc,udiv
+	tst	(sp)+
+	mov	r1,(sp)
+	jmp	*(r3)+
+
+b.urem:
+	jsr	pc,udiv
+	tst	(sp)+
+	mov	r0,(sp)
+	jmp	*(r3)+
+
+/ Unsigned division of 4(sp) by 2(sp), shift and subtract;
+/ the quotient goes to r1, the remainder to r0
+udiv:
+	mov	$16.,-(sp)
+	mov	6(sp),r1
+	clr	r0
+1:
+	asl	r1
+	rol	r0
+	bcs	2f
+	cmp	r0,4(sp)
+	blo	3f
+2:
+	sub	4(sp),r0
+	inc	r1
+3:
+	dec	(sp)
+	bne	1b
+	tst	(sp)+
+	rts	pc
+
+b.and:
+	mov	(sp)+,r0
+	com	r0
+	bic	r0,(sp)
+	jmp	*(r3)+
+
+b.or:
+	bis	(sp)+,(sp)
+	jmp	*(r3)+
+
+b.xor:
+	mov	(sp)+,r0
+	xor	r0,(sp)
+	jmp	*(r3)+
+
+b.shl:
+	mov	(sp)+,r0
+	mov	(sp),r1
+	ash	r0,r1
+	mov	r1,(sp)
+	jmp	*(r3)+
+
+b.shr:
+	mov	(sp)+,r0
+	neg	r0
+	mov	(sp),r1
+	ash	r0,r1
+	mov	r1,(sp)
+	jmp	*(r3)+
+
+/ Logical shift right: one bit with ror, the rest with ash
+b.ushr:
+	mov	(sp)+,r0
+	mov	(sp),r1
+	tst	r0
+	beq	1f
+	clc
+	ror	r1
+	dec	r0
+	neg	r0
+	ash	r0,r1
+1:
+	mov	r1,(sp)
+	jmp	*(r3)+
+
+/ Comparisons leave 1 or 0
+b.eq:
+	mov	(sp)+,r0
+	cmp	(sp),r0
+	beq	true
+	br	false
+
+b.ne:
+	mov	(sp)+,r0
+	cmp	(sp),r0
+	bne	true
+	br	false
+
+b.lt:
+	mov	(sp)+,r0
+	cmp	(sp),r0
+	blt	true
+	br	false
+
+b.le:
+	mov	(sp)+,r0
+	cmp	(sp),r0
+	ble	true
+	br	false
+
+b.gt:
+	mov	(sp)+,r0
+	cmp	(sp),r0
+	bgt	true
+	br	false
+
+b.ge:
+	mov	(sp)+,r0
+	cmp	(sp),r0
+	bge	true
+	br	false
+
+b.ult:
+	mov	(sp)+,r0
+	cmp	(sp),r0
+	blo	true
+	br	false
+
+b.ule:
+	mov	(sp)+,r0
+	cmp	(sp),r0
+	blos	true
+	br	false
+
+b.ugt:
+	mov	(sp)+,r0
+	cmp	(sp),r0
+	bhi	true
+	br	false
+
+b.uge:
+	mov	(sp)+,r0
+	cmp	(sp),r0
+	bhis	true
+	br	false
+
+true:
+	mov	$1,(sp)
+	jmp	*(r3)+
+
+false:
+	clr	(sp)
+	jmp	*(r3)+
+
+/ Select: condition, value if true, value if false
+b.sel:
+	mov	(sp)+,r0
+	mov	(sp)+,r1
+	tst	(sp)
+	bne	1f
+	mov	r0,(sp)
+	jmp	*(r3)+
+1:
+	mov	r1,(sp)
+	jmp	*(r3)+
+
+/ Branch to the label given by the operand
+b.br:
+	mov	(r3),r3
+	jmp	*(r3)+
+
+/ Branch when the value on the stack is zero
+b.bz:
+	tst	(sp)+
+	bne	1f
+	mov	(r3),r3
+	jmp	*(r3)+
+1:
+	tst	(r3)+
+	jmp	*(r3)+
+
+/ Switch: the operand is the number of value and label pairs which
+/ follow; when no value matches, execution goes on after the table
+b.swit:
+	mov	(sp)+,r0
+	mov	(r3)+,r1
+	beq	2f
+1:
+	cmp	(r3)+,r0
+	beq	3f
+	tst	(r3)+
+	sob	r1,1b
+2:
+	jmp	*(r3)+
+3:
+	mov	(r3),r3
+	jmp	*(r3)+
+
+/ Start a list of arguments after the number of fixed ones given by
+/ the operand; the address of the list pointer is on the stack
+b.vast:
+	mov	(r3)+,r0
+	asl	r0
+	add	r4,r0
+	add	$6,r0
+	mov	(sp)+,r1
+	mov	r0,(r1)
+	jmp	*(r3)+
+
+/ Next argument of the list pointed to by the value on the stack
+b.vaarg:
+	mov	(sp)+,r0
+	mov	(r0),r1
+	add	$2,(r0)
+	mov	(r1),-(sp)
+	jmp	*(r3)+
+
+/ Allocate the number of bytes on the stack, which is replaced
+/ by the address of the block
+b.alloc:
+	mov	(sp)+,r0
+	inc	r0
+	bic	$1,r0
+	sub	r0,sp
+	mov	sp,-(sp)
+	jmp	*(r3)+
+
+/ exit(n): terminate with status n
+_exit:
+	mov	2(sp),r0
+	sys	1
+
+/ write(c): write one or two characters, packed high byte first,
+/ on the standard output, or the error output when fout is 1
+_write:
+	mov	$wbuf,r1
+	movb	3(sp),r0
+	beq	1f
+	movb	r0,(r1)+
+1:
+	movb	2(sp),(r1)+
+	sub	$wbuf,r1
+	mov	r1,wsys+4
+	mov	_fout,r0
+	inc	r0
+	sys	0; wsys
+	clr	r0
+	rts	pc
+
+/ read(): next character of the standard input, '*e' at end of file
+_read:
+	clr	r0
+	sys	0; rsys
+	bcs	1f
+	tst	r0
+	beq	1f
+	movb	rbuf,r0
+	bic	$177400,r0
+	cmp	r0,$177
+	blos	2f
+	clr	r0
+2:
+	rts	pc
+1:
+	mov	$4,r0
+	rts	pc
+
+/ nwrite(fd, buf, n) and nread(fd, buf, n): number of bytes
+/ transferred, or -1 on error
+_nwrite:
+	mov	4(sp),nwsys+2
+	mov	6(sp),nwsys+4
+	mov	2(sp),r0
+	sys	0; nwsys
+	br	1f
+_nread:
+	mov	4(sp),nrsys+2
+	mov	6(sp),nrsys+4
+	mov	2(sp),r0
+	sys	0; nrsys
+1:
+	bcc	2f
+	mov	$-1,r0
+2:
+	rts	pc
+
+/ char(s, i): the i-th character of string s
+_char:
+	mov	2(sp),r0
+	add	4(sp),r0
+	movb	(r0),r0
+	bic	$177400,r0
+	rts	pc
+
+/ lchar(s, i, c): store character c as the i-th one of string s
+_lchar:
+	mov	2(sp),r0
+	add	4(sp),r0
+	movb	6(sp),(r0)
+	mov	6(sp),r0
+	rts	pc
+
+/ flush(): output is not buffered
+_flush:
+	clr	r0
+	rts	pc
+
+.data
+wsys:	sys	4; wbuf; 0
+rsys:	sys	3; rbuf; 1
+nwsys:	sys	4; 0; 0
+nrsys:	sys	3; 0; 0
+_fout:	0
+
+.bss
+_argv:	.=.+2
+wbuf:	.=.+2
+rbuf:	.=.+2
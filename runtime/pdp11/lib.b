@@ -0,0 +1,87 @@
+/*
+ * Library functions of the PDP-11 target written in B, after the
+ * B reference manual. Compile with 'blang --target=pdp11 -S lib.b'.
+ */
+
+/*
+ * Formatted output: %d decimal, %o octal, %c character, %s string
+ * and %% percent sign. At most nine arguments are converted.
+ */
+printf(fmt, x1, x2, x3, x4, x5, x6, x7, x8, x9) {
+    auto adx[9], c, i, j, x;
+
+    adx[0] = x1; adx[1] = x2; adx[2] = x3;
+    adx[3] = x4; adx[4] = x5; adx[5] = x6;
+    adx[6] = x7; adx[7] = x8; adx[8] = x9;
+    i = 0;
+    j = 0;
+loop:
+    while ((c = char(fmt, i++)) != '%') {
+        if (c == '*e')
+            return;
+        write(c);
+    }
+    x = adx[j++];
+    switch (c = char(fmt, i++)) {
+    case 'd':
+        printd(x);
+        goto loop;
+
+    case 'o':
+        printo(x);
+        goto loop;
+
+    case 'c':
+        write(x);
+        goto loop;
+
+    case 's':
+        putstr(x);
+        goto loop;
+
+    case '%':
+        write('%');
+        j--;
+        goto loop;
+    }
+    write('%');
+    i--;
+    j--;
+    goto loop;
+}
+
+/* Print a non-negative number in base b */
+printn(n, b) {
+    auto a;
+
+    if (a = n / b)
+        printn(a, b);
+    write(char("0123456789", n % b));
+}
+
+printd(n) {
+    if (n < 0) {
+        write('-');
+        n = -n;
+    }
+    printn(n, 10);
+}
+
+/* Octal digits of all 16 bits, so negative numbers print unsigned */
+printo(n) {
+    auto a;
+
+    if (a = n >> 3 & 017777)
+        printo(a);
+    write('0' + (n & 7));
+}
+
+/* Write a string; returns s */
+putstr(s) {
+    auto c, i;
+
+    i = 0;
+    while (c = char(s, i++))
+        write(c);
+    return (s);
+}
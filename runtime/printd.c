@@ -3,9 +3,9 @@
 //
 // The following function will print a decimal number, possibly negative.
 //
-void b_printd(word_t n, ...)
+word_t b_printd(word_t n, ...)
 {
-    uintptr_t value = (uintptr_t)n;
+    uword_t value = (uword_t)n;
     int negative = n < 0;
     char buf[2 + sizeof(word_t) * 3];
     char *end = buf + sizeof(buf);
@@ -25,4 +25,5 @@ void b_printd(word_t n, ...)
     }
 
     b_nwrite(b_fout + 1, (word_t)p, (word_t)(end - p));
+    return 0;
 }
@@ -1,63 +1,212 @@
 #include "runtime.h"
 
+//
+// Conversion flags.
+//
+#define LEFT 1 // left-justify within the field
+#define ZERO 2 // pad numbers with zeros instead of blanks
+
+//
+// Write len bytes starting at p.
+//
+static void put(const char *p, word_t len)
+{
+    if (len > 0) {
+        b_nwrite(b_fout + 1, (word_t)p, len);
+    }
+}
+
+//
+// Write n copies of character c.
+//
+static void pad(word_t n, char c)
+{
+    char buf[16];
+    word_t i;
+
+    for (i = 0; i < (word_t)sizeof(buf); i++) {
+        buf[i] = c;
+    }
+    while (n > 0) {
+        word_t len = n < (word_t)sizeof(buf) ? n : (word_t)sizeof(buf);
+        put(buf, len);
+        n -= len;
+    }
+}
+
+//
+// Write a converted field of len bytes after the given number of
+// leading zeros, justified within width. The sign, if any, is written
+// before the zero padding.
+//
+static void field(const char *sign, word_t zeros, const char *p, word_t len, word_t width, int flags)
+{
+    word_t nsign = (sign != 0);
+    word_t gap;
+
+    if (zeros < 0) {
+        zeros = 0;
+    }
+    gap = width - len - nsign - zeros;
+    if (gap > 0 && !(flags & LEFT) && !(flags & ZERO)) {
+        pad(gap, ' ');
+    }
+    put(sign, nsign);
+    if (gap > 0 && !(flags & LEFT) && (flags & ZERO)) {
+        pad(gap, '0');
+    }
+    pad(zeros, '0');
+    put(p, len);
+    if (gap > 0 && (flags & LEFT)) {
+        pad(gap, ' ');
+    }
+}
+
+//
+// Convert an unsigned value to the given base, and write it with at
+// least prec digits. Digits are placed right to left, ending before end;
+// the zeros up to the precision are written by field(), as the precision
+// may exceed the buffer.
+//
+static void number(const char *sign, char *end, uword_t value, unsigned base, word_t prec, word_t width, int flags)
+{
+    char *p = end;
+
+    do {
+        *--p = "0123456789abcdef"[value % base];
+        value /= base;
+    } while (value != 0);
+
+    field(sign, prec - (end - p), p, end - p, width, flags);
+}
+
 //
 // The following function is a general formatting, printing, and
 // conversion subroutine. The first argument is a format string.
-// Character sequences,of the form ‘%x’ are interpreted and cause
-// conversion of type x’ of the next argument, other character
+// Character sequences of the form '%x' are interpreted and cause
+// conversion of type 'x' of the next argument, other character
 // sequences are printed verbatim.
 //
-void b_printf(word_t fmt, ...)
+// A conversion may contain flags '-' (left-justify) and '0' (zero
+// padding), a field width and a precision '.n' between the percent
+// sign and the conversion letter:
+//
+//      %d  decimal             %u  unsigned decimal
+//      %o  unsigned octal      %x  unsigned hexadecimal
+//      %b  unsigned binary     %c  character constant
+//      %s  string              %%  percent sign
+//
+// For strings the precision limits the number of characters printed,
+// for numbers it gives the minimal number of digits. A sequence with
+// an unknown conversion letter is printed verbatim.
+//
+word_t b_printf(word_t fmt, ...)
 {
-    word_t x, c, i = 0, j;
+    char buf[2 + sizeof(word_t) * 8];
+    char *end = buf + sizeof(buf);
+    word_t x, c, i = 0, start, j;
 
     va_list ap;
     va_start(ap, fmt);
-loop:
-    while ((c = b_char(fmt, i++)) != '%') {
-        if (c == '\0')
-            goto end;
-        b_write(c);
-    }
-    switch (c = b_char(fmt, i++)) {
-    case 'd': // decimal
-        x = va_arg(ap, word_t);
-        if (x < 0) {
-            x = -x;
-            b_write('-');
-        }
-        b_printd(x);
-        goto loop;
-
-    case 'o': // octal
-        x = va_arg(ap, word_t);
-        if (x < 0) {
-            x = -x;
-            b_write('-');
-        }
-        b_printo(x);
-        goto loop;
-
-    case 'c':
-        x = va_arg(ap, word_t);
-        b_write(x);
-        goto loop;
-
-    case 's':
-        x = va_arg(ap, word_t);
-        j = 0;
-        while ((c = b_char(x, j++)) != '\0')
-            b_write(c);
-        goto loop;
-    case '%':
-        b_write('%');
-        goto loop;
-    }
-    // Unknown format.
-    b_write('%');
-    i--;
-    goto loop;
-
-end:
+    for (;;) {
+        // Copy text up to the next percent sign.
+        start = i;
+        while ((c = b_char(fmt, i)) != '%' && c != '\0') {
+            i++;
+        }
+        put((char *)fmt + start, i - start);
+        if (c == '\0') {
+            break;
+        }
+
+        // Parse flags, width and precision.
+        start       = i++;
+        int flags   = 0;
+        word_t width = 0;
+        word_t prec  = -1;
+        for (;; i++) {
+            c = b_char(fmt, i);
+            if (c == '-') {
+                flags |= LEFT;
+            } else if (c == '0') {
+                flags |= ZERO;
+            } else {
+                break;
+            }
+        }
+        while ((c = b_char(fmt, i)) >= '0' && c <= '9') {
+            width = width * 10 + c - '0';
+            i++;
+        }
+        if (c == '.') {
+            prec = 0;
+            while ((c = b_char(fmt, ++i)) >= '0' && c <= '9') {
+                prec = prec * 10 + c - '0';
+            }
+        }
+        if (c != '\0') {
+            i++;
+        }
+
+        char *p;
+        switch (c) {
+        case 'd': // decimal
+            x = va_arg(ap, word_t);
+            if (x < 0) {
+                number("-", end, 1 + ~(uword_t)x, 10, prec, width, flags);
+            } else {
+                number(0, end, x, 10, prec, width, flags);
+            }
+            break;
+
+        case 'u': // unsigned decimal
+            number(0, end, va_arg(ap, word_t), 10, prec, width, flags);
+            break;
+
+        case 'o': // unsigned octal
+            number(0, end, va_arg(ap, word_t), 8, prec, width, flags);
+            break;
+
+        case 'x': // unsigned hexadecimal
+            number(0, end, va_arg(ap, word_t), 16, prec, width, flags);
+            break;
+
+        case 'b': // unsigned binary
+            number(0, end, va_arg(ap, word_t), 2, prec, width, flags);
+            break;
+
+        case 'c': // character constant, big-endian packed
+            x = va_arg(ap, word_t);
+            p = end;
+            do {
+                *--p = x & 0xff;
+                x    = (uword_t)x >> 8;
+            } while (x != 0);
+            field(0, 0, p, end - p, width, flags & LEFT);
+            break;
+
+        case 's': // string
+            x = va_arg(ap, word_t);
+            j = 0;
+            while (b_char(x, j) != '\0' && (prec < 0 || j < prec)) {
+                j++;
+            }
+            field(0, 0, (char *)x, j, width, flags & LEFT);
+            break;
+
+        case '%':
+            put("%", 1);
+            break;
+
+        default:
+            // Unknown format: print it verbatim.
+            put((char *)fmt + start, i - start);
+            break;
+        }
+        if (c == '\0') {
+            break;
+        }
+    }
     va_end(ap);
+    return 0;
 }
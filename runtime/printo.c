@@ -4,10 +4,10 @@
 // The following function will print an unsigned number, n,
 // to the base 8.
 //
-void b_printo(word_t n, ...)
+word_t b_printo(word_t n, ...)
 {
-    uintptr_t value = (uintptr_t)n;
-    char buf[(sizeof(uintptr_t) * 8 + 2) / 3];
+    uword_t value = (uword_t)n;
+    char buf[(sizeof(uword_t) * 8 + 2) / 3];
     char *end = buf + sizeof(buf);
     char *p = end;
 
@@ -17,4 +17,5 @@ void b_printo(word_t n, ...)
     } while (value != 0);
 
     b_nwrite(b_fout + 1, (word_t)p, (word_t)(end - p));
+    return 0;
 }
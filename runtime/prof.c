@@ -0,0 +1,209 @@
+#include "runtime.h"
+#ifndef __wasm__
+#include <fcntl.h>
+#include <time.h>
+
+#define NFRAMES 4096 // depth of calls timed
+#define NARCS   1024 // pairs of caller and callee counted
+
+//
+// Records of the functions of programs compiled with -p, registered
+// on their first call and linked by their first word; the last one
+// has 1 there. A record holds:
+//
+//  r[0]  next record, 0 until registered
+//  r[1]  name of the function
+//  r[2]  number of calls
+//  r[3]  ticks spent in the function itself
+//  r[4]  ticks spent in the function and the functions it calls
+//  r[5]  number of its calls in progress
+//
+static word_t *registered = (word_t *)1;
+
+//
+// Calls from a function to another, and those in progress.
+//
+struct arc {
+    word_t *caller, *callee;
+    word_t count, ticks, active;
+};
+static struct arc arcs[NARCS];
+
+//
+// Stack of the calls in progress: the record, the arc of the call,
+// the time of entry and the time spent in the functions it called.
+//
+struct frame {
+    word_t *rec;
+    struct arc *arc;
+    word_t start, child;
+};
+static struct frame stack[NFRAMES];
+static word_t depth;
+
+//
+// Ticks and nanoseconds when profiling started, to find the rate.
+//
+static word_t start_ticks, start_ns;
+
+//
+// Monotonic time in nanoseconds, or 0 when not available.
+//
+static word_t nanoseconds(void)
+{
+#if defined(linux) && defined(SYS_clock_gettime)
+    struct timespec ts;
+
+    if (syscall(SYS_clock_gettime, CLOCK_MONOTONIC, (word_t)&ts, 0) == 0) {
+        return ts.tv_sec * 1000000000 + ts.tv_nsec;
+    }
+#endif
+    return 0;
+}
+
+//
+// The arc from caller to callee, found by hashing their addresses;
+// a null pointer when the table is full.
+//
+static struct arc *find_arc(word_t *caller, word_t *callee)
+{
+    uword_t i = (((uword_t)caller >> 3) * 31 + ((uword_t)callee >> 3)) % NARCS;
+    word_t n;
+
+    for (n = 0; n < NARCS; n++, i = (i + 1) % NARCS) {
+        if (arcs[i].callee == 0) {
+            arcs[i].caller = caller;
+            arcs[i].callee = callee;
+        }
+        if (arcs[i].caller == caller && arcs[i].callee == callee) {
+            return &arcs[i];
+        }
+    }
+    return 0;
+}
+
+//
+// Pop the top of the stack at the given time: the ticks of the call
+// are added to the function and to the arc, unless they are still in
+// progress further down, and to the time of the caller in its callees.
+//
+static void pop(word_t now)
+{
+    struct frame *f;
+    word_t elapsed;
+
+    if (--depth >= NFRAMES) {
+        return;
+    }
+    f       = &stack[depth];
+    elapsed = now - f->start;
+    f->rec[3] += elapsed - f->child;
+    if (--f->rec[5] == 0) {
+        f->rec[4] += elapsed;
+    }
+    if (f->arc && --f->arc->active == 0) {
+        f->arc->ticks += elapsed;
+    }
+    if (depth > 0) {
+        stack[depth - 1].child += elapsed;
+    }
+}
+
+//
+// Write the profile to bmon.out. Called at exit, when the calls
+// still in progress end.
+//
+static word_t b_prof_write(word_t unused, ...)
+{
+    word_t now = ticks(), ns = nanoseconds(), rate = 0;
+    word_t *r, fd, i, fout = b_fout;
+
+    while (depth > 0) {
+        pop(now);
+    }
+    if (ns > start_ns && start_ns != 0) {
+        // Ticks per second, halving both spans while the product overflows
+        unsigned long t = now - start_ticks, n = ns - start_ns;
+
+        while (t > 9223372036UL) {
+            t >>= 1;
+            n >>= 1;
+        }
+        if (n > 0) {
+            rate = t * 1000000000 / n;
+        }
+    }
+#ifdef SYS_open
+    fd = syscall(SYS_open, (word_t) "bmon.out", O_WRONLY | O_CREAT | O_TRUNC, 0644);
+#else
+    fd = syscall6(SYS_openat, AT_FDCWD, (word_t) "bmon.out", O_WRONLY | O_CREAT | O_TRUNC, 0644, 0, 0);
+#endif
+    if (fd < 0) {
+        b_fout = 1;
+        b_printf((word_t) "cannot write profile to bmon.out\n");
+        b_fout = fout;
+        return 0;
+    }
+    b_fout = fd - 1;
+    b_printf((word_t) "rate %d\n", rate);
+    for (r = registered; r != (word_t *)1; r = (word_t *)r[0]) {
+        b_printf((word_t) "f %s %d %d %d\n", r[1], r[2], r[3], r[4]);
+    }
+    for (i = 0; i < NARCS; i++) {
+        if (arcs[i].callee) {
+            b_printf((word_t) "a %s %s %d %d\n", arcs[i].caller[1], arcs[i].callee[1],
+                     arcs[i].count, arcs[i].ticks);
+        }
+    }
+    b_fout = fout;
+    syscall(SYS_close, fd, 0, 0);
+    return 0;
+}
+
+//
+// Called on entry to every function compiled with -p, with its record.
+//
+word_t b_prof_enter(word_t rec, ...)
+{
+    word_t *r = (word_t *)rec;
+    struct frame *f;
+
+    if (r[0] == 0) {
+        if (registered == (word_t *)1) {
+            b_atexit((word_t)b_prof_write);
+            start_ns    = nanoseconds();
+            start_ticks = ticks();
+        }
+        r[0]       = (word_t)registered;
+        registered = r;
+    }
+    r[2]++;
+    if (depth < NFRAMES) {
+        f        = &stack[depth];
+        f->rec   = r;
+        f->arc   = depth > 0 ? find_arc(stack[depth - 1].rec, r) : 0;
+        f->child = 0;
+        if (f->arc) {
+            f->arc->count++;
+            f->arc->active++;
+        }
+        r[5]++;
+        f->start = ticks();
+    }
+    depth++;
+    return 0;
+}
+
+//
+// Called by every function compiled with -p before it returns.
+//
+word_t b_prof_leave(word_t rec, ...)
+{
+    word_t now = ticks();
+
+    if (depth > 0) {
+        pop(now);
+    }
+    return 0;
+}
+#endif
@@ -0,0 +1,11 @@
+#include "runtime.h"
+
+//
+// The string s is written on the standard output file.
+// The address of s is returned.
+//
+word_t b_putstr(word_t s, ...)
+{
+    b_nwrite(b_fout + 1, s, b_length(s));
+    return s;
+}
@@ -14,3 +14,35 @@ static inline long syscall(long n, long arg1, long arg2, long arg3)
                   : "memory");
     return a0;
 }
+
+//
+// Syscall wrapper with six arguments, as needed for mmap()
+//
+static inline long syscall6(long n, long arg1, long arg2, long arg3, long arg4, long arg5, long arg6)
+{
+    register long a0 asm("a0") = arg1;
+    register long a1 asm("a1") = arg2;
+    register long a2 asm("a2") = arg3;
+    register long a3 asm("a3") = arg4;
+    register long a4 asm("a4") = arg5;
+    register long a5 asm("a5") = arg6;
+    register long a7 asm("a7") = n;
+
+    asm volatile ("ecall"
+                  : "+r"(a0)
+                  : "r"(a1), "r"(a2), "r"(a3), "r"(a4), "r"(a5), "r"(a7)
+                  : "memory");
+    return a0;
+}
+
+//
+// Real-time counter, read by profiled programs; the cycle counter
+// is not accessible to user programs on recent Linux kernels
+//
+static inline long ticks(void)
+{
+    long t;
+
+    asm volatile("rdtime %0" : "=r"(t));
+    return t;
+}
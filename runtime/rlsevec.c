@@ -0,0 +1,28 @@
+#include "runtime.h"
+
+#ifdef HOSTED
+void free(void *ptr);
+#endif
+
+//
+// The vector v of n+1 words, previously obtained from getvec(),
+// is released for reuse.  The size is taken from the block header;
+// argument n is accepted for compatibility with the Honeywell library.
+// A hosted program gives the vector back to the C library.
+//
+word_t b_rlsevec(word_t v, /*word_t n,*/ ...)
+{
+#ifdef HOSTED
+    free((void *)v);
+#else
+    word_t *p;
+
+    if (v == 0) {
+        return 0;
+    }
+    p          = (word_t *)v - 1;
+    p[1]       = (word_t)b_freelist;
+    b_freelist = p;
+#endif
+    return 0;
+}
@@ -3,7 +3,9 @@
 //
 #include <stdarg.h>
 #include <stdint.h>
+#ifndef __wasm__
 #include <sys/syscall.h>
+#endif
 
 //
 // Set external name of the symbol
@@ -14,43 +16,117 @@
 #ifdef __APPLE__
 #define ALIAS(name) __asm__("_b."name)
 #endif
+#ifdef __wasm__
+#define ALIAS(name) __asm__("b."name)
+#endif
 
 //
 // Type representing B's word-sized value.
+// On WebAssembly a word has 64 bits, while pointers have 32.
 //
+#ifdef __wasm__
+typedef int64_t word_t;
+typedef uint64_t uword_t;
+#else
 typedef intptr_t word_t;
+typedef uintptr_t uword_t;
+#endif
 
 // Select output stream: 0-stdout, 1-stderr.
 extern word_t b_fout
     ALIAS("fout");
 
+// List of vectors released by rlsevec().
+extern word_t *b_freelist;
+
+// Command line arguments: argv[0] is the count, followed by the strings.
+extern word_t b_argv
+    ALIAS("argv");
+
+// Environment strings, terminated by a null pointer.
+extern word_t *b_environ;
+
+// Number of arguments of a call to a B function through its thunk.
+extern word_t b_nargs
+    ALIAS(".nargs");
+
 //
-// Function declarations.
+// Function declarations. Every routine takes a word followed by optional
+// arguments and returns a word, which matches the calls generated by the
+// compiler; WebAssembly traps on calls with any other signature.
 //
-void b_exit(void)
+word_t b_exit(word_t status, ...)
     ALIAS("exit");
+word_t b_atexit(word_t f, ...)
+    ALIAS("atexit");
 word_t b_char(word_t string, /*word_t i,*/ ...)
     ALIAS("char");
-void b_lchar(word_t string, /*word_t i, word_t chr,*/ ...)
+word_t b_lchar(word_t string, /*word_t i, word_t chr,*/ ...)
     ALIAS("lchar");
-word_t b_read(void)
+word_t b_read(word_t unused, ...)
     ALIAS("read");
 word_t b_nread(word_t file, /*word_t buffer, word_t count,*/ ...)
     ALIAS("nread");
-void b_writeb(word_t c, ...)
+word_t b_writeb(word_t c, ...)
     ALIAS("writeb");
-void b_write(word_t ch, ...)
+word_t b_write(word_t ch, ...)
     ALIAS("write");
 word_t b_nwrite(word_t file, /*word_t buffer, word_t count,*/ ...)
     ALIAS("nwrite");
-void b_printd(word_t n, ...)
+word_t b_printd(word_t n, ...)
     ALIAS("printd");
-void b_printo(word_t n, ...)
+word_t b_printo(word_t n, ...)
     ALIAS("printo");
-void b_printf(word_t fmt, ...)
+word_t b_printf(word_t fmt, ...)
     ALIAS("printf");
-void b_flush(void)
+word_t b_flush(word_t unused, ...)
     ALIAS("flush");
+word_t b_sbrk(word_t incr, ...)
+    ALIAS("sbrk");
+word_t b_getvec(word_t n, ...)
+    ALIAS("getvec");
+word_t b_rlsevec(word_t v, /*word_t n,*/ ...)
+    ALIAS("rlsevec");
+word_t b_length(word_t string, ...)
+    ALIAS("length");
+word_t b_concat(word_t a, /*word_t s1, word_t s2,*/ ...)
+    ALIAS("concat");
+word_t b_compare(word_t s1, /*word_t s2,*/ ...)
+    ALIAS("compare");
+word_t b_getstr(word_t s, ...)
+    ALIAS("getstr");
+word_t b_putstr(word_t s, ...)
+    ALIAS("putstr");
+word_t b_atoi(word_t s, ...)
+    ALIAS("atoi");
+word_t b_itoa(word_t n, /*word_t s, word_t base,*/ ...)
+    ALIAS("itoa");
+word_t b_getarg(word_t s, /*word_t line, word_t i,*/ ...)
+    ALIAS("getarg");
+word_t b_getenv(word_t name, ...)
+    ALIAS("getenv");
+
+// Failed check of -fbounds-check; the dot keeps it apart from B names.
+word_t b_bounds(word_t where, /*word_t func, word_t name, word_t index, word_t size,*/ ...)
+    ALIAS(".bounds");
+
+// Failed check of -ftrapv or -fstack-check.
+word_t b_trap(word_t where, /*word_t func, word_t msg,*/ ...)
+    ALIAS(".trap");
+
+// Registration of the counters of --coverage.
+word_t b_cov(word_t desc, ...)
+    ALIAS(".cov");
+
+// Lowest address of the stack for -fstack-check.
+extern word_t b_stack_limit
+    ALIAS(".stack.limit");
+
+// Entry and exit hooks of profiled functions.
+word_t b_prof_enter(word_t rec, ...)
+    ALIAS(".prof.enter");
+word_t b_prof_leave(word_t rec, ...)
+    ALIAS(".prof.leave");
 
 //
 // Inline functions.
@@ -64,3 +140,6 @@ void b_flush(void)
 #ifdef __riscv
 #include "riscv64.h"
 #endif
+#ifdef __wasm__
+#include "wasm32.h"
+#endif
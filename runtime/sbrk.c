@@ -0,0 +1,85 @@
+#include "runtime.h"
+
+#ifdef HOSTED
+void *malloc(__SIZE_TYPE__ size);
+#endif
+
+#ifdef __APPLE__
+//
+// Memory protection and mapping flags for mmap().
+//
+#define PROT_READ   0x01
+#define PROT_WRITE  0x02
+#define MAP_PRIVATE 0x0002
+#define MAP_ANON    0x1000
+#endif
+
+//
+// The data segment of the process is extended by incr bytes,
+// rounded up to a whole number of words.  The address of the
+// new memory is returned, or -1 when no more memory is available.
+// On macOS there is no brk() system call, so each request is
+// satisfied by a separate anonymous mapping instead.  On WebAssembly
+// the break starts at the end of the initial linear memory, which
+// grows by whole pages.  A hosted program, whose break belongs to the
+// C library, takes the memory from malloc().
+//
+word_t b_sbrk(word_t incr, ...)
+{
+    incr = (incr + sizeof(word_t) - 1) & ~(word_t)(sizeof(word_t) - 1);
+    if (incr < 0) {
+        return -1;
+    }
+
+#ifdef HOSTED
+    word_t addr = (word_t)malloc(incr ? incr : sizeof(word_t));
+    return addr ? addr : -1;
+#endif
+
+#if defined(linux) && !defined(HOSTED)
+    static word_t curbrk;
+
+    if (curbrk == 0) {
+        curbrk = syscall(SYS_brk, 0, 0, 0);
+    }
+    word_t old = curbrk;
+    if (incr == 0) {
+        return old;
+    }
+    word_t new = syscall(SYS_brk, old + incr, 0, 0);
+    if (new < old + incr) {
+        return -1;
+    }
+    curbrk = new;
+    return old;
+#endif
+
+#if defined(__APPLE__) && !defined(HOSTED)
+    if (incr == 0) {
+        incr = sizeof(word_t);
+    }
+    word_t addr = syscall6(SYS_mmap, 0, incr, PROT_READ | PROT_WRITE, MAP_PRIVATE | MAP_ANON, -1, 0);
+    if (addr < 0 && addr > -4096) {
+        return -1;
+    }
+    return addr;
+#endif
+
+#ifdef __wasm__
+    static word_t curbrk;
+    word_t end = (word_t)__builtin_wasm_memory_size(0) * WASM_PAGE;
+
+    if (curbrk == 0) {
+        curbrk = end;
+    }
+    word_t old = curbrk;
+    if (old + incr > end) {
+        word_t pages = (old + incr - end + WASM_PAGE - 1) / WASM_PAGE;
+        if (__builtin_wasm_memory_grow(0, pages) == (__SIZE_TYPE__)-1) {
+            return -1;
+        }
+    }
+    curbrk = old + incr;
+    return old;
+#endif
+}
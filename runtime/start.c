@@ -1,16 +1,198 @@
 #include "runtime.h"
 
+//
+// Command line arguments in B form: argv[0] holds the number
+// of arguments, argv[1] through argv[argv[0]] point to the
+// argument strings, starting with the program name.
+//
+word_t b_argv ALIAS("argv");
+
+//
+// Environment strings, terminated by a null pointer.
+//
+word_t *b_environ;
+
+//
+// Number of arguments of a call to a function whose parameters the
+// caller does not know, set before the call: the thunk of a function
+// compiled from B passes zero words for those missing.
+//
+word_t b_nargs ALIAS(".nargs");
+
+#ifndef __wasm__
 #ifdef linux
+#include <sys/resource.h>
+#endif
+
+#define STACK_MARGIN (64 * 1024) // room for the report of an overflow
+
+//
+// Lowest address of the stack for functions compiled with -fstack-check,
+// or 0 when the size of the stack is unlimited.
+//
+word_t b_stack_limit ALIAS(".stack.limit");
+
 //
-// Entry point of any B program.
+// Set the limit of the stack from its top, in the frame of the entry
+// point, and the maximum size of the stack: 8 MiB, as by default on
+// Linux and macOS, unless the resource limit of Linux says otherwise.
 //
-void b_start(void) __asm__("_start"); // assure, that _start is really named _start in asm
+static void set_stack_limit(word_t top)
+{
+    uword_t size = 8 * 1024 * 1024;
+#if defined(linux) && defined(SYS_prlimit64)
+    uword_t rlim[2];
+
+    if (syscall6(SYS_prlimit64, 0, RLIMIT_STACK, 0, (word_t)rlim, 0, 0) == 0) {
+        size = rlim[0];
+    }
+#endif
+    if (size < (uword_t)top - STACK_MARGIN) {
+        b_stack_limit = top - size + STACK_MARGIN;
+    }
+}
+#endif
+
+#ifdef HOSTED
+//
+// Entry point of a program built with -fsanitize, which is linked
+// with the C library, so that the sanitizer runtimes are started
+// first. The main() of B is b.main; the arguments are copied into
+// a B vector.
+//
+word_t b_main(word_t argv, ...)
+    ALIAS("main");
 
-void b_start()
+int main(int argc, char **argv, char **envp)
 {
-    word_t main(void);
+    word_t *vec = (word_t *)b_getvec(argc);
+    word_t i;
+
+    set_stack_limit((word_t)&vec);
+    vec[0] = argc;
+    for (i = 0; i < argc; i++) {
+        vec[i + 1] = (word_t)argv[i];
+    }
+    b_argv    = (word_t)vec;
+    b_environ = (word_t *)envp;
+
+    b_nargs = 1;
+    b_exit(b_main(b_argv));
+    return 0;
+}
+#else
+word_t main(word_t argv, ...);
+#endif
+
+#if defined(linux) && !defined(HOSTED)
+//
+// Entry point of any B program. The initial stack pointer, which
+// addresses argc followed by the argument and environment pointers,
+// is passed to b_start().
+//
+#ifdef __x86_64__
+asm(".text\n"
+    ".globl _start\n"
+    "_start:\n"
+    "   xor %ebp, %ebp\n"
+    "   mov %rsp, %rdi\n"
+    "   and $-16, %rsp\n"
+    "   call b_start\n"
+    "   hlt\n");
+#endif
+#ifdef __aarch64__
+asm(".text\n"
+    ".globl _start\n"
+    "_start:\n"
+    "   mov x29, #0\n"
+    "   mov x30, #0\n"
+    "   mov x0, sp\n"
+    "   bl b_start\n");
+#endif
+#ifdef __riscv
+asm(".text\n"
+    ".globl _start\n"
+    "_start:\n"
+    "   mv a0, sp\n"
+    "   call b_start\n");
+#endif
+
+void b_start(word_t *sp)
+{
+    // The stack already holds a B vector: the count
+    // followed by pointers to the argument strings.
+    b_argv    = (word_t)sp;
+    b_environ = sp + sp[0] + 2;
+    set_stack_limit((word_t)sp);
+
+    b_nargs = 1;
+    b_exit(main(b_argv));
+}
+#endif
+
+#if defined(__APPLE__) && !defined(HOSTED)
+//
+// Entry point of any B program, selected with the '-e _b_start'
+// linker option. It is called by dyld with the same arguments
+// as the C main().
+//
+void b_start(word_t argc, char **argv, char **envp) __asm__("_b_start");
+
+void b_start(word_t argc, char **argv, char **envp)
+{
+    word_t *vec = (word_t *)b_getvec(argc);
+    word_t i;
+
+    set_stack_limit((word_t)&vec);
+    vec[0] = argc;
+    for (i = 0; i < argc; i++) {
+        vec[i + 1] = (word_t)argv[i];
+    }
+    b_argv    = (word_t)vec;
+    b_environ = (word_t *)envp;
+
+    b_nargs = 1;
+    b_exit(main(b_argv));
+}
+#endif
+
+#ifdef __wasm__
+//
+// The strings given by a pair of WASI calls are copied to memory
+// obtained with sbrk().  Returned is a vector of words pointing to
+// them, after the given number of free words and before a zero word.
+//
+static word_t *b_strings(word_t first, uint32_t count, uint32_t size,
+                         int32_t (*get)(char **, char *))
+{
+    char **ptrs = (char **)(intptr_t)b_sbrk((count + 1) * sizeof(char *) + size);
+    word_t *vec = (word_t *)(intptr_t)b_getvec(first + count);
+    uint32_t i;
+
+    get(ptrs, (char *)(ptrs + count + 1));
+    for (i = 0; i < count; i++) {
+        vec[first + i] = (word_t)(intptr_t)ptrs[i];
+    }
+    return vec;
+}
+
+//
+// Entry point of any B program, called by the WASI host.
+//
+void _start(void)
+{
+    uint32_t count, size;
+    word_t *vec;
+
+    wasi_args_sizes_get(&count, &size);
+    vec    = b_strings(1, count, size, wasi_args_get);
+    vec[0] = count;
+    b_argv = (word_t)(intptr_t)vec;
+
+    wasi_environ_sizes_get(&count, &size);
+    b_environ = b_strings(0, count, size, wasi_environ_get);
 
-    word_t code = main();
-    syscall(SYS_exit, code, 0, 0);
+    b_nargs = 1;
+    b_exit(main(b_argv));
 }
 #endif
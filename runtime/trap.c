@@ -0,0 +1,24 @@
+#include "runtime.h"
+
+//
+// Called by code compiled with -ftrapv when a division or a remainder
+// has no result: the divisor is zero, or the most negative word is
+// divided by -1; and by code compiled with -fstack-check when a
+// function is called with the stack full. The position in the source,
+// the function and the kind of fault are reported on the standard
+// error, then the program stops on a trap.
+//
+word_t b_trap(word_t where, /*word_t func, word_t msg,*/ ...)
+{
+    va_list ap;
+    word_t func, msg;
+
+    va_start(ap, where);
+    func = va_arg(ap, word_t);
+    msg  = va_arg(ap, word_t);
+    va_end(ap);
+
+    b_fout = 1;
+    b_printf((word_t) "%s: in %s(): %s\n", where, func, msg);
+    __builtin_trap();
+}
@@ -0,0 +1,63 @@
+//
+// Syscall wrapper implementation for WebAssembly (WASI)
+//
+// There are no system calls: the runtime imports WASI functions
+// from the host, and syscall() maps the few calls it needs on them.
+//
+#define SYS_read  0
+#define SYS_write 1
+#define SYS_exit  60
+
+#define WASI(name) __attribute__((import_module("wasi_snapshot_preview1"), import_name(name)))
+
+//
+// Buffer of a scatter/gather operation.
+//
+struct wasi_iovec {
+    void *buf;
+    uint32_t len;
+};
+
+int32_t wasi_fd_read(int32_t fd, struct wasi_iovec *iovs, int32_t niovs, uint32_t *nread)
+    WASI("fd_read");
+int32_t wasi_fd_write(int32_t fd, struct wasi_iovec *iovs, int32_t niovs, uint32_t *nwritten)
+    WASI("fd_write");
+void wasi_proc_exit(int32_t status)
+    WASI("proc_exit") __attribute__((noreturn));
+int32_t wasi_args_sizes_get(uint32_t *count, uint32_t *size)
+    WASI("args_sizes_get");
+int32_t wasi_args_get(char **argv, char *buf)
+    WASI("args_get");
+int32_t wasi_environ_sizes_get(uint32_t *count, uint32_t *size)
+    WASI("environ_sizes_get");
+int32_t wasi_environ_get(char **environ, char *buf)
+    WASI("environ_get");
+
+//
+// Like the kernel, return the result or a negated error number.
+//
+static inline long syscall(long n, long a1, long a2, long a3)
+{
+    struct wasi_iovec iov = { (void *)a2, (uint32_t)a3 };
+    uint32_t count;
+    int32_t err;
+
+    switch (n) {
+    case SYS_read:
+        err = wasi_fd_read(a1, &iov, 1, &count);
+        break;
+    case SYS_write:
+        err = wasi_fd_write(a1, &iov, 1, &count);
+        break;
+    case SYS_exit:
+        wasi_proc_exit(a1);
+    default:
+        return -1;
+    }
+    return err ? -err : (long)count;
+}
+
+//
+// Size of a page of linear memory, by which it grows.
+//
+#define WASM_PAGE 65536
@@ -3,11 +3,11 @@
 //
 // One or more characters are written on the standard output file.
 //
-void b_write(word_t ch, ...)
+word_t b_write(word_t ch, ...)
 {
     char buf[sizeof(word_t)];
     char *p = buf;
-    uintptr_t input = ch;
+    uword_t input = ch;
     unsigned len;
 
     for (len = 0; len < sizeof(word_t); len++, input <<= 8) {
@@ -18,4 +18,5 @@ void b_write(word_t ch, ...)
         }
     }
     syscall(SYS_write, b_fout + 1, (word_t)buf, p - buf);
+    return 0;
 }
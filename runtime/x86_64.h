@@ -16,3 +16,35 @@ static inline long syscall(long n, long a1, long a2, long a3)
     );
     return ret;
 }
+
+//
+// Syscall wrapper with six arguments, as needed for mmap()
+//
+static inline long syscall6(long n, long a1, long a2, long a3, long a4, long a5, long a6)
+{
+    long ret;
+    register long r10 asm("r10") = a4;
+    register long r8 asm("r8")   = a5;
+    register long r9 asm("r9")   = a6;
+
+#ifdef __APPLE__
+    n |= 0x2000000;
+#endif
+
+    asm volatile("syscall"
+                 : "=a"(ret)
+                 : "a"(n), "D"(a1), "S"(a2), "d"(a3), "r"(r10), "r"(r8), "r"(r9)
+                 : "rcx", "r11", "memory");
+    return ret;
+}
+
+//
+// Time stamp counter, read by profiled programs
+//
+static inline long ticks(void)
+{
+    unsigned lo, hi;
+
+    asm volatile("rdtsc" : "=a"(lo), "=d"(hi));
+    return ((long)hi << 32) | lo;
+}